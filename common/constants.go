@@ -116,6 +116,9 @@ var RetryTimes = 0
 
 var IsMasterNode bool
 
+// NodeId 标识当前实例，用于跨节点事件去重与选主，可通过 NODE_NAME 指定
+var NodeId string
+
 var requestInterval int
 var RequestInterval time.Duration
 
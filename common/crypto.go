@@ -1,9 +1,15 @@
 package common
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
+	"errors"
+	"strings"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -30,3 +36,52 @@ func ValidatePasswordAndHash(password string, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
+
+// EncryptedValuePrefix marks values produced by EncryptWithSecret
+const EncryptedValuePrefix = "enc:v1:"
+
+func secretCipher() (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte(CryptoSecret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptWithSecret encrypts plaintext with AES-GCM using a key derived from CryptoSecret
+func EncryptWithSecret(plaintext string) (string, error) {
+	gcm, err := secretCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return EncryptedValuePrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptWithSecret reverses EncryptWithSecret; CryptoSecret must match the exporting instance
+func DecryptWithSecret(value string) (string, error) {
+	if !strings.HasPrefix(value, EncryptedValuePrefix) {
+		return "", errors.New("value is not encrypted")
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, EncryptedValuePrefix))
+	if err != nil {
+		return "", err
+	}
+	gcm, err := secretCipher()
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("encrypted value is too short")
+	}
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("failed to decrypt value, check CRYPTO_SECRET")
+	}
+	return string(plaintext), nil
+}
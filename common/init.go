@@ -82,6 +82,14 @@ func InitEnv() {
 	DebugEnabled = os.Getenv("DEBUG") == "true"
 	MemoryCacheEnabled = os.Getenv("MEMORY_CACHE_ENABLED") == "true"
 	IsMasterNode = os.Getenv("NODE_TYPE") != "slave"
+	NodeId = os.Getenv("NODE_NAME")
+	if NodeId == "" {
+		hostname, _ := os.Hostname()
+		if hostname == "" {
+			hostname = "new-api"
+		}
+		NodeId = hostname + "-" + GetRandomString(6)
+	}
 	TLSInsecureSkipVerify = GetEnvOrDefaultBool("TLS_INSECURE_SKIP_VERIFY", false)
 	if TLSInsecureSkipVerify {
 		if tr, ok := http.DefaultTransport.(*http.Transport); ok && tr != nil {
@@ -8,7 +8,9 @@ const (
 	ContextKeyEstimatedTokens ContextKey = "estimated_tokens"
 
 	ContextKeyOriginalModel    ContextKey = "original_model"
+	ContextKeyRequestedModel   ContextKey = "requested_model" // 跨模型降级前客户端请求的模型
 	ContextKeyRequestStartTime ContextKey = "request_start_time"
+	ContextKeyRelayFormat      ContextKey = "relay_format"
 
 	/* token related keys */
 	ContextKeyTokenUnlimited         ContextKey = "token_unlimited_quota"
@@ -19,6 +21,7 @@ const (
 	ContextKeyTokenModelLimitEnabled ContextKey = "token_model_limit_enabled"
 	ContextKeyTokenModelLimit        ContextKey = "token_model_limit"
 	ContextKeyTokenCrossGroupRetry   ContextKey = "token_cross_group_retry"
+	ContextKeyTokenCallbackUrl       ContextKey = "token_callback_url"
 
 	/* channel related keys */
 	ContextKeyChannelId                ContextKey = "channel_id"
@@ -65,4 +68,15 @@ const (
 
 	// ContextKeyLanguage stores the user's language preference for i18n
 	ContextKeyLanguage ContextKey = "language"
+
+	// ContextKeyHedgeLeg marks a copied context running one leg of a hedged request;
+	// upstream requests are bound to its request context so the losing leg can be cancelled.
+	ContextKeyHedgeLeg ContextKey = "hedge_leg"
+
+	// ContextKeyHedgeLost is set on the losing leg once the race is decided; its usage is never billed.
+	ContextKeyHedgeLost ContextKey = "hedge_lost"
+
+	// ContextKeyAdmissionStart records when the request first entered the admission queue,
+	// so the max wait also covers re-queueing after upstream rate limits.
+	ContextKeyAdmissionStart ContextKey = "admission_start"
 )
@@ -1,5 +1,7 @@
 package constant
 
+import "strings"
+
 const (
 	MjErrorUnknown = 5
 	MjRequestError = 4
@@ -26,6 +28,14 @@ const (
 	MjActionEdits         = "EDITS"
 )
 
+// MidjourneyActionModelName 返回 MJ 操作对应的计费模型名
+func MidjourneyActionModelName(action string) string {
+	if action == MjActionSwapFace {
+		return "swap_face"
+	}
+	return "mj_" + strings.ToLower(action)
+}
+
 var MidjourneyModel2Action = map[string]string{
 	"mj_imagine":        MjActionImagine,
 	"mj_describe":       MjActionDescribe,
@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+const auditLogExportLimit = 50000
+
+func parseAuditLogQuery(c *gin.Context) model.AuditLogQuery {
+	actorId, _ := strconv.Atoi(c.Query("actor_id"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	return model.AuditLogQuery{
+		ActorId:        actorId,
+		Action:         c.Query("action"),
+		TargetType:     c.Query("target_type"),
+		TargetId:       c.Query("target_id"),
+		RequestId:      c.Query("request_id"),
+		StartTimestamp: startTimestamp,
+		EndTimestamp:   endTimestamp,
+	}
+}
+
+func GetAuditLogs(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	logs, total, err := model.GetAuditLogs(parseAuditLogQuery(c), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(logs)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// ExportAuditLogs 导出审计日志，?format=csv|json，默认 json
+func ExportAuditLogs(c *gin.Context) {
+	logs, err := model.GetAuditLogsForExport(parseAuditLogQuery(c), auditLogExportLimit)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	filename := fmt.Sprintf("audit_logs_%s", time.Now().Format("20060102150405"))
+	if c.Query("format") != "csv" {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.json", filename))
+		c.JSON(http.StatusOK, logs)
+		return
+	}
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.csv", filename))
+	c.Status(http.StatusOK)
+	writer := csv.NewWriter(c.Writer)
+	_ = writer.Write([]string{"id", "created_at", "actor_id", "actor_name", "actor_role", "ip", "action", "target_type", "target_id", "diff", "request_id", "prev_hash", "hash"})
+	for _, l := range logs {
+		_ = writer.Write([]string{
+			strconv.Itoa(l.Id),
+			strconv.FormatInt(l.CreatedAt, 10),
+			strconv.Itoa(l.ActorId),
+			l.ActorName,
+			strconv.Itoa(l.ActorRole),
+			l.Ip,
+			l.Action,
+			l.TargetType,
+			l.TargetId,
+			l.Diff,
+			l.RequestId,
+			l.PrevHash,
+			l.Hash,
+		})
+	}
+	writer.Flush()
+}
+
+// VerifyAuditLogs 校验审计日志哈希链的完整性
+func VerifyAuditLogs(c *gin.Context) {
+	result, err := model.VerifyAuditLogChain()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, result)
+}
@@ -166,7 +166,7 @@ func GetResponseBody(method, url string, channel *model.Channel, headers http.He
 	return body, nil
 }
 
-func updateChannelCloseAIBalance(channel *model.Channel) (float64, error) {
+func fetchChannelCloseAIBalance(channel *model.Channel) (float64, error) {
 	url := fmt.Sprintf("%s/dashboard/billing/credit_grants", channel.GetBaseURL())
 	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(channel.Key))
 
@@ -178,11 +178,10 @@ func updateChannelCloseAIBalance(channel *model.Channel) (float64, error) {
 	if err != nil {
 		return 0, err
 	}
-	channel.UpdateBalance(response.TotalAvailable)
 	return response.TotalAvailable, nil
 }
 
-func updateChannelOpenAISBBalance(channel *model.Channel) (float64, error) {
+func fetchChannelOpenAISBBalance(channel *model.Channel) (float64, error) {
 	url := fmt.Sprintf("https://api.openai-sb.com/sb-api/user/status?api_key=%s", channel.Key)
 	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(channel.Key))
 	if err != nil {
@@ -200,11 +199,10 @@ func updateChannelOpenAISBBalance(channel *model.Channel) (float64, error) {
 	if err != nil {
 		return 0, err
 	}
-	channel.UpdateBalance(balance)
 	return balance, nil
 }
 
-func updateChannelAIProxyBalance(channel *model.Channel) (float64, error) {
+func fetchChannelAIProxyBalance(channel *model.Channel) (float64, error) {
 	url := "https://aiproxy.io/api/report/getUserOverview"
 	headers := http.Header{}
 	headers.Add("Api-Key", channel.Key)
@@ -220,11 +218,10 @@ func updateChannelAIProxyBalance(channel *model.Channel) (float64, error) {
 	if !response.Success {
 		return 0, fmt.Errorf("code: %d, message: %s", response.ErrorCode, response.Message)
 	}
-	channel.UpdateBalance(response.Data.TotalPoints)
 	return response.Data.TotalPoints, nil
 }
 
-func updateChannelAPI2GPTBalance(channel *model.Channel) (float64, error) {
+func fetchChannelAPI2GPTBalance(channel *model.Channel) (float64, error) {
 	url := "https://api.api2gpt.com/dashboard/billing/credit_grants"
 	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(channel.Key))
 
@@ -236,11 +233,10 @@ func updateChannelAPI2GPTBalance(channel *model.Channel) (float64, error) {
 	if err != nil {
 		return 0, err
 	}
-	channel.UpdateBalance(response.TotalRemaining)
 	return response.TotalRemaining, nil
 }
 
-func updateChannelSiliconFlowBalance(channel *model.Channel) (float64, error) {
+func fetchChannelSiliconFlowBalance(channel *model.Channel) (float64, error) {
 	url := "https://api.siliconflow.cn/v1/user/info"
 	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(channel.Key))
 	if err != nil {
@@ -258,11 +254,10 @@ func updateChannelSiliconFlowBalance(channel *model.Channel) (float64, error) {
 	if err != nil {
 		return 0, err
 	}
-	channel.UpdateBalance(balance)
 	return balance, nil
 }
 
-func updateChannelDeepSeekBalance(channel *model.Channel) (float64, error) {
+func fetchChannelDeepSeekBalance(channel *model.Channel) (float64, error) {
 	url := "https://api.deepseek.com/user/balance"
 	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(channel.Key))
 	if err != nil {
@@ -287,11 +282,10 @@ func updateChannelDeepSeekBalance(channel *model.Channel) (float64, error) {
 	if err != nil {
 		return 0, err
 	}
-	channel.UpdateBalance(balance)
 	return balance, nil
 }
 
-func updateChannelAIGC2DBalance(channel *model.Channel) (float64, error) {
+func fetchChannelAIGC2DBalance(channel *model.Channel) (float64, error) {
 	url := "https://api.aigc2d.com/dashboard/billing/credit_grants"
 	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(channel.Key))
 	if err != nil {
@@ -302,11 +296,10 @@ func updateChannelAIGC2DBalance(channel *model.Channel) (float64, error) {
 	if err != nil {
 		return 0, err
 	}
-	channel.UpdateBalance(response.TotalAvailable)
 	return response.TotalAvailable, nil
 }
 
-func updateChannelOpenRouterBalance(channel *model.Channel) (float64, error) {
+func fetchChannelOpenRouterBalance(channel *model.Channel) (float64, error) {
 	url := "https://openrouter.ai/api/v1/credits"
 	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(channel.Key))
 	if err != nil {
@@ -318,11 +311,10 @@ func updateChannelOpenRouterBalance(channel *model.Channel) (float64, error) {
 		return 0, err
 	}
 	balance := response.Data.TotalCredits - response.Data.TotalUsage
-	channel.UpdateBalance(balance)
 	return balance, nil
 }
 
-func updateChannelMoonshotBalance(channel *model.Channel) (float64, error) {
+func fetchChannelMoonshotBalance(channel *model.Channel) (float64, error) {
 	url := "https://api.moonshot.cn/v1/users/me/balance"
 	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(channel.Key))
 	if err != nil {
@@ -352,43 +344,11 @@ func updateChannelMoonshotBalance(channel *model.Channel) (float64, error) {
 	}
 	availableBalanceCny := response.Data.AvailableBalance
 	availableBalanceUsd := decimal.NewFromFloat(availableBalanceCny).Div(decimal.NewFromFloat(operation_setting.Price)).InexactFloat64()
-	channel.UpdateBalance(availableBalanceUsd)
 	return availableBalanceUsd, nil
 }
 
-func updateChannelBalance(channel *model.Channel) (float64, error) {
-	baseURL := constant.ChannelBaseURLs[channel.Type]
-	if channel.GetBaseURL() == "" {
-		channel.BaseURL = &baseURL
-	}
-	switch channel.Type {
-	case constant.ChannelTypeOpenAI:
-		if channel.GetBaseURL() != "" {
-			baseURL = channel.GetBaseURL()
-		}
-	case constant.ChannelTypeAzure:
-		return 0, errors.New("尚未实现")
-	case constant.ChannelTypeCustom:
-		baseURL = channel.GetBaseURL()
-	//case common.ChannelTypeOpenAISB:
-	//	return updateChannelOpenAISBBalance(channel)
-	case constant.ChannelTypeAIProxy:
-		return updateChannelAIProxyBalance(channel)
-	case constant.ChannelTypeAPI2GPT:
-		return updateChannelAPI2GPTBalance(channel)
-	case constant.ChannelTypeAIGC2D:
-		return updateChannelAIGC2DBalance(channel)
-	case constant.ChannelTypeSiliconFlow:
-		return updateChannelSiliconFlowBalance(channel)
-	case constant.ChannelTypeDeepSeek:
-		return updateChannelDeepSeekBalance(channel)
-	case constant.ChannelTypeOpenRouter:
-		return updateChannelOpenRouterBalance(channel)
-	case constant.ChannelTypeMoonshot:
-		return updateChannelMoonshotBalance(channel)
-	default:
-		return 0, errors.New("尚未实现")
-	}
+func fetchChannelOpenAIBalance(channel *model.Channel) (float64, error) {
+	baseURL := channel.GetBaseURL()
 	url := fmt.Sprintf("%s/v1/dashboard/billing/subscription", baseURL)
 
 	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(channel.Key))
@@ -416,9 +376,39 @@ func updateChannelBalance(channel *model.Channel) (float64, error) {
 	if err != nil {
 		return 0, err
 	}
-	balance := subscription.HardLimitUSD - usage.TotalUsage/100
+	return subscription.HardLimitUSD - usage.TotalUsage/100, nil
+}
+
+func init() {
+	service.RegisterBalanceFetcher(constant.ChannelTypeOpenAI, service.BalanceFetcherFunc(fetchChannelOpenAIBalance))
+	service.RegisterBalanceFetcher(constant.ChannelTypeCustom, service.BalanceFetcherFunc(fetchChannelOpenAIBalance))
+	//service.RegisterBalanceFetcher(constant.ChannelTypeOpenAISB, service.BalanceFetcherFunc(fetchChannelOpenAISBBalance))
+	service.RegisterBalanceFetcher(constant.ChannelTypeAIProxy, service.BalanceFetcherFunc(fetchChannelAIProxyBalance))
+	service.RegisterBalanceFetcher(constant.ChannelTypeAPI2GPT, service.BalanceFetcherFunc(fetchChannelAPI2GPTBalance))
+	service.RegisterBalanceFetcher(constant.ChannelTypeAIGC2D, service.BalanceFetcherFunc(fetchChannelAIGC2DBalance))
+	service.RegisterBalanceFetcher(constant.ChannelTypeSiliconFlow, service.BalanceFetcherFunc(fetchChannelSiliconFlowBalance))
+	service.RegisterBalanceFetcher(constant.ChannelTypeDeepSeek, service.BalanceFetcherFunc(fetchChannelDeepSeekBalance))
+	service.RegisterBalanceFetcher(constant.ChannelTypeOpenRouter, service.BalanceFetcherFunc(fetchChannelOpenRouterBalance))
+	service.RegisterBalanceFetcher(constant.ChannelTypeMoonshot, service.BalanceFetcherFunc(fetchChannelMoonshotBalance))
+}
+
+// updateChannelBalance 通过注册的 BalanceFetcher 查询余额，保存后执行低余额告警与降权检查，
+// 返回是否调整了渠道优先级（需要刷新渠道缓存）
+func updateChannelBalance(channel *model.Channel) (float64, bool, error) {
+	fetcher, ok := service.GetBalanceFetcher(channel.Type)
+	if !ok {
+		return 0, false, errors.New("尚未实现")
+	}
+	if channel.GetBaseURL() == "" {
+		baseURL := constant.ChannelBaseURLs[channel.Type]
+		channel.BaseURL = &baseURL
+	}
+	balance, err := fetcher.FetchBalance(channel)
+	if err != nil {
+		return 0, false, err
+	}
 	channel.UpdateBalance(balance)
-	return balance, nil
+	return balance, service.CheckChannelBalance(channel, balance), nil
 }
 
 func UpdateChannelBalance(c *gin.Context) {
@@ -439,11 +429,14 @@ func UpdateChannelBalance(c *gin.Context) {
 		})
 		return
 	}
-	balance, err := updateChannelBalance(channel)
+	balance, priorityChanged, err := updateChannelBalance(channel)
 	if err != nil {
 		common.ApiError(c, err)
 		return
 	}
+	if priorityChanged {
+		model.InitChannelCache()
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -456,8 +449,17 @@ func updateAllChannelsBalance() error {
 	if err != nil {
 		return err
 	}
+	priorityChanged := false
+	defer func() {
+		// 所有渠道检查完成后统一刷新一次缓存
+		if priorityChanged {
+			model.InitChannelCache()
+		}
+	}()
 	for _, channel := range channels {
-		if channel.Status != common.ChannelStatusEnabled {
+		// 因余额低于下限被禁用的渠道仍需查询余额，以便恢复后自动启用
+		floorDisabled := channel.Status == common.ChannelStatusAutoDisabled && channel.GetOtherSettings().BalanceFloorDisabled
+		if channel.Status != common.ChannelStatusEnabled && !floorDisabled {
 			continue
 		}
 		if channel.ChannelInfo.IsMultiKey {
@@ -467,17 +469,19 @@ func updateAllChannelsBalance() error {
 		//if channel.Type != common.ChannelTypeOpenAI && channel.Type != common.ChannelTypeCustom {
 		//	continue
 		//}
-		balance, err := updateChannelBalance(channel)
+		balance, changed, err := updateChannelBalance(channel)
+		priorityChanged = priorityChanged || changed
 		if err != nil {
 			continue
 		} else {
 			// err is nil & balance <= 0 means quota is used up
-			if balance <= 0 {
+			if balance <= 0 && channel.Status == common.ChannelStatusEnabled {
 				service.DisableChannel(*types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, "", channel.GetAutoBan()), "余额不足")
 			}
 		}
 		time.Sleep(common.RequestInterval)
 	}
+	service.CleanupChannelBalanceSnapshots()
 	return nil
 }
 
@@ -496,8 +500,12 @@ func UpdateAllChannelsBalance(c *gin.Context) {
 }
 
 func AutomaticallyUpdateChannels(frequency int) {
+	model.RegisterLeaseJob(model.JobChannelBalanceUpdate)
 	for {
 		time.Sleep(time.Duration(frequency) * time.Minute)
+		if !model.IsJobLeader(model.JobChannelBalanceUpdate) {
+			continue
+		}
 		common.SysLog("updating all channels")
 		_ = updateAllChannelsBalance()
 		common.SysLog("channels update done")
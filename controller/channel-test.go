@@ -872,11 +872,9 @@ func TestAllChannels(c *gin.Context) {
 var autoTestChannelsOnce sync.Once
 
 func AutomaticallyTestChannels() {
-	// 只在Master节点定时测试渠道
-	if !common.IsMasterNode {
-		return
-	}
 	autoTestChannelsOnce.Do(func() {
+		// 多节点部署时只由持有租约的节点定时测试渠道
+		model.RegisterLeaseJob(model.JobChannelAutoTest)
 		for {
 			if !operation_setting.GetMonitorSetting().AutoTestChannelEnabled {
 				time.Sleep(1 * time.Minute)
@@ -885,10 +883,12 @@ func AutomaticallyTestChannels() {
 			for {
 				frequency := operation_setting.GetMonitorSetting().AutoTestChannelMinutes
 				time.Sleep(time.Duration(int(math.Round(frequency))) * time.Minute)
-				common.SysLog(fmt.Sprintf("automatically test channels with interval %f minutes", frequency))
-				common.SysLog("automatically testing all channels")
-				_ = testAllChannels(false)
-				common.SysLog("automatically channel test finished")
+				if model.IsJobLeader(model.JobChannelAutoTest) {
+					common.SysLog(fmt.Sprintf("automatically test channels with interval %f minutes", frequency))
+					common.SysLog("automatically testing all channels")
+					_ = testAllChannels(false)
+					common.SysLog("automatically channel test finished")
+				}
 				if !operation_setting.GetMonitorSetting().AutoTestChannelEnabled {
 					break
 				}
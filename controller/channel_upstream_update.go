@@ -631,9 +631,6 @@ func runChannelUpstreamModelUpdateTaskOnce() {
 
 func StartChannelUpstreamModelUpdateTask() {
 	channelUpstreamModelUpdateTaskOnce.Do(func() {
-		if !common.IsMasterNode {
-			return
-		}
 		if !common.GetEnvOrDefaultBool("CHANNEL_UPSTREAM_MODEL_UPDATE_TASK_ENABLED", true) {
 			common.SysLog("upstream model update task disabled by CHANNEL_UPSTREAM_MODEL_UPDATE_TASK_ENABLED")
 			return
@@ -648,6 +645,7 @@ func StartChannelUpstreamModelUpdateTask() {
 		}
 		interval := time.Duration(intervalMinutes) * time.Minute
 
+		model.RegisterLeaseJob(model.JobChannelUpstreamUpdate)
 		go func() {
 			common.SysLog(fmt.Sprintf("upstream model update task started: interval=%s", interval))
 			runChannelUpstreamModelUpdateTaskOnce()
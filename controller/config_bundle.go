@@ -0,0 +1,226 @@
+package controller
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func writeConfigBundle(c *gin.Context, bundle *service.ConfigBundle, filename string) {
+	format := c.DefaultQuery("format", "yaml")
+	data, err := service.MarshalConfigBundle(bundle, format)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	contentType := "application/json"
+	ext := "json"
+	if format == "yaml" {
+		contentType = "application/yaml"
+		ext = "yaml"
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.%s", filename, ext))
+	c.Data(http.StatusOK, contentType, data)
+}
+
+func readConfigBundle(c *gin.Context) (*service.ConfigBundle, bool) {
+	data, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, false
+	}
+	bundle, err := service.ParseConfigBundle(data)
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, false
+	}
+	return bundle, true
+}
+
+// createConfigSnapshot 保存当前配置快照，密钥加密保存以便回滚时恢复
+func createConfigSnapshot(c *gin.Context, source string, comment string) (*model.ConfigSnapshot, error) {
+	bundle, err := service.BuildConfigBundle(service.ConfigKeyModeEncrypted)
+	if err != nil {
+		return nil, err
+	}
+	data, err := common.Marshal(bundle)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &model.ConfigSnapshot{
+		Comment:   comment,
+		Source:    source,
+		Content:   string(data),
+		CreatedBy: c.GetInt("id"),
+	}
+	if err := snapshot.Insert(); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// ExportConfigBundle 导出完整网关配置，?format=yaml|json&key_mode=omit|encrypted
+func ExportConfigBundle(c *gin.Context) {
+	bundle, err := service.BuildConfigBundle(c.DefaultQuery("key_mode", service.ConfigKeyModeOmit))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	writeConfigBundle(c, bundle, "new-api-config-"+time.Now().Format("20060102150405"))
+}
+
+// DiffConfigBundle 预览（dry-run）应用导出包后的变更，?prune=true 时包含删除项
+func DiffConfigBundle(c *gin.Context) {
+	bundle, ok := readConfigBundle(c)
+	if !ok {
+		return
+	}
+	diff, err := service.DiffConfigBundle(bundle, c.Query("prune") == "true")
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, diff)
+}
+
+// ApplyConfigBundle 应用导出包，应用前自动保存快照
+func ApplyConfigBundle(c *gin.Context) {
+	bundle, ok := readConfigBundle(c)
+	if !ok {
+		return
+	}
+	snapshot, err := createConfigSnapshot(c, model.ConfigSnapshotSourceAutoApply, "before apply")
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	prune := c.Query("prune") == "true"
+	diff, err := service.ApplyConfigBundle(bundle, prune)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	service.RecordAudit(c, service.AuditActionConfigApply, service.AuditTargetConfig, snapshot.Id, nil, map[string]any{
+		"prune":   prune,
+		"summary": diff.Summary,
+	})
+	common.ApiSuccess(c, gin.H{
+		"snapshot_id": snapshot.Id,
+		"diff":        diff,
+	})
+}
+
+func GetConfigSnapshots(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	snapshots, total, err := model.GetConfigSnapshots(pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(snapshots)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func CreateConfigSnapshot(c *gin.Context) {
+	var req struct {
+		Comment string `json:"comment"`
+	}
+	_ = c.ShouldBindJSON(&req)
+	snapshot, err := createConfigSnapshot(c, model.ConfigSnapshotSourceManual, req.Comment)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	snapshot.Content = ""
+	common.ApiSuccess(c, snapshot)
+}
+
+func loadConfigSnapshotBundle(c *gin.Context) (*model.ConfigSnapshot, *service.ConfigBundle, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, nil, false
+	}
+	snapshot, err := model.GetConfigSnapshotById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, nil, false
+	}
+	bundle, err := service.ParseConfigBundle([]byte(snapshot.Content))
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, nil, false
+	}
+	return snapshot, bundle, true
+}
+
+// DownloadConfigSnapshot 下载快照内容（密钥保持加密）
+func DownloadConfigSnapshot(c *gin.Context) {
+	snapshot, bundle, ok := loadConfigSnapshotBundle(c)
+	if !ok {
+		return
+	}
+	writeConfigBundle(c, bundle, fmt.Sprintf("new-api-config-snapshot-%d", snapshot.Id))
+}
+
+// DiffConfigSnapshot 预览回滚到快照会产生的变更
+func DiffConfigSnapshot(c *gin.Context) {
+	_, bundle, ok := loadConfigSnapshotBundle(c)
+	if !ok {
+		return
+	}
+	diff, err := service.DiffConfigBundle(bundle, true)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, diff)
+}
+
+// RollbackConfigSnapshot 回滚到指定快照，快照之后新增的条目会被删除
+func RollbackConfigSnapshot(c *gin.Context) {
+	snapshot, bundle, ok := loadConfigSnapshotBundle(c)
+	if !ok {
+		return
+	}
+	backup, err := createConfigSnapshot(c, model.ConfigSnapshotSourceAutoRollback, fmt.Sprintf("before rollback to #%d", snapshot.Id))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	diff, err := service.ApplyConfigBundle(bundle, true)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	service.RecordAudit(c, service.AuditActionConfigRollback, service.AuditTargetConfig, snapshot.Id, nil, map[string]any{
+		"backup_snapshot_id": backup.Id,
+		"summary":            diff.Summary,
+	})
+	common.ApiSuccess(c, gin.H{
+		"snapshot_id": backup.Id,
+		"diff":        diff,
+	})
+}
+
+func DeleteConfigSnapshot(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.DeleteConfigSnapshotById(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
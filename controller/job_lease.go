@@ -0,0 +1,21 @@
+package controller
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetJobLeases 查看后台任务租约由哪个节点持有
+func GetJobLeases(c *gin.Context) {
+	leases, err := model.GetJobLeases()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"node_id": common.NodeId,
+		"leases":  leases,
+	})
+}
@@ -3,9 +3,11 @@ package controller
 import (
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
 
 	"github.com/gin-gonic/gin"
 )
@@ -120,6 +122,26 @@ func GetLogsStat(c *gin.Context) {
 	return
 }
 
+// GetMarginReport 按 channel/model/group/day 汇总收入、上游成本与毛利
+func GetMarginReport(c *gin.Context) {
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	channel, _ := strconv.Atoi(c.Query("channel"))
+	items, err := model.GetMarginReport(model.MarginReportQuery{
+		GroupBy:        c.DefaultQuery("group_by", model.MarginGroupByChannel),
+		StartTimestamp: startTimestamp,
+		EndTimestamp:   endTimestamp,
+		ChannelId:      channel,
+		ModelName:      c.Query("model_name"),
+		Group:          c.Query("group"),
+	})
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, items)
+}
+
 func GetLogsSelfStat(c *gin.Context) {
 	username := c.GetString("username")
 	logType, _ := strconv.Atoi(c.Query("type"))
@@ -169,3 +191,79 @@ func DeleteHistoryLogs(c *gin.Context) {
 	})
 	return
 }
+
+func usageRollupQueryFromRequest(c *gin.Context) model.UsageRollupQuery {
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	tokenId, _ := strconv.Atoi(c.Query("token_id"))
+	channel, _ := strconv.Atoi(c.Query("channel"))
+	var groupBy []string
+	for _, dim := range strings.Split(c.Query("group_by"), ",") {
+		if dim = strings.TrimSpace(dim); dim != "" {
+			groupBy = append(groupBy, dim)
+		}
+	}
+	return model.UsageRollupQuery{
+		Period:         c.Query("period"),
+		GroupBy:        groupBy,
+		StartTimestamp: startTimestamp,
+		EndTimestamp:   endTimestamp,
+		UserId:         userId,
+		TokenId:        tokenId,
+		ChannelId:      channel,
+		Group:          c.Query("group"),
+		ModelName:      c.Query("model_name"),
+		RelayFormat:    c.Query("relay_format"),
+		ErrorClass:     c.Query("error_class"),
+	}
+}
+
+// GetUsageAnalytics 按 group_by 指定的维度（逗号分隔）查询用量汇总
+func GetUsageAnalytics(c *gin.Context) {
+	items, err := model.QueryUsageRollups(usageRollupQueryFromRequest(c))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, items)
+}
+
+// GetUserUsageAnalytics 用户查询自己的用量汇总，不开放渠道维度
+func GetUserUsageAnalytics(c *gin.Context) {
+	query := usageRollupQueryFromRequest(c)
+	query.UserId = c.GetInt("id")
+	query.ChannelId = 0
+	for _, dim := range query.GroupBy {
+		if dim == model.UsageDimChannel || dim == model.UsageDimUser {
+			common.ApiErrorMsg(c, "不支持的分组维度: "+dim)
+			return
+		}
+	}
+	items, err := model.QueryUsageRollups(query)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	for _, item := range items {
+		item.Username = ""
+	}
+	common.ApiSuccess(c, items)
+}
+
+// BackfillUsageAnalytics 根据历史日志重建指定范围的用量汇总
+func BackfillUsageAnalytics(c *gin.Context) {
+	var req struct {
+		StartTimestamp int64 `json:"start_timestamp"`
+		EndTimestamp   int64 `json:"end_timestamp"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.StartTimestamp <= 0 || req.EndTimestamp < req.StartTimestamp {
+		common.ApiErrorMsg(c, "无效的时间范围")
+		return
+	}
+	if !service.BackfillUsageRollupsAsync(req.StartTimestamp, req.EndTimestamp) {
+		common.ApiErrorMsg(c, "已有回填任务正在执行")
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
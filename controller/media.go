@@ -0,0 +1,201 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/mediastore"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type mediaObjectItem struct {
+	*model.MediaObject
+	Url string `json:"url"`
+}
+
+// serveMediaObject 输出已保存的对象，读取失败且尚未写入响应时返回 false 以便调用方回退到上游
+func serveMediaObject(c *gin.Context, obj *model.MediaObject) bool {
+	body, err := service.OpenMediaObject(c.Request.Context(), obj)
+	if err != nil {
+		if !errors.Is(err, mediastore.ErrNotFound) {
+			logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to open media object %d: %s", obj.Id, err.Error()))
+		}
+		return false
+	}
+	defer body.Close()
+	c.Writer.Header().Set("Content-Type", obj.ContentType)
+	c.Writer.Header().Set("Content-Length", strconv.FormatInt(obj.Size, 10))
+	c.Writer.Header().Set("Cache-Control", "private, max-age=3600")
+	c.Writer.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(c.Writer, body); err != nil {
+		logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to stream media object %d: %s", obj.Id, err.Error()))
+	}
+	return true
+}
+
+// GetSignedMedia 通过签名地址访问已保存的对象，无需登录
+func GetSignedMedia(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	expires, _ := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if !service.VerifyMediaSignature(id, expires, c.Query("sig")) {
+		c.Status(http.StatusForbidden)
+		return
+	}
+	obj, err := model.GetMediaObjectById(id)
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	if !serveMediaObject(c, obj) {
+		c.Status(http.StatusNotFound)
+	}
+}
+
+func toMediaObjectItems(objs []*model.MediaObject) []mediaObjectItem {
+	items := make([]mediaObjectItem, 0, len(objs))
+	for _, obj := range objs {
+		items = append(items, mediaObjectItem{MediaObject: obj, Url: service.BuildSignedMediaURL(obj)})
+	}
+	return items
+}
+
+func GetSelfMediaObjects(c *gin.Context) {
+	userId := c.GetInt("id")
+	pageInfo := common.GetPageQuery(c)
+	objs, total, err := model.GetUserMediaObjects(userId, pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	usage, err := model.GetUserMediaUsage(userId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(toMediaObjectItems(objs))
+	common.ApiSuccess(c, gin.H{
+		"page":       pageInfo,
+		"used_bytes": usage,
+	})
+}
+
+func DeleteSelfMediaObject(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	obj, err := model.GetMediaObjectById(id)
+	if err != nil || obj.UserId != c.GetInt("id") {
+		common.ApiErrorMsg(c, "对象不存在")
+		return
+	}
+	if err := service.DeleteMediaObject(c.Request.Context(), obj); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// GetAllMediaObjects 管理员查看已保存的对象，可按 user_id 过滤
+func GetAllMediaObjects(c *gin.Context) {
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	pageInfo := common.GetPageQuery(c)
+	objs, total, err := model.GetUserMediaObjects(userId, pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(toMediaObjectItems(objs))
+	common.ApiSuccess(c, pageInfo)
+}
+
+func DeleteMediaObject(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	obj, err := model.GetMediaObjectById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := service.DeleteMediaObject(c.Request.Context(), obj); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func GetMediaUserPolicy(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	policy, err := model.GetMediaUserPolicy(userId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	usage, err := model.GetUserMediaUsage(userId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"policy":     policy,
+		"used_bytes": usage,
+	})
+}
+
+func UpdateMediaUserPolicy(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	var policy model.MediaUserPolicy
+	if err := common.DecodeJson(c.Request.Body, &policy); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if (policy.RetentionDays != nil && *policy.RetentionDays < 0) || (policy.QuotaBytes != nil && *policy.QuotaBytes < 0) {
+		common.ApiErrorMsg(c, "保留天数和配额不能为负数")
+		return
+	}
+	policy.UserId = userId
+	if err := model.UpsertMediaUserPolicy(&policy); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, policy)
+}
+
+func DeleteMediaUserPolicy(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.DeleteMediaUserPolicy(userId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
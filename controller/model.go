@@ -109,6 +109,17 @@ func init() {
 	})
 }
 
+// routerOpenAIModel 虚拟路由模型在模型列表中的条目，支持的端点与默认模型一致
+func routerOpenAIModel(routerModel *operation_setting.RouterModel) dto.OpenAIModels {
+	return dto.OpenAIModels{
+		Id:                     routerModel.Name,
+		Object:                 "model",
+		Created:                1626777600,
+		OwnedBy:                "router",
+		SupportedEndpointTypes: model.GetModelSupportEndpointTypes(routerModel.Default),
+	}
+}
+
 func ListModels(c *gin.Context, modelType int) {
 	userOpenAiModels := make([]dto.OpenAIModels, 0)
 
@@ -133,6 +144,10 @@ func ListModels(c *gin.Context, modelType int) {
 			tokenModelLimit = map[string]bool{}
 		}
 		for allowModel, _ := range tokenModelLimit {
+			if routerModel, ok := operation_setting.GetModelRouterSetting().GetRouterModel(allowModel); ok {
+				userOpenAiModels = append(userOpenAiModels, routerOpenAIModel(routerModel))
+				continue
+			}
 			if !acceptUnsetRatioModel {
 				_, _, exist := ratio_setting.GetModelRatioOrPrice(allowModel)
 				if !exist {
@@ -200,6 +215,14 @@ func ListModels(c *gin.Context, modelType int) {
 				})
 			}
 		}
+		if routerSetting := operation_setting.GetModelRouterSetting(); routerSetting.Enabled {
+			for i := range routerSetting.Models {
+				routerModel := &routerSetting.Models[i]
+				if routerModel.VisibleTo(group, userGroup) && !common.StringsContains(models, routerModel.Name) {
+					userOpenAiModels = append(userOpenAiModels, routerOpenAIModel(routerModel))
+				}
+			}
+		}
 	}
 
 	switch modelType {
@@ -263,7 +286,13 @@ func EnabledListModels(c *gin.Context) {
 
 func RetrieveModel(c *gin.Context, modelType int) {
 	modelId := c.Param("model")
-	if aiModel, ok := openAIModelsMap[modelId]; ok {
+	aiModel, ok := openAIModelsMap[modelId]
+	if !ok {
+		if routerModel, found := service.GetRouterModel(c, modelId); found {
+			aiModel, ok = routerOpenAIModel(routerModel), true
+		}
+	}
+	if ok {
 		switch modelType {
 		case constant.ChannelTypeAnthropic:
 			c.JSON(200, dto.AnthropicModel{
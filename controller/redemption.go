@@ -8,6 +8,7 @@ import (
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/i18n"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
 
 	"github.com/gin-gonic/gin"
 )
@@ -103,6 +104,11 @@ func AddRedemption(c *gin.Context) {
 			return
 		}
 		keys = append(keys, key)
+		service.RecordAudit(c, service.AuditActionRedemptionCreate, service.AuditTargetRedemption, cleanRedemption.Id, nil, map[string]any{
+			"name":         cleanRedemption.Name,
+			"quota":        cleanRedemption.Quota,
+			"expired_time": cleanRedemption.ExpiredTime,
+		})
 	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
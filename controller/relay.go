@@ -67,6 +67,7 @@ func geminiRelayHandler(c *gin.Context, info *relaycommon.RelayInfo) *types.NewA
 func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 
 	requestId := c.GetString(common.RequestIdKey)
+	common.SetContextKey(c, constant.ContextKeyRelayFormat, string(relayFormat))
 	//group := common.GetContextKeyString(c, constant.ContextKeyUsingGroup)
 	//originalModel := common.GetContextKeyString(c, constant.ContextKeyOriginalModel)
 
@@ -89,6 +90,11 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		if newAPIError != nil {
 			logger.LogError(c, fmt.Sprintf("relay error: %s", newAPIError.Error()))
 			newAPIError.SetMessage(common.MessageWithRequestId(newAPIError.Error(), requestId))
+			if relayFormat != types.RelayFormatOpenAIRealtime && helper.IsEventStreamStarted(c) {
+				// 流式响应头已经写出（如 ping），以客户端格式的错误事件结束流
+				_ = helper.StreamErrorEvent(c, relayFormat, newAPIError)
+				return
+			}
 			switch relayFormat {
 			case types.RelayFormatOpenAIRealtime:
 				helper.WssError(c, ws, newAPIError.ToOpenAIError())
@@ -124,9 +130,12 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 
 	needSensitiveCheck := setting.ShouldCheckPromptSensitive()
 	needCountToken := constant.CountToken
+	// 虚拟路由模型需要完整的请求特征（图片、工具等）来选择实际模型
+	_, isRouterModel := service.GetRouterModel(c, relayInfo.OriginModelName)
+	isRouterModel = isRouterModel && service.SupportsModelRouting(c.Request.URL.Path)
 	// Avoid building huge CombineText (strings.Join) when token counting and sensitive check are both disabled.
 	var meta *types.TokenCountMeta
-	if needSensitiveCheck || needCountToken {
+	if needSensitiveCheck || needCountToken || isRouterModel {
 		meta = request.GetTokenCountMeta()
 	} else {
 		meta = fastTokenCountMetaForPricing(request)
@@ -149,6 +158,12 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 
 	relayInfo.SetEstimatePromptTokens(tokens)
 
+	if isRouterModel {
+		if newAPIError = routeRelayModel(c, relayInfo, request, meta, tokens); newAPIError != nil {
+			return
+		}
+	}
+
 	priceData, err := helper.ModelPriceHelper(c, relayInfo, tokens, meta)
 	if err != nil {
 		newAPIError = types.NewError(err, types.ErrorCodeModelPriceError)
@@ -186,6 +201,35 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 	relayInfo.RetryIndex = 0
 	relayInfo.LastError = nil
 
+	for {
+		newAPIError = relayWithChannelRetry(c, relayFormat, relayInfo, retryParam)
+		if newAPIError == nil {
+			return
+		}
+		requeued, queueErr := requeueAfterRateLimit(c, relayFormat, relayInfo, retryParam, newAPIError)
+		if requeued {
+			continue
+		}
+		newAPIError = queueErr
+		// 当前模型的渠道都失败后按降级链切换模型，按实际提供服务的模型计费
+		switched, billingErr := switchToFallbackModel(c, relayInfo, retryParam, newAPIError, tokens, meta)
+		if billingErr != nil {
+			newAPIError = billingErr
+		}
+		if !switched {
+			break
+		}
+	}
+
+	useChannel := c.GetStringSlice("use_channel")
+	if len(useChannel) > 1 {
+		retryLogStr := fmt.Sprintf("重试：%s", strings.Trim(strings.Join(strings.Fields(fmt.Sprint(useChannel)), "->"), "[]"))
+		logger.LogInfo(c, retryLogStr)
+	}
+}
+
+// relayWithChannelRetry 在当前模型的渠道与优先级之间重试
+func relayWithChannelRetry(c *gin.Context, relayFormat types.RelayFormat, relayInfo *relaycommon.RelayInfo, retryParam *service.RetryParam) (newAPIError *types.NewAPIError) {
 	for ; retryParam.GetRetry() <= common.RetryTimes; retryParam.IncreaseRetry() {
 		relayInfo.RetryIndex = retryParam.GetRetry()
 		channel, channelErr := getChannel(c, relayInfo, retryParam)
@@ -195,9 +239,19 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 			break
 		}
 
+		channel, releaseSlot, slotErr := acquireChannelSlot(c, relayInfo, retryParam, channel)
+		if slotErr != nil {
+			newAPIError = slotErr
+			if types.IsSkipRetryError(slotErr) {
+				break
+			}
+			continue
+		}
+
 		addUsedChannel(c, channel.Id)
 		bodyStorage, bodyErr := common.GetBodyStorage(c)
 		if bodyErr != nil {
+			releaseSlot()
 			// Ensure consistent 413 for oversized bodies even when error occurs later (e.g., retry path)
 			if common.IsRequestBodyTooLargeError(bodyErr) || errors.Is(bodyErr, common.ErrRequestBodyTooLarge) {
 				newAPIError = types.NewErrorWithStatusCode(bodyErr, types.ErrorCodeReadRequestBodyFailed, http.StatusRequestEntityTooLarge, types.ErrOptionWithSkipRetry())
@@ -208,16 +262,12 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		}
 		c.Request.Body = io.NopCloser(bodyStorage)
 
-		switch relayFormat {
-		case types.RelayFormatOpenAIRealtime:
-			newAPIError = relay.WssHelper(c, relayInfo)
-		case types.RelayFormatClaude:
-			newAPIError = relay.ClaudeHelper(c, relayInfo)
-		case types.RelayFormatGemini:
-			newAPIError = geminiRelayHandler(c, relayInfo)
-		default:
-			newAPIError = relayHandler(c, relayInfo)
+		if rule, ruleIndex, ok := getHedgeRule(c, relayFormat, relayInfo); ok {
+			channel, newAPIError = relayWithHedge(c, relayFormat, relayInfo, channel, bodyStorage, rule, ruleIndex)
+		} else {
+			newAPIError = relayByFormat(c, relayFormat, relayInfo)
 		}
+		releaseSlot()
 
 		if newAPIError == nil {
 			relayInfo.LastError = nil
@@ -233,11 +283,52 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 			break
 		}
 	}
+	return newAPIError
+}
 
-	useChannel := c.GetStringSlice("use_channel")
-	if len(useChannel) > 1 {
-		retryLogStr := fmt.Sprintf("重试：%s", strings.Trim(strings.Join(strings.Fields(fmt.Sprint(useChannel)), "->"), "[]"))
-		logger.LogInfo(c, retryLogStr)
+func relayByFormat(c *gin.Context, relayFormat types.RelayFormat, relayInfo *relaycommon.RelayInfo) *types.NewAPIError {
+	switch relayFormat {
+	case types.RelayFormatOpenAIRealtime:
+		return relay.WssHelper(c, relayInfo)
+	case types.RelayFormatClaude:
+		return relay.ClaudeHelper(c, relayInfo)
+	case types.RelayFormatGemini:
+		return geminiRelayHandler(c, relayInfo)
+	default:
+		return relayHandler(c, relayInfo)
+	}
+}
+
+// routeRelayModel 按路由规则选择虚拟模型的实际模型，并使用为该模型选出的渠道
+func routeRelayModel(c *gin.Context, relayInfo *relaycommon.RelayInfo, request dto.Request, meta *types.TokenCountMeta, tokens int) *types.NewAPIError {
+	channel, newAPIError := service.RouteModel(c, relayInfo, request, meta, tokens)
+	if newAPIError != nil {
+		return newAPIError
+	}
+	return middleware.SetupContextForSelectedChannel(c, channel, relayInfo.OriginModelName)
+}
+
+// switchToFallbackModel 切换到降级链中下一个可计价的模型并按其价格重新预扣费，没有可用的降级模型时返回 false。
+// 重新预扣失败（如额度不足）时返回该错误，不再继续降级
+func switchToFallbackModel(c *gin.Context, relayInfo *relaycommon.RelayInfo, retryParam *service.RetryParam, lastErr *types.NewAPIError, tokens int, meta *types.TokenCountMeta) (bool, *types.NewAPIError) {
+	for {
+		fallbackModel, ok := service.NextModelFallback(c, relayInfo, lastErr)
+		if !ok {
+			return false, nil
+		}
+		service.SwitchRelayModel(c, relayInfo, fallbackModel)
+		priceData, err := helper.ModelPriceHelper(c, relayInfo, tokens, meta)
+		if err != nil {
+			logger.LogError(c, fmt.Sprintf("model fallback to %s skipped: %s", fallbackModel, err.Error()))
+			continue
+		}
+		if apiErr := service.RebillFallbackModel(c, relayInfo, priceData); apiErr != nil {
+			return false, apiErr
+		}
+		retryParam.ModelName = fallbackModel
+		retryParam.SetRetry(0)
+		relayInfo.LastError = nil
+		return true, nil
 	}
 }
 
@@ -437,6 +528,70 @@ func RelayMidjourney(c *gin.Context) {
 	}
 }
 
+// RelayCountTokens 处理 Claude /v1/messages/count_tokens 与 Gemini :countTokens，不计费。
+// 渠道原生支持时转发上游，否则（或上游失败时）本地估算
+func RelayCountTokens(c *gin.Context, relayFormat types.RelayFormat) {
+	requestId := c.GetString(common.RequestIdKey)
+	common.SetContextKey(c, constant.ContextKeyRelayFormat, string(relayFormat))
+
+	var newAPIError *types.NewAPIError
+	defer func() {
+		if newAPIError == nil {
+			return
+		}
+		logger.LogError(c, fmt.Sprintf("count tokens error: %s", newAPIError.Error()))
+		newAPIError.SetMessage(common.MessageWithRequestId(newAPIError.Error(), requestId))
+		if relayFormat == types.RelayFormatClaude {
+			c.JSON(newAPIError.StatusCode, gin.H{
+				"type":  "error",
+				"error": newAPIError.ToClaudeError(),
+			})
+			return
+		}
+		c.JSON(newAPIError.StatusCode, gin.H{
+			"error": newAPIError.ToOpenAIError(),
+		})
+	}()
+
+	request, err := helper.GetAndValidateRequest(c, relayFormat)
+	if err != nil {
+		newAPIError = types.NewError(err, types.ErrorCodeInvalidRequest)
+		return
+	}
+	relayInfo, err := relaycommon.GenRelayInfo(c, relayFormat, request, nil)
+	if err != nil {
+		newAPIError = types.NewError(err, types.ErrorCodeGenRelayInfoFailed)
+		return
+	}
+
+	tokens, err := relay.CountTokensHelper(c, relayInfo)
+	if err != nil {
+		if !errors.Is(err, relay.ErrCountTokensUnsupported) {
+			logger.LogWarn(c, fmt.Sprintf("upstream count tokens failed, fallback to local estimate: %s", err.Error()))
+		}
+		tokens, err = estimateCountTokens(c, relayInfo, request)
+		if err != nil {
+			newAPIError = types.NewError(err, types.ErrorCodeCountTokenFailed)
+			return
+		}
+	}
+
+	if relayFormat == types.RelayFormatClaude {
+		c.JSON(http.StatusOK, dto.ClaudeCountTokensResponse{InputTokens: tokens})
+		return
+	}
+	c.JSON(http.StatusOK, dto.GeminiCountTokensResponse{TotalTokens: tokens})
+}
+
+// estimateCountTokens 本地估算输入 token，关闭 token 统计时仍需返回结果
+func estimateCountTokens(c *gin.Context, info *relaycommon.RelayInfo, request dto.Request) (int, error) {
+	meta := request.GetTokenCountMeta()
+	if !constant.CountToken {
+		return service.CountTextToken(meta.CombineText, info.OriginModelName), nil
+	}
+	return service.EstimateRequestToken(c, meta, info)
+}
+
 func RelayNotImplemented(c *gin.Context) {
 	err := types.OpenAIError{
 		Message: "API not implemented",
@@ -575,6 +730,8 @@ func RelayTask(c *gin.Context) {
 		task.PrivateData.BillingSource = relayInfo.BillingSource
 		task.PrivateData.SubscriptionId = relayInfo.SubscriptionId
 		task.PrivateData.TokenId = relayInfo.TokenId
+		task.PrivateData.CallbackURL = service.ResolveTaskCallbackURL(c)
+		task.PrivateData.UpstreamCallback = relayInfo.TaskRelayInfo != nil && relayInfo.UpstreamCallback
 		task.PrivateData.BillingContext = &model.TaskBillingContext{
 			ModelPrice:      relayInfo.PriceData.ModelPrice,
 			GroupRatio:      relayInfo.PriceData.GroupRatioInfo.GroupRatio,
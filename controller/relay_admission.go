@@ -0,0 +1,123 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rateLimitRequeueDelay 所有渠道都被上游限流后，重新排队到再次尝试的最短间隔
+const rateLimitRequeueDelay = time.Second
+
+func noopRelease() {}
+
+// acquireChannelSlot 占用所选渠道的并发名额并计入所选 key 的限流用量。渠道已满（包括所有 key 都没有限流余量）
+// 且准入队列未启用时返回可重试的错误，由重试逻辑换渠道；启用时进入分组与模型对应的队列等待，
+// 放行时可能换到另一个有空闲名额的渠道。队列中已有请求等待时新请求直接排队，避免插队
+func acquireChannelSlot(c *gin.Context, relayInfo *relaycommon.RelayInfo, retryParam *service.RetryParam, channel *model.Channel) (*model.Channel, func(), *types.NewAPIError) {
+	limited, err := model.CacheGetChannel(channel.Id)
+	if err != nil {
+		return channel, noopRelease, nil
+	}
+	queueEnabled := service.AdmissionQueueApplies(relayInfo)
+	if !queueEnabled || !service.HasAdmissionWaiters(relayInfo) {
+		if release, ok := model.TryAcquireChannelSlot(limited); ok {
+			return channel, acquireChannelKey(c, relayInfo, channel, release), nil
+		}
+		if !queueEnabled {
+			return nil, nil, types.NewErrorWithStatusCode(fmt.Errorf("channel #%d has no capacity left (concurrency or rate limit)", limited.Id), types.ErrorCodeChannelConcurrencyLimited, http.StatusTooManyRequests)
+		}
+	}
+
+	_, specificChannel := common.GetContextKey(c, constant.ContextKeyTokenSpecificChannelId)
+	var (
+		admitted *model.Channel
+		release  func()
+	)
+	tryAdmit := func() bool {
+		candidate := limited
+		if !specificChannel {
+			param := *retryParam
+			param.Retry = common.GetPointer(retryParam.GetRetry())
+			if selected, _, err := service.CacheGetRandomSatisfiedChannel(&param); err == nil && selected != nil {
+				candidate = selected
+			}
+		}
+		slotRelease, ok := model.TryAcquireChannelSlot(candidate)
+		if !ok {
+			return false
+		}
+		admitted, release = candidate, slotRelease
+		return true
+	}
+	if apiErr := service.WaitForAdmission(c, relayInfo, tryAdmit); apiErr != nil {
+		return nil, nil, apiErr
+	}
+	// 排队期间 key 可能已被冷却，放行后重新选择 key
+	relayInfo.PriceData.GroupRatioInfo = helper.HandleGroupRatio(c, relayInfo)
+	if apiErr := middleware.SetupContextForSelectedChannel(c, admitted, relayInfo.OriginModelName); apiErr != nil {
+		release()
+		return nil, nil, apiErr
+	}
+	if admitted.Id != channel.Id {
+		logger.LogInfo(c, fmt.Sprintf("admitted from queue to channel #%d", admitted.Id))
+	}
+	return admitted, acquireChannelKey(c, relayInfo, admitted, release), nil
+}
+
+// acquireChannelKey 将本次请求计入所选 key 的 RPM/TPM 与并发数，返回同时释放渠道与 key 名额的函数。
+// 渠道与 key 都没有上限时无需计数
+func acquireChannelKey(c *gin.Context, relayInfo *relaycommon.RelayInfo, channel *model.Channel, releaseSlot func()) func() {
+	if !channel.HasCapacityLimits() {
+		return releaseSlot
+	}
+	keyIndex := 0
+	if common.GetContextKeyBool(c, constant.ContextKeyChannelIsMultiKey) {
+		keyIndex = common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex)
+	}
+	releaseKey := model.AcquireChannelKey(channel.Id, keyIndex, relayInfo.GetEstimatePromptTokens())
+	return func() {
+		releaseKey()
+		releaseSlot()
+	}
+}
+
+// requeueAfterRateLimit 当前模型的渠道都被上游限流时重新排队，等待后从头重试渠道；
+// 累计等待时间仍受准入队列的最长等待时间限制
+func requeueAfterRateLimit(c *gin.Context, relayFormat types.RelayFormat, relayInfo *relaycommon.RelayInfo, retryParam *service.RetryParam, lastErr *types.NewAPIError) (bool, *types.NewAPIError) {
+	if lastErr == nil || lastErr.StatusCode != http.StatusTooManyRequests || types.IsSkipRetryError(lastErr) {
+		return false, lastErr
+	}
+	if lastErr.GetErrorCode() == types.ErrorCodeChannelConcurrencyLimited {
+		return false, lastErr
+	}
+	if relayFormat == types.RelayFormatOpenAIRealtime || helper.IsEventStreamStarted(c) {
+		return false, lastErr
+	}
+	if !service.AdmissionQueueApplies(relayInfo) || !operation_setting.GetAdmissionQueueSetting().RequeueOnRateLimit {
+		return false, lastErr
+	}
+	readyAt := time.Now().Add(rateLimitRequeueDelay)
+	if apiErr := service.WaitForAdmission(c, relayInfo, func() bool {
+		return !time.Now().Before(readyAt)
+	}); apiErr != nil {
+		return false, apiErr
+	}
+	logger.LogInfo(c, fmt.Sprintf("all channels for model %s were rate limited, retrying after queueing", relayInfo.OriginModelName))
+	retryParam.SetRetry(0)
+	relayInfo.LastError = nil
+	return true, nil
+}
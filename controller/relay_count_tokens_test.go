@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/QuantumNous/new-api/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCountTokensContext(t *testing.T, path string, body string, channel *model.Channel, modelName string) (*gin.Context, *httptest.ResponseRecorder) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	require.Nil(t, middleware.SetupContextForSelectedChannel(c, channel, modelName))
+	return c, recorder
+}
+
+func TestRelayCountTokens_LocalEstimateForUnsupportedChannel(t *testing.T) {
+	channel := &model.Channel{Id: 1, Type: constant.ChannelTypeOpenAI, Key: "sk-test"}
+	body := `{"model":"claude-sonnet-4","messages":[{"role":"user","content":"hello world, how are you today?"}]}`
+	c, recorder := newCountTokensContext(t, "/v1/messages/count_tokens", body, channel, "claude-sonnet-4")
+
+	RelayCountTokens(c, types.RelayFormatClaude)
+
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var resp struct {
+		InputTokens int `json:"input_tokens"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &resp))
+	assert.Greater(t, resp.InputTokens, 0)
+}
+
+func TestRelayCountTokens_GeminiGenerateContentRequestWrapper(t *testing.T) {
+	channel := &model.Channel{Id: 1, Type: constant.ChannelTypeOpenAI, Key: "sk-test"}
+	body := `{"generateContentRequest":{"model":"models/gemini-2.5-flash","contents":[{"role":"user","parts":[{"text":"count these tokens please"}]}]}}`
+	c, recorder := newCountTokensContext(t, "/v1beta/models/gemini-2.5-flash:countTokens", body, channel, "gemini-2.5-flash")
+
+	RelayCountTokens(c, types.RelayFormatGemini)
+
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var resp struct {
+		TotalTokens int `json:"totalTokens"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &resp))
+	assert.Greater(t, resp.TotalTokens, 0)
+}
+
+func TestRelayCountTokens_ForwardsToAnthropic(t *testing.T) {
+	service.InitHttpClient()
+	fetchSetting := system_setting.GetFetchSetting()
+	saved := fetchSetting.EnableSSRFProtection
+	fetchSetting.EnableSSRFProtection = false
+	t.Cleanup(func() { fetchSetting.EnableSSRFProtection = saved })
+
+	var gotPath, gotKey, gotBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotKey = r.Header.Get("x-api-key")
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		_, _ = w.Write([]byte(`{"input_tokens":42}`))
+	}))
+	defer server.Close()
+
+	mapping := `{"claude-alias":"claude-sonnet-4-20250514"}`
+	channel := &model.Channel{Id: 2, Type: constant.ChannelTypeAnthropic, Key: "sk-ant", BaseURL: &server.URL, ModelMapping: &mapping}
+	body := `{"model":"claude-alias","messages":[{"role":"user","content":"hi"}]}`
+	c, recorder := newCountTokensContext(t, "/v1/messages/count_tokens", body, channel, "claude-alias")
+
+	RelayCountTokens(c, types.RelayFormatClaude)
+
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	assert.JSONEq(t, `{"input_tokens":42}`, recorder.Body.String())
+	assert.Equal(t, "/v1/messages/count_tokens", gotPath)
+	assert.Equal(t, "sk-ant", gotKey)
+	assert.Contains(t, gotBody, `"model":"claude-sonnet-4-20250514"`)
+}
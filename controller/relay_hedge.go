@@ -0,0 +1,425 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// hedgeChannelAttempts 选择对冲渠道时避开主渠道的尝试次数
+const hedgeChannelAttempts = 3
+
+var errHedgeLost = errors.New("hedged request lost the race")
+
+// hedgeRace 对冲竞速状态，第一个向客户端输出首字节的一方胜出
+type hedgeRace struct {
+	mu      sync.Mutex
+	legs    []*hedgeLeg // legs[0] 为主请求，legs[1] 为对冲请求
+	winner  *hedgeLeg
+	claimed chan struct{}
+}
+
+type hedgeLeg struct {
+	c            *gin.Context
+	info         *relaycommon.RelayInfo
+	channel      *model.Channel
+	cancel       context.CancelFunc
+	storage      common.BodyStorage
+	start        time.Time
+	overheadCost int
+	err          *types.NewAPIError
+	done         chan struct{}
+	releaseSlot  func() // 对冲渠道的并发名额，主请求的名额由重试逻辑持有
+}
+
+// addLeg 已有一方胜出时不再加入新的请求
+func (r *hedgeRace) addLeg(leg *hedgeLeg) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.winner != nil {
+		return false
+	}
+	r.legs = append(r.legs, leg)
+	return true
+}
+
+// claim 在 leg 所在的 goroutine 中调用，返回 leg 是否为胜出方
+func (r *hedgeRace) claim(leg *hedgeLeg) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.winner != nil {
+		return r.winner == leg
+	}
+	r.winner = leg
+	service.RecordFirstByteLatency(leg.info.OriginModelName, time.Since(leg.start))
+	if len(r.legs) > 1 {
+		loser := r.legs[0]
+		if leg == r.legs[0] {
+			loser = r.legs[1]
+		}
+		// 落败方随后可能仍会走到结算流程（非流式写入失败、流式被取消后按估算用量结算），标记后跳过计费
+		common.SetContextKey(loser.c, constant.ContextKeyHedgeLost, true)
+		leg.info.Hedge = &relaycommon.HedgeInfo{
+			PrimaryChannelId: r.legs[0].channel.Id,
+			HedgeChannelId:   r.legs[1].channel.Id,
+			HedgeWon:         leg == r.legs[1],
+			OverheadCost:     loser.overheadCost,
+		}
+	}
+	close(r.claimed)
+	return true
+}
+
+func (r *hedgeRace) getWinner() *hedgeLeg {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.winner
+}
+
+// hedgeWriter 在胜出前缓存响应头，胜出后直接写入客户端连接；落败方的写入返回 errHedgeLost
+type hedgeWriter struct {
+	gin.ResponseWriter
+	race    *hedgeRace
+	leg     *hedgeLeg
+	header  http.Header
+	status  int
+	claimed bool
+}
+
+func (w *hedgeWriter) claim() error {
+	if w.claimed {
+		return nil
+	}
+	if !w.race.claim(w.leg) {
+		return errHedgeLost
+	}
+	w.claimed = true
+	header := w.ResponseWriter.Header()
+	for key, values := range w.header {
+		header[key] = values
+	}
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	return nil
+}
+
+func (w *hedgeWriter) Header() http.Header {
+	if w.claimed {
+		return w.ResponseWriter.Header()
+	}
+	return w.header
+}
+
+func (w *hedgeWriter) WriteHeader(code int) {
+	if w.claimed {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.status = code
+}
+
+func (w *hedgeWriter) WriteHeaderNow() {
+	if w.claim() == nil {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *hedgeWriter) Write(data []byte) (int, error) {
+	if err := w.claim(); err != nil {
+		return 0, err
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *hedgeWriter) WriteString(s string) (int, error) {
+	if err := w.claim(); err != nil {
+		return 0, err
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *hedgeWriter) Flush() {
+	if w.claimed {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *hedgeWriter) Status() int {
+	if w.claimed {
+		return w.ResponseWriter.Status()
+	}
+	if w.status != 0 {
+		return w.status
+	}
+	return http.StatusOK
+}
+
+func (w *hedgeWriter) Size() int {
+	if w.claimed {
+		return w.ResponseWriter.Size()
+	}
+	return -1
+}
+
+func (w *hedgeWriter) Written() bool {
+	return w.claimed && w.ResponseWriter.Written()
+}
+
+// getHedgeRule 仅对首次尝试的对话类请求做对冲，指定渠道的令牌不做对冲
+func getHedgeRule(c *gin.Context, relayFormat types.RelayFormat, relayInfo *relaycommon.RelayInfo) (*operation_setting.HedgeRule, int, bool) {
+	if relayInfo.RetryIndex > 0 {
+		return nil, -1, false
+	}
+	switch relayFormat {
+	case types.RelayFormatOpenAI:
+		if relayInfo.RelayMode != relayconstant.RelayModeChatCompletions {
+			return nil, -1, false
+		}
+	case types.RelayFormatClaude, types.RelayFormatOpenAIResponses:
+	default:
+		return nil, -1, false
+	}
+	if _, ok := common.GetContextKey(c, constant.ContextKeyTokenSpecificChannelId); ok {
+		return nil, -1, false
+	}
+	rule, ruleIndex, ok := service.GetHedgeRule(relayInfo)
+	if ok {
+		service.RecordHedgeEligible(ruleIndex)
+	}
+	return rule, ruleIndex, ok
+}
+
+// newHedgeLeg 为一方请求复制独立的 gin 上下文、请求体与 RelayInfo
+func newHedgeLeg(c *gin.Context, race *hedgeRace, relayInfo *relaycommon.RelayInfo, body []byte) (*hedgeLeg, error) {
+	storage, err := common.CreateBodyStorage(body)
+	if err != nil {
+		return nil, err
+	}
+	legCtx := c.Copy()
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	legCtx.Request = c.Request.WithContext(ctx)
+	legCtx.Request.Body = io.NopCloser(storage)
+	legCtx.Set(common.KeyBodyStorage, storage)
+	common.SetContextKey(legCtx, constant.ContextKeyHedgeLeg, true)
+
+	info := relayInfo.CloneForHedge()
+	// 等待首字节期间不发送 ping，避免 ping 被当作首字节
+	info.DisablePing = true
+	leg := &hedgeLeg{
+		c:       legCtx,
+		info:    info,
+		cancel:  cancel,
+		storage: storage,
+		done:    make(chan struct{}),
+	}
+	legCtx.Writer = &hedgeWriter{
+		ResponseWriter: c.Writer,
+		race:           race,
+		leg:            leg,
+		header:         c.Writer.Header().Clone(),
+	}
+	return leg, nil
+}
+
+func (leg *hedgeLeg) release() {
+	leg.cancel()
+	_ = leg.storage.Close()
+	if leg.releaseSlot != nil {
+		leg.releaseSlot()
+	}
+}
+
+func runHedgeLeg(race *hedgeRace, leg *hedgeLeg, relayFormat types.RelayFormat) {
+	leg.start = time.Now()
+	go func() {
+		defer close(leg.done)
+		defer func() {
+			if r := recover(); r != nil {
+				logger.LogError(leg.c, fmt.Sprintf("hedged relay panic: %v\n%s", r, debug.Stack()))
+				leg.err = types.NewError(fmt.Errorf("hedged relay panic: %v", r), types.ErrorCodeDoRequestFailed)
+			}
+		}()
+		leg.err = relayByFormat(leg.c, relayFormat, leg.info)
+		if leg.err == nil {
+			race.claim(leg)
+		}
+	}()
+}
+
+// selectHedgeChannel 在副本上下文中选择与主渠道不同、且并发未满的渠道
+func selectHedgeChannel(leg *hedgeLeg, primaryChannelId int) (*model.Channel, error) {
+	retryParam := &service.RetryParam{
+		Ctx:        leg.c,
+		TokenGroup: leg.info.TokenGroup,
+		ModelName:  leg.info.OriginModelName,
+		Retry:      common.GetPointer(0),
+	}
+	for attempt := 0; attempt < hedgeChannelAttempts; attempt++ {
+		channel, _, err := service.CacheGetRandomSatisfiedChannel(retryParam)
+		if err != nil {
+			return nil, err
+		}
+		if channel == nil || channel.Id == primaryChannelId {
+			continue
+		}
+		releaseSlot, ok := model.TryAcquireChannelSlot(channel)
+		if !ok {
+			continue
+		}
+		leg.info.PriceData.GroupRatioInfo = helper.HandleGroupRatio(leg.c, leg.info)
+		if apiErr := middleware.SetupContextForSelectedChannel(leg.c, channel, leg.info.OriginModelName); apiErr != nil {
+			releaseSlot()
+			return nil, apiErr
+		}
+		leg.releaseSlot = acquireChannelKey(leg.c, leg.info, channel, releaseSlot)
+		addUsedChannel(leg.c, channel.Id)
+		return channel, nil
+	}
+	return nil, errors.New("no other channel available")
+}
+
+// relayWithHedge 主渠道在对冲延迟内没有输出首字节时，向另一个渠道发送相同请求，先输出首字节的一方胜出，
+// 落败方被取消且不向用户计费，其估算成本记为对冲开销。返回的渠道与错误对应最终采用的一方
+func relayWithHedge(c *gin.Context, relayFormat types.RelayFormat, relayInfo *relaycommon.RelayInfo, channel *model.Channel, bodyStorage common.BodyStorage, rule *operation_setting.HedgeRule, ruleIndex int) (*model.Channel, *types.NewAPIError) {
+	body, err := bodyStorage.Bytes()
+	if err != nil {
+		return channel, relayByFormat(c, relayFormat, relayInfo)
+	}
+	race := &hedgeRace{claimed: make(chan struct{})}
+	primary, err := newHedgeLeg(c, race, relayInfo, body)
+	if err != nil {
+		return channel, relayByFormat(c, relayFormat, relayInfo)
+	}
+	primary.channel = channel
+	primary.overheadCost = service.EstimateHedgeOverheadCost(relayInfo, channel.GetOtherSettings())
+	race.addLeg(primary)
+	runHedgeLeg(race, primary, relayFormat)
+
+	timer := time.NewTimer(service.HedgeDelay(rule, relayInfo.OriginModelName))
+	defer timer.Stop()
+	select {
+	case <-race.claimed:
+		<-primary.done
+		return finishHedge(c, relayInfo, primary)
+	case <-primary.done:
+		return finishHedge(c, relayInfo, primary)
+	case <-timer.C:
+	}
+
+	hedge := startHedgeLeg(c, race, relayFormat, relayInfo, primary, body, ruleIndex, rule.MaxHedgeRate)
+	if hedge == nil {
+		<-primary.done
+		return finishHedge(c, relayInfo, primary)
+	}
+
+	primaryDone, hedgeDone := primary.done, hedge.done
+	for {
+		select {
+		case <-race.claimed:
+		case <-primaryDone:
+			primaryDone = nil
+		case <-hedgeDone:
+			hedgeDone = nil
+		}
+		if winner := race.getWinner(); winner != nil {
+			loser := primary
+			if winner == primary {
+				loser = hedge
+			}
+			loserFailed := isHedgeLegDone(loser)
+			loser.cancel()
+			<-winner.done
+			if loserFailed {
+				reportFailedHedgeLeg(loser)
+			}
+			go func() {
+				<-loser.done
+				loser.release()
+			}()
+			return finishHedge(c, relayInfo, winner)
+		}
+		if primaryDone == nil && hedgeDone == nil {
+			// 双方都在输出首字节前失败，按主请求的错误进入重试
+			reportFailedHedgeLeg(hedge)
+			hedge.release()
+			return finishHedge(c, relayInfo, primary)
+		}
+	}
+}
+
+func startHedgeLeg(c *gin.Context, race *hedgeRace, relayFormat types.RelayFormat, relayInfo *relaycommon.RelayInfo, primary *hedgeLeg, body []byte, ruleIndex int, maxHedgeRate float64) *hedgeLeg {
+	if !service.TryAcquireHedge(ruleIndex, maxHedgeRate) {
+		return nil
+	}
+	hedge, err := newHedgeLeg(c, race, relayInfo, body)
+	if err != nil {
+		return nil
+	}
+	channel, err := selectHedgeChannel(hedge, primary.channel.Id)
+	if err != nil {
+		logger.LogDebug(c, fmt.Sprintf("hedge skipped: %s", err.Error()))
+		hedge.release()
+		return nil
+	}
+	hedge.channel = channel
+	hedge.overheadCost = service.EstimateHedgeOverheadCost(hedge.info, channel.GetOtherSettings())
+	if !race.addLeg(hedge) {
+		hedge.release()
+		return nil
+	}
+	logger.LogInfo(c, fmt.Sprintf("no first byte from channel #%d after %s, hedging to channel #%d", primary.channel.Id, time.Since(primary.start).Round(time.Millisecond), channel.Id))
+	runHedgeLeg(race, hedge, relayFormat)
+	return hedge
+}
+
+func isHedgeLegDone(leg *hedgeLeg) bool {
+	select {
+	case <-leg.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// reportFailedHedgeLeg 在胜负分出前已经失败的一方仍按渠道错误处理（自动禁用等）
+func reportFailedHedgeLeg(leg *hedgeLeg) {
+	if leg.err == nil {
+		return
+	}
+	processChannelError(leg.c, *types.NewChannelError(leg.channel.Id, leg.channel.Type, leg.channel.Name, leg.channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(leg.c, constant.ContextKeyChannelKey), leg.channel.GetAutoBan()), leg.err)
+}
+
+// finishHedge 将最终采用的一方的上下文与 RelayInfo 写回原请求
+func finishHedge(c *gin.Context, relayInfo *relaycommon.RelayInfo, result *hedgeLeg) (*model.Channel, *types.NewAPIError) {
+	for key, value := range result.c.Keys {
+		if key == common.KeyBodyStorage || key == string(constant.ContextKeyHedgeLeg) || key == string(constant.ContextKeyHedgeLost) {
+			continue
+		}
+		c.Set(key, value)
+	}
+	disablePing := relayInfo.DisablePing
+	*relayInfo = *result.info
+	relayInfo.DisablePing = disablePing
+	result.release()
+	return result.channel, result.err
+}
@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHedgeWriterFirstByteWins(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+
+	race := &hedgeRace{claimed: make(chan struct{})}
+	primary := &hedgeLeg{c: c.Copy(), info: &relaycommon.RelayInfo{OriginModelName: "gpt-test"}, channel: &model.Channel{Id: 1}, overheadCost: 7}
+	hedge := &hedgeLeg{c: c.Copy(), info: &relaycommon.RelayInfo{OriginModelName: "gpt-test"}, channel: &model.Channel{Id: 2}, overheadCost: 11}
+	require.True(t, race.addLeg(primary))
+	require.True(t, race.addLeg(hedge))
+
+	primaryOut := &hedgeWriter{ResponseWriter: c.Writer, race: race, leg: primary, header: http.Header{}}
+	hedgeOut := &hedgeWriter{ResponseWriter: c.Writer, race: race, leg: hedge, header: http.Header{}}
+
+	// 写入首字节前的响应头只保存在各自的副本中
+	primaryOut.Header().Set("X-Leg", "primary")
+	hedgeOut.Header().Set("X-Leg", "hedge")
+	hedgeOut.WriteHeader(http.StatusAccepted)
+	assert.False(t, hedgeOut.Written())
+	assert.Empty(t, recorder.Header().Get("X-Leg"))
+
+	_, err := hedgeOut.WriteString("data: hello\n\n")
+	require.NoError(t, err)
+	_, err = primaryOut.Write([]byte("data: late\n\n"))
+	assert.ErrorIs(t, err, errHedgeLost)
+	assert.False(t, race.addLeg(&hedgeLeg{}))
+
+	assert.Same(t, hedge, race.getWinner())
+	assert.Equal(t, http.StatusAccepted, recorder.Code)
+	assert.Equal(t, "hedge", recorder.Header().Get("X-Leg"))
+	assert.Equal(t, "data: hello\n\n", recorder.Body.String())
+	require.NotNil(t, hedge.info.Hedge)
+	assert.True(t, hedge.info.Hedge.HedgeWon)
+	assert.Equal(t, 1, hedge.info.Hedge.PrimaryChannelId)
+	assert.Equal(t, 2, hedge.info.Hedge.HedgeChannelId)
+	assert.Equal(t, 7, hedge.info.Hedge.OverheadCost)
+	assert.Nil(t, primary.info.Hedge)
+
+	// 落败方被标记，不再结算
+	assert.True(t, service.IsLostHedgeLeg(primary.c))
+	assert.False(t, service.IsLostHedgeLeg(hedge.c))
+}
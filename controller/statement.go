@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetUserStatements 当前用户的历史对账单
+func GetUserStatements(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	statements, total, err := model.GetStatements(c.GetInt("id"), c.Query("period"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(statements)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// GetAllStatements 管理员查看对账单，可按用户与账期过滤
+func GetAllStatements(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	statements, total, err := model.GetStatements(userId, c.Query("period"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(statements)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// GetUserStatement 当前用户的对账单详情
+func GetUserStatement(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	statement, err := model.GetUserStatementById(c.GetInt("id"), id)
+	if err != nil {
+		common.ApiErrorMsg(c, "对账单不存在")
+		return
+	}
+	respondStatementDetail(c, statement)
+}
+
+func GetStatement(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	statement, err := model.GetStatementById(id)
+	if err != nil {
+		common.ApiErrorMsg(c, "对账单不存在")
+		return
+	}
+	respondStatementDetail(c, statement)
+}
+
+func respondStatementDetail(c *gin.Context, statement *model.Statement) {
+	details, err := statement.GetDetails()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"statement": statement,
+		"details":   details,
+	})
+}
+
+// DownloadUserStatement 下载当前用户的对账单，format=csv|html|pdf
+func DownloadUserStatement(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	statement, err := model.GetUserStatementById(c.GetInt("id"), id)
+	if err != nil {
+		common.ApiErrorMsg(c, "对账单不存在")
+		return
+	}
+	writeStatementFile(c, statement)
+}
+
+func DownloadStatement(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	statement, err := model.GetStatementById(id)
+	if err != nil {
+		common.ApiErrorMsg(c, "对账单不存在")
+		return
+	}
+	writeStatementFile(c, statement)
+}
+
+func writeStatementFile(c *gin.Context, statement *model.Statement) {
+	var (
+		data        []byte
+		err         error
+		contentType string
+		ext         string
+	)
+	switch c.DefaultQuery("format", "html") {
+	case "csv":
+		data, err = service.RenderStatementCSV(statement)
+		contentType, ext = "text/csv; charset=utf-8", "csv"
+	case "html":
+		data, err = service.RenderStatementHTML(statement)
+		contentType, ext = "text/html; charset=utf-8", "html"
+	case "pdf":
+		data, err = service.RenderStatementPDF(statement)
+		contentType, ext = "application/pdf", "pdf"
+	default:
+		common.ApiErrorMsg(c, "不支持的格式")
+		return
+	}
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	disposition := "attachment"
+	if ext == "html" && c.Query("inline") == "true" {
+		disposition = "inline"
+	}
+	c.Header("Content-Disposition", disposition+`; filename="`+statement.InvoiceNo+"."+ext+`"`)
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// GenerateStatement 管理员为指定用户生成账期对账单，已出账时生成新的修订版；不指定用户时为账期内所有活跃用户补齐
+func GenerateStatement(c *gin.Context) {
+	var req struct {
+		UserId int    `json:"user_id"`
+		Period string `json:"period"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.UserId == 0 {
+		generated, err := service.CloseStatementPeriod(c.Request.Context(), req.Period)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		common.ApiSuccess(c, gin.H{"generated": generated})
+		return
+	}
+	statement, err := service.GenerateStatement(req.UserId, req.Period)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, statement)
+}
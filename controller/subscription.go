@@ -6,6 +6,7 @@ import (
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -293,6 +294,7 @@ func AdminBindSubscription(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	service.RecordAudit(c, service.AuditActionSubscriptionBind, service.AuditTargetSubscription, req.UserId, nil, map[string]any{"user_id": req.UserId, "plan_id": req.PlanId})
 	if msg != "" {
 		common.ApiSuccess(c, gin.H{"message": msg})
 		return
@@ -337,6 +339,7 @@ func AdminCreateUserSubscription(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	service.RecordAudit(c, service.AuditActionSubscriptionBind, service.AuditTargetSubscription, userId, nil, map[string]any{"user_id": userId, "plan_id": req.PlanId})
 	if msg != "" {
 		common.ApiSuccess(c, gin.H{"message": msg})
 		return
@@ -1,11 +1,16 @@
 package controller
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
 	"strconv"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/relay"
 	"github.com/QuantumNous/new-api/service"
@@ -92,3 +97,22 @@ func tasksToDto(tasks []*model.Task, fillUser bool) []*dto.TaskDto {
 	}
 	return result
 }
+
+// TaskUpstreamCallback 接收上游任务状态推送，URL 中的 token 由任务 ID 派生，无需其他鉴权
+func TaskUpstreamCallback(c *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": "read body failed"})
+		return
+	}
+	err = service.HandleTaskCallback(c.Request.Context(), c.Param("platform"), c.Param("task_id"), c.Param("token"), body)
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "ok"})
+	case errors.Is(err, service.ErrTaskCallbackInvalidToken):
+		c.JSON(http.StatusForbidden, gin.H{"code": 1, "message": err.Error()})
+	default:
+		logger.LogWarn(c.Request.Context(), fmt.Sprintf("task callback %s failed: %s", c.Param("task_id"), err.Error()))
+		c.JSON(http.StatusBadRequest, gin.H{"code": 1, "message": err.Error()})
+	}
+}
@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/relay"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// cancelUserTask 取消当前用户的任务，task 为 nil 时表示任务不存在
+func cancelUserTask(c *gin.Context, task *model.Task) *dto.TaskError {
+	if task == nil {
+		return service.TaskErrorWrapperLocal(errors.New("task_not_exist"), "task_not_exist", http.StatusNotFound)
+	}
+	err := service.CancelTask(c.Request.Context(), task)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, service.ErrTaskCancelDisabled):
+		return service.TaskErrorWrapperLocal(err, "task_cancel_disabled", http.StatusForbidden)
+	case errors.Is(err, service.ErrTaskNotCancellable):
+		return service.TaskErrorWrapperLocal(err, "task_not_cancellable", http.StatusConflict)
+	case errors.Is(err, service.ErrTaskCancelUnsupported):
+		return service.TaskErrorWrapperLocal(err, "task_cancel_unsupported", http.StatusBadRequest)
+	default:
+		return service.TaskErrorWrapper(err, "task_cancel_failed", http.StatusBadGateway)
+	}
+}
+
+func getUserTask(c *gin.Context, taskId string) (*model.Task, *dto.TaskError) {
+	task, exist, err := model.GetByTaskId(c.GetInt("id"), taskId)
+	if err != nil {
+		return nil, service.TaskErrorWrapper(err, "get_task_failed", http.StatusInternalServerError)
+	}
+	if !exist {
+		return nil, nil
+	}
+	return task, nil
+}
+
+// CancelSelfTask 控制台取消任务
+func CancelSelfTask(c *gin.Context) {
+	task, taskErr := getUserTask(c, c.Param("task_id"))
+	if taskErr == nil {
+		taskErr = cancelUserTask(c, task)
+	}
+	if taskErr != nil {
+		common.ApiErrorMsg(c, taskErr.Message)
+		return
+	}
+	common.ApiSuccess(c, relay.TaskModel2Dto(task))
+}
+
+// RelayVideoCancel 取消视频任务，返回 OpenAI 视频对象
+func RelayVideoCancel(c *gin.Context) {
+	task, taskErr := getUserTask(c, c.Param("task_id"))
+	if taskErr == nil {
+		taskErr = cancelUserTask(c, task)
+	}
+	if taskErr != nil {
+		respondTaskError(c, taskErr)
+		return
+	}
+	c.JSON(http.StatusOK, task.ToOpenAIVideo())
+}
@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetSelfTaskWebhookDeliveries 用户查看自己的任务回调投递记录
+func GetSelfTaskWebhookDeliveries(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	deliveries, total, err := model.GetTaskWebhookDeliveries(c.GetInt("id"), c.Query("task_id"), c.Query("status"), pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(deliveries)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// GetAllTaskWebhookDeliveries 管理员查看全部回调投递记录
+func GetAllTaskWebhookDeliveries(c *gin.Context) {
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	pageInfo := common.GetPageQuery(c)
+	deliveries, total, err := model.GetTaskWebhookDeliveries(userId, c.Query("task_id"), c.Query("status"), pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(deliveries)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// RetrySelfTaskWebhookDelivery 重新投递一条回调
+func RetrySelfTaskWebhookDelivery(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	delivery, err := model.GetTaskWebhookDeliveryById(id)
+	if err != nil || delivery.UserId != c.GetInt("id") {
+		common.ApiErrorMsg(c, "投递记录不存在")
+		return
+	}
+	if delivery.Status == model.TaskWebhookStatusPending {
+		common.ApiErrorMsg(c, "该记录正在等待投递")
+		return
+	}
+	if err := service.RetryTaskWebhookDelivery(delivery); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, delivery)
+}
@@ -97,6 +97,7 @@ func setupLogin(user *model.User, c *gin.Context) {
 		common.ApiErrorI18n(c, i18n.MsgUserSessionSaveFailed)
 		return
 	}
+	service.RecordLoginIp(user.Id, c.ClientIP())
 	c.JSON(http.StatusOK, gin.H{
 		"message": "",
 		"success": true,
@@ -575,6 +576,9 @@ func UpdateUser(c *gin.Context) {
 	if originUser.Quota != updatedUser.Quota {
 		model.RecordLog(originUser.Id, model.LogTypeManage, fmt.Sprintf("管理员将用户额度从 %s修改为 %s", logger.LogQuota(originUser.Quota), logger.LogQuota(updatedUser.Quota)))
 	}
+	if newUser, err := model.GetUserById(updatedUser.Id, false); err == nil {
+		service.RecordAudit(c, service.AuditActionUserUpdate, service.AuditTargetUser, updatedUser.Id, originUser, newUser)
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -776,6 +780,7 @@ func DeleteUser(c *gin.Context) {
 		})
 		return
 	}
+	service.RecordAudit(c, service.AuditActionUserDelete, service.AuditTargetUser, id, originUser, nil)
 }
 
 func DeleteSelf(c *gin.Context) {
@@ -830,6 +835,11 @@ func CreateUser(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	service.RecordAudit(c, service.AuditActionUserCreate, service.AuditTargetUser, cleanUser.Id, nil, map[string]any{
+		"username":     cleanUser.Username,
+		"display_name": cleanUser.DisplayName,
+		"role":         cleanUser.Role,
+	})
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -866,6 +876,7 @@ func ManageUser(c *gin.Context) {
 		common.ApiErrorI18n(c, i18n.MsgUserNoPermissionHigherLevel)
 		return
 	}
+	originUser := user
 	switch req.Action {
 	case "disable":
 		user.Status = common.UserStatusDisabled
@@ -913,6 +924,9 @@ func ManageUser(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	service.RecordAudit(c, service.AuditActionUserManage+"."+req.Action, service.AuditTargetUser, user.Id,
+		map[string]any{"role": originUser.Role, "status": originUser.Status},
+		map[string]any{"role": user.Role, "status": user.Status})
 	clearUser := model.User{
 		Role:   user.Role,
 		Status: user.Status,
@@ -1054,6 +1068,58 @@ type UpdateUserSettingRequest struct {
 	UpstreamModelUpdateNotifyEnabled *bool   `json:"upstream_model_update_notify_enabled,omitempty"`
 	AcceptUnsetModelRatioModel       bool    `json:"accept_unset_model_ratio_model"`
 	RecordIpLog                      bool    `json:"record_ip_log"`
+
+	SlackWebhookUrl    string          `json:"slack_webhook_url,omitempty"`
+	DiscordWebhookUrl  string          `json:"discord_webhook_url,omitempty"`
+	TelegramBotToken   string          `json:"telegram_bot_token,omitempty"`
+	TelegramChatId     string          `json:"telegram_chat_id,omitempty"`
+	FeishuWebhookUrl   string          `json:"feishu_webhook_url,omitempty"`
+	FeishuSecret       string          `json:"feishu_secret,omitempty"`
+	DingTalkWebhookUrl string          `json:"dingtalk_webhook_url,omitempty"`
+	DingTalkSecret     string          `json:"dingtalk_secret,omitempty"`
+	WeComWebhookUrl    string          `json:"wecom_webhook_url,omitempty"`
+	NtfyUrl            string          `json:"ntfy_url,omitempty"`
+	NtfyToken          string          `json:"ntfy_token,omitempty"`
+	NotifyEvents       map[string]bool `json:"notify_events,omitempty"`
+}
+
+// filterNotifyEvents 只保留事件目录中存在且当前用户可订阅的事件
+func filterNotifyEvents(events map[string]bool, isAdmin bool) map[string]bool {
+	if len(events) == 0 {
+		return nil
+	}
+	filtered := make(map[string]bool, len(events))
+	for event, subscribed := range events {
+		info, ok := dto.GetNotifyEventInfo(event)
+		if !ok || (info.AdminOnly && !isAdmin) {
+			continue
+		}
+		filtered[event] = subscribed
+	}
+	return filtered
+}
+
+// GetNotifyEvents 返回当前用户可订阅的通知事件及订阅状态
+func GetNotifyEvents(c *gin.Context) {
+	user, err := model.GetUserById(c.GetInt("id"), false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	setting := user.GetSetting()
+	isAdmin := user.Role >= common.RoleAdminUser
+	type notifyEventItem struct {
+		dto.NotifyEventInfo
+		Subscribed bool `json:"subscribed"`
+	}
+	items := make([]notifyEventItem, 0, len(dto.NotifyEventCatalog))
+	for _, info := range dto.NotifyEventCatalog {
+		if info.AdminOnly && !isAdmin {
+			continue
+		}
+		items = append(items, notifyEventItem{NotifyEventInfo: info, Subscribed: setting.IsSubscribed(info.Event)})
+	}
+	common.ApiSuccess(c, items)
 }
 
 func UpdateUserSetting(c *gin.Context) {
@@ -1064,7 +1130,7 @@ func UpdateUserSetting(c *gin.Context) {
 	}
 
 	// 验证预警类型
-	if req.QuotaWarningType != dto.NotifyTypeEmail && req.QuotaWarningType != dto.NotifyTypeWebhook && req.QuotaWarningType != dto.NotifyTypeBark && req.QuotaWarningType != dto.NotifyTypeGotify {
+	if _, ok := service.GetNotifier(req.QuotaWarningType); !ok {
 		common.ApiErrorI18n(c, i18n.MsgSettingInvalidType)
 		return
 	}
@@ -1156,6 +1222,7 @@ func UpdateUserSetting(c *gin.Context) {
 		UpstreamModelUpdateNotifyEnabled: upstreamModelUpdateNotifyEnabled,
 		AcceptUnsetRatioModel:            req.AcceptUnsetModelRatioModel,
 		RecordIpLog:                      req.RecordIpLog,
+		NotifyEvents:                     filterNotifyEvents(req.NotifyEvents, user.Role >= common.RoleAdminUser),
 	}
 
 	// 如果是webhook类型,添加webhook相关设置
@@ -1188,6 +1255,32 @@ func UpdateUserSetting(c *gin.Context) {
 		}
 	}
 
+	// 其他通知渠道
+	switch req.QuotaWarningType {
+	case dto.NotifyTypeSlack:
+		settings.SlackWebhookUrl = req.SlackWebhookUrl
+	case dto.NotifyTypeDiscord:
+		settings.DiscordWebhookUrl = req.DiscordWebhookUrl
+	case dto.NotifyTypeTelegram:
+		settings.TelegramBotToken = req.TelegramBotToken
+		settings.TelegramChatId = req.TelegramChatId
+	case dto.NotifyTypeFeishu:
+		settings.FeishuWebhookUrl = req.FeishuWebhookUrl
+		settings.FeishuSecret = req.FeishuSecret
+	case dto.NotifyTypeDingTalk:
+		settings.DingTalkWebhookUrl = req.DingTalkWebhookUrl
+		settings.DingTalkSecret = req.DingTalkSecret
+	case dto.NotifyTypeWeCom:
+		settings.WeComWebhookUrl = req.WeComWebhookUrl
+	case dto.NotifyTypeNtfy:
+		settings.NtfyUrl = req.NtfyUrl
+		settings.NtfyToken = req.NtfyToken
+	}
+	if err := service.ValidateNotifySetting(req.QuotaWarningType, settings); err != nil {
+		common.ApiErrorMsg(c, err.Error())
+		return
+	}
+
 	// 更新用户设置
 	user.SetSetting(settings)
 	if err := user.Update(false); err != nil {
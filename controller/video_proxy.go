@@ -1,8 +1,10 @@
 package controller
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -55,73 +57,21 @@ func VideoProxy(c *gin.Context) {
 		return
 	}
 
-	channel, err := model.CacheGetChannel(task.ChannelId)
-	if err != nil {
-		logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to get channel for task %s: %s", taskID, err.Error()))
-		videoProxyError(c, http.StatusInternalServerError, "server_error", "Failed to retrieve channel information")
-		return
-	}
-	baseURL := channel.GetBaseURL()
-	if baseURL == "" {
-		baseURL = "https://api.openai.com"
-	}
-
-	var videoURL string
-	proxy := channel.GetSetting().Proxy
-	client, err := service.GetHttpClientWithProxy(proxy)
-	if err != nil {
-		logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to create proxy client for task %s: %s", taskID, err.Error()))
-		videoProxyError(c, http.StatusInternalServerError, "server_error", "Failed to create proxy client")
-		return
-	}
-
-	ctx, cancel := context.WithTimeout(c.Request.Context(), 60*time.Second)
-	defer cancel()
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "", nil)
-	if err != nil {
-		logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to create request: %s", err.Error()))
-		videoProxyError(c, http.StatusInternalServerError, "server_error", "Failed to create proxy request")
-		return
-	}
-
-	switch channel.Type {
-	case constant.ChannelTypeGemini:
-		apiKey := task.PrivateData.Key
-		if apiKey == "" {
-			logger.LogError(c.Request.Context(), fmt.Sprintf("Missing stored API key for Gemini task %s", taskID))
-			videoProxyError(c, http.StatusInternalServerError, "server_error", "API key not stored for task")
-			return
-		}
-		videoURL, err = getGeminiVideoURL(channel, task, apiKey)
-		if err != nil {
-			logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to resolve Gemini video URL for task %s: %s", taskID, err.Error()))
-			videoProxyError(c, http.StatusBadGateway, "server_error", "Failed to resolve Gemini video URL")
+	if obj := service.FindPersistedMedia(model.MediaSourceTask, task.TaskID); obj != nil {
+		if serveMediaObject(c, obj) {
 			return
 		}
-		req.Header.Set("x-goog-api-key", apiKey)
-	case constant.ChannelTypeVertexAi:
-		videoURL, err = getVertexVideoURL(channel, task)
-		if err != nil {
-			logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to resolve Vertex video URL for task %s: %s", taskID, err.Error()))
-			videoProxyError(c, http.StatusBadGateway, "server_error", "Failed to resolve Vertex video URL")
-			return
-		}
-	case constant.ChannelTypeOpenAI, constant.ChannelTypeSora:
-		videoURL = fmt.Sprintf("%s/v1/videos/%s/content", baseURL, task.GetUpstreamTaskID())
-		req.Header.Set("Authorization", "Bearer "+channel.Key)
-	default:
-		// Video URL is stored in PrivateData.ResultURL (fallback to FailReason for old data)
-		videoURL = task.GetResultURL()
 	}
 
-	videoURL = strings.TrimSpace(videoURL)
-	if videoURL == "" {
-		logger.LogError(c.Request.Context(), fmt.Sprintf("Video URL is empty for task %s", taskID))
-		videoProxyError(c, http.StatusBadGateway, "server_error", "Failed to fetch video content")
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 60*time.Second)
+	defer cancel()
+	client, req, videoURL, perr := buildTaskContentRequest(ctx, task)
+	if perr != nil {
+		logger.LogError(c.Request.Context(), fmt.Sprintf("Task %s: %s", taskID, perr.logMsg))
+		videoProxyError(c, perr.status, perr.errType, perr.message)
 		return
 	}
-
-	if strings.HasPrefix(videoURL, "data:") {
+	if req == nil {
 		if err := writeVideoDataURL(c, videoURL); err != nil {
 			logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to decode video data URL for task %s: %s", taskID, err.Error()))
 			videoProxyError(c, http.StatusBadGateway, "server_error", "Failed to fetch video content")
@@ -129,20 +79,6 @@ func VideoProxy(c *gin.Context) {
 		return
 	}
 
-	fetchSetting := system_setting.GetFetchSetting()
-	if err := common.ValidateURLWithFetchSetting(videoURL, fetchSetting.EnableSSRFProtection, fetchSetting.AllowPrivateIp, fetchSetting.DomainFilterMode, fetchSetting.IpFilterMode, fetchSetting.DomainList, fetchSetting.IpList, fetchSetting.AllowedPorts, fetchSetting.ApplyIPFilterForDomain); err != nil {
-		logger.LogError(c.Request.Context(), fmt.Sprintf("Video URL blocked for task %s: %v", taskID, err))
-		videoProxyError(c, http.StatusForbidden, "server_error", fmt.Sprintf("request blocked: %v", err))
-		return
-	}
-
-	req.URL, err = url.Parse(videoURL)
-	if err != nil {
-		logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to parse URL %s: %s", videoURL, err.Error()))
-		videoProxyError(c, http.StatusInternalServerError, "server_error", "Failed to create proxy request")
-		return
-	}
-
 	resp, err := client.Do(req)
 	if err != nil {
 		logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to fetch video from %s: %s", videoURL, err.Error()))
@@ -203,3 +139,114 @@ func writeVideoDataURL(c *gin.Context, dataURL string) error {
 	_, err = c.Writer.Write(videoBytes)
 	return err
 }
+
+type taskContentError struct {
+	status  int
+	errType string
+	message string
+	logMsg  string
+}
+
+// buildTaskContentRequest 解析任务结果的上游地址并构造带鉴权的请求；结果为 data URL 时 req 为 nil
+func buildTaskContentRequest(ctx context.Context, task *model.Task) (*http.Client, *http.Request, string, *taskContentError) {
+	channel, err := model.CacheGetChannel(task.ChannelId)
+	if err != nil {
+		return nil, nil, "", &taskContentError{http.StatusInternalServerError, "server_error", "Failed to retrieve channel information",
+			fmt.Sprintf("Failed to get channel: %s", err.Error())}
+	}
+	baseURL := channel.GetBaseURL()
+	if baseURL == "" {
+		baseURL = "https://api.openai.com"
+	}
+
+	var videoURL string
+	proxy := channel.GetSetting().Proxy
+	client, err := service.GetHttpClientWithProxy(proxy)
+	if err != nil {
+		return nil, nil, "", &taskContentError{http.StatusInternalServerError, "server_error", "Failed to create proxy client",
+			fmt.Sprintf("Failed to create proxy client: %s", err.Error())}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "", nil)
+	if err != nil {
+		return nil, nil, "", &taskContentError{http.StatusInternalServerError, "server_error", "Failed to create proxy request",
+			fmt.Sprintf("Failed to create request: %s", err.Error())}
+	}
+
+	switch channel.Type {
+	case constant.ChannelTypeGemini:
+		apiKey := task.PrivateData.Key
+		if apiKey == "" {
+			return nil, nil, "", &taskContentError{http.StatusInternalServerError, "server_error", "API key not stored for task",
+				"Missing stored API key for Gemini task"}
+		}
+		videoURL, err = getGeminiVideoURL(channel, task, apiKey)
+		if err != nil {
+			return nil, nil, "", &taskContentError{http.StatusBadGateway, "server_error", "Failed to resolve Gemini video URL",
+				fmt.Sprintf("Failed to resolve Gemini video URL: %s", err.Error())}
+		}
+		req.Header.Set("x-goog-api-key", apiKey)
+	case constant.ChannelTypeVertexAi:
+		videoURL, err = getVertexVideoURL(channel, task)
+		if err != nil {
+			return nil, nil, "", &taskContentError{http.StatusBadGateway, "server_error", "Failed to resolve Vertex video URL",
+				fmt.Sprintf("Failed to resolve Vertex video URL: %s", err.Error())}
+		}
+	case constant.ChannelTypeOpenAI, constant.ChannelTypeSora:
+		videoURL = fmt.Sprintf("%s/v1/videos/%s/content", baseURL, task.GetUpstreamTaskID())
+		req.Header.Set("Authorization", "Bearer "+channel.Key)
+	default:
+		// Video URL is stored in PrivateData.ResultURL (fallback to FailReason for old data)
+		videoURL = task.GetResultURL()
+	}
+
+	videoURL = strings.TrimSpace(videoURL)
+	if videoURL == "" {
+		return nil, nil, "", &taskContentError{http.StatusBadGateway, "server_error", "Failed to fetch video content", "Video URL is empty"}
+	}
+
+	if strings.HasPrefix(videoURL, "data:") {
+		return nil, nil, videoURL, nil
+	}
+
+	fetchSetting := system_setting.GetFetchSetting()
+	if err := common.ValidateURLWithFetchSetting(videoURL, fetchSetting.EnableSSRFProtection, fetchSetting.AllowPrivateIp, fetchSetting.DomainFilterMode, fetchSetting.IpFilterMode, fetchSetting.DomainList, fetchSetting.IpList, fetchSetting.AllowedPorts, fetchSetting.ApplyIPFilterForDomain); err != nil {
+		return nil, nil, "", &taskContentError{http.StatusForbidden, "server_error", fmt.Sprintf("request blocked: %v", err),
+			fmt.Sprintf("Video URL blocked: %v", err)}
+	}
+
+	req.URL, err = url.Parse(videoURL)
+	if err != nil {
+		return nil, nil, "", &taskContentError{http.StatusInternalServerError, "server_error", "Failed to create proxy request",
+			fmt.Sprintf("Failed to parse URL %s: %s", videoURL, err.Error())}
+	}
+	return client, req, videoURL, nil
+}
+
+// OpenTaskContent 打开任务结果内容，供持久化存储使用
+func OpenTaskContent(ctx context.Context, task *model.Task) (io.ReadCloser, string, error) {
+	client, req, videoURL, perr := buildTaskContentRequest(ctx, task)
+	if perr != nil {
+		return nil, "", errors.New(perr.logMsg)
+	}
+	if req == nil {
+		parts := strings.SplitN(videoURL, ",", 2)
+		if len(parts) != 2 || !strings.HasSuffix(parts[0], ";base64") {
+			return nil, "", errors.New("unsupported data url")
+		}
+		data, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return nil, "", err
+		}
+		return io.NopCloser(bytes.NewReader(data)), strings.TrimSuffix(strings.TrimPrefix(parts[0], "data:"), ";base64"), nil
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, "", fmt.Errorf("upstream returned status %d", resp.StatusCode)
+	}
+	return resp.Body, resp.Header.Get("Content-Type"), nil
+}
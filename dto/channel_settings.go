@@ -40,6 +40,54 @@ type ChannelOtherSettings struct {
 	UpstreamModelUpdateLastDetectedModels []string      `json:"upstream_model_update_last_detected_models,omitempty"` // 上次检测到的可加入模型
 	UpstreamModelUpdateLastRemovedModels  []string      `json:"upstream_model_update_last_removed_models,omitempty"`  // 上次检测到的可删除模型
 	UpstreamModelUpdateIgnoredModels      []string      `json:"upstream_model_update_ignored_models,omitempty"`       // 手动忽略的模型
+
+	// 上游成本：优先按模型价格计算，否则使用成本倍率（成本 = 不含分组倍率的计费额度 × 倍率）
+	UpstreamCostMultiplier float64                       `json:"upstream_cost_multiplier,omitempty"`
+	UpstreamModelPrices    map[string]UpstreamModelPrice `json:"upstream_model_prices,omitempty"`
+
+	// 余额监控：阈值为 0 时使用全局默认值，低于告警阈值通知管理员，低于下限时降权或禁用
+	BalanceAlertThreshold float64 `json:"balance_alert_threshold,omitempty"`
+	BalanceFloor          float64 `json:"balance_floor,omitempty"`
+	BalanceFloorAction    string  `json:"balance_floor_action,omitempty"` // deprioritize / disable
+	// 降权前的优先级与降权后的优先级，余额恢复后还原；期间优先级被手动修改时不再还原
+	BalanceOriginalPriority      *int64 `json:"balance_original_priority,omitempty"`
+	BalanceDeprioritizedPriority *int64 `json:"balance_deprioritized_priority,omitempty"`
+	// 因余额低于下限被自动禁用，余额恢复后自动启用
+	BalanceFloorDisabled bool `json:"balance_floor_disabled,omitempty"`
+
+	// 最大并发请求数，0 表示不限制。已满的渠道在选择时被跳过，全部已满时请求进入准入队列
+	MaxConcurrency int `json:"max_concurrency,omitempty"`
+	// 渠道整体与每个 key 的 RPM/TPM/并发上限，0 表示不限制。没有余量的 key 在选择时被跳过，
+	// 所有 key 都没有余量时渠道按并发已满处理
+	RPMLimit          int `json:"rpm_limit,omitempty"`
+	TPMLimit          int `json:"tpm_limit,omitempty"`
+	KeyRPMLimit       int `json:"key_rpm_limit,omitempty"`
+	KeyTPMLimit       int `json:"key_tpm_limit,omitempty"`
+	KeyMaxConcurrency int `json:"key_max_concurrency,omitempty"`
+}
+
+// UpstreamModelPrice 渠道上游的模型价格，token 价格单位为 美元/百万 token
+type UpstreamModelPrice struct {
+	Input      float64 `json:"input,omitempty"`
+	Output     float64 `json:"output,omitempty"`
+	CacheRead  float64 `json:"cache_read,omitempty"` // 未设置时按 Input 计算
+	PerRequest float64 `json:"per_request,omitempty"`
+}
+
+// GetUpstreamModelPrice 依次按给定模型名查找上游价格
+func (s *ChannelOtherSettings) GetUpstreamModelPrice(modelNames ...string) (UpstreamModelPrice, bool) {
+	if s == nil || len(s.UpstreamModelPrices) == 0 {
+		return UpstreamModelPrice{}, false
+	}
+	for _, name := range modelNames {
+		if name == "" {
+			continue
+		}
+		if price, ok := s.UpstreamModelPrices[name]; ok {
+			return price, true
+		}
+	}
+	return UpstreamModelPrice{}, false
 }
 
 func (s *ChannelOtherSettings) IsOpenRouterEnterprise() bool {
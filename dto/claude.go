@@ -557,6 +557,11 @@ type ClaudeUsage struct {
 	ServerToolUse               *ClaudeServerToolUse `json:"server_tool_use,omitempty"`
 }
 
+// ClaudeCountTokensResponse /v1/messages/count_tokens 的响应
+type ClaudeCountTokensResponse struct {
+	InputTokens int `json:"input_tokens"`
+}
+
 type ClaudeCacheCreationUsage struct {
 	Ephemeral5mInputTokens int `json:"ephemeral_5m_input_tokens,omitempty"`
 	Ephemeral1hInputTokens int `json:"ephemeral_1h_input_tokens,omitempty"`
@@ -2,6 +2,7 @@ package dto
 
 type Notify struct {
 	Type    string        `json:"type"`
+	Event   string        `json:"event,omitempty"` // 事件类型，用于订阅过滤；Type 还可能带有用于限流的后缀
 	Title   string        `json:"title"`
 	Content string        `json:"content"`
 	Values  []interface{} `json:"values"`
@@ -10,13 +11,79 @@ type Notify struct {
 const ContentValueParam = "{{value}}"
 
 const (
-	NotifyTypeQuotaExceed   = "quota_exceed"
-	NotifyTypeChannelUpdate = "channel_update"
-	NotifyTypeChannelTest   = "channel_test"
+	NotifyTypeQuotaExceed    = "quota_exceed"
+	NotifyTypeChannelUpdate  = "channel_update"
+	NotifyTypeChannelTest    = "channel_test"
+	NotifyTypeChannelBalance = "channel_balance"
 )
 
+// 可订阅的通知事件
+const (
+	NotifyEventQuotaExceed          = NotifyTypeQuotaExceed
+	NotifyEventTopUpSuccess         = "topup_success"
+	NotifyEventTokenExpiring        = "token_expiring"
+	NotifyEventTaskFailed           = "task_failed"
+	NotifyEventSubscriptionRenewing = "subscription_renewing"
+	NotifyEventSubscriptionExpired  = "subscription_expired"
+	NotifyEventLoginNewIp           = "login_new_ip"
+	NotifyEventChannelDisabled      = "channel_disabled"
+	NotifyEventChannelRecovered     = "channel_recovered"
+	NotifyEventChannelBalance       = NotifyTypeChannelBalance
+	NotifyEventChannelTest          = NotifyTypeChannelTest
+)
+
+// NotifyEventInfo 事件目录项
+type NotifyEventInfo struct {
+	Event     string `json:"event"`
+	Name      string `json:"name"`
+	AdminOnly bool   `json:"admin_only"`
+	Default   bool   `json:"default"`
+}
+
+var NotifyEventCatalog = []NotifyEventInfo{
+	{Event: NotifyEventQuotaExceed, Name: "额度不足", Default: true},
+	{Event: NotifyEventTopUpSuccess, Name: "充值成功", Default: true},
+	{Event: NotifyEventTokenExpiring, Name: "令牌即将过期", Default: true},
+	{Event: NotifyEventTaskFailed, Name: "异步任务失败", Default: false},
+	{Event: NotifyEventSubscriptionRenewing, Name: "订阅即将到期", Default: true},
+	{Event: NotifyEventSubscriptionExpired, Name: "订阅已到期", Default: true},
+	{Event: NotifyEventLoginNewIp, Name: "新 IP 登录", Default: true},
+	{Event: NotifyEventChannelDisabled, Name: "渠道被自动禁用", AdminOnly: true, Default: true},
+	{Event: NotifyEventChannelRecovered, Name: "渠道恢复启用", AdminOnly: true, Default: true},
+	{Event: NotifyEventChannelBalance, Name: "渠道余额不足", AdminOnly: true, Default: true},
+	{Event: NotifyEventChannelTest, Name: "渠道测试完成", AdminOnly: true, Default: true},
+}
+
+// GetNotifyEventInfo 返回事件目录项，未收录的事件返回 false
+func GetNotifyEventInfo(event string) (NotifyEventInfo, bool) {
+	for _, info := range NotifyEventCatalog {
+		if info.Event == event {
+			return info, true
+		}
+	}
+	return NotifyEventInfo{}, false
+}
+
+// IsSubscribed 用户是否订阅了事件，未收录的事件始终发送
+func (s UserSetting) IsSubscribed(event string) bool {
+	info, ok := GetNotifyEventInfo(event)
+	if !ok {
+		return true
+	}
+	if subscribed, ok := s.NotifyEvents[event]; ok {
+		return subscribed
+	}
+	return info.Default
+}
+
 func NewNotify(t string, title string, content string, values []interface{}) Notify {
+	return NewEventNotify(t, t, title, content, values)
+}
+
+// NewEventNotify 创建通知，t 为带限流后缀的类型，event 为事件类型
+func NewEventNotify(event string, t string, title string, content string, values []interface{}) Notify {
 	return Notify{
+		Event:   event,
 		Type:    t,
 		Title:   title,
 		Content: content,
@@ -8,6 +8,9 @@ const (
 	RealtimeEventTypeConversationCreate = "conversation.item.create"
 	RealtimeEventTypeResponseCreate     = "response.create"
 	RealtimeEventInputAudioBufferAppend = "input_audio_buffer.append"
+	RealtimeEventInputAudioBufferCommit = "input_audio_buffer.commit"
+	RealtimeEventInputAudioBufferClear  = "input_audio_buffer.clear"
+	RealtimeEventTypeResponseCancel     = "response.cancel"
 )
 
 const (
@@ -21,6 +24,16 @@ const (
 	RealtimeEventConversationItemCreated            = "conversation.item.created"
 )
 
+const (
+	RealtimeEventResponseCreated                  = "response.created"
+	RealtimeEventResponseTextDelta                = "response.text.delta"
+	RealtimeEventInputAudioBufferCommitted        = "input_audio_buffer.committed"
+	RealtimeEventInputAudioBufferCleared          = "input_audio_buffer.cleared"
+	RealtimeEventInputAudioBufferSpeechStarted    = "input_audio_buffer.speech_started"
+	RealtimeEventInputAudioTranscriptionDelta     = "conversation.item.input_audio_transcription.delta"
+	RealtimeEventInputAudioTranscriptionCompleted = "conversation.item.input_audio_transcription.completed"
+)
+
 type RealtimeEvent struct {
 	EventId string `json:"event_id"`
 	Type    string `json:"type"`
@@ -31,10 +44,22 @@ type RealtimeEvent struct {
 	Response *RealtimeResponse  `json:"response,omitempty"`
 	Delta    string             `json:"delta,omitempty"`
 	Audio    string             `json:"audio,omitempty"`
+
+	ResponseId string `json:"response_id,omitempty"`
+	ItemId     string `json:"item_id,omitempty"`
+	CallId     string `json:"call_id,omitempty"`
+	Name       string `json:"name,omitempty"`
+	Arguments  string `json:"arguments,omitempty"`
+	Transcript string `json:"transcript,omitempty"`
 }
 
 type RealtimeResponse struct {
 	Usage *RealtimeUsage `json:"usage"`
+
+	Id     string         `json:"id,omitempty"`
+	Object string         `json:"object,omitempty"`
+	Status string         `json:"status,omitempty"`
+	Output []RealtimeItem `json:"output,omitempty"`
 }
 
 type RealtimeUsage struct {
@@ -79,6 +104,9 @@ type RealtimeItem struct {
 	Name      *string           `json:"name,omitempty"`
 	ToolCalls any               `json:"tool_calls,omitempty"`
 	CallId    string            `json:"call_id,omitempty"`
+
+	Arguments string `json:"arguments,omitempty"`
+	Output    string `json:"output,omitempty"`
 }
 type RealtimeContent struct {
 	Type       string `json:"type"`
@@ -16,6 +16,21 @@ type UserSetting struct {
 	SidebarModules                   string  `json:"sidebar_modules,omitempty"`                      // SidebarModules 左侧边栏模块配置
 	BillingPreference                string  `json:"billing_preference,omitempty"`                   // BillingPreference 扣费策略（订阅/钱包）
 	Language                         string  `json:"language,omitempty"`                             // Language 用户语言偏好 (zh, en)
+
+	// 其他通知渠道
+	SlackWebhookUrl    string `json:"slack_webhook_url,omitempty"`    // Slack Incoming Webhook 地址
+	DiscordWebhookUrl  string `json:"discord_webhook_url,omitempty"`  // Discord Webhook 地址
+	TelegramBotToken   string `json:"telegram_bot_token,omitempty"`   // Telegram 机器人 Token
+	TelegramChatId     string `json:"telegram_chat_id,omitempty"`     // Telegram 接收消息的 chat_id
+	FeishuWebhookUrl   string `json:"feishu_webhook_url,omitempty"`   // 飞书自定义机器人 Webhook 地址
+	FeishuSecret       string `json:"feishu_secret,omitempty"`        // 飞书机器人签名密钥（可选）
+	DingTalkWebhookUrl string `json:"dingtalk_webhook_url,omitempty"` // 钉钉自定义机器人 Webhook 地址
+	DingTalkSecret     string `json:"dingtalk_secret,omitempty"`      // 钉钉机器人加签密钥（可选）
+	WeComWebhookUrl    string `json:"wecom_webhook_url,omitempty"`    // 企业微信群机器人 Webhook 地址
+	NtfyUrl            string `json:"ntfy_url,omitempty"`             // ntfy 主题地址，例如 https://ntfy.sh/my-topic
+	NtfyToken          string `json:"ntfy_token,omitempty"`           // ntfy 访问令牌（可选）
+
+	NotifyEvents map[string]bool `json:"notify_events,omitempty"` // 事件订阅，未设置的事件使用默认值
 }
 
 var (
@@ -23,4 +38,12 @@ var (
 	NotifyTypeWebhook = "webhook" // Webhook
 	NotifyTypeBark    = "bark"    // Bark 推送
 	NotifyTypeGotify  = "gotify"  // Gotify 推送
+
+	NotifyTypeSlack    = "slack"    // Slack
+	NotifyTypeDiscord  = "discord"  // Discord
+	NotifyTypeTelegram = "telegram" // Telegram
+	NotifyTypeFeishu   = "feishu"   // 飞书
+	NotifyTypeDingTalk = "dingtalk" // 钉钉
+	NotifyTypeWeCom    = "wecom"    // 企业微信
+	NotifyTypeNtfy     = "ntfy"     // ntfy
 )
@@ -7,8 +7,10 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
@@ -90,6 +92,9 @@ func main() {
 		go model.SyncChannelCache(common.SyncFrequency)
 	}
 
+	// 跨节点缓存失效事件，定时同步作为兜底
+	model.StartCacheEventBus()
+
 	// 热更新配置
 	go model.SyncOptions(common.SyncFrequency)
 
@@ -121,13 +126,35 @@ func main() {
 		return a
 	}
 
+	// 任务结果内容需要渠道鉴权，由 controller 解析
+	service.OpenTaskContentFunc = controller.OpenTaskContent
+
+	// Expired media object cleanup
+	service.StartMediaCleanupTask()
+
+	// Usage analytics rollups
+	service.StartUsageRollupTask()
+	// 收到退出信号时先刷新内存中的用量汇总再退出
+	gopool.Go(func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		<-quit
+		service.FlushUsageRollupsOnExit()
+		os.Exit(0)
+	})
+
+	// Monthly statements
+	service.StartStatementCloseTask()
+	service.StartNotifyEventTask()
+
+	// Task status callbacks to user-provided URLs
+	service.StartTaskWebhookDispatcher()
+
 	// Channel upstream model update check task
 	controller.StartChannelUpstreamModelUpdateTask()
 
-	if common.IsMasterNode && constant.UpdateTask {
-		gopool.Go(func() {
-			controller.UpdateMidjourneyTaskBulk()
-		})
+	// 任务轮询通过租约选主，任意节点均可接管
+	if constant.UpdateTask {
 		gopool.Go(func() {
 			controller.UpdateTaskBulk()
 		})
@@ -99,7 +99,18 @@ func Distribute() func(c *gin.Context) {
 					}
 				}
 
-				if preferredChannelID, found := service.GetPreferredChannelByAffinity(c, modelRequest.Model, usingGroup); found {
+				// 虚拟路由模型在解析请求后才能确定实际模型，由 relay 选择渠道
+				_, isRouterModel := service.GetRouterModel(c, modelRequest.Model)
+				if isRouterModel && !service.SupportsModelRouting(c.Request.URL.Path) {
+					abortWithOpenAiMessage(c, http.StatusServiceUnavailable, i18n.T(c, i18n.MsgDistributorNoAvailableChannel, map[string]any{"Group": usingGroup, "Model": modelRequest.Model}), types.ErrorCodeModelNotFound)
+					return
+				}
+
+				preferredChannelID, found := 0, false
+				if !isRouterModel {
+					preferredChannelID, found = service.GetPreferredChannelByAffinity(c, modelRequest.Model, usingGroup)
+				}
+				if found {
 					preferred, err := model.CacheGetChannel(preferredChannelID)
 					if err == nil && preferred != nil {
 						if preferred.Status != common.ChannelStatusEnabled {
@@ -127,13 +138,22 @@ func Distribute() func(c *gin.Context) {
 					}
 				}
 
-				if channel == nil {
+				if channel == nil && !isRouterModel {
 					channel, selectGroup, err = service.CacheGetRandomSatisfiedChannel(&service.RetryParam{
 						Ctx:        c,
 						ModelName:  modelRequest.Model,
 						TokenGroup: usingGroup,
 						Retry:      common.GetPointer(0),
 					})
+					if err != nil || channel == nil {
+						// 请求的模型没有可用渠道时按降级链切换模型
+						if fallbackModel, fallbackChannel, ok := service.SelectModelFallbackChannel(c, modelRequest.Model, usingGroup); ok {
+							common.SetContextKey(c, constant.ContextKeyRequestedModel, modelRequest.Model)
+							c.Header(service.ServedModelHeader, fallbackModel)
+							modelRequest.Model = fallbackModel
+							channel, err = fallbackChannel, nil
+						}
+					}
 					if err != nil {
 						showGroup := usingGroup
 						if usingGroup == "auto" {
@@ -0,0 +1,227 @@
+package model
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AuditLog 管理操作审计记录。
+// 每一行都保存上一行的哈希（PrevHash），并以自身内容计算 Hash，形成哈希链；
+// 任意一行被修改或删除都会导致后续校验失败，从而发现篡改。
+type AuditLog struct {
+	Id         int    `json:"id"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint;index"`
+	ActorId    int    `json:"actor_id" gorm:"index"`
+	ActorName  string `json:"actor_name" gorm:"type:varchar(64);default:''"`
+	ActorRole  int    `json:"actor_role" gorm:"default:0"`
+	Ip         string `json:"ip" gorm:"type:varchar(64);default:''"`
+	Action     string `json:"action" gorm:"type:varchar(64);index"`
+	TargetType string `json:"target_type" gorm:"type:varchar(32);index:idx_audit_target,priority:1"`
+	TargetId   string `json:"target_id" gorm:"type:varchar(128);index:idx_audit_target,priority:2"`
+	Diff       string `json:"diff" gorm:"type:text"`
+	RequestId  string `json:"request_id" gorm:"type:varchar(64);index;default:''"`
+	PrevHash   string `json:"prev_hash" gorm:"type:varchar(64);default:''"`
+	Hash       string `json:"hash" gorm:"type:varchar(64);uniqueIndex"`
+}
+
+// AuditLogHead 哈希链链尾。写入审计记录时在同一事务中对该行加行锁（SELECT ... FOR UPDATE），
+// 多节点并发写入也会串行读取链尾，哈希链不会分叉
+type AuditLogHead struct {
+	Id     int    `json:"id" gorm:"primaryKey;autoIncrement:false"`
+	LastId int    `json:"last_id"`
+	Hash   string `json:"hash" gorm:"type:varchar(64);default:''"`
+}
+
+const auditLogHeadId = 1
+
+var errAuditLogImmutable = errors.New("audit log is immutable")
+
+// auditLogMutex 减少同一进程内对链尾行锁的争用；SQLite 不支持行锁，单实例部署时由它串行化写入
+var auditLogMutex sync.Mutex
+
+func (AuditLogHead) TableName() string {
+	return "audit_log_heads"
+}
+
+func (AuditLog) TableName() string {
+	return "audit_logs"
+}
+
+func (a *AuditLog) BeforeUpdate(tx *gorm.DB) error {
+	return errAuditLogImmutable
+}
+
+func (a *AuditLog) BeforeDelete(tx *gorm.DB) error {
+	return errAuditLogImmutable
+}
+
+// ComputeHash 根据上一条哈希与本条内容计算链式哈希
+func (a *AuditLog) ComputeHash() string {
+	payload := strings.Join([]string{
+		a.PrevHash,
+		fmt.Sprintf("%d", a.CreatedAt),
+		fmt.Sprintf("%d", a.ActorId),
+		a.ActorName,
+		fmt.Sprintf("%d", a.ActorRole),
+		a.Ip,
+		a.Action,
+		a.TargetType,
+		a.TargetId,
+		a.Diff,
+		a.RequestId,
+	}, "\x1f")
+	return hex.EncodeToString(common.Sha256Raw([]byte(payload)))
+}
+
+// lockAuditLogHead 加锁读取链尾，链尾行不存在时以现有最后一条记录初始化
+func lockAuditLogHead(tx *gorm.DB) (*AuditLogHead, error) {
+	var head AuditLogHead
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", auditLogHeadId).Limit(1).Find(&head).Error
+	if err != nil {
+		return nil, err
+	}
+	if head.Id != 0 {
+		return &head, nil
+	}
+	var last AuditLog
+	if err = tx.Select("id", "hash").Order("id desc").Limit(1).Find(&last).Error; err != nil {
+		return nil, err
+	}
+	head = AuditLogHead{Id: auditLogHeadId, LastId: last.Id, Hash: last.Hash}
+	if err = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&head).Error; err != nil {
+		return nil, err
+	}
+	// 其他节点可能同时完成了初始化，以加锁读取到的链尾为准
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", auditLogHeadId).First(&head).Error
+	return &head, err
+}
+
+// InsertAuditLog 追加一条审计记录，并将其链接到当前链尾
+func InsertAuditLog(entry *AuditLog) error {
+	auditLogMutex.Lock()
+	defer auditLogMutex.Unlock()
+	return DB.Transaction(func(tx *gorm.DB) error {
+		head, err := lockAuditLogHead(tx)
+		if err != nil {
+			return err
+		}
+		if entry.CreatedAt == 0 {
+			entry.CreatedAt = common.GetTimestamp()
+		}
+		entry.Id = 0
+		entry.PrevHash = head.Hash
+		entry.Hash = entry.ComputeHash()
+		if err = tx.Create(entry).Error; err != nil {
+			return err
+		}
+		return tx.Model(&AuditLogHead{}).Where("id = ?", auditLogHeadId).Updates(map[string]interface{}{
+			"last_id": entry.Id,
+			"hash":    entry.Hash,
+		}).Error
+	})
+}
+
+type AuditLogQuery struct {
+	ActorId        int
+	Action         string
+	TargetType     string
+	TargetId       string
+	RequestId      string
+	StartTimestamp int64
+	EndTimestamp   int64
+}
+
+func (q AuditLogQuery) apply(tx *gorm.DB) *gorm.DB {
+	if q.ActorId != 0 {
+		tx = tx.Where("actor_id = ?", q.ActorId)
+	}
+	if q.Action != "" {
+		tx = tx.Where("action = ?", q.Action)
+	}
+	if q.TargetType != "" {
+		tx = tx.Where("target_type = ?", q.TargetType)
+	}
+	if q.TargetId != "" {
+		tx = tx.Where("target_id = ?", q.TargetId)
+	}
+	if q.RequestId != "" {
+		tx = tx.Where("request_id = ?", q.RequestId)
+	}
+	if q.StartTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", q.StartTimestamp)
+	}
+	if q.EndTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", q.EndTimestamp)
+	}
+	return tx
+}
+
+func GetAuditLogs(query AuditLogQuery, startIdx int, num int) (logs []*AuditLog, total int64, err error) {
+	tx := query.apply(DB.Model(&AuditLog{}))
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&logs).Error
+	return logs, total, err
+}
+
+// GetAuditLogsForExport 按 id 升序返回符合条件的记录，最多 limit 条
+func GetAuditLogsForExport(query AuditLogQuery, limit int) (logs []*AuditLog, err error) {
+	err = query.apply(DB.Model(&AuditLog{})).Order("id asc").Limit(limit).Find(&logs).Error
+	return logs, err
+}
+
+type AuditChainVerifyResult struct {
+	Valid    bool `json:"valid"`
+	Checked  int  `json:"checked"`
+	BrokenId int  `json:"broken_id,omitempty"`
+	// Truncated 链尾记录缺失（最新的若干条被删除），与链尾行不一致
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// VerifyAuditLogChain 从头校验哈希链，返回第一条不一致记录的 id；
+// 同时与链尾行比对，发现最新记录被删除的情况
+func VerifyAuditLogChain() (*AuditChainVerifyResult, error) {
+	// 先读取链尾，校验期间新写入的记录不影响比对
+	var head AuditLogHead
+	if err := DB.Where("id = ?", auditLogHeadId).Limit(1).Find(&head).Error; err != nil {
+		return nil, err
+	}
+	result := &AuditChainVerifyResult{Valid: true}
+	prevHash := ""
+	lastId := 0
+	for {
+		var batch []*AuditLog
+		err := DB.Where("id > ?", lastId).Order("id asc").Limit(500).Find(&batch).Error
+		if err != nil {
+			return nil, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		for _, entry := range batch {
+			result.Checked++
+			if entry.PrevHash != prevHash || entry.ComputeHash() != entry.Hash ||
+				(head.Id != 0 && entry.Id == head.LastId && entry.Hash != head.Hash) {
+				result.Valid = false
+				result.BrokenId = entry.Id
+				return result, nil
+			}
+			prevHash = entry.Hash
+			lastId = entry.Id
+		}
+	}
+	if head.Id != 0 && lastId < head.LastId {
+		result.Valid = false
+		result.Truncated = true
+	}
+	return result, nil
+}
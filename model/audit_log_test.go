@@ -0,0 +1,58 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditLogHashChain(t *testing.T) {
+	t.Cleanup(func() {
+		DB.Exec("DELETE FROM audit_logs")
+		DB.Exec("DELETE FROM audit_log_heads")
+	})
+
+	for i, action := range []string{"option.update", "channel.update", "user.delete"} {
+		require.NoError(t, InsertAuditLog(&AuditLog{ActorId: 1, Action: action, TargetType: "test", TargetId: string(rune('a' + i)), Diff: "{}"}))
+	}
+
+	result, err := VerifyAuditLogChain()
+	require.NoError(t, err)
+	require.True(t, result.Valid)
+	require.Equal(t, 3, result.Checked)
+
+	var last AuditLog
+	require.NoError(t, DB.Order("id desc").First(&last).Error)
+	var head AuditLogHead
+	require.NoError(t, DB.First(&head, auditLogHeadId).Error)
+	require.Equal(t, last.Id, head.LastId)
+	require.Equal(t, last.Hash, head.Hash)
+
+	// 链尾行丢失时以现有最后一条记录重新初始化，链保持连续
+	require.NoError(t, DB.Exec("DELETE FROM audit_log_heads").Error)
+	require.NoError(t, InsertAuditLog(&AuditLog{ActorId: 1, Action: "option.update", TargetType: "test", TargetId: "d", Diff: "{}"}))
+	result, err = VerifyAuditLogChain()
+	require.NoError(t, err)
+	require.True(t, result.Valid)
+	require.Equal(t, 4, result.Checked)
+
+	var second AuditLog
+	require.NoError(t, DB.Order("id asc").Offset(1).First(&second).Error)
+	require.Error(t, DB.Model(&second).Update("diff", `{"x":1}`).Error, "audit rows must reject updates")
+
+	// 删除最新的记录后，剩余记录的链仍然连续，但与链尾行不一致
+	var newest AuditLog
+	require.NoError(t, DB.Order("id desc").First(&newest).Error)
+	require.NoError(t, DB.Exec("DELETE FROM audit_logs WHERE id = ?", newest.Id).Error)
+	result, err = VerifyAuditLogChain()
+	require.NoError(t, err)
+	require.False(t, result.Valid)
+	require.True(t, result.Truncated)
+	require.Equal(t, 3, result.Checked)
+
+	require.NoError(t, DB.Exec("UPDATE audit_logs SET diff = ? WHERE id = ?", `{"x":1}`, second.Id).Error)
+	result, err = VerifyAuditLogChain()
+	require.NoError(t, err)
+	require.False(t, result.Valid)
+	require.Equal(t, second.Id, result.BrokenId)
+}
@@ -0,0 +1,251 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 跨节点缓存失效事件类型
+const (
+	CacheEventChannelStatus         = "channel_status"          // target: "<channel_id>:<status>"
+	CacheEventChannelUpdate         = "channel_update"          // 重新加载全部渠道缓存
+	CacheEventOptionUpdate          = "option_update"           // target: option key，接收方从数据库重新读取
+	CacheEventRatioUpdate           = "ratio_update"            // 重新计算定价缓存
+	CacheEventTokenEvict            = "token_evict"             // target: token key 的 HMAC
+	CacheEventUserEvict             = "user_evict"              // target: user id
+	CacheEventSubscriptionPlanEvict = "subscription_plan_evict" // target: plan id
+)
+
+const (
+	cacheEventRedisChannel    = "new-api:cache_events"
+	cacheEventRedisVersionKey = "new-api:cache_events:version"
+	cacheEventPollBatchSize   = 500
+	cacheEventRetention       = time.Hour
+	cacheEventCleanupInterval = 10 * time.Minute
+)
+
+// CacheEvent 缓存变更事件。Redis 模式下版本号来自 INCR，数据库模式下使用自增主键，
+// 接收方发现版本不连续时执行一次全量重新同步。
+type CacheEvent struct {
+	Version   int64  `json:"version" gorm:"column:id;primaryKey;autoIncrement"`
+	Type      string `json:"type" gorm:"type:varchar(64)"`
+	Target    string `json:"target" gorm:"type:varchar(255)"`
+	NodeId    string `json:"node_id" gorm:"type:varchar(128)"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+func (CacheEvent) TableName() string {
+	return "cache_events"
+}
+
+var (
+	cacheEventBusStarted  atomic.Bool
+	cacheEventLastVersion atomic.Int64
+	cacheEventReceiveLock sync.Mutex
+)
+
+// PublishCacheEvent 向其他节点广播缓存变更，事件总线未启动时不做任何事
+func PublishCacheEvent(eventType string, target string) {
+	if !cacheEventBusStarted.Load() {
+		return
+	}
+	event := &CacheEvent{
+		Type:      eventType,
+		Target:    target,
+		NodeId:    common.NodeId,
+		CreatedAt: common.GetTimestamp(),
+	}
+	var err error
+	if common.RedisEnabled {
+		err = publishRedisCacheEvent(event)
+	} else {
+		err = DB.Create(event).Error
+	}
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to publish cache event %s(%s): %s", eventType, target, err.Error()))
+	}
+}
+
+func publishRedisCacheEvent(event *CacheEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	version, err := common.RDB.Incr(ctx, cacheEventRedisVersionKey).Result()
+	if err != nil {
+		return err
+	}
+	event.Version = version
+	data, err := common.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return common.RDB.Publish(ctx, cacheEventRedisChannel, string(data)).Err()
+}
+
+// StartCacheEventBus 启动事件订阅：Redis 可用时使用 pub/sub，否则轮询 cache_events 表
+func StartCacheEventBus() {
+	if !common.GetEnvOrDefaultBool("CACHE_EVENT_BUS_ENABLED", true) {
+		common.SysLog("cache event bus disabled")
+		return
+	}
+	if common.RedisEnabled {
+		pubsub := common.RDB.Subscribe(context.Background(), cacheEventRedisChannel)
+		// 等待订阅生效后再读取当前版本，避免漏掉两者之间的事件
+		if _, err := pubsub.Receive(context.Background()); err != nil {
+			common.SysError("failed to subscribe cache events, falling back to polling only: " + err.Error())
+			_ = pubsub.Close()
+			return
+		}
+		version, err := common.RDB.Get(context.Background(), cacheEventRedisVersionKey).Int64()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			common.SysError("failed to read cache event version: " + err.Error())
+		}
+		cacheEventLastVersion.Store(version)
+		cacheEventBusStarted.Store(true)
+		go runRedisCacheEventSubscriber(pubsub)
+		common.SysLog("cache event bus started (redis pub/sub)")
+		return
+	}
+	var version int64
+	if err := DB.Model(&CacheEvent{}).Select("COALESCE(MAX(id), 0)").Scan(&version).Error; err != nil {
+		common.SysError("failed to read cache event version: " + err.Error())
+	}
+	cacheEventLastVersion.Store(version)
+	cacheEventBusStarted.Store(true)
+	interval := time.Duration(common.GetEnvOrDefault("CACHE_EVENT_POLL_INTERVAL", 1)) * time.Second
+	go runDBCacheEventPoller(interval)
+	common.SysLog(fmt.Sprintf("cache event bus started (database polling, interval %s)", interval))
+}
+
+func runRedisCacheEventSubscriber(pubsub *redis.PubSub) {
+	for msg := range pubsub.Channel() {
+		event := &CacheEvent{}
+		if err := common.UnmarshalJsonStr(msg.Payload, event); err != nil {
+			common.SysError("failed to decode cache event: " + err.Error())
+			continue
+		}
+		receiveCacheEvent(event)
+	}
+}
+
+func runDBCacheEventPoller(interval time.Duration) {
+	RegisterLeaseJob(JobCacheEventCleanup)
+	lastCleanup := time.Now()
+	for {
+		time.Sleep(interval)
+		if err := pollCacheEvents(); err != nil {
+			common.SysError("failed to poll cache events: " + err.Error())
+		}
+		if IsJobLeader(JobCacheEventCleanup) && time.Since(lastCleanup) > cacheEventCleanupInterval {
+			lastCleanup = time.Now()
+			cutoff := time.Now().Add(-cacheEventRetention).Unix()
+			if err := DB.Where("created_at < ?", cutoff).Delete(&CacheEvent{}).Error; err != nil {
+				common.SysError("failed to clean up cache events: " + err.Error())
+			}
+		}
+	}
+}
+
+func pollCacheEvents() error {
+	for {
+		var events []*CacheEvent
+		err := DB.Where("id > ?", cacheEventLastVersion.Load()).
+			Order("id asc").
+			Limit(cacheEventPollBatchSize).
+			Find(&events).Error
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			receiveCacheEvent(event)
+		}
+		if len(events) < cacheEventPollBatchSize {
+			return nil
+		}
+	}
+}
+
+// receiveCacheEvent 按版本顺序处理事件，版本出现空洞说明有事件丢失，直接全量重新同步
+func receiveCacheEvent(event *CacheEvent) {
+	cacheEventReceiveLock.Lock()
+	defer cacheEventReceiveLock.Unlock()
+
+	last := cacheEventLastVersion.Load()
+	if event.Version <= last {
+		return
+	}
+	cacheEventLastVersion.Store(event.Version)
+	if event.Version > last+1 {
+		common.SysLog(fmt.Sprintf("cache event gap detected (last %d, got %d), resyncing caches", last, event.Version))
+		resyncAllCaches()
+		return
+	}
+	if event.NodeId == common.NodeId {
+		return
+	}
+	applyCacheEvent(event)
+}
+
+func applyCacheEvent(event *CacheEvent) {
+	switch event.Type {
+	case CacheEventChannelStatus:
+		idStr, statusStr, _ := strings.Cut(event.Target, ":")
+		id, err1 := strconv.Atoi(idStr)
+		status, err2 := strconv.Atoi(statusStr)
+		if err1 != nil || err2 != nil {
+			return
+		}
+		if status == common.ChannelStatusEnabled {
+			// 启用需要重新加入分组索引，直接重新加载
+			loadChannelCache()
+		} else {
+			CacheUpdateChannelStatus(id, status)
+		}
+	case CacheEventChannelUpdate:
+		loadChannelCache()
+	case CacheEventOptionUpdate:
+		reloadOptionFromDatabase(event.Target)
+	case CacheEventRatioUpdate:
+		refreshPricingLocal()
+	case CacheEventTokenEvict:
+		// token 缓存在 Redis 中共享，这里再删一次以覆盖并发回填的旧值
+		if common.RedisEnabled {
+			_ = common.RedisDelKey(fmt.Sprintf("token:%s", event.Target))
+		}
+	case CacheEventUserEvict:
+		if id, err := strconv.Atoi(event.Target); err == nil {
+			_ = invalidateUserCache(id)
+		}
+	case CacheEventSubscriptionPlanEvict:
+		if id, err := strconv.Atoi(event.Target); err == nil {
+			invalidateSubscriptionPlanCacheLocal(id)
+		}
+	}
+}
+
+func reloadOptionFromDatabase(key string) {
+	option := Option{}
+	if err := DB.Where(commonKeyCol+" = ?", key).First(&option).Error; err != nil {
+		common.SysError(fmt.Sprintf("failed to reload option %s: %s", key, err.Error()))
+		return
+	}
+	if err := updateOptionMap(option.Key, option.Value); err != nil {
+		common.SysError("failed to update option map: " + err.Error())
+	}
+}
+
+// resyncAllCaches 丢失事件后全量重新加载本地缓存
+func resyncAllCaches() {
+	loadChannelCache()
+	loadOptionsFromDatabase()
+	refreshPricingLocal()
+}
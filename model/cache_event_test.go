@@ -0,0 +1,41 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheEventPollAppliesOptionUpdates(t *testing.T) {
+	const optionKey = "CacheEventTestOption"
+	common.OptionMapRWMutex.Lock()
+	if common.OptionMap == nil {
+		common.OptionMap = make(map[string]string)
+	}
+	common.OptionMapRWMutex.Unlock()
+	t.Cleanup(func() {
+		DB.Exec("DELETE FROM cache_events")
+		DB.Where(commonKeyCol+" = ?", optionKey).Delete(&Option{})
+		cacheEventLastVersion.Store(0)
+	})
+	cacheEventLastVersion.Store(0)
+
+	require.NoError(t, DB.Create(&Option{Key: optionKey, Value: "remote"}).Error)
+	require.NoError(t, DB.Create(&CacheEvent{Type: CacheEventOptionUpdate, Target: optionKey, NodeId: "other-node"}).Error)
+	require.NoError(t, pollCacheEvents())
+
+	common.OptionMapRWMutex.RLock()
+	require.Equal(t, "remote", common.OptionMap[optionKey])
+	common.OptionMapRWMutex.RUnlock()
+
+	// 本节点发布的事件只推进版本号，不重复应用
+	require.NoError(t, DB.Model(&Option{}).Where(commonKeyCol+" = ?", optionKey).Update("value", "self").Error)
+	require.NoError(t, DB.Create(&CacheEvent{Type: CacheEventOptionUpdate, Target: optionKey, NodeId: common.NodeId}).Error)
+	require.NoError(t, pollCacheEvents())
+	require.EqualValues(t, 2, cacheEventLastVersion.Load())
+
+	common.OptionMapRWMutex.RLock()
+	require.Equal(t, "remote", common.OptionMap[optionKey])
+	common.OptionMapRWMutex.RUnlock()
+}
@@ -55,6 +55,9 @@ type Channel struct {
 
 	// cache info
 	Keys []string `json:"-" gorm:"-"`
+
+	// 余额预测，仅在接口返回时填充
+	BalanceForecast *ChannelBalanceForecast `json:"balance_forecast,omitempty" gorm:"-"`
 }
 
 type ChannelInfo struct {
@@ -144,6 +147,12 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 	if len(enabledIdx) == 0 {
 		return "", 0, types.NewError(errors.New("no enabled keys"), types.ErrorCodeChannelNoAvailableKey)
 	}
+	// Prefer keys that are not cooling down and still have rate limit headroom
+	enabledIdx = preferKeysWithHeadroom(channel, enabledIdx)
+	usable := make(map[int]bool, len(enabledIdx))
+	for _, idx := range enabledIdx {
+		usable[idx] = true
+	}
 
 	switch channel.ChannelInfo.MultiKeyMode {
 	case constant.MultiKeyModeRandom:
@@ -175,7 +184,7 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 		}
 		for i := 0; i < len(keys); i++ {
 			idx := (start + i) % len(keys)
-			if getStatus(idx) == common.ChannelStatusEnabled {
+			if usable[idx] {
 				// update polling index for next call (point to the next position)
 				channel.ChannelInfo.MultiKeyPollingIndex = (idx + 1) % len(keys)
 				return keys[idx], idx, nil
@@ -675,6 +684,11 @@ func UpdateChannelStatus(channelId int, usingKey string, status int, reason stri
 			common.SysLog(fmt.Sprintf("failed to update channel status: channel_id=%d, status=%d, error=%v", channel.Id, status, err))
 			return false
 		}
+		if channel.ChannelInfo.IsMultiKey {
+			PublishCacheEvent(CacheEventChannelUpdate, "")
+		} else {
+			PublishCacheEvent(CacheEventChannelStatus, fmt.Sprintf("%d:%d", channel.Id, status))
+		}
 	}
 	return true
 }
@@ -0,0 +1,154 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// ChannelBalanceSnapshot 每次查询余额时记录的渠道余额与已用额度，用于估算消耗速度
+type ChannelBalanceSnapshot struct {
+	Id        int     `json:"id"`
+	ChannelId int     `json:"channel_id" gorm:"index:idx_channel_balance_snapshot,priority:1"`
+	Balance   float64 `json:"balance"`
+	UsedQuota int64   `json:"used_quota" gorm:"bigint;default:0"`
+	CreatedAt int64   `json:"created_at" gorm:"bigint;index:idx_channel_balance_snapshot,priority:2;index"`
+}
+
+// ChannelBalanceForecast 按近期已用额度增长估算的余额耗尽时间。
+// 消耗按本站计费额度折算为美元，与上游实际扣费可能存在偏差
+type ChannelBalanceForecast struct {
+	Balance     float64 `json:"balance"`
+	BurnPerDay  float64 `json:"burn_per_day"`
+	WindowHours float64 `json:"window_hours"`
+	DaysLeft    float64 `json:"days_left"` // 无消耗时为 -1
+	DepletesAt  int64   `json:"depletes_at,omitempty"`
+	Summary     string  `json:"summary"`
+}
+
+func RecordChannelBalanceSnapshot(channelId int, balance float64, usedQuota int64) error {
+	return DB.Create(&ChannelBalanceSnapshot{
+		ChannelId: channelId,
+		Balance:   balance,
+		UsedQuota: usedQuota,
+		CreatedAt: common.GetTimestamp(),
+	}).Error
+}
+
+func DeleteChannelBalanceSnapshotsBefore(timestamp int64) (int64, error) {
+	result := DB.Where("created_at < ?", timestamp).Delete(&ChannelBalanceSnapshot{})
+	return result.RowsAffected, result.Error
+}
+
+// channelBalanceBaseline 窗口内最早的已用额度，已用额度只增不减，取最小值即可
+type channelBalanceBaseline struct {
+	ChannelId int
+	UsedQuota int64
+	CreatedAt int64
+}
+
+func getChannelBalanceBaselines(channelIds []int, since int64) (map[int]channelBalanceBaseline, error) {
+	baselines := make(map[int]channelBalanceBaseline, len(channelIds))
+	if len(channelIds) == 0 {
+		return baselines, nil
+	}
+	var rows []channelBalanceBaseline
+	err := DB.Model(&ChannelBalanceSnapshot{}).
+		Select("channel_id, min(used_quota) AS used_quota, min(created_at) AS created_at").
+		Where("channel_id in ? and created_at >= ?", channelIds, since).
+		Group("channel_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		baselines[row.ChannelId] = row
+	}
+	return baselines, nil
+}
+
+// ComputeChannelBalanceForecast 根据窗口起点与当前的已用额度计算日均消耗与剩余天数
+func ComputeChannelBalanceForecast(balance float64, baseUsedQuota int64, baseAt int64, usedQuota int64, now int64) *ChannelBalanceForecast {
+	elapsed := float64(now - baseAt)
+	if elapsed <= 0 {
+		return nil
+	}
+	days := elapsed / 86400
+	burn := float64(usedQuota-baseUsedQuota) / common.QuotaPerUnit / days
+	forecast := &ChannelBalanceForecast{
+		Balance:     balance,
+		BurnPerDay:  math.Max(burn, 0),
+		WindowHours: math.Round(elapsed/3600*10) / 10,
+		DaysLeft:    -1,
+	}
+	switch {
+	case balance <= 0:
+		forecast.DaysLeft = 0
+		forecast.Summary = "balance exhausted"
+	case forecast.BurnPerDay <= 0:
+		forecast.Summary = "no recent usage"
+	default:
+		forecast.DaysLeft = balance / forecast.BurnPerDay
+		forecast.DepletesAt = now + int64(forecast.DaysLeft*86400)
+		forecast.Summary = formatDaysLeft(forecast.DaysLeft)
+	}
+	return forecast
+}
+
+func formatDaysLeft(days float64) string {
+	if days < 1 {
+		hours := math.Max(math.Round(days*24), 1)
+		return fmt.Sprintf("runs out in ~%d hours", int(hours))
+	}
+	return fmt.Sprintf("runs out in ~%d days", int(math.Round(days)))
+}
+
+// FillChannelBalanceForecasts 为已查询过余额的渠道填充余额预测
+func FillChannelBalanceForecasts(channels []*Channel, window time.Duration) error {
+	ids := make([]int, 0, len(channels))
+	for _, channel := range channels {
+		if channel != nil && channel.BalanceUpdatedTime > 0 {
+			ids = append(ids, channel.Id)
+		}
+	}
+	now := common.GetTimestamp()
+	baselines, err := getChannelBalanceBaselines(ids, now-int64(window.Seconds()))
+	if err != nil {
+		return err
+	}
+	for _, channel := range channels {
+		if channel == nil {
+			continue
+		}
+		base, ok := baselines[channel.Id]
+		if !ok {
+			continue
+		}
+		channel.BalanceForecast = ComputeChannelBalanceForecast(channel.Balance, base.UsedQuota, base.CreatedAt, channel.UsedQuota, now)
+	}
+	return nil
+}
+
+// UpdateChannelBalancePriority 余额监控调整优先级：同时保存渠道设置（记录原优先级）与 abilities 优先级。
+// 不刷新渠道缓存，由调用方在一批调整完成后调用一次 InitChannelCache
+func UpdateChannelBalancePriority(channel *Channel, priority int64) error {
+	err := DB.Model(&Channel{}).Where("id = ?", channel.Id).Updates(map[string]interface{}{
+		"priority": priority,
+		"settings": channel.OtherSettings,
+	}).Error
+	if err != nil {
+		return err
+	}
+	if err := DB.Model(&Ability{}).Where("channel_id = ?", channel.Id).Update("priority", priority).Error; err != nil {
+		return err
+	}
+	channel.Priority = &priority
+	return nil
+}
+
+// UpdateChannelBalanceSettings 只保存渠道设置，用于记录或清除余额监控的标记
+func UpdateChannelBalanceSettings(channel *Channel) error {
+	return DB.Model(&Channel{}).Where("id = ?", channel.Id).Update("settings", channel.OtherSettings).Error
+}
@@ -18,7 +18,13 @@ var group2model2channels map[string]map[string][]int // enabled channel
 var channelsIDM map[int]*Channel                     // all channels include disabled
 var channelSyncLock sync.RWMutex
 
+// InitChannelCache 从数据库重新加载渠道缓存，并通知其他节点同步
 func InitChannelCache() {
+	loadChannelCache()
+	PublishCacheEvent(CacheEventChannelUpdate, "")
+}
+
+func loadChannelCache() {
 	if !common.MemoryCacheEnabled {
 		return
 	}
@@ -89,7 +95,7 @@ func SyncChannelCache(frequency int) {
 	for {
 		time.Sleep(time.Duration(frequency) * time.Second)
 		common.SysLog("syncing channels from database")
-		InitChannelCache()
+		loadChannelCache()
 	}
 }
 
@@ -115,6 +121,8 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 		return nil, nil
 	}
 
+	channels = preferUnsaturatedChannels(channels)
+
 	if len(channels) == 1 {
 		if channel, ok := channelsIDM[channels[0]]; ok {
 			return channel, nil
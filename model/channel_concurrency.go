@@ -0,0 +1,161 @@
+package model
+
+import (
+	"sync"
+	"time"
+)
+
+// 渠道并发计数只保存在本实例内存中，多实例部署时各实例分别限制
+
+// channelLimits 渠道设置中的并发与限流上限，0 表示不限制
+type channelLimits struct {
+	maxConcurrency    int
+	rpm               int
+	tpm               int
+	keyRPM            int
+	keyTPM            int
+	keyMaxConcurrency int
+}
+
+// unlimited 渠道与 key 都没有并发和限流上限
+func (l channelLimits) unlimited() bool {
+	return l == channelLimits{}
+}
+
+type cachedChannelLimits struct {
+	otherSettings string
+	limits        channelLimits
+}
+
+var (
+	channelSlotMu     sync.Mutex
+	channelInflight   = make(map[int]int)
+	channelSlotFreed  = make(chan struct{})
+	channelLimitCache sync.Map // channel id -> cachedChannelLimits
+)
+
+// getLimits 按 OtherSettings 原文缓存解析结果，避免每次选择渠道都解析 JSON
+func (channel *Channel) getLimits() channelLimits {
+	if channel == nil || channel.OtherSettings == "" {
+		return channelLimits{}
+	}
+	if cached, ok := channelLimitCache.Load(channel.Id); ok {
+		entry := cached.(cachedChannelLimits)
+		if entry.otherSettings == channel.OtherSettings {
+			return entry.limits
+		}
+	}
+	settings := channel.GetOtherSettings()
+	limits := channelLimits{
+		maxConcurrency:    max(settings.MaxConcurrency, 0),
+		rpm:               max(settings.RPMLimit, 0),
+		tpm:               max(settings.TPMLimit, 0),
+		keyRPM:            max(settings.KeyRPMLimit, 0),
+		keyTPM:            max(settings.KeyTPMLimit, 0),
+		keyMaxConcurrency: max(settings.KeyMaxConcurrency, 0),
+	}
+	channelLimitCache.Store(channel.Id, cachedChannelLimits{otherSettings: channel.OtherSettings, limits: limits})
+	return limits
+}
+
+// HasCapacityLimits 渠道或其 key 配置了并发或 RPM/TPM 上限
+func (channel *Channel) HasCapacityLimits() bool {
+	return !channel.getLimits().unlimited()
+}
+
+// GetMaxConcurrency 返回渠道的最大并发数，0 表示不限制
+func (channel *Channel) GetMaxConcurrency() int {
+	return channel.getLimits().maxConcurrency
+}
+
+// IsChannelSaturated 渠道并发已达上限，或渠道及其所有 key 都没有限流余量
+func IsChannelSaturated(channel *Channel) bool {
+	if !channelHasHeadroom(channel, time.Now()) {
+		return true
+	}
+	limit := channel.GetMaxConcurrency()
+	if limit == 0 {
+		return false
+	}
+	channelSlotMu.Lock()
+	defer channelSlotMu.Unlock()
+	return channelInflight[channel.Id] >= limit
+}
+
+// TryAcquireChannelSlot 占用渠道的一个并发名额，成功时返回释放函数，重复调用释放函数只生效一次。
+// 渠道没有限流余量时同样视为已满。没有任何上限的渠道永远不会因并发占满，不记录并发数也不唤醒排队请求，
+// 避免每个请求都争用全局锁
+func TryAcquireChannelSlot(channel *Channel) (func(), bool) {
+	if !channelHasHeadroom(channel, time.Now()) {
+		return nil, false
+	}
+	if !channel.HasCapacityLimits() {
+		return func() {}, true
+	}
+	limit := channel.GetMaxConcurrency()
+	channelSlotMu.Lock()
+	defer channelSlotMu.Unlock()
+	if limit > 0 && channelInflight[channel.Id] >= limit {
+		return nil, false
+	}
+	channelInflight[channel.Id]++
+	channelId := channel.Id
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			releaseChannelSlot(channelId)
+		})
+	}, true
+}
+
+func releaseChannelSlot(channelId int) {
+	channelSlotMu.Lock()
+	defer channelSlotMu.Unlock()
+	if channelInflight[channelId] <= 1 {
+		delete(channelInflight, channelId)
+	} else {
+		channelInflight[channelId]--
+	}
+	notifyChannelSlotFreed()
+}
+
+// notifyChannelSlotFreed 唤醒等待名额的请求，调用方需持有 channelSlotMu
+func notifyChannelSlotFreed() {
+	close(channelSlotFreed)
+	channelSlotFreed = make(chan struct{})
+}
+
+// ChannelSlotFreed 返回一个在下一次释放并发名额时关闭的通道
+func ChannelSlotFreed() <-chan struct{} {
+	channelSlotMu.Lock()
+	defer channelSlotMu.Unlock()
+	return channelSlotFreed
+}
+
+// GetChannelInflight 返回渠道当前正在处理的请求数
+func GetChannelInflight(channelId int) int {
+	channelSlotMu.Lock()
+	defer channelSlotMu.Unlock()
+	return channelInflight[channelId]
+}
+
+// preferUnsaturatedChannels 跳过并发已满的渠道；全部已满时保留原列表，由调用方排队等待
+func preferUnsaturatedChannels(channelIds []int) []int {
+	saturated := 0
+	for _, channelId := range channelIds {
+		if channel, ok := channelsIDM[channelId]; ok && IsChannelSaturated(channel) {
+			saturated++
+		}
+	}
+	if saturated == 0 || saturated == len(channelIds) {
+		return channelIds
+	}
+	available := make([]int, 0, len(channelIds)-saturated)
+	for _, channelId := range channelIds {
+		if channel, ok := channelsIDM[channelId]; ok && IsChannelSaturated(channel) {
+			continue
+		}
+		available = append(available, channelId)
+	}
+	return available
+}
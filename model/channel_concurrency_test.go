@@ -0,0 +1,33 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTryAcquireChannelSlot(t *testing.T) {
+	// 没有任何上限的渠道不记录并发数
+	unlimited := &Channel{Id: 90601}
+	release, ok := TryAcquireChannelSlot(unlimited)
+	require.True(t, ok)
+	require.Zero(t, GetChannelInflight(unlimited.Id))
+	release()
+
+	limited := &Channel{Id: 90602, OtherSettings: `{"max_concurrency":1}`}
+	release, ok = TryAcquireChannelSlot(limited)
+	require.True(t, ok)
+	require.Equal(t, 1, GetChannelInflight(limited.Id))
+	_, ok = TryAcquireChannelSlot(limited)
+	require.False(t, ok)
+
+	freed := ChannelSlotFreed()
+	release()
+	release()
+	require.Zero(t, GetChannelInflight(limited.Id))
+	select {
+	case <-freed:
+	default:
+		t.Fatal("releasing a slot must wake waiters")
+	}
+}
@@ -0,0 +1,260 @@
+package model
+
+import (
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+// UpstreamRateLimit 上游响应头中的限流余量，Remaining 为 -1 表示响应头未提供
+type UpstreamRateLimit struct {
+	RequestsRemaining int
+	RequestsReset     time.Time
+	TokensRemaining   int
+	TokensReset       time.Time
+}
+
+const rateWindowSize = time.Minute
+
+// rateWindow 固定窗口计数，上一窗口按剩余比例折算，近似最近一分钟的用量
+type rateWindow struct {
+	start        time.Time
+	requests     int
+	tokens       int
+	prevRequests int
+	prevTokens   int
+}
+
+func (w *rateWindow) rotate(now time.Time) {
+	elapsed := now.Sub(w.start)
+	if elapsed < rateWindowSize {
+		return
+	}
+	if elapsed < 2*rateWindowSize {
+		w.prevRequests, w.prevTokens = w.requests, w.tokens
+		w.start = w.start.Add(rateWindowSize)
+	} else {
+		w.prevRequests, w.prevTokens = 0, 0
+		w.start = now
+	}
+	w.requests, w.tokens = 0, 0
+}
+
+func (w *rateWindow) add(now time.Time, requests int, tokens int) {
+	w.rotate(now)
+	w.requests += requests
+	w.tokens += tokens
+}
+
+func (w *rateWindow) withinLimits(now time.Time, rpm int, tpm int) bool {
+	if rpm == 0 && tpm == 0 {
+		return true
+	}
+	w.rotate(now)
+	weight := 1 - float64(now.Sub(w.start))/float64(rateWindowSize)
+	requests := w.requests + int(float64(w.prevRequests)*weight)
+	tokens := w.tokens + int(float64(w.prevTokens)*weight)
+	return (rpm == 0 || requests < rpm) && (tpm == 0 || tokens < tpm)
+}
+
+type keyRateState struct {
+	window        rateWindow
+	inflight      int
+	cooldownUntil time.Time
+	upstream      UpstreamRateLimit
+}
+
+func (s *keyRateState) hasHeadroom(now time.Time, limits channelLimits) bool {
+	if now.Before(s.cooldownUntil) {
+		return false
+	}
+	if s.upstream.RequestsRemaining == 0 && now.Before(s.upstream.RequestsReset) {
+		return false
+	}
+	if s.upstream.TokensRemaining == 0 && now.Before(s.upstream.TokensReset) {
+		return false
+	}
+	if limits.keyMaxConcurrency > 0 && s.inflight >= limits.keyMaxConcurrency {
+		return false
+	}
+	return s.window.withinLimits(now, limits.keyRPM, limits.keyTPM)
+}
+
+type channelRateState struct {
+	window rateWindow
+	keys   map[int]*keyRateState // key index -> state，单 key 渠道使用 0
+}
+
+// 与并发计数相同，限流状态只保存在本实例内存中
+var (
+	channelRateMu     sync.Mutex
+	channelRateStates = make(map[int]*channelRateState)
+)
+
+func getChannelRateState(channelId int, now time.Time) *channelRateState {
+	state := channelRateStates[channelId]
+	if state == nil {
+		state = &channelRateState{window: rateWindow{start: now}, keys: make(map[int]*keyRateState)}
+		channelRateStates[channelId] = state
+	}
+	return state
+}
+
+func (s *channelRateState) getKey(keyIndex int, now time.Time) *keyRateState {
+	key := s.keys[keyIndex]
+	if key == nil {
+		key = &keyRateState{
+			window:   rateWindow{start: now},
+			upstream: UpstreamRateLimit{RequestsRemaining: -1, TokensRemaining: -1},
+		}
+		s.keys[keyIndex] = key
+	}
+	return key
+}
+
+func (s *channelRateState) keyHasHeadroom(keyIndex int, now time.Time, limits channelLimits) bool {
+	key := s.keys[keyIndex]
+	return key == nil || key.hasHeadroom(now, limits)
+}
+
+func (channel *Channel) isKeyEnabled(keyIndex int) bool {
+	if channel.ChannelInfo.MultiKeyStatusList == nil {
+		return true
+	}
+	status, ok := channel.ChannelInfo.MultiKeyStatusList[keyIndex]
+	return !ok || status == common.ChannelStatusEnabled
+}
+
+// channelHasHeadroom 渠道整体未超过 RPM/TPM 上限，且至少有一个启用的 key 有余量
+func channelHasHeadroom(channel *Channel, now time.Time) bool {
+	if channel == nil {
+		return true
+	}
+	limits := channel.getLimits()
+	if limits.unlimited() && !operation_setting.GetChannelRateLimitSetting().CooldownEnabled {
+		return true
+	}
+	channelRateMu.Lock()
+	defer channelRateMu.Unlock()
+	state := channelRateStates[channel.Id]
+	if state == nil {
+		return true
+	}
+	if !state.window.withinLimits(now, limits.rpm, limits.tpm) {
+		return false
+	}
+	if len(state.keys) == 0 {
+		return true
+	}
+	if !channel.ChannelInfo.IsMultiKey || channel.ChannelInfo.MultiKeySize <= 0 {
+		return state.keyHasHeadroom(0, now, limits)
+	}
+	for keyIndex := 0; keyIndex < channel.ChannelInfo.MultiKeySize; keyIndex++ {
+		if channel.isKeyEnabled(keyIndex) && state.keyHasHeadroom(keyIndex, now, limits) {
+			return true
+		}
+	}
+	return false
+}
+
+// preferKeysWithHeadroom 跳过冷却中或没有限流余量的 key；全部没有余量时保留原列表
+func preferKeysWithHeadroom(channel *Channel, keyIndexes []int) []int {
+	limits := channel.getLimits()
+	now := time.Now()
+	channelRateMu.Lock()
+	defer channelRateMu.Unlock()
+	state := channelRateStates[channel.Id]
+	if state == nil || len(state.keys) == 0 {
+		return keyIndexes
+	}
+	available := make([]int, 0, len(keyIndexes))
+	for _, keyIndex := range keyIndexes {
+		if state.keyHasHeadroom(keyIndex, now, limits) {
+			available = append(available, keyIndex)
+		}
+	}
+	if len(available) == 0 {
+		return keyIndexes
+	}
+	return available
+}
+
+// AcquireChannelKey 记录一次发往该 key 的请求，计入渠道与 key 的 RPM/TPM 以及 key 的并发数，
+// 返回释放并发的函数，重复调用只生效一次
+func AcquireChannelKey(channelId int, keyIndex int, promptTokens int) func() {
+	now := time.Now()
+	channelRateMu.Lock()
+	state := getChannelRateState(channelId, now)
+	state.window.add(now, 1, promptTokens)
+	key := state.getKey(keyIndex, now)
+	key.window.add(now, 1, promptTokens)
+	key.inflight++
+	channelRateMu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			channelRateMu.Lock()
+			if key.inflight > 0 {
+				key.inflight--
+			}
+			channelRateMu.Unlock()
+			channelSlotMu.Lock()
+			notifyChannelSlotFreed()
+			channelSlotMu.Unlock()
+		})
+	}
+}
+
+// RecordChannelKeyTokens 请求完成后补记输出 token，输入 token 在发出请求时已按估算计入
+func RecordChannelKeyTokens(channelId int, keyIndex int, tokens int) {
+	if tokens <= 0 {
+		return
+	}
+	now := time.Now()
+	channelRateMu.Lock()
+	defer channelRateMu.Unlock()
+	state := getChannelRateState(channelId, now)
+	state.window.add(now, 0, tokens)
+	state.getKey(keyIndex, now).window.add(now, 0, tokens)
+}
+
+// CooldownChannelKey 在 until 之前跳过该 key
+func CooldownChannelKey(channelId int, keyIndex int, until time.Time) {
+	now := time.Now()
+	channelRateMu.Lock()
+	defer channelRateMu.Unlock()
+	key := getChannelRateState(channelId, now).getKey(keyIndex, now)
+	if until.After(key.cooldownUntil) {
+		key.cooldownUntil = until
+	}
+}
+
+// UpdateChannelKeyRateLimit 记录上游响应头中的限流余量，响应头未提供的部分保留原值
+func UpdateChannelKeyRateLimit(channelId int, keyIndex int, limit UpstreamRateLimit) {
+	now := time.Now()
+	channelRateMu.Lock()
+	defer channelRateMu.Unlock()
+	key := getChannelRateState(channelId, now).getKey(keyIndex, now)
+	if limit.RequestsRemaining >= 0 {
+		key.upstream.RequestsRemaining = limit.RequestsRemaining
+		key.upstream.RequestsReset = limit.RequestsReset
+	}
+	if limit.TokensRemaining >= 0 {
+		key.upstream.TokensRemaining = limit.TokensRemaining
+		key.upstream.TokensReset = limit.TokensReset
+	}
+}
+
+// GetChannelKeyCooldown 返回 key 的冷却截止时间，未冷却时返回零值
+func GetChannelKeyCooldown(channelId int, keyIndex int) time.Time {
+	channelRateMu.Lock()
+	defer channelRateMu.Unlock()
+	state := channelRateStates[channelId]
+	if state == nil || state.keys[keyIndex] == nil {
+		return time.Time{}
+	}
+	return state.keys[keyIndex].cooldownUntil
+}
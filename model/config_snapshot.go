@@ -0,0 +1,81 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// ConfigSnapshot 保存某一时刻完整网关配置的导出包（JSON），用于回滚。
+// Content 中渠道密钥与敏感配置以 CryptoSecret 加密保存。
+type ConfigSnapshot struct {
+	Id          int    `json:"id"`
+	Comment     string `json:"comment" gorm:"type:varchar(255);default:''"`
+	Source      string `json:"source" gorm:"type:varchar(32);default:''"` // manual, auto_apply, auto_rollback
+	Content     string `json:"content,omitempty" gorm:"type:text"`
+	ContentHash string `json:"content_hash" gorm:"type:varchar(64)"`
+	Size        int    `json:"size"`
+	CreatedBy   int    `json:"created_by"`
+	CreatedAt   int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+const (
+	ConfigSnapshotSourceManual       = "manual"
+	ConfigSnapshotSourceAutoApply    = "auto_apply"
+	ConfigSnapshotSourceAutoRollback = "auto_rollback"
+)
+
+func (ConfigSnapshot) TableName() string {
+	return "config_snapshots"
+}
+
+func (s *ConfigSnapshot) Insert() error {
+	s.CreatedAt = common.GetTimestamp()
+	s.Size = len(s.Content)
+	s.ContentHash = common.Sha1([]byte(s.Content))
+	return DB.Create(s).Error
+}
+
+// GetConfigSnapshots 列出快照（不包含内容）
+func GetConfigSnapshots(startIdx int, num int) (snapshots []*ConfigSnapshot, total int64, err error) {
+	tx := DB.Model(&ConfigSnapshot{})
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Omit("content").Order("id desc").Limit(num).Offset(startIdx).Find(&snapshots).Error
+	return snapshots, total, err
+}
+
+func GetConfigSnapshotById(id int) (*ConfigSnapshot, error) {
+	var snapshot ConfigSnapshot
+	if err := DB.First(&snapshot, id).Error; err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+func DeleteConfigSnapshotById(id int) error {
+	return DB.Delete(&ConfigSnapshot{}, id).Error
+}
+
+// migrateConfigSnapshotContent MySQL 的 text 只有 64KB，快照内容需要 longtext
+func migrateConfigSnapshotContent() error {
+	if !common.UsingMySQL {
+		return nil
+	}
+	var columnType string
+	if err := DB.Raw(`SELECT COLUMN_TYPE FROM information_schema.columns
+			WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?`,
+		"config_snapshots", "content").Scan(&columnType).Error; err != nil {
+		common.SysLog(fmt.Sprintf("Warning: failed to query metadata for config_snapshots.content: %v", err))
+		return nil
+	}
+	if strings.ToLower(columnType) == "longtext" {
+		return nil
+	}
+	if err := DB.Exec("ALTER TABLE config_snapshots MODIFY COLUMN content longtext").Error; err != nil {
+		return fmt.Errorf("failed to migrate config_snapshots.content to longtext: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,291 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm/clause"
+)
+
+// 需要全局只运行一份的后台任务
+const (
+	JobTaskPolling            = "task_polling"
+	JobSubscriptionReset      = "subscription_reset"
+	JobCodexCredentialRefresh = "codex_credential_refresh"
+	JobChannelAutoTest        = "channel_auto_test"
+	JobChannelBalanceUpdate   = "channel_balance_update"
+	JobChannelUpstreamUpdate  = "channel_upstream_update"
+	JobCacheEventCleanup      = "cache_event_cleanup"
+	JobMediaCleanup           = "media_cleanup"
+	JobTaskWebhookDelivery    = "task_webhook_delivery"
+	JobUsageRollupCleanup     = "usage_rollup_cleanup"
+	JobStatementClose         = "statement_close"
+	JobNotifyEventScan        = "notify_event_scan"
+)
+
+const (
+	jobLeaseTTL           = 30 * time.Second
+	jobLeaseRenewInterval = 10 * time.Second
+	// 本地认为租约失效的时间早于存储端，避免续约失败时与新持有者重叠
+	jobLeaseSafetyMargin = 5 * time.Second
+	jobLeaseRedisPrefix  = "new-api:lease:"
+)
+
+// JobLease 数据库租约行，Redis 不可用时使用
+type JobLease struct {
+	Name      string `json:"name" gorm:"primaryKey;type:varchar(64)"`
+	Holder    string `json:"holder" gorm:"type:varchar(128)"`
+	ExpiresAt int64  `json:"expires_at" gorm:"bigint"`
+	UpdatedAt int64  `json:"updated_at" gorm:"bigint"`
+}
+
+// JobLeaseInfo 租约状态，用于管理接口展示
+type JobLeaseInfo struct {
+	Name      string `json:"name"`
+	Holder    string `json:"holder"`
+	ExpiresAt int64  `json:"expires_at"`
+	IsSelf    bool   `json:"is_self"`
+}
+
+// jobLeaseState 本节点对单个任务的租约状态，ctx 在租约丢失或到期未续约时取消
+type jobLeaseState struct {
+	deadline time.Time
+	ctx      context.Context
+	cancel   context.CancelFunc
+	timer    *time.Timer
+}
+
+var (
+	jobLeaseLock      sync.RWMutex
+	jobLeases         = make(map[string]*jobLeaseState)
+	jobLeaseStartOnce sync.Once
+)
+
+var redisAcquireLeaseScript = redis.NewScript(`
+local v = redis.call('GET', KEYS[1])
+if not v then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+	return 1
+end
+if v == ARGV[1] then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	return 1
+end
+return 0
+`)
+
+func leaderElectionEnabled() bool {
+	return common.GetEnvOrDefaultBool("JOB_LEADER_ELECTION_ENABLED", true)
+}
+
+// RegisterLeaseJob 登记后台任务并开始竞争租约，未开启选主时仅 master 节点持有
+func RegisterLeaseJob(name string) {
+	jobLeaseLock.Lock()
+	if _, ok := jobLeases[name]; !ok {
+		jobLeases[name] = &jobLeaseState{}
+	}
+	jobLeaseLock.Unlock()
+	if !leaderElectionEnabled() {
+		return
+	}
+	jobLeaseStartOnce.Do(func() {
+		go runJobLeaseRenewer()
+	})
+	renewJobLease(name)
+}
+
+// IsJobLeader 当前节点是否持有该任务的租约
+func IsJobLeader(name string) bool {
+	if !leaderElectionEnabled() {
+		return common.IsMasterNode
+	}
+	jobLeaseLock.RLock()
+	defer jobLeaseLock.RUnlock()
+	state, ok := jobLeases[name]
+	return ok && time.Now().Before(state.deadline)
+}
+
+// JobLeaderContext 当前节点持有租约时返回本次租约期的 context，租约丢失或到期未续约时取消。
+// 执行时间较长的任务应在该 context 取消后停止写入，避免与新持有者同时运行
+func JobLeaderContext(name string) (context.Context, bool) {
+	if !leaderElectionEnabled() {
+		return context.Background(), common.IsMasterNode
+	}
+	jobLeaseLock.RLock()
+	defer jobLeaseLock.RUnlock()
+	state, ok := jobLeases[name]
+	if !ok || state.ctx == nil || !time.Now().Before(state.deadline) {
+		return nil, false
+	}
+	return state.ctx, true
+}
+
+func runJobLeaseRenewer() {
+	ticker := time.NewTicker(jobLeaseRenewInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		jobLeaseLock.RLock()
+		names := make([]string, 0, len(jobLeases))
+		for name := range jobLeases {
+			names = append(names, name)
+		}
+		jobLeaseLock.RUnlock()
+		for _, name := range names {
+			renewJobLease(name)
+		}
+	}
+}
+
+func renewJobLease(name string) {
+	start := time.Now()
+	acquired, err := tryAcquireJobLease(name, common.NodeId, jobLeaseTTL)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to renew job lease %s: %s", name, err.Error()))
+	}
+	jobLeaseLock.Lock()
+	defer jobLeaseLock.Unlock()
+	state := jobLeases[name]
+	wasLeader := state.ctx != nil
+	if acquired {
+		state.deadline = start.Add(jobLeaseTTL - jobLeaseSafetyMargin)
+		if !wasLeader {
+			state.ctx, state.cancel = context.WithCancel(context.Background())
+			common.SysLog(fmt.Sprintf("acquired job lease %s", name))
+		}
+		// 续约卡住时按本地截止时间释放
+		if state.timer == nil {
+			state.timer = time.AfterFunc(time.Until(state.deadline), func() { expireJobLease(name) })
+		} else {
+			state.timer.Reset(time.Until(state.deadline))
+		}
+	} else {
+		releaseJobLeaseLocked(name, state)
+	}
+}
+
+func expireJobLease(name string) {
+	jobLeaseLock.Lock()
+	defer jobLeaseLock.Unlock()
+	state := jobLeases[name]
+	if state.ctx != nil && !time.Now().Before(state.deadline) {
+		releaseJobLeaseLocked(name, state)
+	}
+}
+
+func releaseJobLeaseLocked(name string, state *jobLeaseState) {
+	state.deadline = time.Time{}
+	if state.ctx == nil {
+		return
+	}
+	state.cancel()
+	state.ctx, state.cancel = nil, nil
+	common.SysLog(fmt.Sprintf("lost job lease %s", name))
+}
+
+func tryAcquireJobLease(name string, holder string, ttl time.Duration) (bool, error) {
+	if common.RedisEnabled {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		n, err := redisAcquireLeaseScript.Run(ctx, common.RDB, []string{jobLeaseRedisPrefix + name}, holder, ttl.Milliseconds()).Int()
+		if err != nil {
+			return false, err
+		}
+		return n == 1, nil
+	}
+	// 以数据库时间判断过期，避免节点间时钟偏差导致租约重叠
+	now := GetDBTimestamp()
+	expiresAt := now + int64(ttl.Seconds())
+	result := DB.Model(&JobLease{}).
+		Where("name = ? AND (holder = ? OR expires_at < ?)", name, holder, now).
+		Updates(map[string]any{"holder": holder, "expires_at": expiresAt, "updated_at": now})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return true, nil
+	}
+	result = DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&JobLease{
+		Name:      name,
+		Holder:    holder,
+		ExpiresAt: expiresAt,
+		UpdatedAt: now,
+	})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// GetJobLeases 返回已登记任务的租约持有情况
+func GetJobLeases() ([]JobLeaseInfo, error) {
+	jobLeaseLock.RLock()
+	names := make([]string, 0, len(jobLeases))
+	for name := range jobLeases {
+		names = append(names, name)
+	}
+	jobLeaseLock.RUnlock()
+	sort.Strings(names)
+
+	infos := make([]JobLeaseInfo, 0, len(names))
+	if !leaderElectionEnabled() {
+		for _, name := range names {
+			info := JobLeaseInfo{Name: name, IsSelf: common.IsMasterNode}
+			if common.IsMasterNode {
+				info.Holder = common.NodeId
+			}
+			infos = append(infos, info)
+		}
+		return infos, nil
+	}
+	if common.RedisEnabled {
+		ctx := context.Background()
+		for _, name := range names {
+			key := jobLeaseRedisPrefix + name
+			holder, err := common.RDB.Get(ctx, key).Result()
+			if errors.Is(err, redis.Nil) {
+				infos = append(infos, JobLeaseInfo{Name: name})
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			ttl, _ := common.RDB.PTTL(ctx, key).Result()
+			infos = append(infos, JobLeaseInfo{
+				Name:      name,
+				Holder:    holder,
+				ExpiresAt: time.Now().Add(ttl).Unix(),
+				IsSelf:    holder == common.NodeId,
+			})
+		}
+		return infos, nil
+	}
+	if len(names) == 0 {
+		return infos, nil
+	}
+	var leases []JobLease
+	if err := DB.Where("name IN ?", names).Find(&leases).Error; err != nil {
+		return nil, err
+	}
+	leaseMap := make(map[string]JobLease, len(leases))
+	for _, lease := range leases {
+		leaseMap[lease.Name] = lease
+	}
+	now := GetDBTimestamp()
+	for _, name := range names {
+		info := JobLeaseInfo{Name: name}
+		if lease, ok := leaseMap[name]; ok && lease.ExpiresAt >= now {
+			info.Holder = lease.Holder
+			info.ExpiresAt = lease.ExpiresAt
+			info.IsSelf = lease.Holder == common.NodeId
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
@@ -0,0 +1,75 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTryAcquireJobLeaseDB(t *testing.T) {
+	t.Cleanup(func() {
+		DB.Exec("DELETE FROM job_leases")
+	})
+
+	ok, err := tryAcquireJobLease("test_job", "node-a", time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// 租约未过期时其他节点无法获取，持有者可以续约
+	ok, err = tryAcquireJobLease("test_job", "node-b", time.Minute)
+	require.NoError(t, err)
+	require.False(t, ok)
+	ok, err = tryAcquireJobLease("test_job", "node-a", time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// 过期后可被接管
+	require.NoError(t, DB.Model(&JobLease{}).Where("name = ?", "test_job").Update("expires_at", time.Now().Add(-time.Second).Unix()).Error)
+	ok, err = tryAcquireJobLease("test_job", "node-b", time.Minute)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	var lease JobLease
+	require.NoError(t, DB.First(&lease, "name = ?", "test_job").Error)
+	require.Equal(t, "node-b", lease.Holder)
+}
+
+func TestJobLeaderContextCancelledOnLoss(t *testing.T) {
+	const name = "test_fenced_job"
+	jobLeaseLock.Lock()
+	jobLeases[name] = &jobLeaseState{}
+	jobLeaseLock.Unlock()
+	t.Cleanup(func() {
+		jobLeaseLock.Lock()
+		if state := jobLeases[name]; state.timer != nil {
+			state.timer.Stop()
+		}
+		delete(jobLeases, name)
+		jobLeaseLock.Unlock()
+		DB.Exec("DELETE FROM job_leases")
+	})
+
+	renewJobLease(name)
+	ctx, ok := JobLeaderContext(name)
+	require.True(t, ok)
+	require.NoError(t, ctx.Err())
+
+	// 续约仍持有时沿用同一 context
+	renewJobLease(name)
+	same, ok := JobLeaderContext(name)
+	require.True(t, ok)
+	require.Equal(t, ctx, same)
+
+	// 租约被其他节点接管后，续约失败并取消 context
+	require.NoError(t, DB.Model(&JobLease{}).Where("name = ?", name).Updates(map[string]any{
+		"holder":     "other-" + common.NodeId,
+		"expires_at": GetDBTimestamp() + 60,
+	}).Error)
+	renewJobLease(name)
+	require.Error(t, ctx.Err())
+	_, ok = JobLeaderContext(name)
+	require.False(t, ok)
+	require.False(t, IsJobLeader(name))
+}
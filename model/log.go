@@ -7,7 +7,9 @@ import (
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/setting/system_setting"
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/gin-gonic/gin"
@@ -26,6 +28,7 @@ type Log struct {
 	TokenName        string `json:"token_name" gorm:"index;default:''"`
 	ModelName        string `json:"model_name" gorm:"index;index:index_username_model_name,priority:1;default:''"`
 	Quota            int    `json:"quota" gorm:"default:0"`
+	UpstreamCost     int    `json:"upstream_cost" gorm:"default:0"` // 上游渠道成本（额度单位）
 	PromptTokens     int    `json:"prompt_tokens" gorm:"default:0"`
 	CompletionTokens int    `json:"completion_tokens" gorm:"default:0"`
 	UseTime          int    `json:"use_time" gorm:"default:0"`
@@ -95,6 +98,7 @@ func RecordErrorLog(c *gin.Context, userId int, channelId int, modelName string,
 	logger.LogInfo(c, fmt.Sprintf("record error log: userId=%d, channelId=%d, modelName=%s, tokenName=%s, content=%s", userId, channelId, modelName, tokenName, content))
 	username := c.GetString("username")
 	requestId := c.GetString(common.RequestIdKey)
+	other = appendLogRelayFormat(c, other)
 	otherStr := common.MapToJsonStr(other)
 	// 判断是否需要记录 IP
 	needRecordIp := false
@@ -132,6 +136,7 @@ func RecordErrorLog(c *gin.Context, userId int, channelId int, modelName string,
 	if err != nil {
 		logger.LogError(c, "failed to record log: "+err.Error())
 	}
+	recordLogUsageRollup(c, log, other)
 }
 
 type RecordConsumeLogParams struct {
@@ -141,6 +146,7 @@ type RecordConsumeLogParams struct {
 	ModelName        string                 `json:"model_name"`
 	TokenName        string                 `json:"token_name"`
 	Quota            int                    `json:"quota"`
+	UpstreamCost     int                    `json:"upstream_cost"`
 	Content          string                 `json:"content"`
 	TokenId          int                    `json:"token_id"`
 	UseTimeSeconds   int                    `json:"use_time_seconds"`
@@ -151,11 +157,27 @@ type RecordConsumeLogParams struct {
 
 func RecordConsumeLog(c *gin.Context, userId int, params RecordConsumeLogParams) {
 	if !common.LogConsumeEnabled {
+		params.Other = appendLogRelayFormat(c, params.Other)
+		// 关闭消费日志时仍然累加用量汇总
+		recordLogUsageRollup(c, &Log{
+			UserId:           userId,
+			CreatedAt:        common.GetTimestamp(),
+			Type:             LogTypeConsume,
+			PromptTokens:     params.PromptTokens,
+			CompletionTokens: params.CompletionTokens,
+			ModelName:        params.ModelName,
+			Quota:            params.Quota,
+			ChannelId:        params.ChannelId,
+			TokenId:          params.TokenId,
+			UseTime:          params.UseTimeSeconds,
+			Group:            params.Group,
+		}, params.Other)
 		return
 	}
 	logger.LogInfo(c, fmt.Sprintf("record consume log: userId=%d, params=%s", userId, common.GetJsonString(params)))
 	username := c.GetString("username")
 	requestId := c.GetString(common.RequestIdKey)
+	params.Other = appendLogRelayFormat(c, params.Other)
 	otherStr := common.MapToJsonStr(params.Other)
 	// 判断是否需要记录 IP
 	needRecordIp := false
@@ -175,6 +197,7 @@ func RecordConsumeLog(c *gin.Context, userId int, params RecordConsumeLogParams)
 		TokenName:        params.TokenName,
 		ModelName:        params.ModelName,
 		Quota:            params.Quota,
+		UpstreamCost:     params.UpstreamCost,
 		ChannelId:        params.ChannelId,
 		TokenId:          params.TokenId,
 		UseTime:          params.UseTimeSeconds,
@@ -193,6 +216,7 @@ func RecordConsumeLog(c *gin.Context, userId int, params RecordConsumeLogParams)
 	if err != nil {
 		logger.LogError(c, "failed to record log: "+err.Error())
 	}
+	recordLogUsageRollup(c, log, params.Other)
 	if common.DataExportEnabled {
 		gopool.Go(func() {
 			LogQuotaData(userId, username, params.ModelName, params.Quota, common.GetTimestamp(), params.PromptTokens+params.CompletionTokens)
@@ -207,9 +231,11 @@ type RecordTaskBillingLogParams struct {
 	ChannelId int
 	ModelName string
 	Quota     int
-	TokenId   int
-	Group     string
-	Other     map[string]interface{}
+	// UpstreamCost 退款日志记录退还部分对应的上游成本，毛利报表按此冲减成本
+	UpstreamCost int
+	TokenId      int
+	Group        string
+	Other        map[string]interface{}
 }
 
 func RecordTaskBillingLog(params RecordTaskBillingLogParams) {
@@ -224,23 +250,57 @@ func RecordTaskBillingLog(params RecordTaskBillingLogParams) {
 		}
 	}
 	log := &Log{
-		UserId:    params.UserId,
-		Username:  username,
-		CreatedAt: common.GetTimestamp(),
-		Type:      params.LogType,
-		Content:   params.Content,
-		TokenName: tokenName,
-		ModelName: params.ModelName,
-		Quota:     params.Quota,
-		ChannelId: params.ChannelId,
-		TokenId:   params.TokenId,
-		Group:     params.Group,
-		Other:     common.MapToJsonStr(params.Other),
+		UserId:       params.UserId,
+		Username:     username,
+		CreatedAt:    common.GetTimestamp(),
+		Type:         params.LogType,
+		Content:      params.Content,
+		TokenName:    tokenName,
+		ModelName:    params.ModelName,
+		Quota:        params.Quota,
+		ChannelId:    params.ChannelId,
+		TokenId:      params.TokenId,
+		UpstreamCost: params.UpstreamCost,
+		Group:        params.Group,
+		Other:        common.MapToJsonStr(params.Other),
 	}
 	err := LOG_DB.Create(log).Error
 	if err != nil {
 		common.SysLog("failed to record task billing log: " + err.Error())
 	}
+	recordLogUsageRollup(nil, log, params.Other)
+}
+
+// appendLogRelayFormat 在 other 中记录请求格式，供用量汇总及回填按格式分组
+func appendLogRelayFormat(c *gin.Context, other map[string]interface{}) map[string]interface{} {
+	if c == nil {
+		return other
+	}
+	relayFormat := common.GetContextKeyString(c, constant.ContextKeyRelayFormat)
+	if relayFormat == "" {
+		return other
+	}
+	if other == nil {
+		other = make(map[string]interface{})
+	}
+	if _, ok := other["relay_format"]; !ok {
+		other["relay_format"] = relayFormat
+	}
+	return other
+}
+
+// recordLogUsageRollup 日志写入后累加多维用量汇总，c 为空时使用日志中的秒级耗时
+func recordLogUsageRollup(c *gin.Context, log *Log, other map[string]interface{}) {
+	if !system_setting.GetUsageRollupSetting().Enabled {
+		return
+	}
+	var latencyMs int64
+	if c != nil {
+		if startTime := common.GetContextKeyTime(c, constant.ContextKeyRequestStartTime); !startTime.IsZero() {
+			latencyMs = time.Since(startTime).Milliseconds()
+		}
+	}
+	RecordUsageRollup(UsageRollupEventFromLog(log, other, latencyMs))
 }
 
 func GetAllLogs(logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string, startIdx int, num int, channel int, group string, requestId string) (logs []*Log, total int64, err error) {
@@ -0,0 +1,136 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+const (
+	MarginGroupByChannel = "channel"
+	MarginGroupByModel   = "model"
+	MarginGroupByGroup   = "group"
+	MarginGroupByDay     = "day"
+)
+
+// MarginReportItem 收入/上游成本/毛利汇总，金额均为额度单位
+type MarginReportItem struct {
+	Key              string  `json:"key"`
+	Name             string  `json:"name,omitempty"`
+	Requests         int64   `json:"requests"`
+	Revenue          int64   `json:"revenue"`
+	Cost             int64   `json:"cost"`
+	Margin           int64   `json:"margin"`
+	MarginRate       float64 `json:"margin_rate"`
+	UntrackedRevenue int64   `json:"untracked_revenue"` // 渠道未配置成本的收入，不参与毛利率计算
+}
+
+type MarginReportQuery struct {
+	GroupBy        string
+	StartTimestamp int64
+	EndTimestamp   int64
+	ChannelId      int
+	ModelName      string
+	Group          string
+}
+
+func marginGroupExpr(groupBy string) (string, error) {
+	switch groupBy {
+	case MarginGroupByChannel, "":
+		return "channel_id", nil
+	case MarginGroupByModel:
+		return "model_name", nil
+	case MarginGroupByGroup:
+		return logGroupCol, nil
+	case MarginGroupByDay:
+		return "created_at - created_at % 86400", nil
+	}
+	return "", errors.New("不支持的分组方式")
+}
+
+// GetMarginReport 按渠道/模型/分组/天汇总消费日志中的收入与上游成本，退款日志冲减对应的收入与成本
+func GetMarginReport(query MarginReportQuery) ([]*MarginReportItem, error) {
+	expr, err := marginGroupExpr(query.GroupBy)
+	if err != nil {
+		return nil, err
+	}
+	signedQuota := fmt.Sprintf("CASE WHEN type = %d THEN -quota ELSE quota END", LogTypeRefund)
+	tx := LOG_DB.Table("logs").
+		Select(fmt.Sprintf("%s AS bucket, sum(CASE WHEN type = %d THEN 1 ELSE 0 END) AS requests, sum(%s) AS revenue, "+
+			"sum(CASE WHEN type = %d THEN -upstream_cost ELSE upstream_cost END) AS cost, "+
+			"sum(CASE WHEN upstream_cost = 0 THEN %s ELSE 0 END) AS untracked_revenue",
+			expr, LogTypeConsume, signedQuota, LogTypeRefund, signedQuota)).
+		Where("type IN ?", []int{LogTypeConsume, LogTypeRefund})
+	if query.StartTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", query.StartTimestamp)
+	}
+	if query.EndTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", query.EndTimestamp)
+	}
+	if query.ChannelId != 0 {
+		tx = tx.Where("channel_id = ?", query.ChannelId)
+	}
+	if query.ModelName != "" {
+		tx = tx.Where("model_name = ?", query.ModelName)
+	}
+	if query.Group != "" {
+		tx = tx.Where(logGroupCol+" = ?", query.Group)
+	}
+	var rows []struct {
+		Bucket           string
+		Requests         int64
+		Revenue          int64
+		Cost             int64
+		UntrackedRevenue int64
+	}
+	if err := tx.Group("bucket").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	items := make([]*MarginReportItem, 0, len(rows))
+	channelIds := make([]int, 0)
+	for _, row := range rows {
+		item := &MarginReportItem{
+			Key:              row.Bucket,
+			Requests:         row.Requests,
+			Revenue:          row.Revenue,
+			Cost:             row.Cost,
+			UntrackedRevenue: row.UntrackedRevenue,
+		}
+		tracked := row.Revenue - row.UntrackedRevenue
+		item.Margin = tracked - row.Cost
+		if tracked > 0 {
+			item.MarginRate = float64(item.Margin) / float64(tracked)
+		}
+		items = append(items, item)
+		if query.GroupBy == MarginGroupByChannel || query.GroupBy == "" {
+			if id, err := strconv.Atoi(row.Bucket); err == nil {
+				channelIds = append(channelIds, id)
+			}
+		}
+	}
+
+	if len(channelIds) > 0 {
+		var channels []struct {
+			Id   int
+			Name string
+		}
+		if err := DB.Table("channels").Select("id, name").Where("id IN ?", channelIds).Find(&channels).Error; err == nil {
+			names := make(map[string]string, len(channels))
+			for _, ch := range channels {
+				names[strconv.Itoa(ch.Id)] = ch.Name
+			}
+			for _, item := range items {
+				item.Name = names[item.Key]
+			}
+		}
+	}
+
+	if query.GroupBy == MarginGroupByDay {
+		sort.Slice(items, func(i, j int) bool { return items[i].Key < items[j].Key })
+	} else {
+		sort.Slice(items, func(i, j int) bool { return items[i].Margin < items[j].Margin })
+	}
+	return items, nil
+}
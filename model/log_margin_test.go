@@ -0,0 +1,46 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetMarginReportByChannel(t *testing.T) {
+	t.Cleanup(func() {
+		DB.Exec("DELETE FROM logs")
+		DB.Exec("DELETE FROM channels")
+	})
+	require.NoError(t, DB.Create(&Channel{Id: 901, Name: "reseller-a"}).Error)
+	logs := []*Log{
+		{Type: LogTypeConsume, ChannelId: 901, ModelName: "gpt-4o", Quota: 1000, UpstreamCost: 1200, CreatedAt: 100},
+		{Type: LogTypeConsume, ChannelId: 901, ModelName: "gpt-4o", Quota: 500, UpstreamCost: 0, CreatedAt: 200},
+		{Type: LogTypeConsume, ChannelId: 902, ModelName: "gpt-4o", Quota: 1000, UpstreamCost: 600, CreatedAt: 300},
+		{Type: LogTypeTopup, ChannelId: 902, Quota: 99999, CreatedAt: 300},
+		// 失败后退款的任务：收入与成本都被冲减
+		{Type: LogTypeConsume, ChannelId: 902, ModelName: "video", Quota: 2000, UpstreamCost: 1500, CreatedAt: 400},
+		{Type: LogTypeRefund, ChannelId: 902, ModelName: "video", Quota: 2000, UpstreamCost: 1500, CreatedAt: 500},
+	}
+	for _, l := range logs {
+		require.NoError(t, LOG_DB.Create(l).Error)
+	}
+
+	items, err := GetMarginReport(MarginReportQuery{GroupBy: MarginGroupByChannel})
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+
+	// 亏损渠道排在最前
+	require.Equal(t, "901", items[0].Key)
+	require.Equal(t, "reseller-a", items[0].Name)
+	require.EqualValues(t, 2, items[0].Requests)
+	require.EqualValues(t, 1500, items[0].Revenue)
+	require.EqualValues(t, 500, items[0].UntrackedRevenue)
+	require.EqualValues(t, -200, items[0].Margin)
+
+	require.Equal(t, "902", items[1].Key)
+	require.EqualValues(t, 2, items[1].Requests)
+	require.EqualValues(t, 1000, items[1].Revenue)
+	require.EqualValues(t, 600, items[1].Cost)
+	require.EqualValues(t, 400, items[1].Margin)
+	require.InDelta(t, 0.4, items[1].MarginRate, 1e-9)
+}
@@ -196,6 +196,10 @@ func InitDB() (err error) {
 		sqlDB.SetConnMaxLifetime(time.Second * time.Duration(common.GetEnvOrDefault("SQL_MAX_LIFETIME", 60)))
 
 		if !common.IsMasterNode {
+			// 选主租约表所有节点都会使用，从节点可能先于主节点启动
+			if err := DB.AutoMigrate(&JobLease{}); err != nil {
+				common.SysError("failed to migrate JobLease: " + err.Error())
+			}
 			return nil
 		}
 		if common.UsingMySQL {
@@ -254,9 +258,13 @@ func migrateDB() error {
 	if err := migrateTokenModelLimitsToText(); err != nil {
 		return err
 	}
+	if err := migrateStatementRevisionIndex(); err != nil {
+		return err
+	}
 
 	err := DB.AutoMigrate(
 		&Channel{},
+		&ChannelBalanceSnapshot{},
 		&Token{},
 		&User{},
 		&PasskeyCredential{},
@@ -264,7 +272,8 @@ func migrateDB() error {
 		&Redemption{},
 		&Ability{},
 		&Log{},
-		&Midjourney{},
+		&UsageRollup{},
+		&Statement{},
 		&TopUp{},
 		&QuotaData{},
 		&Task{},
@@ -275,15 +284,30 @@ func migrateDB() error {
 		&TwoFA{},
 		&TwoFABackupCode{},
 		&Checkin{},
+		&UserLoginIp{},
 		&SubscriptionOrder{},
 		&UserSubscription{},
 		&SubscriptionPreConsumeRecord{},
 		&CustomOAuthProvider{},
 		&UserOAuthBinding{},
+		&AuditLog{},
+		&AuditLogHead{},
+		&ConfigSnapshot{},
+		&CacheEvent{},
+		&JobLease{},
+		&MediaObject{},
+		&MediaUserPolicy{},
+		&TaskWebhookDelivery{},
 	)
 	if err != nil {
 		return err
 	}
+	if err := migrateConfigSnapshotContent(); err != nil {
+		return err
+	}
+	if err := migrateMidjourneyTasks(); err != nil {
+		return err
+	}
 	if common.UsingSQLite {
 		if err := ensureSubscriptionPlanTableSQLite(); err != nil {
 			return err
@@ -297,6 +321,9 @@ func migrateDB() error {
 }
 
 func migrateDBFast() error {
+	if err := migrateStatementRevisionIndex(); err != nil {
+		return err
+	}
 
 	var wg sync.WaitGroup
 
@@ -305,6 +332,7 @@ func migrateDBFast() error {
 		name  string
 	}{
 		{&Channel{}, "Channel"},
+		{&ChannelBalanceSnapshot{}, "ChannelBalanceSnapshot"},
 		{&Token{}, "Token"},
 		{&User{}, "User"},
 		{&PasskeyCredential{}, "PasskeyCredential"},
@@ -312,7 +340,8 @@ func migrateDBFast() error {
 		{&Redemption{}, "Redemption"},
 		{&Ability{}, "Ability"},
 		{&Log{}, "Log"},
-		{&Midjourney{}, "Midjourney"},
+		{&UsageRollup{}, "UsageRollup"},
+		{&Statement{}, "Statement"},
 		{&TopUp{}, "TopUp"},
 		{&QuotaData{}, "QuotaData"},
 		{&Task{}, "Task"},
@@ -323,11 +352,20 @@ func migrateDBFast() error {
 		{&TwoFA{}, "TwoFA"},
 		{&TwoFABackupCode{}, "TwoFABackupCode"},
 		{&Checkin{}, "Checkin"},
+		{&UserLoginIp{}, "UserLoginIp"},
 		{&SubscriptionOrder{}, "SubscriptionOrder"},
 		{&UserSubscription{}, "UserSubscription"},
 		{&SubscriptionPreConsumeRecord{}, "SubscriptionPreConsumeRecord"},
 		{&CustomOAuthProvider{}, "CustomOAuthProvider"},
 		{&UserOAuthBinding{}, "UserOAuthBinding"},
+		{&AuditLog{}, "AuditLog"},
+		{&AuditLogHead{}, "AuditLogHead"},
+		{&ConfigSnapshot{}, "ConfigSnapshot"},
+		{&CacheEvent{}, "CacheEvent"},
+		{&JobLease{}, "JobLease"},
+		{&MediaObject{}, "MediaObject"},
+		{&MediaUserPolicy{}, "MediaUserPolicy"},
+		{&TaskWebhookDelivery{}, "TaskWebhookDelivery"},
 	}
 	// 动态计算migration数量，确保errChan缓冲区足够大
 	errChan := make(chan error, len(migrations))
@@ -352,6 +390,12 @@ func migrateDBFast() error {
 			return err
 		}
 	}
+	if err := migrateConfigSnapshotContent(); err != nil {
+		return err
+	}
+	if err := migrateMidjourneyTasks(); err != nil {
+		return err
+	}
 	if common.UsingSQLite {
 		if err := ensureSubscriptionPlanTableSQLite(); err != nil {
 			return err
@@ -367,7 +411,7 @@ func migrateDBFast() error {
 
 func migrateLOGDB() error {
 	var err error
-	if err = LOG_DB.AutoMigrate(&Log{}); err != nil {
+	if err = LOG_DB.AutoMigrate(&Log{}, &UsageRollup{}); err != nil {
 		return err
 	}
 	return nil
@@ -0,0 +1,150 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrMediaQuotaExceeded = errors.New("media storage quota exceeded")
+
+const (
+	MediaSourceTask       = "task"
+	MediaSourceMidjourney = "midjourney"
+	MediaSourceImage      = "image"
+)
+
+// MediaObject 持久化保存的生成内容
+type MediaObject struct {
+	Id          int    `json:"id"`
+	UserId      int    `json:"user_id" gorm:"index"`
+	Key         string `json:"key" gorm:"type:varchar(255);uniqueIndex"`
+	Backend     string `json:"backend" gorm:"type:varchar(16)"`
+	SourceType  string `json:"source_type" gorm:"type:varchar(32);index:idx_media_source,priority:1"`
+	SourceId    string `json:"source_id" gorm:"type:varchar(191);index:idx_media_source,priority:2"`
+	SourceUrl   string `json:"-" gorm:"type:text"`
+	ContentType string `json:"content_type" gorm:"type:varchar(128)"`
+	Size        int64  `json:"size" gorm:"bigint"`
+	CreatedAt   int64  `json:"created_at" gorm:"bigint"`
+	ExpiresAt   int64  `json:"expires_at" gorm:"bigint;index"` // 0 表示永久保留
+}
+
+// MediaUserPolicy 单个用户的保留天数与存储配额，未设置的字段使用全局默认值
+type MediaUserPolicy struct {
+	UserId        int    `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	RetentionDays *int   `json:"retention_days"`
+	QuotaBytes    *int64 `json:"quota_bytes"`
+	UpdatedAt     int64  `json:"updated_at" gorm:"bigint"`
+}
+
+func CreateMediaObject(obj *MediaObject) error {
+	if obj.CreatedAt == 0 {
+		obj.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Create(obj).Error
+}
+
+// CreateMediaObjectWithinQuota 在同一事务中锁定用户行、统计已用空间并写入记录，
+// 避免并发保存时各自通过检查后合计超出配额；quotaBytes <= 0 表示不限制
+func CreateMediaObjectWithinQuota(obj *MediaObject, quotaBytes int64) error {
+	if quotaBytes <= 0 {
+		return CreateMediaObject(obj)
+	}
+	if obj.CreatedAt == 0 {
+		obj.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var user User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id = ?", obj.UserId).Limit(1).Find(&user).Error; err != nil {
+			return err
+		}
+		var usage int64
+		if err := tx.Model(&MediaObject{}).Where("user_id = ?", obj.UserId).Select("COALESCE(SUM(size), 0)").Scan(&usage).Error; err != nil {
+			return err
+		}
+		if usage+obj.Size > quotaBytes {
+			return ErrMediaQuotaExceeded
+		}
+		return tx.Create(obj).Error
+	})
+}
+
+func GetMediaObjectById(id int) (*MediaObject, error) {
+	var obj MediaObject
+	if err := DB.First(&obj, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &obj, nil
+}
+
+// GetMediaObjectsBySource 返回某个任务/请求产生的全部对象，按保存顺序排列
+func GetMediaObjectsBySource(sourceType string, sourceId string) ([]*MediaObject, error) {
+	var objs []*MediaObject
+	err := DB.Where("source_type = ? AND source_id = ?", sourceType, sourceId).Order("id asc").Find(&objs).Error
+	return objs, err
+}
+
+func GetUserMediaUsage(userId int) (int64, error) {
+	var usage int64
+	err := DB.Model(&MediaObject{}).Where("user_id = ?", userId).Select("COALESCE(SUM(size), 0)").Scan(&usage).Error
+	return usage, err
+}
+
+func GetUserMediaObjects(userId int, pageInfo *common.PageInfo) (objs []*MediaObject, total int64, err error) {
+	tx := DB.Model(&MediaObject{})
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(pageInfo.GetPageSize()).Offset(pageInfo.GetStartIdx()).Find(&objs).Error
+	return objs, total, err
+}
+
+func GetExpiredMediaObjects(now int64, limit int) ([]*MediaObject, error) {
+	var objs []*MediaObject
+	err := DB.Where("expires_at > 0 AND expires_at <= ?", now).Order("id asc").Limit(limit).Find(&objs).Error
+	return objs, err
+}
+
+func DeleteMediaObjectById(id int) error {
+	return DB.Delete(&MediaObject{}, "id = ?", id).Error
+}
+
+// GetMediaUserPolicy 用户未单独配置时返回 nil
+func GetMediaUserPolicy(userId int) (*MediaUserPolicy, error) {
+	var policy MediaUserPolicy
+	err := DB.First(&policy, "user_id = ?", userId).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func UpsertMediaUserPolicy(policy *MediaUserPolicy) error {
+	policy.UpdatedAt = common.GetTimestamp()
+	return DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"retention_days", "quota_bytes", "updated_at"}),
+	}).Create(policy).Error
+}
+
+func DeleteMediaUserPolicy(userId int) error {
+	return DB.Delete(&MediaUserPolicy{}, "user_id = ?", userId).Error
+}
+
+// MediaExpiresAt 根据保留天数计算过期时间
+func MediaExpiresAt(retentionDays int) int64 {
+	if retentionDays <= 0 {
+		return 0
+	}
+	return time.Now().Add(time.Duration(retentionDays) * 24 * time.Hour).Unix()
+}
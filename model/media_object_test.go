@@ -0,0 +1,23 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateMediaObjectWithinQuota(t *testing.T) {
+	t.Cleanup(func() { DB.Exec("DELETE FROM media_objects") })
+
+	// 两次保存都已通过预检查，写入记录时以事务内的用量为准
+	require.NoError(t, CreateMediaObjectWithinQuota(&MediaObject{UserId: 7, Key: "7/a", Size: 5}, 8))
+	err := CreateMediaObjectWithinQuota(&MediaObject{UserId: 7, Key: "7/b", Size: 5}, 8)
+	require.ErrorIs(t, err, ErrMediaQuotaExceeded)
+
+	usage, err := GetUserMediaUsage(7)
+	require.NoError(t, err)
+	require.EqualValues(t, 5, usage)
+
+	require.NoError(t, CreateMediaObjectWithinQuota(&MediaObject{UserId: 7, Key: "7/c", Size: 3}, 8))
+	require.NoError(t, CreateMediaObjectWithinQuota(&MediaObject{UserId: 7, Key: "7/d", Size: 5}, 0))
+}
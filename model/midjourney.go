@@ -1,5 +1,14 @@
 package model
 
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+)
+
+// Midjourney MJ 任务视图，保持 /mj/* 与 /api/mj 的返回格式不变。
+// 数据实际保存在 tasks 表（platform = mj），旧的 midjourneys 表仅作为迁移来源。
 type Midjourney struct {
 	Id          int    `json:"id"`
 	Code        int    `json:"code"`
@@ -23,198 +32,259 @@ type Midjourney struct {
 	Quota       int    `json:"quota"`
 	Buttons     string `json:"buttons"`
 	Properties  string `json:"properties"`
+	CallbackUrl string `json:"-" gorm:"type:varchar(512)"`
 }
 
-// TaskQueryParams 用于包含所有搜索条件的结构体，可以根据需求添加更多字段
-type TaskQueryParams struct {
-	ChannelID      string
-	MjID           string
-	StartTimestamp string
-	EndTimestamp   string
+// MidjourneyTaskData MJ 特有字段，保存在 Task.Data 中；时间为上游返回的毫秒时间戳
+type MidjourneyTaskData struct {
+	Code        int    `json:"code"`
+	Prompt      string `json:"prompt"`
+	PromptEn    string `json:"prompt_en,omitempty"`
+	Description string `json:"description,omitempty"`
+	State       string `json:"state,omitempty"`
+	SubmitTime  int64  `json:"submit_time"`
+	StartTime   int64  `json:"start_time,omitempty"`
+	FinishTime  int64  `json:"finish_time,omitempty"`
+	ImageUrl    string `json:"image_url,omitempty"`
+	VideoUrl    string `json:"video_url,omitempty"`
+	VideoUrls   string `json:"video_urls,omitempty"`
+	Buttons     string `json:"buttons,omitempty"`
+	Properties  string `json:"properties,omitempty"`
 }
 
-func GetAllUserTask(userId int, startIdx int, num int, queryParams TaskQueryParams) []*Midjourney {
-	var tasks []*Midjourney
-	var err error
-
-	// 初始化查询构建器
-	query := DB.Where("user_id = ?", userId)
+// NewMidjourneyTask 由 MJ 任务视图构建 tasks 表记录
+func NewMidjourneyTask(m *Midjourney) *Task {
+	t := &Task{}
+	t.SetMidjourney(m)
+	return t
+}
 
-	if queryParams.MjID != "" {
-		query = query.Where("mj_id = ?", queryParams.MjID)
+// SetMidjourney 将 MJ 任务视图的字段写回 Task，不修改分组与计费上下文
+func (t *Task) SetMidjourney(m *Midjourney) {
+	t.TaskID = m.MjId
+	t.Platform = constant.TaskPlatformMidjourney
+	t.UserId = m.UserId
+	t.ChannelId = m.ChannelId
+	t.Quota = m.Quota
+	t.Action = m.Action
+	t.Status = TaskStatus(m.Status)
+	if t.Status == "" {
+		t.Status = TaskStatusSubmitted
 	}
-	if queryParams.StartTimestamp != "" {
-		// 假设您已将前端传来的时间戳转换为数据库所需的时间格式，并处理了时间戳的验证和解析
-		query = query.Where("submit_time >= ?", queryParams.StartTimestamp)
+	t.Progress = m.Progress
+	t.FailReason = m.FailReason
+	t.SubmitTime = m.SubmitTime / 1000
+	t.StartTime = m.StartTime / 1000
+	t.FinishTime = m.FinishTime / 1000
+	t.Properties.Input = m.Prompt
+	t.PrivateData.ResultURL = m.ImageUrl
+	t.PrivateData.CallbackURL = m.CallbackUrl
+	t.SetData(MidjourneyTaskData{
+		Code:        m.Code,
+		Prompt:      m.Prompt,
+		PromptEn:    m.PromptEn,
+		Description: m.Description,
+		State:       m.State,
+		SubmitTime:  m.SubmitTime,
+		StartTime:   m.StartTime,
+		FinishTime:  m.FinishTime,
+		ImageUrl:    m.ImageUrl,
+		VideoUrl:    m.VideoUrl,
+		VideoUrls:   m.VideoUrls,
+		Buttons:     m.Buttons,
+		Properties:  m.Properties,
+	})
+}
+
+// ToMidjourney 将 tasks 表中的 MJ 任务还原为 MJ 任务视图
+func (t *Task) ToMidjourney() *Midjourney {
+	var data MidjourneyTaskData
+	if len(t.Data) > 0 {
+		_ = t.GetData(&data)
 	}
-	if queryParams.EndTimestamp != "" {
-		query = query.Where("submit_time <= ?", queryParams.EndTimestamp)
+	return &Midjourney{
+		Id:          int(t.ID),
+		Code:        data.Code,
+		UserId:      t.UserId,
+		Action:      t.Action,
+		MjId:        t.TaskID,
+		Prompt:      data.Prompt,
+		PromptEn:    data.PromptEn,
+		Description: data.Description,
+		State:       data.State,
+		SubmitTime:  data.SubmitTime,
+		StartTime:   data.StartTime,
+		FinishTime:  data.FinishTime,
+		ImageUrl:    data.ImageUrl,
+		VideoUrl:    data.VideoUrl,
+		VideoUrls:   data.VideoUrls,
+		Status:      string(t.Status),
+		Progress:    t.Progress,
+		FailReason:  t.FailReason,
+		ChannelId:   t.ChannelId,
+		Quota:       t.Quota,
+		Buttons:     data.Buttons,
+		Properties:  data.Properties,
+		CallbackUrl: t.PrivateData.CallbackURL,
 	}
+}
 
-	// 获取数据
-	err = query.Order("id desc").Limit(num).Offset(startIdx).Find(&tasks).Error
-	if err != nil {
-		return nil
+// FillMidjourneyBillingDefaults 为从旧 midjourneys 表迁移的任务补全分组与计费上下文。
+// 旧表没有令牌与计费快照：分组取用户当前分组，扣费额度视为按次价格、分组倍率记为 1，退款只退还钱包
+func (t *Task) FillMidjourneyBillingDefaults() {
+	if t.Group == "" {
+		t.Group, _ = GetUserGroup(t.UserId, false)
 	}
-
-	return tasks
+	t.fillMidjourneyBillingContext()
 }
 
-func GetAllTasks(startIdx int, num int, queryParams TaskQueryParams) []*Midjourney {
-	var tasks []*Midjourney
-	var err error
-
-	// 初始化查询构建器
-	query := DB
-
-	// 添加过滤条件
-	if queryParams.ChannelID != "" {
-		query = query.Where("channel_id = ?", queryParams.ChannelID)
+func (t *Task) fillMidjourneyBillingContext() {
+	modelName := constant.MidjourneyActionModelName(t.Action)
+	if t.Properties.OriginModelName == "" {
+		t.Properties.OriginModelName = modelName
 	}
-	if queryParams.MjID != "" {
-		query = query.Where("mj_id = ?", queryParams.MjID)
+	if t.PrivateData.BillingSource == "" {
+		t.PrivateData.BillingSource = "wallet"
 	}
-	if queryParams.StartTimestamp != "" {
-		query = query.Where("submit_time >= ?", queryParams.StartTimestamp)
+	if t.PrivateData.BillingContext == nil {
+		t.PrivateData.BillingContext = &TaskBillingContext{
+			ModelPrice:      float64(t.Quota) / common.QuotaPerUnit,
+			GroupRatio:      1,
+			OriginModelName: modelName,
+			PerCallBilling:  true,
+		}
 	}
-	if queryParams.EndTimestamp != "" {
-		query = query.Where("submit_time <= ?", queryParams.EndTimestamp)
-	}
-
-	// 获取数据
-	err = query.Order("id desc").Limit(num).Offset(startIdx).Find(&tasks).Error
-	if err != nil {
-		return nil
-	}
-
-	return tasks
 }
 
-func GetAllUnFinishTasks() []*Midjourney {
-	var tasks []*Midjourney
-	var err error
-	// get all tasks progress is not 100%
-	err = DB.Where("progress != ?", "100%").Find(&tasks).Error
+func GetByOnlyMJId(mjId string) *Task {
+	var task *Task
+	err := DB.Where("platform = ? and task_id = ?", constant.TaskPlatformMidjourney, mjId).Order("id desc").First(&task).Error
 	if err != nil {
 		return nil
 	}
-	return tasks
+	return task
 }
 
-func GetByOnlyMJId(mjId string) *Midjourney {
-	var mj *Midjourney
-	var err error
-	err = DB.Where("mj_id = ?", mjId).First(&mj).Error
+func GetByMJId(userId int, mjId string) *Task {
+	var task *Task
+	err := DB.Where("platform = ? and user_id = ? and task_id = ?", constant.TaskPlatformMidjourney, userId, mjId).Order("id desc").First(&task).Error
 	if err != nil {
 		return nil
 	}
-	return mj
+	return task
 }
 
-func GetByMJId(userId int, mjId string) *Midjourney {
-	var mj *Midjourney
-	var err error
-	err = DB.Where("user_id = ? and mj_id = ?", userId, mjId).First(&mj).Error
+func GetByMJIds(userId int, mjIds []string) []*Task {
+	var tasks []*Task
+	err := DB.Where("platform = ? and user_id = ? and task_id in (?)", constant.TaskPlatformMidjourney, userId, mjIds).Find(&tasks).Error
 	if err != nil {
 		return nil
 	}
-	return mj
+	return tasks
 }
 
-func GetByMJIds(userId int, mjIds []string) []*Midjourney {
-	var mj []*Midjourney
-	var err error
-	err = DB.Where("user_id = ? and mj_id in (?)", userId, mjIds).Find(&mj).Error
-	if err != nil {
+const midjourneyMigrateBatchSize = 500
+
+// migrateMidjourneyTasks 将旧 midjourneys 表的记录迁移到 tasks 表。
+// 已迁移的记录按 task_id 跳过，可重复执行；旧表保留以便回滚。
+func migrateMidjourneyTasks() error {
+	if !DB.Migrator().HasTable(&Midjourney{}) {
 		return nil
 	}
-	return mj
-}
-
-func GetMjByuId(id int) *Midjourney {
-	var mj *Midjourney
-	var err error
-	err = DB.Where("id = ?", id).First(&mj).Error
-	if err != nil {
+	var last Midjourney
+	if err := DB.Order("id desc").Limit(1).Find(&last).Error; err != nil || last.Id == 0 {
+		return err
+	}
+	if midjourneyTaskMigrated(&last) {
 		return nil
 	}
-	return mj
-}
-
-func UpdateProgress(id int, progress string) error {
-	return DB.Model(&Midjourney{}).Where("id = ?", id).Update("progress", progress).Error
-}
-
-func (midjourney *Midjourney) Insert() error {
-	var err error
-	err = DB.Create(midjourney).Error
-	return err
-}
-
-func (midjourney *Midjourney) Update() error {
-	var err error
-	err = DB.Save(midjourney).Error
-	return err
-}
 
-// UpdateWithStatus performs a conditional UPDATE guarded by fromStatus (CAS).
-// Returns (true, nil) if this caller won the update, (false, nil) if
-// another process already moved the task out of fromStatus.
-// UpdateWithStatus performs a conditional UPDATE guarded by fromStatus (CAS).
-// Uses Model().Select("*").Updates() to avoid GORM Save()'s INSERT fallback.
-func (midjourney *Midjourney) UpdateWithStatus(fromStatus string) (bool, error) {
-	result := DB.Model(midjourney).Where("status = ?", fromStatus).Select("*").Updates(midjourney)
-	if result.Error != nil {
-		return false, result.Error
-	}
-	return result.RowsAffected > 0, nil
-}
+	common.SysLog("migrating midjourney tasks to tasks table")
+	lastId, migrated := 0, 0
+	for {
+		var batch []*Midjourney
+		if err := DB.Where("id > ?", lastId).Order("id asc").Limit(midjourneyMigrateBatchSize).Find(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		lastId = batch[len(batch)-1].Id
 
-func MjBulkUpdate(mjIds []string, params map[string]any) error {
-	return DB.Model(&Midjourney{}).
-		Where("mj_id in (?)", mjIds).
-		Updates(params).Error
-}
+		ids := make([]string, 0, len(batch))
+		for _, m := range batch {
+			ids = append(ids, legacyMidjourneyTaskID(m))
+		}
+		var existing []string
+		if err := DB.Model(&Task{}).Where("platform = ? and task_id in (?)", constant.TaskPlatformMidjourney, ids).
+			Pluck("task_id", &existing).Error; err != nil {
+			return err
+		}
+		seen := make(map[string]bool, len(existing))
+		for _, id := range existing {
+			seen[id] = true
+		}
 
-func MjBulkUpdateByTaskIds(taskIDs []int, params map[string]any) error {
-	return DB.Model(&Midjourney{}).
-		Where("id in (?)", taskIDs).
-		Updates(params).Error
+		groups, err := legacyMidjourneyUserGroups(batch)
+		if err != nil {
+			return err
+		}
+		tasks := make([]*Task, 0, len(batch))
+		for _, m := range batch {
+			taskID := legacyMidjourneyTaskID(m)
+			if seen[taskID] {
+				continue
+			}
+			seen[taskID] = true
+			task := NewMidjourneyTask(m)
+			task.TaskID = taskID
+			task.CreatedAt = task.SubmitTime
+			task.UpdatedAt = task.SubmitTime
+			task.Group = groups[m.UserId]
+			task.fillMidjourneyBillingContext()
+			if m.MjId == "" {
+				// 提交失败的任务没有上游 ID，直接标记为失败
+				task.Status = TaskStatusFailure
+				task.Progress = "100%"
+			}
+			tasks = append(tasks, task)
+		}
+		if len(tasks) > 0 {
+			if err := DB.CreateInBatches(tasks, 100).Error; err != nil {
+				return err
+			}
+			migrated += len(tasks)
+		}
+	}
+	common.SysLog(fmt.Sprintf("migrated %d midjourney tasks", migrated))
+	return nil
 }
 
-// CountAllTasks returns total midjourney tasks for admin query
-func CountAllTasks(queryParams TaskQueryParams) int64 {
-	var total int64
-	query := DB.Model(&Midjourney{})
-	if queryParams.ChannelID != "" {
-		query = query.Where("channel_id = ?", queryParams.ChannelID)
+func legacyMidjourneyUserGroups(batch []*Midjourney) (map[int]string, error) {
+	userIds := make([]int, 0, len(batch))
+	for _, m := range batch {
+		userIds = append(userIds, m.UserId)
 	}
-	if queryParams.MjID != "" {
-		query = query.Where("mj_id = ?", queryParams.MjID)
+	var users []User
+	if err := DB.Select("id", commonGroupCol).Where("id in (?)", userIds).Find(&users).Error; err != nil {
+		return nil, err
 	}
-	if queryParams.StartTimestamp != "" {
-		query = query.Where("submit_time >= ?", queryParams.StartTimestamp)
+	groups := make(map[int]string, len(users))
+	for _, user := range users {
+		groups[user.Id] = user.Group
 	}
-	if queryParams.EndTimestamp != "" {
-		query = query.Where("submit_time <= ?", queryParams.EndTimestamp)
-	}
-	_ = query.Count(&total).Error
-	return total
+	return groups, nil
 }
 
-// CountAllUserTask returns total midjourney tasks for user
-func CountAllUserTask(userId int, queryParams TaskQueryParams) int64 {
-	var total int64
-	query := DB.Model(&Midjourney{}).Where("user_id = ?", userId)
-	if queryParams.MjID != "" {
-		query = query.Where("mj_id = ?", queryParams.MjID)
-	}
-	if queryParams.StartTimestamp != "" {
-		query = query.Where("submit_time >= ?", queryParams.StartTimestamp)
-	}
-	if queryParams.EndTimestamp != "" {
-		query = query.Where("submit_time <= ?", queryParams.EndTimestamp)
+func legacyMidjourneyTaskID(m *Midjourney) string {
+	if m.MjId == "" {
+		return fmt.Sprintf("mj_legacy_%d", m.Id)
 	}
-	_ = query.Count(&total).Error
-	return total
+	return m.MjId
+}
+
+func midjourneyTaskMigrated(m *Midjourney) bool {
+	var count int64
+	DB.Model(&Task{}).Where("platform = ? and task_id = ?", constant.TaskPlatformMidjourney, legacyMidjourneyTaskID(m)).Count(&count)
+	return count > 0
 }
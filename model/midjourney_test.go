@@ -0,0 +1,62 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrateMidjourneyTasks(t *testing.T) {
+	truncateTables(t)
+	require.NoError(t, DB.AutoMigrate(&Midjourney{}))
+	t.Cleanup(func() {
+		require.NoError(t, DB.Migrator().DropTable(&Midjourney{}))
+	})
+
+	legacy := []*Midjourney{
+		{UserId: 1, Action: constant.MjActionImagine, MjId: "mj-1", Prompt: "a cat", Status: "SUCCESS", Progress: "100%",
+			SubmitTime: 1700000000123, FinishTime: 1700000060456, ImageUrl: "https://cdn.example.com/1.png", ChannelId: 3, Quota: 500,
+			Buttons: `[{"customId":"MJ::JOB::upsample::1"}]`, CallbackUrl: "https://hook.example.com"},
+		{UserId: 1, Action: constant.MjActionImagine, MjId: "mj-1", Status: "SUCCESS", Progress: "100%"},
+		{UserId: 2, Action: constant.MjActionDescribe, Status: "", Progress: "0%", FailReason: "banned"},
+	}
+	require.NoError(t, DB.Create(&legacy).Error)
+	require.NoError(t, DB.Create(&User{Id: 1, Username: "mj-legacy", Group: "vip"}).Error)
+
+	require.NoError(t, migrateMidjourneyTasks())
+	require.NoError(t, migrateMidjourneyTasks())
+
+	var tasks []*Task
+	require.NoError(t, DB.Where("platform = ?", constant.TaskPlatformMidjourney).Order("id").Find(&tasks).Error)
+	require.Len(t, tasks, 2)
+
+	task := GetByMJId(1, "mj-1")
+	require.NotNil(t, task)
+	assert.Equal(t, TaskStatus(TaskStatusSuccess), task.Status)
+	assert.Equal(t, int64(1700000000), task.SubmitTime)
+	assert.Equal(t, "https://cdn.example.com/1.png", task.GetResultURL())
+	assert.Equal(t, "https://hook.example.com", task.PrivateData.CallbackURL)
+
+	// 旧记录补全分组与计费上下文，失败时可按钱包退款
+	assert.Equal(t, "vip", task.Group)
+	assert.Equal(t, "mj_imagine", task.Properties.OriginModelName)
+	assert.Equal(t, "wallet", task.PrivateData.BillingSource)
+	require.NotNil(t, task.PrivateData.BillingContext)
+	assert.Equal(t, "mj_imagine", task.PrivateData.BillingContext.OriginModelName)
+	assert.True(t, task.PrivateData.BillingContext.PerCallBilling)
+	assert.InDelta(t, 500/common.QuotaPerUnit, task.PrivateData.BillingContext.ModelPrice, 1e-12)
+
+	mj := task.ToMidjourney()
+	assert.Equal(t, "a cat", mj.Prompt)
+	assert.Equal(t, int64(1700000000123), mj.SubmitTime)
+	assert.Equal(t, legacy[0].Buttons, mj.Buttons)
+	assert.Equal(t, 500, mj.Quota)
+
+	failed := GetByMJId(2, "mj_legacy_3")
+	require.NotNil(t, failed)
+	assert.Equal(t, TaskStatus(TaskStatusFailure), failed.Status)
+	assert.Equal(t, "100%", failed.Progress)
+}
@@ -12,6 +12,8 @@ import (
 	"github.com/QuantumNous/new-api/setting/performance_setting"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
 	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"gorm.io/gorm"
 )
 
 type Option struct {
@@ -140,6 +142,8 @@ func InitOptionMap() {
 	common.OptionMap["ImageRatio"] = ratio_setting.ImageRatio2JSONString()
 	common.OptionMap["AudioRatio"] = ratio_setting.AudioRatio2JSONString()
 	common.OptionMap["AudioCompletionRatio"] = ratio_setting.AudioCompletionRatio2JSONString()
+	common.OptionMap["ImageCompletionRatio"] = ratio_setting.ImageCompletionRatio2JSONString()
+	common.OptionMap["ModelPricingRules"] = ratio_setting.ModelPricingRules2JSONString()
 	common.OptionMap["TopUpLink"] = common.TopUpLink
 	//common.OptionMap["ChatLink"] = common.ChatLink
 	//common.OptionMap["ChatLink2"] = common.ChatLink2
@@ -206,8 +210,21 @@ func UpdateOption(key string, value string) error {
 	// If save value does not contain primary key, it will execute Create,
 	// otherwise it will execute Update (with all fields).
 	DB.Save(&option)
-	// Update OptionMap
-	return updateOptionMap(key, value)
+	return ApplyOptionValue(key, value)
+}
+
+// SaveOptionWithTx 在事务中保存配置项，事务提交后需调用 ApplyOptionValue 更新内存中的配置
+func SaveOptionWithTx(tx *gorm.DB, key string, value string) error {
+	return tx.Save(&Option{Key: key, Value: value}).Error
+}
+
+// ApplyOptionValue 更新内存中的配置并通知其他节点
+func ApplyOptionValue(key string, value string) error {
+	if err := updateOptionMap(key, value); err != nil {
+		return err
+	}
+	PublishCacheEvent(CacheEventOptionUpdate, key)
+	return nil
 }
 
 func updateOptionMap(key string, value string) (err error) {
@@ -485,6 +502,10 @@ func updateOptionMap(key string, value string) (err error) {
 		err = ratio_setting.UpdateAudioRatioByJSONString(value)
 	case "AudioCompletionRatio":
 		err = ratio_setting.UpdateAudioCompletionRatioByJSONString(value)
+	case "ImageCompletionRatio":
+		err = ratio_setting.UpdateImageCompletionRatioByJSONString(value)
+	case "ModelPricingRules":
+		err = ratio_setting.UpdateModelPricingRulesByJSONString(value)
 	case "TopUpLink":
 		common.TopUpLink = value
 	//case "ChatLink":
@@ -30,6 +30,8 @@ type Pricing struct {
 	ImageRatio             *float64                `json:"image_ratio,omitempty"`
 	AudioRatio             *float64                `json:"audio_ratio,omitempty"`
 	AudioCompletionRatio   *float64                `json:"audio_completion_ratio,omitempty"`
+	ImageCompletionRatio   *float64                `json:"image_completion_ratio,omitempty"`
+	PricingRule            *types.PricingRule      `json:"pricing_rule,omitempty"`
 	EnableGroup            []string                `json:"enable_groups"`
 	SupportedEndpointTypes []constant.EndpointType `json:"supported_endpoint_types"`
 	PricingVersion         string                  `json:"pricing_version,omitempty"`
@@ -319,6 +321,12 @@ func updatePricing() {
 			audioCompletionRatio := ratio_setting.GetAudioCompletionRatio(model)
 			pricing.AudioCompletionRatio = &audioCompletionRatio
 		}
+		if imageCompletionRatio, ok := ratio_setting.GetImageCompletionRatio(model); ok {
+			pricing.ImageCompletionRatio = &imageCompletionRatio
+		}
+		if rule, ok := ratio_setting.GetModelPricingRule(model); ok {
+			pricing.PricingRule = rule
+		}
 		pricingMap = append(pricingMap, pricing)
 	}
 
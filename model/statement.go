@@ -0,0 +1,345 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+// Statement 用户月度对账单，余额相关金额均为额度单位，支付金额为订单原始金额
+type Statement struct {
+	Id                        int     `json:"id"`
+	UserId                    int     `json:"user_id" gorm:"uniqueIndex:idx_statement_user_period_rev,priority:1"`
+	Username                  string  `json:"username" gorm:"type:varchar(64);default:''"`
+	Period                    string  `json:"period" gorm:"type:varchar(7);uniqueIndex:idx_statement_user_period_rev,priority:2;index"`
+	Revision                  int     `json:"revision" gorm:"default:1;uniqueIndex:idx_statement_user_period_rev,priority:3"` // 已出账的对账单不可修改，重新生成时写入新修订版
+	PeriodStart               int64   `json:"period_start" gorm:"bigint"`
+	PeriodEnd                 int64   `json:"period_end" gorm:"bigint"`
+	InvoiceNo                 string  `json:"invoice_no" gorm:"type:varchar(64);uniqueIndex"`
+	OpeningBalance            int64   `json:"opening_balance"`
+	TopUpQuota                int64   `json:"top_up_quota"`
+	TopUpMoney                float64 `json:"top_up_money"`
+	RedemptionQuota           int64   `json:"redemption_quota"`
+	SubscriptionMoney         float64 `json:"subscription_money"`
+	ConsumedQuota             int64   `json:"consumed_quota"`              // 钱包扣费
+	SubscriptionConsumedQuota int64   `json:"subscription_consumed_quota"` // 订阅额度内的消耗，不影响钱包余额
+	RefundQuota               int64   `json:"refund_quota"`
+	AdjustmentQuota           int64   `json:"adjustment_quota"` // 管理员调整、签到、邀请奖励等未单独统计的变动
+	ClosingBalance            int64   `json:"closing_balance"`
+	RequestCount              int64   `json:"request_count"`
+	Details                   string  `json:"-" gorm:"type:text"`
+	CreatedAt                 int64   `json:"created_at" gorm:"bigint"`
+}
+
+// StatementDetails 对账单明细，以 JSON 保存在 Statement.Details
+type StatementDetails struct {
+	TopUps        []StatementTopUp        `json:"top_ups"`
+	Redemptions   []StatementRedemption   `json:"redemptions"`
+	Subscriptions []StatementSubscription `json:"subscriptions"`
+	Models        []StatementModelUsage   `json:"models"`
+}
+
+type StatementTopUp struct {
+	TradeNo       string  `json:"trade_no"`
+	PaymentMethod string  `json:"payment_method"`
+	Money         float64 `json:"money"`
+	Quota         int64   `json:"quota"`
+	CompleteTime  int64   `json:"complete_time"`
+}
+
+type StatementRedemption struct {
+	Id           int    `json:"id"`
+	Name         string `json:"name"`
+	Quota        int64  `json:"quota"`
+	RedeemedTime int64  `json:"redeemed_time"`
+}
+
+type StatementSubscription struct {
+	TradeNo       string  `json:"trade_no"`
+	PlanId        int     `json:"plan_id"`
+	PlanTitle     string  `json:"plan_title"`
+	PaymentMethod string  `json:"payment_method"`
+	Money         float64 `json:"money"`
+	CompleteTime  int64   `json:"complete_time"`
+}
+
+type StatementModelUsage struct {
+	ModelName                 string `json:"model_name"`
+	Requests                  int64  `json:"requests"`
+	PromptTokens              int64  `json:"prompt_tokens"`
+	CompletionTokens          int64  `json:"completion_tokens"`
+	Quota                     int64  `json:"quota"`
+	SubscriptionQuota         int64  `json:"subscription_quota"`
+	RefundQuota               int64  `json:"refund_quota"`
+	SubscriptionRefundedQuota int64  `json:"subscription_refunded_quota"`
+}
+
+func (s *Statement) GetDetails() (*StatementDetails, error) {
+	details := &StatementDetails{}
+	if s.Details == "" {
+		return details, nil
+	}
+	if err := common.UnmarshalJsonStr(s.Details, details); err != nil {
+		return nil, err
+	}
+	return details, nil
+}
+
+func (s *Statement) SetDetails(details *StatementDetails) error {
+	data, err := common.Marshal(details)
+	if err != nil {
+		return err
+	}
+	s.Details = string(data)
+	return nil
+}
+
+// StatementPeriodRange 解析 "2006-01" 格式的账期，返回 [start, end) 时间戳（服务器本地时区）
+func StatementPeriodRange(period string) (int64, int64, error) {
+	start, err := time.ParseInLocation("2006-01", period, time.Local)
+	if err != nil {
+		return 0, 0, errors.New("账期格式应为 YYYY-MM")
+	}
+	return start.Unix(), start.AddDate(0, 1, 0).Unix(), nil
+}
+
+// StatementPeriodOf 返回时间所在的账期
+func StatementPeriodOf(t time.Time) string {
+	return t.In(time.Local).Format("2006-01")
+}
+
+// StatementInvoiceNo 生成发票号，同一用户同一账期固定不变；修订版追加 -R<修订号>
+func StatementInvoiceNo(prefix string, period string, userId int, revision int) string {
+	if prefix == "" {
+		prefix = "INV"
+	}
+	invoiceNo := fmt.Sprintf("%s-%s-%06d", prefix, period[:4]+period[5:], userId)
+	if revision > 1 {
+		invoiceNo += fmt.Sprintf("-R%d", revision)
+	}
+	return invoiceNo
+}
+
+// CreateStatementRevision 保存对账单为该用户账期的下一个修订版，已有的对账单保持不变。
+// invoicePrefix 用于按修订号生成发票号
+func CreateStatementRevision(s *Statement, invoicePrefix string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var revision int
+		if err := tx.Model(&Statement{}).Where("user_id = ? and period = ?", s.UserId, s.Period).
+			Select("COALESCE(MAX(revision), 0)").Scan(&revision).Error; err != nil {
+			return err
+		}
+		s.Id = 0
+		s.Revision = revision + 1
+		s.InvoiceNo = StatementInvoiceNo(invoicePrefix, s.Period, s.UserId, s.Revision)
+		return tx.Create(s).Error
+	})
+}
+
+// GetLatestStatement 返回用户账期的最新修订版，不存在时返回 nil
+func GetLatestStatement(userId int, period string) (*Statement, error) {
+	var s Statement
+	err := DB.Where("user_id = ? and period = ?", userId, period).Order("revision desc").First(&s).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// migrateStatementRevisionIndex 删除不含修订号的旧唯一索引，否则无法写入修订版
+func migrateStatementRevisionIndex() error {
+	if !DB.Migrator().HasTable(&Statement{}) || !DB.Migrator().HasIndex(&Statement{}, "idx_statement_user_period") {
+		return nil
+	}
+	return DB.Migrator().DropIndex(&Statement{}, "idx_statement_user_period")
+}
+
+func GetStatementById(id int) (*Statement, error) {
+	var s Statement
+	if err := DB.First(&s, id).Error; err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func GetUserStatementById(userId int, id int) (*Statement, error) {
+	var s Statement
+	if err := DB.Where("id = ? and user_id = ?", id, userId).First(&s).Error; err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// GetPreviousStatement 返回账期之前最近一期对账单的最新修订版
+func GetPreviousStatement(userId int, period string) (*Statement, error) {
+	var s Statement
+	err := DB.Where("user_id = ? and period < ?", userId, period).Order("period desc, revision desc").First(&s).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func GetStatements(userId int, period string, startIdx int, num int) ([]*Statement, int64, error) {
+	tx := DB.Model(&Statement{})
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if period != "" {
+		tx = tx.Where("period = ?", period)
+	}
+	var total int64
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var statements []*Statement
+	err := tx.Omit("details").Order("period desc, revision desc, id desc").Limit(num).Offset(startIdx).Find(&statements).Error
+	return statements, total, err
+}
+
+// CreditedQuota 充值订单实际到账的额度，规则与各支付回调保持一致
+func (topUp *TopUp) CreditedQuota() int64 {
+	switch topUp.PaymentMethod {
+	case "stripe":
+		return int64(topUp.Money * common.QuotaPerUnit)
+	case "creem":
+		return topUp.Amount
+	}
+	return int64(float64(topUp.Amount) * common.QuotaPerUnit)
+}
+
+// GetUserCompletedTopUps 返回账期内成功的充值订单，不含订阅订单生成的记录
+func GetUserCompletedTopUps(userId int, start int64, end int64) ([]*TopUp, error) {
+	var topUps []*TopUp
+	subOrders := DB.Model(&SubscriptionOrder{}).Select("trade_no").Where("user_id = ?", userId)
+	err := DB.Where("user_id = ? and status = ? and complete_time >= ? and complete_time < ?",
+		userId, common.TopUpStatusSuccess, start, end).
+		Where("trade_no NOT IN (?)", subOrders).
+		Order("complete_time asc").Find(&topUps).Error
+	return topUps, err
+}
+
+func GetUserRedeemedRedemptions(userId int, start int64, end int64) ([]*Redemption, error) {
+	var redemptions []*Redemption
+	err := DB.Unscoped().Where("used_user_id = ? and status = ? and redeemed_time >= ? and redeemed_time < ?",
+		userId, common.RedemptionCodeStatusUsed, start, end).
+		Order("redeemed_time asc").Find(&redemptions).Error
+	return redemptions, err
+}
+
+func GetUserCompletedSubscriptionOrders(userId int, start int64, end int64) ([]*SubscriptionOrder, error) {
+	var orders []*SubscriptionOrder
+	err := DB.Where("user_id = ? and status = ? and complete_time >= ? and complete_time < ?",
+		userId, common.TopUpStatusSuccess, start, end).
+		Order("complete_time asc").Find(&orders).Error
+	return orders, err
+}
+
+// statementSubscriptionLike 订阅扣费的日志在 other 中带有 billing_source=subscription
+const statementSubscriptionLike = `%"billing_source":"subscription"%`
+
+// GetUserStatementUsage 按模型汇总账期内的消费与退款，区分钱包与订阅扣费
+func GetUserStatementUsage(userId int, start int64, end int64) ([]StatementModelUsage, error) {
+	var rows []struct {
+		ModelName        string
+		Type             int
+		Subscription     bool
+		Requests         int64
+		PromptTokens     int64
+		CompletionTokens int64
+		Quota            int64
+	}
+	err := LOG_DB.Model(&Log{}).
+		Select("model_name, type, (other LIKE ?) AS subscription, count(*) AS requests, "+
+			"sum(prompt_tokens) AS prompt_tokens, sum(completion_tokens) AS completion_tokens, sum(quota) AS quota",
+			statementSubscriptionLike).
+		Where("user_id = ? and created_at >= ? and created_at < ? and type in ?", userId, start, end,
+			[]int{LogTypeConsume, LogTypeRefund}).
+		Group("model_name, type, subscription").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	byModel := make(map[string]*StatementModelUsage)
+	order := make([]string, 0)
+	for _, row := range rows {
+		usage, ok := byModel[row.ModelName]
+		if !ok {
+			usage = &StatementModelUsage{ModelName: row.ModelName}
+			byModel[row.ModelName] = usage
+			order = append(order, row.ModelName)
+		}
+		switch {
+		case row.Type == LogTypeConsume && row.Subscription:
+			usage.Requests += row.Requests
+			usage.PromptTokens += row.PromptTokens
+			usage.CompletionTokens += row.CompletionTokens
+			usage.SubscriptionQuota += row.Quota
+		case row.Type == LogTypeConsume:
+			usage.Requests += row.Requests
+			usage.PromptTokens += row.PromptTokens
+			usage.CompletionTokens += row.CompletionTokens
+			usage.Quota += row.Quota
+		case row.Subscription:
+			usage.SubscriptionRefundedQuota += row.Quota
+		default:
+			usage.RefundQuota += row.Quota
+		}
+	}
+	result := make([]StatementModelUsage, 0, len(order))
+	for _, name := range order {
+		result = append(result, *byModel[name])
+	}
+	return result, nil
+}
+
+// GetUserStatementActiveUserIds 返回账期内有消费、充值或兑换记录的用户
+func GetUserStatementActiveUserIds(start int64, end int64) ([]int, error) {
+	seen := make(map[int]bool)
+	var ids []int
+	collect := func(found []int) {
+		for _, id := range found {
+			if id > 0 && !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	var found []int
+	if err := LOG_DB.Model(&Log{}).Where("created_at >= ? and created_at < ? and type in ?", start, end,
+		[]int{LogTypeConsume, LogTypeTopup, LogTypeRefund}).Distinct().Pluck("user_id", &found).Error; err != nil {
+		return nil, err
+	}
+	collect(found)
+	found = nil
+	if err := DB.Model(&TopUp{}).Where("status = ? and complete_time >= ? and complete_time < ?",
+		common.TopUpStatusSuccess, start, end).Distinct().Pluck("user_id", &found).Error; err != nil {
+		return nil, err
+	}
+	collect(found)
+	return ids, nil
+}
+
+// GetStatementClosedUserIds 返回账期内已生成对账单的用户
+func GetStatementClosedUserIds(period string) (map[int]bool, error) {
+	var ids []int
+	if err := DB.Model(&Statement{}).Where("period = ?", period).Pluck("user_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	closed := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		closed[id] = true
+	}
+	return closed, nil
+}
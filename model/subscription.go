@@ -135,6 +135,11 @@ func InvalidateSubscriptionPlanCache(planId int) {
 	if planId <= 0 {
 		return
 	}
+	invalidateSubscriptionPlanCacheLocal(planId)
+	PublishCacheEvent(CacheEventSubscriptionPlanEvict, strconv.Itoa(planId))
+}
+
+func invalidateSubscriptionPlanCacheLocal(planId int) {
 	cache := getSubscriptionPlanCache()
 	_, _ = cache.DeleteMany([]string{subscriptionPlanCacheKey(planId)})
 	infoCache := getSubscriptionPlanInfoCache()
@@ -566,7 +571,7 @@ func CompleteSubscriptionOrder(tradeNo string, providerPayload string) error {
 	}
 	if logUserId > 0 {
 		msg := fmt.Sprintf("订阅购买成功，套餐: %s，支付金额: %.2f，支付方式: %s", logPlanTitle, logMoney, logPaymentMethod)
-		RecordLog(logUserId, LogTypeTopup, msg)
+		RecordPaidTopUpLog(logUserId, msg)
 	}
 	return nil
 }
@@ -1190,3 +1195,12 @@ func PostConsumeUserSubscriptionDelta(userSubscriptionId int, delta int64) error
 		return tx.Save(&sub).Error
 	})
 }
+
+// GetUserSubscriptionsEndingBetween 返回结束时间落在 (from, to] 内、状态属于 statuses 的订阅
+func GetUserSubscriptionsEndingBetween(from int64, to int64, statuses []string) ([]UserSubscription, error) {
+	var subs []UserSubscription
+	err := DB.Where("end_time > ? AND end_time <= ? AND status IN ?", from, to, statuses).
+		Order("end_time asc, id asc").
+		Find(&subs).Error
+	return subs, err
+}
@@ -0,0 +1,89 @@
+package model
+
+import (
+	"github.com/QuantumNous/new-api/common"
+)
+
+const (
+	TaskWebhookStatusPending = "pending"
+	TaskWebhookStatusSuccess = "success"
+	TaskWebhookStatusFailed  = "failed"
+)
+
+// TaskWebhookDelivery 任务状态回调的投递记录，同时作为待投递队列
+type TaskWebhookDelivery struct {
+	Id            int    `json:"id"`
+	UserId        int    `json:"user_id" gorm:"index"`
+	TaskId        string `json:"task_id" gorm:"type:varchar(191);index"`
+	Platform      string `json:"platform" gorm:"type:varchar(30)"`
+	TaskStatus    string `json:"task_status" gorm:"type:varchar(20)"`
+	Url           string `json:"url" gorm:"type:varchar(512)"`
+	Payload       string `json:"payload" gorm:"type:text"`
+	Status        string `json:"status" gorm:"type:varchar(16);index:idx_task_webhook_due,priority:1"`
+	Attempts      int    `json:"attempts"`
+	NextAttemptAt int64  `json:"next_attempt_at" gorm:"bigint;index:idx_task_webhook_due,priority:2"`
+	ResponseCode  int    `json:"response_code"`
+	LastError     string `json:"last_error" gorm:"type:text"`
+	CreatedAt     int64  `json:"created_at" gorm:"bigint;index"`
+	UpdatedAt     int64  `json:"updated_at" gorm:"bigint"`
+}
+
+func CreateTaskWebhookDelivery(d *TaskWebhookDelivery) error {
+	now := common.GetTimestamp()
+	d.CreatedAt = now
+	d.UpdatedAt = now
+	if d.Status == "" {
+		d.Status = TaskWebhookStatusPending
+	}
+	if d.NextAttemptAt == 0 {
+		d.NextAttemptAt = now
+	}
+	return DB.Create(d).Error
+}
+
+// GetDueTaskWebhookDeliveries 返回到期待投递的记录
+func GetDueTaskWebhookDeliveries(now int64, limit int) ([]*TaskWebhookDelivery, error) {
+	var deliveries []*TaskWebhookDelivery
+	err := DB.Where("status = ? AND next_attempt_at <= ?", TaskWebhookStatusPending, now).
+		Order("next_attempt_at asc").Limit(limit).Find(&deliveries).Error
+	return deliveries, err
+}
+
+// SaveTaskWebhookAttempt 保存一次投递结果
+func SaveTaskWebhookAttempt(d *TaskWebhookDelivery) error {
+	d.UpdatedAt = common.GetTimestamp()
+	return DB.Model(d).Select("status", "attempts", "next_attempt_at", "response_code", "last_error", "updated_at").Updates(d).Error
+}
+
+func GetTaskWebhookDeliveryById(id int) (*TaskWebhookDelivery, error) {
+	var d TaskWebhookDelivery
+	if err := DB.First(&d, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// GetTaskWebhookDeliveries userId 为 0 时返回全部用户的记录
+func GetTaskWebhookDeliveries(userId int, taskId string, status string, pageInfo *common.PageInfo) (deliveries []*TaskWebhookDelivery, total int64, err error) {
+	tx := DB.Model(&TaskWebhookDelivery{})
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if taskId != "" {
+		tx = tx.Where("task_id = ?", taskId)
+	}
+	if status != "" {
+		tx = tx.Where("status = ?", status)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(pageInfo.GetPageSize()).Offset(pageInfo.GetStartIdx()).Find(&deliveries).Error
+	return deliveries, total, err
+}
+
+// DeleteTaskWebhookDeliveriesBefore 清理早于指定时间且已结束的投递记录
+func DeleteTaskWebhookDeliveriesBefore(timestamp int64) (int64, error) {
+	result := DB.Where("created_at < ? AND status <> ?", timestamp, TaskWebhookStatusPending).Delete(&TaskWebhookDelivery{})
+	return result.RowsAffected, result.Error
+}
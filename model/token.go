@@ -28,6 +28,7 @@ type Token struct {
 	UsedQuota          int            `json:"used_quota" gorm:"default:0"` // used quota
 	Group              string         `json:"group" gorm:"default:''"`
 	CrossGroupRetry    bool           `json:"cross_group_retry"` // 跨分组重试，仅auto分组有效
+	CallbackUrl        string         `json:"callback_url" gorm:"type:varchar(512);default:''"`
 	DeletedAt          gorm.DeletedAt `gorm:"index"`
 }
 
@@ -304,7 +305,7 @@ func (token *Token) Update() (err error) {
 		}
 	}()
 	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota",
-		"model_limits_enabled", "model_limits", "allow_ips", "group", "cross_group_retry").Updates(token).Error
+		"model_limits_enabled", "model_limits", "allow_ips", "group", "cross_group_retry", "callback_url").Updates(token).Error
 	return err
 }
 
@@ -489,3 +490,12 @@ func GetTokenKeysByIds(ids []int, userId int) ([]Token, error) {
 		Find(&tokens).Error
 	return tokens, err
 }
+
+// GetTokensExpiringBetween 返回过期时间落在 (from, to] 内的已启用令牌
+func GetTokensExpiringBetween(from int64, to int64) ([]Token, error) {
+	var tokens []Token
+	err := DB.Select("id", "user_id", "name", "expired_time").
+		Where("status = ? AND expired_time > ? AND expired_time <= ?", common.TokenStatusEnabled, from, to).
+		Find(&tokens).Error
+	return tokens, err
+}
@@ -0,0 +1,652 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+const (
+	UsageRollupHour = "hour"
+	UsageRollupDay  = "day"
+)
+
+// 错误分类，按上游/本地返回的状态码归类，避免 error_code 维度过多
+const (
+	UsageErrorClassRateLimit = "rate_limit"
+	UsageErrorClassTimeout   = "timeout"
+	UsageErrorClassUpstream  = "upstream"
+	UsageErrorClassClient    = "client"
+	UsageErrorClassOther     = "other"
+)
+
+// usageLatencyBounds 延迟直方图各桶的上界（毫秒），最后一个桶收纳超出上界的请求
+var usageLatencyBounds = [usageLatencyBucketCount - 1]int64{500, 1000, 2000, 3000, 5000, 10000, 20000, 30000, 60000, 120000, 300000}
+
+const usageLatencyBucketCount = 12
+
+// UsageLatencyHistogram 固定分桶的延迟直方图，各列可直接累加，用于计算分位数
+type UsageLatencyHistogram struct {
+	LatB0  int64 `json:"-" gorm:"column:lat_b0;default:0"`
+	LatB1  int64 `json:"-" gorm:"column:lat_b1;default:0"`
+	LatB2  int64 `json:"-" gorm:"column:lat_b2;default:0"`
+	LatB3  int64 `json:"-" gorm:"column:lat_b3;default:0"`
+	LatB4  int64 `json:"-" gorm:"column:lat_b4;default:0"`
+	LatB5  int64 `json:"-" gorm:"column:lat_b5;default:0"`
+	LatB6  int64 `json:"-" gorm:"column:lat_b6;default:0"`
+	LatB7  int64 `json:"-" gorm:"column:lat_b7;default:0"`
+	LatB8  int64 `json:"-" gorm:"column:lat_b8;default:0"`
+	LatB9  int64 `json:"-" gorm:"column:lat_b9;default:0"`
+	LatB10 int64 `json:"-" gorm:"column:lat_b10;default:0"`
+	LatB11 int64 `json:"-" gorm:"column:lat_b11;default:0"`
+}
+
+func (h *UsageLatencyHistogram) buckets() [usageLatencyBucketCount]*int64 {
+	return [usageLatencyBucketCount]*int64{&h.LatB0, &h.LatB1, &h.LatB2, &h.LatB3, &h.LatB4, &h.LatB5,
+		&h.LatB6, &h.LatB7, &h.LatB8, &h.LatB9, &h.LatB10, &h.LatB11}
+}
+
+func (h *UsageLatencyHistogram) observe(latencyMs int64) {
+	idx := len(usageLatencyBounds)
+	for i, bound := range usageLatencyBounds {
+		if latencyMs <= bound {
+			idx = i
+			break
+		}
+	}
+	*h.buckets()[idx]++
+}
+
+func (h *UsageLatencyHistogram) merge(other *UsageLatencyHistogram) {
+	dst, src := h.buckets(), other.buckets()
+	for i := range dst {
+		*dst[i] += *src[i]
+	}
+}
+
+// Percentile 返回 p 分位所在桶的上界（毫秒），超出最大上界时返回最大上界
+func (h *UsageLatencyHistogram) Percentile(p float64) int64 {
+	var total int64
+	for _, b := range h.buckets() {
+		total += *b
+	}
+	if total == 0 {
+		return 0
+	}
+	target := int64(float64(total)*p + 0.5)
+	if target < 1 {
+		target = 1
+	}
+	var cumulative int64
+	for i, b := range h.buckets() {
+		cumulative += *b
+		if cumulative >= target && i < len(usageLatencyBounds) {
+			return usageLatencyBounds[i]
+		}
+	}
+	return usageLatencyBounds[len(usageLatencyBounds)-1]
+}
+
+// UsageRollup 按小时/天预聚合的用量统计，维度组合唯一
+type UsageRollup struct {
+	Id                    int    `json:"id"`
+	Period                string `json:"period" gorm:"type:varchar(8);uniqueIndex:idx_usage_rollup_key,priority:1"`
+	BucketAt              int64  `json:"bucket_at" gorm:"bigint;uniqueIndex:idx_usage_rollup_key,priority:2"`
+	UserId                int    `json:"user_id" gorm:"uniqueIndex:idx_usage_rollup_key,priority:3;index"`
+	TokenId               int    `json:"token_id" gorm:"uniqueIndex:idx_usage_rollup_key,priority:4"`
+	ChannelId             int    `json:"channel_id" gorm:"uniqueIndex:idx_usage_rollup_key,priority:5"`
+	GroupName             string `json:"group" gorm:"type:varchar(64);uniqueIndex:idx_usage_rollup_key,priority:6;default:''"`
+	ModelName             string `json:"model_name" gorm:"type:varchar(128);uniqueIndex:idx_usage_rollup_key,priority:7;default:''"`
+	RelayFormat           string `json:"relay_format" gorm:"type:varchar(32);uniqueIndex:idx_usage_rollup_key,priority:8;default:''"`
+	ErrorClass            string `json:"error_class" gorm:"type:varchar(16);uniqueIndex:idx_usage_rollup_key,priority:9;default:''"`
+	RequestCount          int64  `json:"request_count" gorm:"default:0"`
+	ErrorCount            int64  `json:"error_count" gorm:"default:0"`
+	PromptTokens          int64  `json:"prompt_tokens" gorm:"default:0"`
+	CompletionTokens      int64  `json:"completion_tokens" gorm:"default:0"`
+	CacheTokens           int64  `json:"cache_tokens" gorm:"default:0"`
+	ReasoningTokens       int64  `json:"reasoning_tokens" gorm:"default:0"`
+	Quota                 int64  `json:"quota" gorm:"default:0"`
+	LatencySumMs          int64  `json:"latency_sum_ms" gorm:"default:0"`
+	UsageLatencyHistogram `gorm:"embedded"`
+}
+
+// UsageRollupEvent 单条日志对应的用量增量
+type UsageRollupEvent struct {
+	CreatedAt        int64
+	UserId           int
+	TokenId          int
+	ChannelId        int
+	Group            string
+	ModelName        string
+	RelayFormat      string
+	ErrorClass       string
+	RequestCount     int64
+	ErrorCount       int64
+	PromptTokens     int64
+	CompletionTokens int64
+	CacheTokens      int64
+	ReasoningTokens  int64
+	Quota            int64
+	LatencyMs        int64
+}
+
+func usageRollupKey(r *UsageRollup) string {
+	return fmt.Sprintf("%s|%d|%d|%d|%d|%s|%s|%s|%s", r.Period, r.BucketAt, r.UserId, r.TokenId, r.ChannelId,
+		r.GroupName, r.ModelName, r.RelayFormat, r.ErrorClass)
+}
+
+func (r *UsageRollup) add(ev *UsageRollupEvent) {
+	r.RequestCount += ev.RequestCount
+	r.ErrorCount += ev.ErrorCount
+	r.PromptTokens += ev.PromptTokens
+	r.CompletionTokens += ev.CompletionTokens
+	r.CacheTokens += ev.CacheTokens
+	r.ReasoningTokens += ev.ReasoningTokens
+	r.Quota += ev.Quota
+	if ev.RequestCount > 0 {
+		r.LatencySumMs += ev.LatencyMs
+		r.observe(ev.LatencyMs)
+	}
+}
+
+// usageRollupAccumulator 内存中的待写入增量，定期批量刷入数据库
+type usageRollupAccumulator struct {
+	mu   sync.Mutex
+	rows map[string]*UsageRollup
+}
+
+func newUsageRollupAccumulator() *usageRollupAccumulator {
+	return &usageRollupAccumulator{rows: make(map[string]*UsageRollup)}
+}
+
+func (a *usageRollupAccumulator) add(ev *UsageRollupEvent) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, period := range []string{UsageRollupHour, UsageRollupDay} {
+		row := &UsageRollup{
+			Period:      period,
+			BucketAt:    UsageRollupBucket(period, ev.CreatedAt),
+			UserId:      ev.UserId,
+			TokenId:     ev.TokenId,
+			ChannelId:   ev.ChannelId,
+			GroupName:   ev.Group,
+			ModelName:   ev.ModelName,
+			RelayFormat: ev.RelayFormat,
+			ErrorClass:  ev.ErrorClass,
+		}
+		key := usageRollupKey(row)
+		if existing, ok := a.rows[key]; ok {
+			row = existing
+		} else {
+			a.rows[key] = row
+		}
+		row.add(ev)
+	}
+}
+
+func (a *usageRollupAccumulator) take() []*UsageRollup {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	rows := make([]*UsageRollup, 0, len(a.rows))
+	for _, row := range a.rows {
+		rows = append(rows, row)
+	}
+	a.rows = make(map[string]*UsageRollup)
+	return rows
+}
+
+var usageRollupPending = newUsageRollupAccumulator()
+
+// UsageRollupBucket 返回时间戳所在的小时/天起点（UTC）
+func UsageRollupBucket(period string, ts int64) int64 {
+	if period == UsageRollupDay {
+		return ts - ts%86400
+	}
+	return ts - ts%3600
+}
+
+// RecordUsageRollup 累加一条用量增量，由 FlushUsageRollups 定期写入；进程正常退出前会再刷新一次，
+// 异常退出时最多丢失一个刷新周期的增量，可通过回填按日志重建
+func RecordUsageRollup(ev *UsageRollupEvent) {
+	if ev == nil {
+		return
+	}
+	usageRollupPending.add(ev)
+}
+
+// FlushUsageRollups 将内存中的增量写入数据库，返回写入的行数
+func FlushUsageRollups() (int, error) {
+	rows := usageRollupPending.take()
+	for i, row := range rows {
+		if err := upsertUsageRollup(row); err != nil {
+			// 写入失败的增量放回内存，等待下次刷新
+			for _, rest := range rows[i:] {
+				usageRollupPending.mergeRow(rest)
+			}
+			return i, err
+		}
+	}
+	return len(rows), nil
+}
+
+func (a *usageRollupAccumulator) mergeRow(row *UsageRollup) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	key := usageRollupKey(row)
+	existing, ok := a.rows[key]
+	if !ok {
+		a.rows[key] = row
+		return
+	}
+	existing.RequestCount += row.RequestCount
+	existing.ErrorCount += row.ErrorCount
+	existing.PromptTokens += row.PromptTokens
+	existing.CompletionTokens += row.CompletionTokens
+	existing.CacheTokens += row.CacheTokens
+	existing.ReasoningTokens += row.ReasoningTokens
+	existing.Quota += row.Quota
+	existing.LatencySumMs += row.LatencySumMs
+	existing.merge(&row.UsageLatencyHistogram)
+}
+
+func usageRollupKeyQuery(tx *gorm.DB, row *UsageRollup) *gorm.DB {
+	return tx.Model(&UsageRollup{}).Where("period = ? and bucket_at = ? and user_id = ? and token_id = ? and channel_id = ? and group_name = ? and model_name = ? and relay_format = ? and error_class = ?",
+		row.Period, row.BucketAt, row.UserId, row.TokenId, row.ChannelId, row.GroupName, row.ModelName, row.RelayFormat, row.ErrorClass)
+}
+
+func usageRollupIncrements(row *UsageRollup) map[string]interface{} {
+	updates := map[string]interface{}{
+		"request_count":     gorm.Expr("request_count + ?", row.RequestCount),
+		"error_count":       gorm.Expr("error_count + ?", row.ErrorCount),
+		"prompt_tokens":     gorm.Expr("prompt_tokens + ?", row.PromptTokens),
+		"completion_tokens": gorm.Expr("completion_tokens + ?", row.CompletionTokens),
+		"cache_tokens":      gorm.Expr("cache_tokens + ?", row.CacheTokens),
+		"reasoning_tokens":  gorm.Expr("reasoning_tokens + ?", row.ReasoningTokens),
+		"quota":             gorm.Expr("quota + ?", row.Quota),
+		"latency_sum_ms":    gorm.Expr("latency_sum_ms + ?", row.LatencySumMs),
+	}
+	for i, b := range row.buckets() {
+		if *b != 0 {
+			col := fmt.Sprintf("lat_b%d", i)
+			updates[col] = gorm.Expr(col+" + ?", *b)
+		}
+	}
+	return updates
+}
+
+// upsertUsageRollup 先按维度累加，不存在时插入；并发插入冲突时重试累加
+func upsertUsageRollup(row *UsageRollup) error {
+	result := usageRollupKeyQuery(LOG_DB, row).Updates(usageRollupIncrements(row))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+	insert := *row
+	insert.Id = 0
+	if err := LOG_DB.Create(&insert).Error; err != nil {
+		return usageRollupKeyQuery(LOG_DB, row).Updates(usageRollupIncrements(row)).Error
+	}
+	return nil
+}
+
+// UsageErrorClassFromStatus 按状态码归类错误
+func UsageErrorClassFromStatus(statusCode int) string {
+	switch {
+	case statusCode == 429:
+		return UsageErrorClassRateLimit
+	case statusCode == 408 || statusCode == 504:
+		return UsageErrorClassTimeout
+	case statusCode >= 500:
+		return UsageErrorClassUpstream
+	case statusCode >= 400:
+		return UsageErrorClassClient
+	}
+	return UsageErrorClassOther
+}
+
+// usageOtherInt 读取日志 other 中的数值，JSON 反序列化后为 float64
+func usageOtherInt(v interface{}) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case int64:
+		return int(n)
+	case float64:
+		return int(n)
+	}
+	return 0
+}
+
+// UsageRollupEventFromLog 由日志生成用量增量。
+// 任务差额结算与退款只调整额度，不计入请求数；latencyMs <= 0 时使用日志中的秒级耗时。
+func UsageRollupEventFromLog(log *Log, other map[string]interface{}, latencyMs int64) *UsageRollupEvent {
+	ev := &UsageRollupEvent{
+		CreatedAt:   log.CreatedAt,
+		UserId:      log.UserId,
+		TokenId:     log.TokenId,
+		ChannelId:   log.ChannelId,
+		Group:       log.Group,
+		ModelName:   log.ModelName,
+		RelayFormat: common.Interface2String(other["relay_format"]),
+	}
+	switch log.Type {
+	case LogTypeConsume:
+		ev.Quota = int64(log.Quota)
+		if _, isSettlement := other["pre_consumed_quota"]; isSettlement {
+			return ev
+		}
+		ev.RequestCount = 1
+		ev.PromptTokens = int64(log.PromptTokens)
+		ev.CompletionTokens = int64(log.CompletionTokens)
+		ev.CacheTokens = int64(usageOtherInt(other["cache_tokens"]))
+		ev.ReasoningTokens = int64(usageOtherInt(other["reasoning_tokens"]))
+	case LogTypeError:
+		ev.RequestCount = 1
+		ev.ErrorCount = 1
+		ev.ErrorClass = UsageErrorClassFromStatus(usageOtherInt(other["status_code"]))
+	case LogTypeRefund:
+		ev.Quota = -int64(log.Quota)
+		return ev
+	default:
+		return nil
+	}
+	if latencyMs <= 0 {
+		latencyMs = int64(log.UseTime) * 1000
+	}
+	ev.LatencyMs = latencyMs
+	return ev
+}
+
+const usageRollupBackfillBatchSize = 1000
+
+// BackfillUsageRollups 根据日志重建 [start, end) 范围内的整天汇总，范围按天对齐且不包含当天。
+// 逐天处理：先删除当天已有的汇总再重新聚合写入，内存中只保留一天的汇总，可重复执行。
+func BackfillUsageRollups(startTimestamp int64, endTimestamp int64) (int, error) {
+	start := UsageRollupBucket(UsageRollupDay, startTimestamp)
+	end := UsageRollupBucket(UsageRollupDay, endTimestamp+86399)
+	if today := UsageRollupBucket(UsageRollupDay, common.GetTimestamp()); end > today {
+		end = today
+	}
+	if start >= end {
+		return 0, errors.New("回填范围不能包含当天")
+	}
+	processed := 0
+	for day := start; day < end; day += 86400 {
+		n, err := backfillUsageRollupDay(day)
+		processed += n
+		if err != nil {
+			return processed, err
+		}
+	}
+	return processed, nil
+}
+
+// backfillUsageRollupDay 重建一天（含当天的小时汇总）的汇总，返回处理的日志数
+func backfillUsageRollupDay(day int64) (int, error) {
+	if err := LOG_DB.Where("bucket_at >= ? and bucket_at < ?", day, day+86400).Delete(&UsageRollup{}).Error; err != nil {
+		return 0, err
+	}
+	acc := newUsageRollupAccumulator()
+	processed, lastId := 0, 0
+	for {
+		var logs []*Log
+		err := LOG_DB.Where("id > ? and created_at >= ? and created_at < ? and type in ?", lastId, day, day+86400,
+			[]int{LogTypeConsume, LogTypeError, LogTypeRefund}).
+			Order("id asc").Limit(usageRollupBackfillBatchSize).Find(&logs).Error
+		if err != nil {
+			return processed, err
+		}
+		if len(logs) == 0 {
+			break
+		}
+		lastId = logs[len(logs)-1].Id
+		for _, log := range logs {
+			other, _ := common.StrToMap(log.Other)
+			if ev := UsageRollupEventFromLog(log, other, 0); ev != nil {
+				acc.add(ev)
+			}
+		}
+		processed += len(logs)
+	}
+	for _, row := range acc.take() {
+		if err := upsertUsageRollup(row); err != nil {
+			return processed, err
+		}
+	}
+	return processed, nil
+}
+
+// DeleteUsageRollupsBefore 删除指定周期中早于 before 的汇总
+func DeleteUsageRollupsBefore(period string, before int64) (int64, error) {
+	result := LOG_DB.Where("period = ? and bucket_at < ?", period, before).Delete(&UsageRollup{})
+	return result.RowsAffected, result.Error
+}
+
+// 用量查询支持的分组维度
+const (
+	UsageDimTime        = "time"
+	UsageDimUser        = "user"
+	UsageDimToken       = "token"
+	UsageDimChannel     = "channel"
+	UsageDimGroup       = "group"
+	UsageDimModel       = "model"
+	UsageDimRelayFormat = "relay_format"
+	UsageDimErrorClass  = "error_class"
+)
+
+var usageDimColumns = map[string]string{
+	UsageDimTime:        "bucket_at",
+	UsageDimUser:        "user_id",
+	UsageDimToken:       "token_id",
+	UsageDimChannel:     "channel_id",
+	UsageDimGroup:       "group_name",
+	UsageDimModel:       "model_name",
+	UsageDimRelayFormat: "relay_format",
+	UsageDimErrorClass:  "error_class",
+}
+
+const usageQueryMaxRows = 5000
+
+type UsageRollupQuery struct {
+	Period         string
+	GroupBy        []string
+	StartTimestamp int64
+	EndTimestamp   int64
+	UserId         int
+	TokenId        int
+	ChannelId      int
+	Group          string
+	ModelName      string
+	RelayFormat    string
+	ErrorClass     string
+}
+
+// UsageRollupItem 查询结果，仅填充 GroupBy 中的维度
+type UsageRollupItem struct {
+	BucketAt         int64   `json:"bucket_at,omitempty"`
+	UserId           int     `json:"user_id,omitempty"`
+	Username         string  `json:"username,omitempty"`
+	TokenId          int     `json:"token_id,omitempty"`
+	TokenName        string  `json:"token_name,omitempty"`
+	ChannelId        int     `json:"channel_id,omitempty"`
+	ChannelName      string  `json:"channel_name,omitempty"`
+	GroupName        string  `json:"group,omitempty"`
+	ModelName        string  `json:"model_name,omitempty"`
+	RelayFormat      string  `json:"relay_format,omitempty"`
+	ErrorClass       string  `json:"error_class,omitempty"`
+	RequestCount     int64   `json:"request_count"`
+	ErrorCount       int64   `json:"error_count"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	CacheTokens      int64   `json:"cache_tokens"`
+	ReasoningTokens  int64   `json:"reasoning_tokens"`
+	Quota            int64   `json:"quota"`
+	AvgLatencyMs     float64 `json:"avg_latency_ms"`
+	P50LatencyMs     int64   `json:"p50_latency_ms"`
+	P90LatencyMs     int64   `json:"p90_latency_ms"`
+	P99LatencyMs     int64   `json:"p99_latency_ms"`
+}
+
+// ResolveUsagePeriod 未指定周期时，7 天以内按小时，否则按天
+func ResolveUsagePeriod(period string, startTimestamp int64, endTimestamp int64) string {
+	switch period {
+	case UsageRollupHour, UsageRollupDay:
+		return period
+	}
+	if startTimestamp != 0 && endTimestamp != 0 && endTimestamp-startTimestamp <= 7*86400 {
+		return UsageRollupHour
+	}
+	return UsageRollupDay
+}
+
+// QueryUsageRollups 按维度分组汇总用量
+func QueryUsageRollups(query UsageRollupQuery) ([]*UsageRollupItem, error) {
+	period := ResolveUsagePeriod(query.Period, query.StartTimestamp, query.EndTimestamp)
+	dims := make([]string, 0, len(query.GroupBy))
+	seen := make(map[string]bool)
+	for _, dim := range query.GroupBy {
+		dim = strings.TrimSpace(dim)
+		if dim == "" || seen[dim] {
+			continue
+		}
+		col, ok := usageDimColumns[dim]
+		if !ok {
+			return nil, fmt.Errorf("不支持的分组维度: %s", dim)
+		}
+		seen[dim] = true
+		dims = append(dims, col)
+	}
+
+	selects := append([]string{}, dims...)
+	selects = append(selects, "sum(request_count) as request_count", "sum(error_count) as error_count",
+		"sum(prompt_tokens) as prompt_tokens", "sum(completion_tokens) as completion_tokens",
+		"sum(cache_tokens) as cache_tokens", "sum(reasoning_tokens) as reasoning_tokens",
+		"sum(quota) as quota", "sum(latency_sum_ms) as latency_sum_ms")
+	for i := 0; i < usageLatencyBucketCount; i++ {
+		selects = append(selects, fmt.Sprintf("sum(lat_b%d) as lat_b%d", i, i))
+	}
+
+	tx := LOG_DB.Model(&UsageRollup{}).Select(strings.Join(selects, ", ")).Where("period = ?", period)
+	if query.StartTimestamp != 0 {
+		tx = tx.Where("bucket_at >= ?", UsageRollupBucket(period, query.StartTimestamp))
+	}
+	if query.EndTimestamp != 0 {
+		tx = tx.Where("bucket_at <= ?", query.EndTimestamp)
+	}
+	if query.UserId != 0 {
+		tx = tx.Where("user_id = ?", query.UserId)
+	}
+	if query.TokenId != 0 {
+		tx = tx.Where("token_id = ?", query.TokenId)
+	}
+	if query.ChannelId != 0 {
+		tx = tx.Where("channel_id = ?", query.ChannelId)
+	}
+	if query.Group != "" {
+		tx = tx.Where("group_name = ?", query.Group)
+	}
+	if query.ModelName != "" {
+		tx = tx.Where("model_name = ?", query.ModelName)
+	}
+	if query.RelayFormat != "" {
+		tx = tx.Where("relay_format = ?", query.RelayFormat)
+	}
+	if query.ErrorClass != "" {
+		tx = tx.Where("error_class = ?", query.ErrorClass)
+	}
+	if len(dims) > 0 {
+		tx = tx.Group(strings.Join(dims, ", "))
+	}
+
+	var rows []*UsageRollup
+	if err := tx.Limit(usageQueryMaxRows).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	items := make([]*UsageRollupItem, 0, len(rows))
+	for _, row := range rows {
+		item := &UsageRollupItem{
+			BucketAt:         row.BucketAt,
+			UserId:           row.UserId,
+			TokenId:          row.TokenId,
+			ChannelId:        row.ChannelId,
+			GroupName:        row.GroupName,
+			ModelName:        row.ModelName,
+			RelayFormat:      row.RelayFormat,
+			ErrorClass:       row.ErrorClass,
+			RequestCount:     row.RequestCount,
+			ErrorCount:       row.ErrorCount,
+			PromptTokens:     row.PromptTokens,
+			CompletionTokens: row.CompletionTokens,
+			CacheTokens:      row.CacheTokens,
+			ReasoningTokens:  row.ReasoningTokens,
+			Quota:            row.Quota,
+			P50LatencyMs:     row.Percentile(0.5),
+			P90LatencyMs:     row.Percentile(0.9),
+			P99LatencyMs:     row.Percentile(0.99),
+		}
+		if row.RequestCount > 0 {
+			item.AvgLatencyMs = float64(row.LatencySumMs) / float64(row.RequestCount)
+		}
+		items = append(items, item)
+	}
+	fillUsageRollupNames(items, seen)
+
+	if seen[UsageDimTime] {
+		sort.Slice(items, func(i, j int) bool { return items[i].BucketAt < items[j].BucketAt })
+	} else {
+		sort.Slice(items, func(i, j int) bool { return items[i].Quota > items[j].Quota })
+	}
+	return items, nil
+}
+
+type usageNameRow struct {
+	Id   int
+	Name string
+}
+
+func usageLookupNames(table string, column string, ids []int) map[int]string {
+	names := make(map[int]string, len(ids))
+	if len(ids) == 0 {
+		return names
+	}
+	var rows []usageNameRow
+	if err := DB.Table(table).Select("id, "+column+" as name").Where("id IN ?", ids).Find(&rows).Error; err != nil {
+		return names
+	}
+	for _, row := range rows {
+		names[row.Id] = row.Name
+	}
+	return names
+}
+
+func fillUsageRollupNames(items []*UsageRollupItem, dims map[string]bool) {
+	var userIds, tokenIds, channelIds []int
+	for _, item := range items {
+		if dims[UsageDimUser] {
+			userIds = append(userIds, item.UserId)
+		}
+		if dims[UsageDimToken] {
+			tokenIds = append(tokenIds, item.TokenId)
+		}
+		if dims[UsageDimChannel] {
+			channelIds = append(channelIds, item.ChannelId)
+		}
+	}
+	usernames := usageLookupNames("users", "username", userIds)
+	tokenNames := usageLookupNames("tokens", "name", tokenIds)
+	channelNames := usageLookupNames("channels", "name", channelIds)
+	for _, item := range items {
+		item.Username = usernames[item.UserId]
+		item.TokenName = tokenNames[item.TokenId]
+		item.ChannelName = channelNames[item.ChannelId]
+	}
+}
@@ -0,0 +1,111 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsageRollupFlushAndQuery(t *testing.T) {
+	truncateTables(t)
+	usageRollupPending.take()
+	const ts = int64(1700000000)
+
+	for i := 0; i < 3; i++ {
+		RecordUsageRollup(&UsageRollupEvent{CreatedAt: ts, UserId: 1, TokenId: 2, ChannelId: 3, Group: "default",
+			ModelName: "gpt-4o", RelayFormat: "openai", RequestCount: 1, PromptTokens: 100, CompletionTokens: 50,
+			CacheTokens: 10, ReasoningTokens: 5, Quota: 1000, LatencyMs: 800})
+	}
+	_, err := FlushUsageRollups()
+	require.NoError(t, err)
+
+	// 第二次刷新应累加到已有的行
+	RecordUsageRollup(&UsageRollupEvent{CreatedAt: ts + 60, UserId: 1, TokenId: 2, ChannelId: 3, Group: "default",
+		ModelName: "gpt-4o", RelayFormat: "openai", RequestCount: 1, Quota: 1000, LatencyMs: 45000})
+	RecordUsageRollup(&UsageRollupEvent{CreatedAt: ts, UserId: 1, TokenId: 2, ChannelId: 3, Group: "default",
+		ModelName: "claude-3", RelayFormat: "claude", ErrorClass: UsageErrorClassRateLimit, RequestCount: 1, ErrorCount: 1, LatencyMs: 200})
+	_, err = FlushUsageRollups()
+	require.NoError(t, err)
+
+	var count int64
+	require.NoError(t, LOG_DB.Model(&UsageRollup{}).Where("period = ?", UsageRollupHour).Count(&count).Error)
+	assert.Equal(t, int64(2), count)
+
+	items, err := QueryUsageRollups(UsageRollupQuery{Period: UsageRollupDay, GroupBy: []string{UsageDimModel}})
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	gpt := items[0]
+	assert.Equal(t, "gpt-4o", gpt.ModelName)
+	assert.Equal(t, int64(4), gpt.RequestCount)
+	assert.Equal(t, int64(4000), gpt.Quota)
+	assert.Equal(t, int64(300), gpt.PromptTokens)
+	assert.Equal(t, int64(30), gpt.CacheTokens)
+	assert.Equal(t, int64(15), gpt.ReasoningTokens)
+	assert.Equal(t, int64(1000), gpt.P50LatencyMs)
+	assert.Equal(t, int64(60000), gpt.P99LatencyMs)
+
+	items, err = QueryUsageRollups(UsageRollupQuery{Period: UsageRollupHour, GroupBy: []string{UsageDimErrorClass},
+		ErrorClass: UsageErrorClassRateLimit})
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, int64(1), items[0].ErrorCount)
+
+	_, err = QueryUsageRollups(UsageRollupQuery{GroupBy: []string{"ip"}})
+	assert.Error(t, err)
+}
+
+func TestBackfillUsageRollups(t *testing.T) {
+	truncateTables(t)
+	const day = int64(1700006400) // 2023-11-15 00:00:00 UTC
+
+	logs := []*Log{
+		{UserId: 1, CreatedAt: day + 100, Type: LogTypeConsume, ModelName: "gpt-4o", Quota: 500, PromptTokens: 10,
+			CompletionTokens: 20, UseTime: 2, TokenId: 7, Group: "default", Other: `{"cache_tokens":4,"relay_format":"openai"}`},
+		{UserId: 1, CreatedAt: day + 200, Type: LogTypeError, ModelName: "gpt-4o", TokenId: 7, Group: "default",
+			Other: `{"status_code":502,"relay_format":"openai"}`},
+		{UserId: 1, CreatedAt: day + 300, Type: LogTypeRefund, ModelName: "gpt-4o", Quota: 100, TokenId: 7, Group: "default"},
+		{UserId: 1, CreatedAt: day + 400, Type: LogTypeConsume, ModelName: "gpt-4o", Quota: 50, TokenId: 7, Group: "default",
+			Other: `{"task_id":"task_1","pre_consumed_quota":500}`},
+		{UserId: 1, CreatedAt: day + 500, Type: LogTypeTopup, Quota: 99999},
+		{UserId: 2, CreatedAt: day + 86400 + 100, Type: LogTypeConsume, ModelName: "gpt-4o", Quota: 30},
+	}
+	require.NoError(t, LOG_DB.Create(&logs).Error)
+
+	processed, err := BackfillUsageRollups(day, day+86400+3600)
+	require.NoError(t, err)
+	assert.Equal(t, 5, processed)
+	// 重复回填结果不变
+	_, err = BackfillUsageRollups(day, day+86400+3600)
+	require.NoError(t, err)
+
+	// 按天逐日重建
+	items, err := QueryUsageRollups(UsageRollupQuery{Period: UsageRollupDay, UserId: 2, GroupBy: []string{UsageDimTime}})
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, day+86400, items[0].BucketAt)
+	assert.Equal(t, int64(30), items[0].Quota)
+
+	items, err = QueryUsageRollups(UsageRollupQuery{Period: UsageRollupDay, UserId: 1})
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, int64(2), items[0].RequestCount)
+	assert.Equal(t, int64(1), items[0].ErrorCount)
+	assert.Equal(t, int64(450), items[0].Quota)
+	assert.Equal(t, int64(4), items[0].CacheTokens)
+
+	items, err = QueryUsageRollups(UsageRollupQuery{Period: UsageRollupHour, GroupBy: []string{UsageDimRelayFormat, UsageDimErrorClass}})
+	require.NoError(t, err)
+	var upstreamErrors int64
+	for _, item := range items {
+		if item.ErrorClass == UsageErrorClassUpstream {
+			assert.Equal(t, "openai", item.RelayFormat)
+			upstreamErrors += item.ErrorCount
+		}
+	}
+	assert.Equal(t, int64(1), upstreamErrors)
+
+	_, err = BackfillUsageRollups(UsageRollupBucket(UsageRollupDay, common.GetTimestamp()), common.GetTimestamp())
+	assert.Error(t, err)
+}
@@ -509,6 +509,18 @@ func (user *User) Update(updatePassword bool) error {
 	return updateUserCache(*user)
 }
 
+// UpdateUserSettingById 只更新用户设置字段
+func UpdateUserSettingById(id int, setting dto.UserSetting) error {
+	settingBytes, err := json.Marshal(setting)
+	if err != nil {
+		return err
+	}
+	if err := DB.Model(&User{}).Where("id = ?", id).Update("setting", string(settingBytes)).Error; err != nil {
+		return err
+	}
+	return updateUserSettingCache(id, string(settingBytes))
+}
+
 func (user *User) Edit(updatePassword bool) error {
 	var err error
 	if updatePassword {
@@ -579,7 +591,7 @@ func (user *User) Delete() error {
 	}
 
 	// 清除缓存
-	return invalidateUserCache(user.Id)
+	return invalidateUserCacheAndNotify(user.Id)
 }
 
 func (user *User) HardDelete() error {
@@ -2,6 +2,7 @@ package model
 
 import (
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
@@ -57,6 +58,15 @@ func invalidateUserCache(userId int) error {
 	return common.RedisDelKey(getUserCacheKey(userId))
 }
 
+// invalidateUserCacheAndNotify 清除用户缓存并通知其他节点
+func invalidateUserCacheAndNotify(userId int) error {
+	if err := invalidateUserCache(userId); err != nil {
+		return err
+	}
+	PublishCacheEvent(CacheEventUserEvict, strconv.Itoa(userId))
+	return nil
+}
+
 // updateUserCache updates all user cache fields using hash
 func updateUserCache(user User) error {
 	if !common.RedisEnabled {
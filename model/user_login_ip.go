@@ -0,0 +1,52 @@
+package model
+
+import (
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm/clause"
+)
+
+// UserLoginIp 用户最近登录过的 IP，用于新 IP 登录提醒；独立成表，避免与用户设置的更新互相覆盖
+type UserLoginIp struct {
+	Id         int    `json:"id"`
+	UserId     int    `json:"user_id" gorm:"not null;uniqueIndex:idx_user_login_ip,priority:1"`
+	Ip         string `json:"ip" gorm:"type:varchar(64);not null;uniqueIndex:idx_user_login_ip,priority:2"`
+	LastSeenAt int64  `json:"last_seen_at" gorm:"bigint"`
+}
+
+// RecordUserLoginIp 记录一次登录 IP，只保留最近 keep 个；返回该 IP 是否为新 IP（用户首次记录不算）
+func RecordUserLoginIp(userId int, ip string, keep int) (bool, error) {
+	now := common.GetTimestamp()
+	result := DB.Model(&UserLoginIp{}).Where("user_id = ? AND ip = ?", userId, ip).Update("last_seen_at", now)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return false, nil
+	}
+
+	var count int64
+	if err := DB.Model(&UserLoginIp{}).Where("user_id = ?", userId).Count(&count).Error; err != nil {
+		return false, err
+	}
+	// 并发登录时可能已被插入，冲突时忽略
+	result = DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&UserLoginIp{UserId: userId, Ip: ip, LastSeenAt: now})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	var staleIds []int
+	if err := DB.Model(&UserLoginIp{}).Where("user_id = ?", userId).
+		Order("last_seen_at desc, id desc").Offset(keep).Limit(1000).Pluck("id", &staleIds).Error; err != nil {
+		return false, err
+	}
+	if len(staleIds) > 0 {
+		if err := DB.Where("id IN ?", staleIds).Delete(&UserLoginIp{}).Error; err != nil {
+			return false, err
+		}
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,35 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordUserLoginIp(t *testing.T) {
+	t.Cleanup(func() { DB.Exec("DELETE FROM user_login_ips") })
+
+	// 首次记录不算新 IP
+	isNew, err := RecordUserLoginIp(1, "10.0.0.1", 2)
+	require.NoError(t, err)
+	assert.False(t, isNew)
+
+	isNew, err = RecordUserLoginIp(1, "10.0.0.1", 2)
+	require.NoError(t, err)
+	assert.False(t, isNew)
+
+	isNew, err = RecordUserLoginIp(1, "10.0.0.2", 2)
+	require.NoError(t, err)
+	assert.True(t, isNew)
+
+	// 超出保留数量时淘汰最久未使用的 IP
+	DB.Model(&UserLoginIp{}).Where("ip = ?", "10.0.0.1").Update("last_seen_at", 1)
+	isNew, err = RecordUserLoginIp(1, "10.0.0.3", 2)
+	require.NoError(t, err)
+	assert.True(t, isNew)
+
+	var ips []string
+	require.NoError(t, DB.Model(&UserLoginIp{}).Where("user_id = ?", 1).Order("ip").Pluck("ip", &ips).Error)
+	assert.Equal(t, []string{"10.0.0.2", "10.0.0.3"}, ips)
+}
@@ -12,6 +12,7 @@ import (
 	"time"
 
 	common2 "github.com/QuantumNous/new-api/common"
+	constant2 "github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/relay/constant"
@@ -292,6 +293,11 @@ func DoApiRequest(a Adaptor, c *gin.Context, info *common.RelayInfo, requestBody
 	if err != nil {
 		return nil, fmt.Errorf("get request url failed: %w", err)
 	}
+	return DoApiRequestWithURL(a, c, info, fullRequestURL, requestBody)
+}
+
+// DoApiRequestWithURL 使用适配器的请求头设置访问指定地址，用于 count_tokens 等适配器未覆盖的上游接口
+func DoApiRequestWithURL(a Adaptor, c *gin.Context, info *common.RelayInfo, fullRequestURL string, requestBody io.Reader) (*http.Response, error) {
 	if common2.DebugEnabled {
 		println("fullRequestURL:", fullRequestURL)
 	}
@@ -515,6 +521,10 @@ func doRequest(c *gin.Context, req *http.Request, info *common.RelayInfo) (*http
 		}
 	}
 
+	if common2.GetContextKeyBool(c, constant2.ContextKeyHedgeLeg) {
+		// 对冲请求落败的一方通过取消请求上下文断开上游连接
+		req = req.WithContext(c.Request.Context())
+	}
 	resp, err := client.Do(req)
 	if err != nil {
 		logger.LogError(c, "do request failed: "+err.Error())
@@ -523,6 +533,7 @@ func doRequest(c *gin.Context, req *http.Request, info *common.RelayInfo) (*http
 	if resp == nil {
 		return nil, errors.New("resp is nil")
 	}
+	service.ObserveUpstreamRateLimit(c, info, resp)
 
 	_ = req.Body.Close()
 	_ = c.Request.Body.Close()
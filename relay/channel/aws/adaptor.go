@@ -10,6 +10,7 @@ import (
 	"github.com/QuantumNous/new-api/relay/channel"
 	"github.com/QuantumNous/new-api/relay/channel/claude"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/types"
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
@@ -81,8 +82,10 @@ func (a *Adaptor) ConvertAudioRequest(c *gin.Context, info *relaycommon.RelayInf
 }
 
 func (a *Adaptor) ConvertImageRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.ImageRequest) (any, error) {
-	//TODO implement me
-	return nil, errors.New("not implemented")
+	if info.RelayMode != relayconstant.RelayModeImagesGenerations {
+		return nil, errors.New("aws bedrock only supports image generations")
+	}
+	return convertToAwsImageRequest(request, getAwsModelID(info.UpstreamModelName))
 }
 
 func (a *Adaptor) Init(info *relaycommon.RelayInfo) {
@@ -136,8 +139,7 @@ func (a *Adaptor) ConvertRerankRequest(c *gin.Context, relayMode int, request dt
 }
 
 func (a *Adaptor) ConvertEmbeddingRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.EmbeddingRequest) (any, error) {
-	//TODO implement me
-	return nil, errors.New("not implemented")
+	return convertToAwsEmbeddingRequest(request, getAwsModelID(info.UpstreamModelName))
 }
 
 func (a *Adaptor) ConvertOpenAIResponsesRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.OpenAIResponsesRequest) (any, error) {
@@ -146,6 +148,10 @@ func (a *Adaptor) ConvertOpenAIResponsesRequest(c *gin.Context, info *relaycommo
 }
 
 func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (any, error) {
+	// embeddings 与图片生成统一走 SDK 的 InvokeModel，newAwsClient 同时支持 AK/SK 与 API Key
+	if isAwsInvokeBatchMode(info.RelayMode) {
+		return doAwsInvokeBatchRequest(c, info, a, requestBody)
+	}
 	if a.ClientMode == ClientModeApiKey {
 		return channel.DoApiRequest(a, c, info, requestBody)
 	} else {
@@ -154,6 +160,14 @@ func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, request
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage any, err *types.NewAPIError) {
+	switch info.RelayMode {
+	case relayconstant.RelayModeEmbeddings:
+		err, usage = awsEmbeddingHandler(c, info, a.AwsClient, a)
+		return
+	case relayconstant.RelayModeImagesGenerations:
+		err, usage = awsImageHandler(c, info, a.AwsClient, a)
+		return
+	}
 	if a.ClientMode == ClientModeApiKey {
 		claudeAdaptor := claude.Adaptor{}
 		usage, err = claudeAdaptor.DoResponse(c, resp, info)
@@ -171,6 +185,10 @@ func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycom
 	return
 }
 
+func isAwsInvokeBatchMode(relayMode int) bool {
+	return relayMode == relayconstant.RelayModeEmbeddings || relayMode == relayconstant.RelayModeImagesGenerations
+}
+
 func (a *Adaptor) GetModelList() (models []string) {
 	for n := range awsModelIDMap {
 		models = append(models, n)
@@ -27,6 +27,18 @@ var awsModelIDMap = map[string]string{
 	"nova-reel-v1:0":    "amazon.nova-reel-v1:0",
 	"nova-reel-v1:1":    "amazon.nova-reel-v1:1",
 	"nova-sonic-v1:0":   "amazon.nova-sonic-v1:0",
+	// Embedding models
+	"titan-embed-text-v1":          "amazon.titan-embed-text-v1",
+	"titan-embed-text-v2:0":        "amazon.titan-embed-text-v2:0",
+	"cohere-embed-english-v3":      "cohere.embed-english-v3",
+	"cohere-embed-multilingual-v3": "cohere.embed-multilingual-v3",
+	"cohere-embed-v4:0":            "cohere.embed-v4:0",
+	// Image models
+	"titan-image-generator-v1":   "amazon.titan-image-generator-v1",
+	"titan-image-generator-v2:0": "amazon.titan-image-generator-v2:0",
+	"stable-image-core-v1:1":     "stability.stable-image-core-v1:1",
+	"stable-image-ultra-v1:1":    "stability.stable-image-ultra-v1:1",
+	"sd3-5-large-v1:0":           "stability.sd3-5-large-v1:0",
 }
 
 var awsModelCanCrossRegionMap = map[string]map[string]bool{
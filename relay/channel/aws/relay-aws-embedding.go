@@ -0,0 +1,154 @@
+package aws
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// AwsTitanEmbeddingRequest Titan Embeddings 每次只接受一条输入
+type AwsTitanEmbeddingRequest struct {
+	InputText  string `json:"inputText"`
+	Dimensions *int   `json:"dimensions,omitempty"` // 仅 v2 支持
+	Normalize  *bool  `json:"normalize,omitempty"`  // 仅 v2 支持
+}
+
+type AwsTitanEmbeddingResponse struct {
+	Embedding           []float64 `json:"embedding"`
+	InputTextTokenCount int       `json:"inputTextTokenCount"`
+}
+
+type AwsCohereEmbeddingRequest struct {
+	Texts           []string `json:"texts"`
+	InputType       string   `json:"input_type"`
+	Truncate        string   `json:"truncate,omitempty"`
+	EmbeddingTypes  []string `json:"embedding_types,omitempty"`
+	OutputDimension *int     `json:"output_dimension,omitempty"` // 仅 embed-v4 支持
+}
+
+type AwsCohereEmbeddingResponse struct {
+	// v3 返回 [][]float64，指定 embedding_types 时返回 {"float": [][]float64}
+	Embeddings json.RawMessage `json:"embeddings"`
+}
+
+func isAwsTitanEmbeddingModel(modelId string) bool {
+	return strings.Contains(modelId, "titan-embed")
+}
+
+func isAwsCohereEmbeddingModel(modelId string) bool {
+	return strings.Contains(modelId, "cohere.embed") || strings.HasPrefix(modelId, "cohere-embed")
+}
+
+// convertToAwsEmbeddingRequest 转换为 InvokeModel 请求体数组，见 doAwsInvokeBatchRequest
+func convertToAwsEmbeddingRequest(request dto.EmbeddingRequest, modelId string) ([]any, error) {
+	inputs := request.ParseInput()
+	if len(inputs) == 0 {
+		return nil, errors.New("input is required")
+	}
+	switch {
+	case isAwsTitanEmbeddingModel(modelId):
+		payloads := make([]any, 0, len(inputs))
+		for _, input := range inputs {
+			payloads = append(payloads, AwsTitanEmbeddingRequest{
+				InputText:  input,
+				Dimensions: request.Dimensions,
+			})
+		}
+		return payloads, nil
+	case isAwsCohereEmbeddingModel(modelId):
+		cohereReq := AwsCohereEmbeddingRequest{
+			Texts:     inputs,
+			InputType: "search_document",
+			Truncate:  "END",
+		}
+		if strings.Contains(modelId, "embed-v4") {
+			cohereReq.EmbeddingTypes = []string{"float"}
+			cohereReq.OutputDimension = request.Dimensions
+		}
+		return []any{cohereReq}, nil
+	default:
+		return nil, fmt.Errorf("model %s does not support embeddings on aws bedrock", modelId)
+	}
+}
+
+func parseAwsCohereEmbeddings(raw json.RawMessage) ([][]float64, error) {
+	var embeddings [][]float64
+	if err := common.Unmarshal(raw, &embeddings); err == nil {
+		return embeddings, nil
+	}
+	var typed struct {
+		Float [][]float64 `json:"float"`
+	}
+	if err := common.Unmarshal(raw, &typed); err != nil {
+		return nil, err
+	}
+	return typed.Float, nil
+}
+
+func awsEmbeddingHandler(c *gin.Context, info *relaycommon.RelayInfo, invoker awsModelInvoker, a *Adaptor) (*types.NewAPIError, *dto.Usage) {
+	awsReqs, ok := a.AwsReq.([]*bedrockruntime.InvokeModelInput)
+	if !ok {
+		return types.NewError(errors.New("invalid aws embedding request"), types.ErrorCodeInvalidRequest), nil
+	}
+	bodies, apiErr := invokeAwsModelBatch(invoker, awsReqs)
+	if apiErr != nil {
+		return apiErr, nil
+	}
+
+	openAIResponse := dto.OpenAIEmbeddingResponse{
+		Object: "list",
+		Data:   make([]dto.OpenAIEmbeddingResponseItem, 0, len(bodies)),
+		Model:  info.UpstreamModelName,
+	}
+	usage := &dto.Usage{}
+	for _, body := range bodies {
+		if isAwsTitanEmbeddingModel(a.AwsModelId) {
+			var titanResp AwsTitanEmbeddingResponse
+			if err := common.Unmarshal(body, &titanResp); err != nil {
+				return types.NewError(errors.Wrap(err, "unmarshal titan embedding response"), types.ErrorCodeBadResponseBody), nil
+			}
+			openAIResponse.Data = append(openAIResponse.Data, dto.OpenAIEmbeddingResponseItem{
+				Object:    "embedding",
+				Index:     len(openAIResponse.Data),
+				Embedding: titanResp.Embedding,
+			})
+			usage.PromptTokens += titanResp.InputTextTokenCount
+			continue
+		}
+		var cohereResp AwsCohereEmbeddingResponse
+		if err := common.Unmarshal(body, &cohereResp); err != nil {
+			return types.NewError(errors.Wrap(err, "unmarshal cohere embedding response"), types.ErrorCodeBadResponseBody), nil
+		}
+		embeddings, err := parseAwsCohereEmbeddings(cohereResp.Embeddings)
+		if err != nil {
+			return types.NewError(errors.Wrap(err, "parse cohere embeddings"), types.ErrorCodeBadResponseBody), nil
+		}
+		for _, embedding := range embeddings {
+			openAIResponse.Data = append(openAIResponse.Data, dto.OpenAIEmbeddingResponseItem{
+				Object:    "embedding",
+				Index:     len(openAIResponse.Data),
+				Embedding: embedding,
+			})
+		}
+	}
+
+	// Cohere 在 Bedrock 上不返回用量，使用预估的输入 token
+	if usage.PromptTokens == 0 {
+		usage.PromptTokens = info.GetEstimatePromptTokens()
+	}
+	usage.TotalTokens = usage.PromptTokens
+	openAIResponse.Usage = *usage
+
+	c.JSON(http.StatusOK, openAIResponse)
+	return nil, usage
+}
@@ -0,0 +1,210 @@
+package aws
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// AwsCanvasImageRequest Nova Canvas 与 Titan Image Generator 共用的文生图请求格式
+type AwsCanvasImageRequest struct {
+	TaskType              string                         `json:"taskType"`
+	TextToImageParams     AwsCanvasTextToImageParams     `json:"textToImageParams"`
+	ImageGenerationConfig AwsCanvasImageGenerationConfig `json:"imageGenerationConfig"`
+}
+
+type AwsCanvasTextToImageParams struct {
+	Text         string `json:"text"`
+	NegativeText string `json:"negativeText,omitempty"`
+}
+
+type AwsCanvasImageGenerationConfig struct {
+	NumberOfImages int    `json:"numberOfImages"`
+	Width          int    `json:"width"`
+	Height         int    `json:"height"`
+	Quality        string `json:"quality,omitempty"` // standard / premium
+}
+
+type AwsCanvasImageResponse struct {
+	Images []string `json:"images"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// AwsStabilityImageRequest Stability 模型每次只生成一张图
+type AwsStabilityImageRequest struct {
+	Prompt         string `json:"prompt"`
+	NegativePrompt string `json:"negative_prompt,omitempty"`
+	AspectRatio    string `json:"aspect_ratio,omitempty"`
+	OutputFormat   string `json:"output_format,omitempty"`
+}
+
+type AwsStabilityImageResponse struct {
+	Images        []string  `json:"images"`
+	FinishReasons []*string `json:"finish_reasons"`
+}
+
+// Nova Canvas 单次最多生成 5 张
+const awsCanvasMaxImages = 5
+
+var awsStabilityAspectRatios = []string{"21:9", "16:9", "3:2", "5:4", "1:1", "4:5", "2:3", "9:16", "9:21"}
+
+func isAwsCanvasImageModel(modelId string) bool {
+	return strings.Contains(modelId, "nova-canvas") || strings.Contains(modelId, "titan-image-generator")
+}
+
+func isAwsStabilityImageModel(modelId string) bool {
+	return strings.HasPrefix(modelId, "stability.") || strings.HasPrefix(modelId, "stable-") || strings.HasPrefix(modelId, "sd3")
+}
+
+func parseAwsImageSize(size string) (int, int) {
+	parts := strings.Split(strings.ToLower(size), "x")
+	if len(parts) == 2 {
+		width, err1 := strconv.Atoi(parts[0])
+		height, err2 := strconv.Atoi(parts[1])
+		if err1 == nil && err2 == nil && width > 0 && height > 0 {
+			return width, height
+		}
+	}
+	return 1024, 1024
+}
+
+// nearestAwsStabilityAspectRatio 将 OpenAI 的尺寸映射到 Stability 支持的最接近的宽高比
+func nearestAwsStabilityAspectRatio(width, height int) string {
+	target := float64(width) / float64(height)
+	best := "1:1"
+	bestDiff := math.MaxFloat64
+	for _, ratio := range awsStabilityAspectRatios {
+		parts := strings.Split(ratio, ":")
+		w, _ := strconv.ParseFloat(parts[0], 64)
+		h, _ := strconv.ParseFloat(parts[1], 64)
+		if diff := math.Abs(math.Log(target) - math.Log(w/h)); diff < bestDiff {
+			best, bestDiff = ratio, diff
+		}
+	}
+	return best
+}
+
+func getAwsImageNegativePrompt(request dto.ImageRequest) string {
+	raw, ok := request.Extra["negative_prompt"]
+	if !ok {
+		return ""
+	}
+	var negativePrompt string
+	_ = common.Unmarshal(raw, &negativePrompt)
+	return negativePrompt
+}
+
+// convertToAwsImageRequest 转换为 InvokeModel 请求体数组，见 doAwsInvokeBatchRequest
+func convertToAwsImageRequest(request dto.ImageRequest, modelId string) ([]any, error) {
+	if request.Prompt == "" {
+		return nil, errors.New("prompt is required")
+	}
+	n := 1
+	if request.N != nil && *request.N > 0 {
+		n = int(*request.N)
+	}
+	width, height := parseAwsImageSize(request.Size)
+	negativePrompt := getAwsImageNegativePrompt(request)
+
+	switch {
+	case isAwsCanvasImageModel(modelId):
+		if n > awsCanvasMaxImages {
+			return nil, fmt.Errorf("n must be at most %d for model %s", awsCanvasMaxImages, modelId)
+		}
+		quality := "standard"
+		if request.Quality == "hd" || request.Quality == "high" || request.Quality == "premium" {
+			quality = "premium"
+		}
+		return []any{AwsCanvasImageRequest{
+			TaskType: "TEXT_IMAGE",
+			TextToImageParams: AwsCanvasTextToImageParams{
+				Text:         request.Prompt,
+				NegativeText: negativePrompt,
+			},
+			ImageGenerationConfig: AwsCanvasImageGenerationConfig{
+				NumberOfImages: n,
+				Width:          width,
+				Height:         height,
+				Quality:        quality,
+			},
+		}}, nil
+	case isAwsStabilityImageModel(modelId):
+		payloads := make([]any, 0, n)
+		for i := 0; i < n; i++ {
+			payloads = append(payloads, AwsStabilityImageRequest{
+				Prompt:         request.Prompt,
+				NegativePrompt: negativePrompt,
+				AspectRatio:    nearestAwsStabilityAspectRatio(width, height),
+				OutputFormat:   "png",
+			})
+		}
+		return payloads, nil
+	default:
+		return nil, fmt.Errorf("model %s does not support image generation on aws bedrock", modelId)
+	}
+}
+
+func awsImageHandler(c *gin.Context, info *relaycommon.RelayInfo, invoker awsModelInvoker, a *Adaptor) (*types.NewAPIError, *dto.Usage) {
+	awsReqs, ok := a.AwsReq.([]*bedrockruntime.InvokeModelInput)
+	if !ok {
+		return types.NewError(errors.New("invalid aws image request"), types.ErrorCodeInvalidRequest), nil
+	}
+	bodies, apiErr := invokeAwsModelBatch(invoker, awsReqs)
+	if apiErr != nil {
+		return apiErr, nil
+	}
+
+	openAIResponse := dto.ImageResponse{
+		Created: common.GetTimestamp(),
+		Data:    make([]dto.ImageData, 0, len(bodies)),
+	}
+	for _, body := range bodies {
+		if isAwsStabilityImageModel(a.AwsModelId) {
+			var stabilityResp AwsStabilityImageResponse
+			if err := common.Unmarshal(body, &stabilityResp); err != nil {
+				return types.NewError(errors.Wrap(err, "unmarshal stability image response"), types.ErrorCodeBadResponseBody), nil
+			}
+			for i, image := range stabilityResp.Images {
+				// finish_reasons 非空表示被内容过滤
+				if i < len(stabilityResp.FinishReasons) && stabilityResp.FinishReasons[i] != nil {
+					continue
+				}
+				openAIResponse.Data = append(openAIResponse.Data, dto.ImageData{B64Json: image})
+			}
+			continue
+		}
+		var canvasResp AwsCanvasImageResponse
+		if err := common.Unmarshal(body, &canvasResp); err != nil {
+			return types.NewError(errors.Wrap(err, "unmarshal canvas image response"), types.ErrorCodeBadResponseBody), nil
+		}
+		if canvasResp.Error != "" {
+			return types.NewOpenAIError(errors.New(canvasResp.Error), types.ErrorCodeBadResponseBody, http.StatusBadRequest), nil
+		}
+		for _, image := range canvasResp.Images {
+			openAIResponse.Data = append(openAIResponse.Data, dto.ImageData{B64Json: image})
+		}
+	}
+	if len(openAIResponse.Data) == 0 {
+		return types.NewOpenAIError(errors.New("no images generated"), types.ErrorCodeBadResponseBody, http.StatusBadRequest), nil
+	}
+
+	// 按实际生成的图片数量计费
+	info.PriceData.AddOtherRatio("n", float64(len(openAIResponse.Data)))
+
+	c.JSON(http.StatusOK, openAIResponse)
+	return nil, &dto.Usage{
+		PromptTokens: info.GetEstimatePromptTokens(),
+		TotalTokens:  info.GetEstimatePromptTokens(),
+	}
+}
@@ -95,14 +95,7 @@ func doAwsClientRequest(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor,
 	}
 	a.AwsClient = awsCli
 
-	// 获取对应的AWS模型ID
-	awsModelId := getAwsModelID(info.UpstreamModelName)
-
-	awsRegionPrefix := getAwsRegionPrefix(awsCli.Options().Region)
-	canCrossRegion := awsModelCanCrossRegion(awsModelId, awsRegionPrefix)
-	if canCrossRegion {
-		awsModelId = awsModelCrossRegion(awsModelId, awsRegionPrefix)
-	}
+	awsModelId := getAwsInvokeModelID(info.UpstreamModelName, awsCli.Options().Region)
 
 	// init empty request.header
 	requestHeader := http.Header{}
@@ -192,6 +185,66 @@ func buildAwsRequestBody(c *gin.Context, info *relaycommon.RelayInfo, awsClaudeR
 	return common.Marshal(awsClaudeReq)
 }
 
+// getAwsInvokeModelID 获取对应的AWS模型ID，支持跨区域推理时加上区域前缀
+func getAwsInvokeModelID(requestModel string, region string) string {
+	awsModelId := getAwsModelID(requestModel)
+	awsRegionPrefix := getAwsRegionPrefix(region)
+	if awsModelCanCrossRegion(awsModelId, awsRegionPrefix) {
+		awsModelId = awsModelCrossRegion(awsModelId, awsRegionPrefix)
+	}
+	return awsModelId
+}
+
+// awsModelInvoker 便于测试时替换 bedrockruntime.Client
+type awsModelInvoker interface {
+	InvokeModel(ctx context.Context, params *bedrockruntime.InvokeModelInput, optFns ...func(*bedrockruntime.Options)) (*bedrockruntime.InvokeModelOutput, error)
+}
+
+// doAwsInvokeBatchRequest 用于 embeddings 与图片生成：请求体是 Bedrock InvokeModel 请求体组成的数组，
+// 每个元素单独调用一次（Titan embeddings 每次只接受一条输入，Stability 每次只生成一张图）
+func doAwsInvokeBatchRequest(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor, requestBody io.Reader) (any, error) {
+	awsCli, err := newAwsClient(c, info)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeChannelAwsClientError)
+	}
+	a.AwsClient = awsCli
+	a.AwsModelId = getAwsInvokeModelID(info.UpstreamModelName, awsCli.Options().Region)
+
+	var payloads []json.RawMessage
+	if err := common.DecodeJson(requestBody, &payloads); err != nil {
+		return nil, types.NewError(errors.Wrap(err, "decode aws invoke request fail"), types.ErrorCodeBadRequestBody)
+	}
+	if len(payloads) == 0 {
+		return nil, types.NewError(errors.New("empty aws invoke request"), types.ErrorCodeBadRequestBody)
+	}
+	awsReqs := make([]*bedrockruntime.InvokeModelInput, 0, len(payloads))
+	for _, payload := range payloads {
+		awsReqs = append(awsReqs, &bedrockruntime.InvokeModelInput{
+			ModelId:     aws.String(a.AwsModelId),
+			Accept:      aws.String("application/json"),
+			ContentType: aws.String("application/json"),
+			Body:        payload,
+		})
+	}
+	a.AwsReq = awsReqs
+	return nil, nil
+}
+
+// invokeAwsModelBatch 依次调用 InvokeModel，任一失败即返回错误
+func invokeAwsModelBatch(invoker awsModelInvoker, awsReqs []*bedrockruntime.InvokeModelInput) ([][]byte, *types.NewAPIError) {
+	bodies := make([][]byte, 0, len(awsReqs))
+	for _, awsReq := range awsReqs {
+		ctx, cancel := newAwsInvokeContext()
+		awsResp, err := invoker.InvokeModel(ctx, awsReq)
+		cancel()
+		if err != nil {
+			return nil, types.NewOpenAIError(errors.Wrap(err, "InvokeModel"), types.ErrorCodeAwsInvokeError, getAwsErrorStatusCode(err))
+		}
+		bodies = append(bodies, awsResp.Body)
+	}
+	return bodies, nil
+}
+
 func getAwsRegionPrefix(awsRegionId string) string {
 	parts := strings.Split(awsRegionId, "-")
 	regionPrefix := ""
@@ -2,12 +2,15 @@ package aws
 
 import (
 	"bytes"
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/require"
@@ -53,3 +56,107 @@ func TestDoAwsClientRequest_AppliesRuntimeHeaderOverrideToAnthropicBeta(t *testi
 	require.True(t, ok)
 	require.Equal(t, []any{"computer-use-2025-01-24"}, values)
 }
+
+type fakeAwsInvoker struct {
+	requests  []*bedrockruntime.InvokeModelInput
+	responses []string
+}
+
+func (f *fakeAwsInvoker) InvokeModel(_ context.Context, params *bedrockruntime.InvokeModelInput, _ ...func(*bedrockruntime.Options)) (*bedrockruntime.InvokeModelOutput, error) {
+	f.requests = append(f.requests, params)
+	body := f.responses[len(f.requests)-1]
+	return &bedrockruntime.InvokeModelOutput{Body: []byte(body)}, nil
+}
+
+func prepareAwsBatchRequest(t *testing.T, info *relaycommon.RelayInfo, converted any) *Adaptor {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/embeddings", nil)
+
+	body, err := common.Marshal(converted)
+	require.NoError(t, err)
+	adaptor := &Adaptor{}
+	_, err = doAwsInvokeBatchRequest(ctx, info, adaptor, bytes.NewReader(body))
+	require.NoError(t, err)
+	return adaptor
+}
+
+func TestAwsTitanEmbedding_InvokesOncePerInput(t *testing.T) {
+	info := &relaycommon.RelayInfo{
+		RelayMode: relayconstant.RelayModeEmbeddings,
+		ChannelMeta: &relaycommon.ChannelMeta{
+			ApiKey:            "api-key|us-east-1",
+			UpstreamModelName: "titan-embed-text-v2:0",
+		},
+	}
+	converted, err := convertToAwsEmbeddingRequest(dto.EmbeddingRequest{Input: []any{"hello", "world"}}, getAwsModelID(info.UpstreamModelName))
+	require.NoError(t, err)
+	adaptor := prepareAwsBatchRequest(t, info, converted)
+	require.Equal(t, "amazon.titan-embed-text-v2:0", adaptor.AwsModelId)
+
+	invoker := &fakeAwsInvoker{responses: []string{
+		`{"embedding":[0.1,0.2],"inputTextTokenCount":3}`,
+		`{"embedding":[0.3,0.4],"inputTextTokenCount":4}`,
+	}}
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	apiErr, usage := awsEmbeddingHandler(c, info, invoker, adaptor)
+	require.Nil(t, apiErr)
+	require.Len(t, invoker.requests, 2)
+	require.JSONEq(t, `{"inputText":"hello"}`, string(invoker.requests[0].Body))
+	require.Equal(t, 7, usage.PromptTokens)
+
+	var resp dto.OpenAIEmbeddingResponse
+	require.NoError(t, common.Unmarshal(recorder.Body.Bytes(), &resp))
+	require.Len(t, resp.Data, 2)
+	require.Equal(t, 1, resp.Data[1].Index)
+	require.Equal(t, []float64{0.3, 0.4}, resp.Data[1].Embedding)
+}
+
+func TestAwsCohereEmbedding_ParsesTypedEmbeddings(t *testing.T) {
+	embeddings, err := parseAwsCohereEmbeddings([]byte(`{"float":[[1,2],[3,4]]}`))
+	require.NoError(t, err)
+	require.Equal(t, [][]float64{{1, 2}, {3, 4}}, embeddings)
+
+	embeddings, err = parseAwsCohereEmbeddings([]byte(`[[5,6]]`))
+	require.NoError(t, err)
+	require.Equal(t, [][]float64{{5, 6}}, embeddings)
+}
+
+func TestAwsStabilityImage_ChargesPerGeneratedImage(t *testing.T) {
+	n := uint(2)
+	info := &relaycommon.RelayInfo{
+		RelayMode: relayconstant.RelayModeImagesGenerations,
+		ChannelMeta: &relaycommon.ChannelMeta{
+			ApiKey:            "ak|sk|us-west-2",
+			UpstreamModelName: "stable-image-core-v1:1",
+		},
+	}
+	converted, err := convertToAwsImageRequest(dto.ImageRequest{Prompt: "a cat", N: &n, Size: "1792x1024"}, getAwsModelID(info.UpstreamModelName))
+	require.NoError(t, err)
+	require.Len(t, converted, 2)
+	require.Equal(t, "16:9", converted[0].(AwsStabilityImageRequest).AspectRatio)
+	adaptor := prepareAwsBatchRequest(t, info, converted)
+
+	invoker := &fakeAwsInvoker{responses: []string{
+		`{"images":["aW1hZ2Ux"],"finish_reasons":[null]}`,
+		`{"images":["aW1hZ2Uy"],"finish_reasons":["Filter reason: prompt"]}`,
+	}}
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	apiErr, _ := awsImageHandler(c, info, invoker, adaptor)
+	require.Nil(t, apiErr)
+
+	var resp dto.ImageResponse
+	require.NoError(t, common.Unmarshal(recorder.Body.Bytes(), &resp))
+	require.Len(t, resp.Data, 1)
+	require.Equal(t, "aW1hZ2Ux", resp.Data[0].B64Json)
+	require.Equal(t, float64(1), info.PriceData.OtherRatios["n"])
+}
+
+func TestAwsCanvasImage_RejectsTooManyImages(t *testing.T) {
+	n := uint(6)
+	_, err := convertToAwsImageRequest(dto.ImageRequest{Prompt: "a cat", N: &n}, "amazon.nova-canvas-v1:0")
+	require.Error(t, err)
+}
@@ -0,0 +1,322 @@
+package gemini
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Gemini 图片输出支持的宽高比
+var geminiImageAspectRatios = []string{"1:1", "2:3", "3:2", "3:4", "4:3", "4:5", "5:4", "9:16", "16:9", "21:9"}
+
+// imagen 支持的宽高比
+var imagenAspectRatios = []string{"1:1", "3:4", "4:3", "9:16", "16:9"}
+
+const geminiImageMaskHint = "The last image is a mask: only edit the regions that are transparent (or white) in the mask and keep everything else unchanged."
+
+// IsGeminiNativeImageRequest /v1/images 请求使用非 imagen 模型时，通过 generateContent 的图片输出实现
+func IsGeminiNativeImageRequest(info *relaycommon.RelayInfo) bool {
+	if info.RelayMode != constant.RelayModeImagesGenerations && info.RelayMode != constant.RelayModeImagesEdits {
+		return false
+	}
+	return !strings.HasPrefix(info.UpstreamModelName, "imagen")
+}
+
+// GeminiImageAspectRatio 将 OpenAI 的 size 转换为最接近的宽高比，也允许直接传入 "16:9" 形式
+func GeminiImageAspectRatio(size string) string {
+	size = strings.TrimSpace(size)
+	if strings.Contains(size, ":") {
+		return size
+	}
+	return nearestImageAspectRatio(size, geminiImageAspectRatios)
+}
+
+// ImagenAspectRatio 与 GeminiImageAspectRatio 相同，但只使用 imagen 支持的宽高比，直接传入不支持的宽高比时返回错误
+func ImagenAspectRatio(size string) (string, error) {
+	size = strings.TrimSpace(size)
+	if strings.Contains(size, ":") {
+		if !slices.Contains(imagenAspectRatios, size) {
+			return "", fmt.Errorf("aspect ratio %s is not supported by imagen, supported: %s", size, strings.Join(imagenAspectRatios, ", "))
+		}
+		return size, nil
+	}
+	return nearestImageAspectRatio(size, imagenAspectRatios), nil
+}
+
+func nearestImageAspectRatio(size string, ratios []string) string {
+	if size == "" || size == "auto" {
+		return "1:1"
+	}
+	parts := strings.Split(strings.ToLower(size), "x")
+	if len(parts) != 2 {
+		return "1:1"
+	}
+	width, err1 := strconv.Atoi(parts[0])
+	height, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil || width <= 0 || height <= 0 {
+		return "1:1"
+	}
+	target := math.Log(float64(width) / float64(height))
+	best := "1:1"
+	bestDiff := math.MaxFloat64
+	for _, ratio := range ratios {
+		ratioParts := strings.Split(ratio, ":")
+		w, _ := strconv.ParseFloat(ratioParts[0], 64)
+		h, _ := strconv.ParseFloat(ratioParts[1], 64)
+		if diff := math.Abs(target - math.Log(w/h)); diff < bestDiff {
+			best, bestDiff = ratio, diff
+		}
+	}
+	return best
+}
+
+func geminiImageSizeFromQuality(quality string) string {
+	switch quality {
+	case "hd", "high", "2K":
+		return "2K"
+	case "4K":
+		return "4K"
+	case "standard", "medium", "low", "1K":
+		return "1K"
+	}
+	return ""
+}
+
+// ConvertImageRequest2GeminiNative 将 OpenAI Images 生成/编辑请求转换为带图片输出的 generateContent 请求
+func ConvertImageRequest2GeminiNative(c *gin.Context, info *relaycommon.RelayInfo, request dto.ImageRequest) (*dto.GeminiChatRequest, error) {
+	if strings.TrimSpace(request.Prompt) == "" {
+		return nil, errors.New("prompt is required")
+	}
+
+	parts := []dto.GeminiPart{{Text: request.Prompt}}
+	if info.RelayMode == constant.RelayModeImagesEdits {
+		imageParts, err := getGeminiImageEditParts(c, request)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, imageParts...)
+	}
+
+	imageConfig := map[string]string{
+		"aspectRatio": GeminiImageAspectRatio(request.Size),
+	}
+	if imageSize := geminiImageSizeFromQuality(request.Quality); imageSize != "" {
+		imageConfig["imageSize"] = imageSize
+	}
+	imageConfigBytes, err := common.Marshal(imageConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	geminiRequest := &dto.GeminiChatRequest{
+		Contents: []dto.GeminiChatContent{{
+			Role:  "user",
+			Parts: parts,
+		}},
+		GenerationConfig: dto.GeminiChatGenerationConfig{
+			ResponseModalities: []string{"TEXT", "IMAGE"},
+			ImageConfig:        imageConfigBytes,
+		},
+	}
+	if request.N != nil && *request.N > 1 {
+		geminiRequest.GenerationConfig.CandidateCount = common.GetPointer(int(*request.N))
+	}
+	return geminiRequest, nil
+}
+
+// getGeminiImageEditParts 读取待编辑的图片与蒙版：multipart 使用 image / image[] / mask 文件，JSON 使用 image 字段（URL 或 base64）
+func getGeminiImageEditParts(c *gin.Context, request dto.ImageRequest) ([]dto.GeminiPart, error) {
+	var parts []dto.GeminiPart
+	if strings.Contains(c.Request.Header.Get("Content-Type"), "multipart/form-data") {
+		form, err := c.MultipartForm()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse image edit form: %w", err)
+		}
+		var imageFiles []*multipart.FileHeader
+		for fieldName, files := range form.File {
+			if fieldName == "image" || strings.HasPrefix(fieldName, "image[") {
+				imageFiles = append(imageFiles, files...)
+			}
+		}
+		for _, fileHeader := range imageFiles {
+			part, err := multipartFileToGeminiPart(fileHeader)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, part)
+		}
+		if len(parts) == 0 {
+			return nil, errors.New("image is required")
+		}
+		if masks := form.File["mask"]; len(masks) > 0 {
+			mask, err := multipartFileToGeminiPart(masks[0])
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, mask, dto.GeminiPart{Text: geminiImageMaskHint})
+		}
+		return parts, nil
+	}
+
+	var images []string
+	if len(request.Image) > 0 {
+		var single string
+		if err := common.Unmarshal(request.Image, &single); err == nil {
+			images = []string{single}
+		} else if err := common.Unmarshal(request.Image, &images); err != nil {
+			return nil, errors.New("image must be a string or an array of strings")
+		}
+	}
+	for _, image := range images {
+		part, err := dataToGeminiPart(c, image)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+	}
+	if len(parts) == 0 {
+		return nil, errors.New("image is required")
+	}
+	if rawMask, ok := request.Extra["mask"]; ok {
+		var mask string
+		if err := common.Unmarshal(rawMask, &mask); err == nil && mask != "" {
+			part, err := dataToGeminiPart(c, mask)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, part, dto.GeminiPart{Text: geminiImageMaskHint})
+		}
+	}
+	return parts, nil
+}
+
+func multipartFileToGeminiPart(fileHeader *multipart.FileHeader) (dto.GeminiPart, error) {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return dto.GeminiPart{}, fmt.Errorf("failed to open image file %s: %w", fileHeader.Filename, err)
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return dto.GeminiPart{}, fmt.Errorf("failed to read image file %s: %w", fileHeader.Filename, err)
+	}
+	mimeType := fileHeader.Header.Get("Content-Type")
+	if mimeType == "" || mimeType == "application/octet-stream" {
+		mimeType = http.DetectContentType(data)
+	}
+	return dto.GeminiPart{
+		InlineData: &dto.GeminiInlineData{
+			MimeType: mimeType,
+			Data:     base64.StdEncoding.EncodeToString(data),
+		},
+	}, nil
+}
+
+func dataToGeminiPart(c *gin.Context, data string) (dto.GeminiPart, error) {
+	source := types.NewFileSourceFromData(data, "")
+	base64Data, mimeType, err := service.GetBase64Data(c, source, "formatting image for Gemini")
+	if err != nil {
+		return dto.GeminiPart{}, fmt.Errorf("get image base64 failed: %w", err)
+	}
+	return dto.GeminiPart{
+		InlineData: &dto.GeminiInlineData{
+			MimeType: mimeType,
+			Data:     base64Data,
+		},
+	}, nil
+}
+
+// GeminiNativeImageHandler 将 generateContent 的图片输出转换为 OpenAI Images 响应，图片输出 token 按图片补全倍率单独计费
+func GeminiNativeImageHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Response) (*dto.Usage, *types.NewAPIError) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+	service.CloseResponseBodyGracefully(resp)
+
+	var geminiResponse dto.GeminiChatResponse
+	if err := common.Unmarshal(responseBody, &geminiResponse); err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+
+	responseFormat := "b64_json"
+	if request, ok := info.Request.(*dto.ImageRequest); ok && request.ResponseFormat == "url" {
+		responseFormat = "url"
+	}
+
+	openAIResponse := dto.ImageResponse{
+		Created: common.GetTimestamp(),
+	}
+	var revisedPrompt strings.Builder
+	for _, candidate := range geminiResponse.Candidates {
+		for _, part := range candidate.Content.Parts {
+			if part.Thought {
+				continue
+			}
+			if part.Text != "" {
+				revisedPrompt.WriteString(part.Text)
+				continue
+			}
+			if part.InlineData == nil || !strings.HasPrefix(part.InlineData.MimeType, "image/") {
+				continue
+			}
+			imageData := dto.ImageData{}
+			if responseFormat == "url" {
+				// 先以 data URL 返回，开启内容持久化时在下方转存为签名地址
+				imageData.Url = fmt.Sprintf("data:%s;base64,%s", part.InlineData.MimeType, part.InlineData.Data)
+			} else {
+				imageData.B64Json = part.InlineData.Data
+			}
+			openAIResponse.Data = append(openAIResponse.Data, imageData)
+		}
+	}
+	if len(openAIResponse.Data) == 0 {
+		message := "no images generated"
+		if geminiResponse.PromptFeedback != nil && geminiResponse.PromptFeedback.BlockReason != nil {
+			message = fmt.Sprintf("%s: block reason %s", message, *geminiResponse.PromptFeedback.BlockReason)
+		} else if revisedPrompt.Len() > 0 {
+			message = fmt.Sprintf("%s: %s", message, revisedPrompt.String())
+		}
+		return nil, types.NewOpenAIError(errors.New(message), types.ErrorCodeBadResponseBody, http.StatusBadRequest)
+	}
+	for i := range openAIResponse.Data {
+		openAIResponse.Data[i].RevisedPrompt = revisedPrompt.String()
+	}
+
+	usage := buildUsageFromGeminiMetadata(geminiResponse.UsageMetadata, info.GetEstimatePromptTokens())
+	// 按 token 计费时输出 token 已包含全部图片，不再按 n 倍计费
+	if !info.PriceData.UsePrice {
+		info.PriceData.AddOtherRatio("n", 1)
+	} else {
+		info.PriceData.AddOtherRatio("n", float64(len(openAIResponse.Data)))
+	}
+
+	jsonResponse, err := json.Marshal(openAIResponse)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeBadResponseBody)
+	}
+	if responseFormat == "url" {
+		jsonResponse = service.PersistImageResponse(c.Request.Context(), info, jsonResponse)
+	}
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(http.StatusOK)
+	_, _ = c.Writer.Write(jsonResponse)
+	return &usage, nil
+}
@@ -0,0 +1,476 @@
+package gemini
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/relay/channel"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+
+	"github.com/tidwall/gjson"
+)
+
+// OpenAI Realtime 的 pcm16 为 24kHz 单声道，Gemini Live 输出同样是 24kHz PCM
+const geminiLiveAudioMimeType = "audio/pcm;rate=24000"
+
+// OpenAI 的音色在 Gemini 中不存在，遇到时使用上游默认音色
+var openAIRealtimeVoices = map[string]bool{
+	"alloy": true, "ash": true, "ballad": true, "coral": true, "echo": true, "sage": true,
+	"shimmer": true, "verse": true, "marin": true, "cedar": true, "fable": true, "onyx": true, "nova": true,
+}
+
+// GeminiLiveBridge 将 OpenAI Realtime 事件转换为 Gemini Live（BidiGenerateContent）协议。
+// Gemini Live 的 setup 只能在连接开始时发送一次，因此 setup 延迟到第一个需要上游参与的事件，
+// 之前的 session.update 只在本地合并。
+type GeminiLiveBridge struct {
+	session        dto.RealtimeSession
+	temperature    *float64
+	manualTurns    bool // turn_detection 为 null 时由客户端 commit 决定轮次
+	setupSent      bool
+	setupComplete  bool
+	queued         [][]byte // setupComplete 之前暂存的消息
+	activityOpen   bool
+	pendingTurns   []dto.GeminiChatContent
+	awaitingCommit bool // commit 已触发上游响应，忽略随后的 response.create
+	toolNames      map[string]string
+
+	responseId      string
+	itemId          string
+	inputItemId     string
+	inputTranscript strings.Builder
+	usage           *dto.RealtimeUsage
+}
+
+var _ channel.RealtimeBridge = (*GeminiLiveBridge)(nil)
+
+func NewGeminiLiveBridge() *GeminiLiveBridge {
+	return &GeminiLiveBridge{
+		session: dto.RealtimeSession{
+			Modalities:        []string{"text", "audio"},
+			InputAudioFormat:  "pcm16",
+			OutputAudioFormat: "pcm16",
+			TurnDetection:     map[string]any{"type": "server_vad"},
+		},
+		toolNames: make(map[string]string),
+	}
+}
+
+func newRealtimeId(prefix string) string {
+	return prefix + "_" + common.GetUUID()
+}
+
+func (b *GeminiLiveBridge) Open(info *relaycommon.RelayInfo) (*channel.RealtimeBridgeResult, error) {
+	session := b.session
+	return &channel.RealtimeBridgeResult{
+		Client: []*dto.RealtimeEvent{{
+			EventId: newRealtimeId("event"),
+			Type:    dto.RealtimeEventTypeSessionCreated,
+			Session: &session,
+		}},
+	}, nil
+}
+
+func (b *GeminiLiveBridge) FromClient(info *relaycommon.RelayInfo, event *dto.RealtimeEvent, message []byte) (*channel.RealtimeBridgeResult, error) {
+	result := &channel.RealtimeBridgeResult{}
+	switch event.Type {
+	case dto.RealtimeEventTypeSessionUpdate:
+		if event.Session == nil {
+			return nil, nil
+		}
+		if b.setupSent {
+			return nil, errors.New("session.update is not supported after the conversation has started on this channel")
+		}
+		if err := b.mergeSession(info, event.Session, message); err != nil {
+			return nil, err
+		}
+		session := b.session
+		b.emit(result, &dto.RealtimeEvent{Type: dto.RealtimeEventTypeSessionUpdated, Session: &session})
+	case dto.RealtimeEventInputAudioBufferAppend:
+		if err := b.ensureSetup(info, result); err != nil {
+			return nil, err
+		}
+		if b.manualTurns && !b.activityOpen {
+			b.activityOpen = true
+			if err := b.send(result, dto.GeminiLiveClientMessage{RealtimeInput: &dto.GeminiLiveRealtimeInput{ActivityStart: &struct{}{}}}); err != nil {
+				return nil, err
+			}
+		}
+		if err := b.send(result, dto.GeminiLiveClientMessage{RealtimeInput: &dto.GeminiLiveRealtimeInput{
+			Audio: &dto.GeminiInlineData{MimeType: geminiLiveAudioMimeType, Data: event.Audio},
+		}}); err != nil {
+			return nil, err
+		}
+	case dto.RealtimeEventInputAudioBufferCommit:
+		b.inputItemId = newRealtimeId("item")
+		b.emit(result, &dto.RealtimeEvent{Type: dto.RealtimeEventInputAudioBufferCommitted, ItemId: b.inputItemId})
+		if b.manualTurns && b.activityOpen {
+			b.activityOpen = false
+			b.awaitingCommit = true
+			if err := b.send(result, dto.GeminiLiveClientMessage{RealtimeInput: &dto.GeminiLiveRealtimeInput{ActivityEnd: &struct{}{}}}); err != nil {
+				return nil, err
+			}
+		}
+	case dto.RealtimeEventInputAudioBufferClear:
+		b.emit(result, &dto.RealtimeEvent{Type: dto.RealtimeEventInputAudioBufferCleared})
+	case dto.RealtimeEventTypeConversationCreate:
+		if event.Item == nil {
+			return nil, errors.New("item is required")
+		}
+		item := *event.Item
+		if item.Id == "" {
+			item.Id = newRealtimeId("item")
+		}
+		switch item.Type {
+		case "message":
+			b.pendingTurns = append(b.pendingTurns, convertRealtimeItemToGeminiContent(item))
+		case "function_call_output":
+			if err := b.ensureSetup(info, result); err != nil {
+				return nil, err
+			}
+			if err := b.send(result, dto.GeminiLiveClientMessage{ToolResponse: &dto.GeminiLiveToolResponse{
+				FunctionResponses: []dto.GeminiLiveFunctionResponse{{
+					Id:       item.CallId,
+					Name:     b.toolNames[item.CallId],
+					Response: parseRealtimeFunctionOutput(item.Output),
+				}},
+			}}); err != nil {
+				return nil, err
+			}
+		}
+		b.emit(result, &dto.RealtimeEvent{Type: dto.RealtimeEventConversationItemCreated, Item: &item})
+	case dto.RealtimeEventTypeResponseCreate:
+		if err := b.ensureSetup(info, result); err != nil {
+			return nil, err
+		}
+		var err error
+		switch {
+		case len(b.pendingTurns) > 0:
+			err = b.send(result, dto.GeminiLiveClientMessage{ClientContent: &dto.GeminiLiveClientContent{Turns: b.pendingTurns, TurnComplete: true}})
+			b.pendingTurns = nil
+		case b.awaitingCommit:
+			// activityEnd 已经触发了上游响应
+		case b.manualTurns && b.activityOpen:
+			b.activityOpen = false
+			err = b.send(result, dto.GeminiLiveClientMessage{RealtimeInput: &dto.GeminiLiveRealtimeInput{ActivityEnd: &struct{}{}}})
+		default:
+			err = b.send(result, dto.GeminiLiveClientMessage{ClientContent: &dto.GeminiLiveClientContent{TurnComplete: true}})
+		}
+		b.awaitingCommit = false
+		if err != nil {
+			return nil, err
+		}
+	case dto.RealtimeEventTypeResponseCancel:
+		// Gemini Live 没有取消响应的消息，客户端开口说话时上游会自动打断
+	default:
+		return nil, fmt.Errorf("event %s is not supported by gemini live", event.Type)
+	}
+	return result, nil
+}
+
+func (b *GeminiLiveBridge) FromUpstream(info *relaycommon.RelayInfo, message []byte) (*channel.RealtimeBridgeResult, error) {
+	var serverMessage dto.GeminiLiveServerMessage
+	if err := common.Unmarshal(message, &serverMessage); err != nil {
+		return nil, err
+	}
+	result := &channel.RealtimeBridgeResult{}
+
+	if serverMessage.SetupComplete != nil {
+		b.setupComplete = true
+		result.Upstream = b.queued
+		b.queued = nil
+	}
+	if serverMessage.UsageMetadata != nil {
+		b.usage = convertGeminiLiveUsage(serverMessage.UsageMetadata)
+	}
+
+	if content := serverMessage.ServerContent; content != nil {
+		if content.InputTranscription != nil && content.InputTranscription.Text != "" {
+			if b.inputItemId == "" {
+				b.inputItemId = newRealtimeId("item")
+			}
+			b.inputTranscript.WriteString(content.InputTranscription.Text)
+			b.emit(result, &dto.RealtimeEvent{Type: dto.RealtimeEventInputAudioTranscriptionDelta, ItemId: b.inputItemId, Delta: content.InputTranscription.Text})
+		}
+		if content.ModelTurn != nil {
+			for _, part := range content.ModelTurn.Parts {
+				if part.Thought {
+					continue
+				}
+				if part.Text != "" {
+					b.startResponse(result)
+					b.emit(result, &dto.RealtimeEvent{Type: dto.RealtimeEventResponseTextDelta, ResponseId: b.responseId, ItemId: b.itemId, Delta: part.Text})
+				} else if part.InlineData != nil && strings.HasPrefix(part.InlineData.MimeType, "audio/") {
+					b.startResponse(result)
+					b.emit(result, &dto.RealtimeEvent{Type: dto.RealtimeEventResponseAudioDelta, ResponseId: b.responseId, ItemId: b.itemId, Delta: part.InlineData.Data})
+				}
+			}
+		}
+		if content.OutputTranscription != nil && content.OutputTranscription.Text != "" {
+			b.startResponse(result)
+			b.emit(result, &dto.RealtimeEvent{Type: dto.RealtimeEventResponseAudioTranscriptionDelta, ResponseId: b.responseId, ItemId: b.itemId, Delta: content.OutputTranscription.Text})
+		}
+		if content.Interrupted {
+			// 客户端据此停止播放
+			b.emit(result, &dto.RealtimeEvent{Type: dto.RealtimeEventInputAudioBufferSpeechStarted, ItemId: newRealtimeId("item")})
+			b.finishResponse(result, "cancelled", nil)
+		}
+		if content.TurnComplete {
+			if b.inputTranscript.Len() > 0 {
+				b.emit(result, &dto.RealtimeEvent{Type: dto.RealtimeEventInputAudioTranscriptionCompleted, ItemId: b.inputItemId, Transcript: b.inputTranscript.String()})
+				b.inputTranscript.Reset()
+			}
+			b.inputItemId = ""
+			b.finishResponse(result, "completed", nil)
+		}
+	}
+
+	if serverMessage.ToolCall != nil && len(serverMessage.ToolCall.FunctionCalls) > 0 {
+		b.startResponse(result)
+		output := make([]dto.RealtimeItem, 0, len(serverMessage.ToolCall.FunctionCalls))
+		for _, call := range serverMessage.ToolCall.FunctionCalls {
+			b.toolNames[call.Id] = call.Name
+			arguments := "{}"
+			if len(call.Args) > 0 {
+				arguments = string(call.Args)
+			}
+			b.emit(result, &dto.RealtimeEvent{
+				Type:       dto.RealtimeEventResponseFunctionCallArgumentsDone,
+				ResponseId: b.responseId,
+				ItemId:     call.Id,
+				CallId:     call.Id,
+				Name:       call.Name,
+				Arguments:  arguments,
+			})
+			name := call.Name
+			output = append(output, dto.RealtimeItem{
+				Id:        call.Id,
+				Type:      "function_call",
+				Status:    "completed",
+				Name:      &name,
+				CallId:    call.Id,
+				Arguments: arguments,
+			})
+		}
+		// 上游在收到 toolResponse 之前不会继续，按 OpenAI 的习惯以 response.done 结束本轮
+		b.finishResponse(result, "completed", output)
+	}
+	return result, nil
+}
+
+func (b *GeminiLiveBridge) Close(info *relaycommon.RelayInfo) *dto.RealtimeUsage {
+	usage := b.usage
+	b.usage = nil
+	return usage
+}
+
+func (b *GeminiLiveBridge) emit(result *channel.RealtimeBridgeResult, event *dto.RealtimeEvent) {
+	event.EventId = newRealtimeId("event")
+	result.Client = append(result.Client, event)
+}
+
+// send 在上游 setupComplete 之前暂存消息
+func (b *GeminiLiveBridge) send(result *channel.RealtimeBridgeResult, message dto.GeminiLiveClientMessage) error {
+	data, err := common.Marshal(message)
+	if err != nil {
+		return err
+	}
+	if b.setupComplete {
+		result.Upstream = append(result.Upstream, data)
+	} else {
+		b.queued = append(b.queued, data)
+	}
+	return nil
+}
+
+func (b *GeminiLiveBridge) startResponse(result *channel.RealtimeBridgeResult) {
+	if b.responseId != "" {
+		return
+	}
+	b.responseId = newRealtimeId("resp")
+	b.itemId = newRealtimeId("item")
+	b.emit(result, &dto.RealtimeEvent{
+		Type:     dto.RealtimeEventResponseCreated,
+		Response: &dto.RealtimeResponse{Id: b.responseId, Object: "realtime.response", Status: "in_progress"},
+	})
+}
+
+// finishResponse 结束当前响应并带上上游报告的用量；没有进行中的响应时直接结算用量
+func (b *GeminiLiveBridge) finishResponse(result *channel.RealtimeBridgeResult, status string, output []dto.RealtimeItem) {
+	result.Usage = b.usage
+	b.usage = nil
+	if b.responseId == "" {
+		return
+	}
+	b.emit(result, &dto.RealtimeEvent{
+		Type: dto.RealtimeEventTypeResponseDone,
+		Response: &dto.RealtimeResponse{
+			Id:     b.responseId,
+			Object: "realtime.response",
+			Status: status,
+			Output: output,
+			Usage:  result.Usage,
+		},
+	})
+	b.responseId = ""
+	b.itemId = ""
+}
+
+func (b *GeminiLiveBridge) mergeSession(info *relaycommon.RelayInfo, session *dto.RealtimeSession, message []byte) error {
+	if session.InputAudioFormat != "" && session.InputAudioFormat != "pcm16" {
+		return fmt.Errorf("input_audio_format %s is not supported by gemini live, use pcm16", session.InputAudioFormat)
+	}
+	if session.OutputAudioFormat != "" && session.OutputAudioFormat != "pcm16" {
+		return fmt.Errorf("output_audio_format %s is not supported by gemini live, use pcm16", session.OutputAudioFormat)
+	}
+	if len(session.Modalities) > 0 {
+		b.session.Modalities = session.Modalities
+	}
+	if session.Instructions != "" {
+		b.session.Instructions = session.Instructions
+	}
+	if session.Voice != "" {
+		b.session.Voice = session.Voice
+	}
+	if gjson.GetBytes(message, "session.input_audio_transcription").Exists() {
+		b.session.InputAudioTranscription = session.InputAudioTranscription
+	}
+	if turnDetection := gjson.GetBytes(message, "session.turn_detection"); turnDetection.Exists() {
+		b.session.TurnDetection = session.TurnDetection
+		b.manualTurns = turnDetection.Type == gjson.Null
+	}
+	if gjson.GetBytes(message, "session.tools").Exists() {
+		b.session.Tools = session.Tools
+		info.RealtimeTools = session.Tools
+	}
+	if session.ToolChoice != "" {
+		b.session.ToolChoice = session.ToolChoice
+	}
+	if gjson.GetBytes(message, "session.temperature").Exists() {
+		temperature := session.Temperature
+		b.session.Temperature = temperature
+		b.temperature = &temperature
+	}
+	return nil
+}
+
+func (b *GeminiLiveBridge) hasAudioOutput() bool {
+	for _, modality := range b.session.Modalities {
+		if modality == "audio" {
+			return true
+		}
+	}
+	return false
+}
+
+// ensureSetup 第一次需要上游参与时发送 setup，Gemini Live 不允许中途修改
+func (b *GeminiLiveBridge) ensureSetup(info *relaycommon.RelayInfo, result *channel.RealtimeBridgeResult) error {
+	if b.setupSent {
+		return nil
+	}
+	setup := &dto.GeminiLiveSetup{
+		Model:            "models/" + info.UpstreamModelName,
+		GenerationConfig: &dto.GeminiChatGenerationConfig{Temperature: b.temperature},
+	}
+	if b.hasAudioOutput() {
+		setup.GenerationConfig.ResponseModalities = []string{"AUDIO"}
+		setup.OutputAudioTranscription = &struct{}{}
+		if voice := b.session.Voice; voice != "" && !openAIRealtimeVoices[strings.ToLower(voice)] {
+			speechConfig, err := common.Marshal(map[string]any{
+				"voiceConfig": map[string]any{"prebuiltVoiceConfig": map[string]string{"voiceName": voice}},
+			})
+			if err != nil {
+				return err
+			}
+			setup.GenerationConfig.SpeechConfig = speechConfig
+		}
+	} else {
+		setup.GenerationConfig.ResponseModalities = []string{"TEXT"}
+	}
+	if b.session.Instructions != "" {
+		setup.SystemInstruction = &dto.GeminiChatContent{Parts: []dto.GeminiPart{{Text: b.session.Instructions}}}
+	}
+	if len(b.session.Tools) > 0 {
+		declarations := make([]map[string]any, 0, len(b.session.Tools))
+		for _, tool := range b.session.Tools {
+			declaration := map[string]any{"name": tool.Name, "description": tool.Description}
+			if tool.Parameters != nil {
+				declaration["parameters"] = tool.Parameters
+			}
+			declarations = append(declarations, declaration)
+		}
+		setup.Tools = []dto.GeminiChatTool{{FunctionDeclarations: declarations}}
+	}
+	if b.session.InputAudioTranscription.Model != "" {
+		setup.InputAudioTranscription = &struct{}{}
+	}
+	if b.manualTurns {
+		setup.RealtimeInputConfig = json.RawMessage(`{"automaticActivityDetection":{"disabled":true}}`)
+	}
+
+	data, err := common.Marshal(dto.GeminiLiveClientMessage{Setup: setup})
+	if err != nil {
+		return err
+	}
+	b.setupSent = true
+	result.Upstream = append(result.Upstream, data)
+	return nil
+}
+
+func convertRealtimeItemToGeminiContent(item dto.RealtimeItem) dto.GeminiChatContent {
+	content := dto.GeminiChatContent{Role: "user"}
+	if item.Role == "assistant" {
+		content.Role = "model"
+	}
+	for _, part := range item.Content {
+		switch part.Type {
+		case "input_text", "text":
+			content.Parts = append(content.Parts, dto.GeminiPart{Text: part.Text})
+		case "input_audio", "audio":
+			if part.Audio != "" {
+				content.Parts = append(content.Parts, dto.GeminiPart{InlineData: &dto.GeminiInlineData{MimeType: geminiLiveAudioMimeType, Data: part.Audio}})
+			} else if part.Transcript != "" {
+				content.Parts = append(content.Parts, dto.GeminiPart{Text: part.Transcript})
+			}
+		}
+	}
+	return content
+}
+
+// parseRealtimeFunctionOutput Gemini 要求 response 为对象，非 JSON 对象的输出包装为 {"output": ...}
+func parseRealtimeFunctionOutput(output string) any {
+	var object map[string]any
+	if err := common.UnmarshalJsonStr(output, &object); err == nil && object != nil {
+		return object
+	}
+	return map[string]any{"output": output}
+}
+
+func convertGeminiLiveUsage(metadata *dto.GeminiLiveUsageMetadata) *dto.RealtimeUsage {
+	usage := &dto.RealtimeUsage{
+		InputTokens:  metadata.PromptTokenCount + metadata.ToolUsePromptTokenCount,
+		OutputTokens: metadata.ResponseTokenCount + metadata.ThoughtsTokenCount,
+	}
+	usage.TotalTokens = metadata.TotalTokenCount
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.InputTokens + usage.OutputTokens
+	}
+	usage.InputTokenDetails.CachedTokens = metadata.CachedContentTokenCount
+	for _, detail := range metadata.PromptTokensDetails {
+		if detail.Modality == "AUDIO" {
+			usage.InputTokenDetails.AudioTokens += detail.TokenCount
+		}
+	}
+	for _, detail := range metadata.ResponseTokensDetails {
+		if detail.Modality == "AUDIO" {
+			usage.OutputTokenDetails.AudioTokens += detail.TokenCount
+		}
+	}
+	// 计费按文本/音频明细计算，其余 token 都计入文本
+	usage.InputTokenDetails.TextTokens = usage.InputTokens - usage.InputTokenDetails.AudioTokens
+	usage.OutputTokenDetails.TextTokens = usage.OutputTokens - usage.OutputTokenDetails.AudioTokens
+	return usage
+}
@@ -0,0 +1,133 @@
+package gemini
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/constant"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeminiImageAspectRatio(t *testing.T) {
+	cases := map[string]string{
+		"":          "1:1",
+		"1024x1024": "1:1",
+		"1536x1024": "3:2",
+		"1024x1536": "2:3",
+		"1792x1024": "16:9",
+		"1024x1792": "9:16",
+		"1280x1024": "5:4",
+		"2560x1080": "21:9",
+		"4:3":       "4:3",
+		"bogus":     "1:1",
+	}
+	for size, expected := range cases {
+		assert.Equal(t, expected, GeminiImageAspectRatio(size), size)
+	}
+}
+
+func TestImagenAspectRatio(t *testing.T) {
+	cases := map[string]string{
+		"":          "1:1",
+		"1536x1024": "4:3",
+		"1792x1024": "16:9",
+		"1024x1792": "9:16",
+		"3:4":       "3:4",
+	}
+	for size, expected := range cases {
+		ratio, err := ImagenAspectRatio(size)
+		require.NoError(t, err, size)
+		assert.Equal(t, expected, ratio, size)
+	}
+	for _, size := range []string{"21:9", "2:3", "4:5"} {
+		_, err := ImagenAspectRatio(size)
+		assert.Error(t, err, size)
+	}
+}
+
+func TestConvertImageRequest2GeminiNative(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/images/generations", nil)
+	info := &relaycommon.RelayInfo{RelayMode: constant.RelayModeImagesGenerations}
+
+	geminiRequest, err := ConvertImageRequest2GeminiNative(c, info, dto.ImageRequest{
+		Prompt:  "a cat",
+		Size:    "1792x1024",
+		Quality: "hd",
+		N:       common.GetPointer(uint(2)),
+	})
+	require.NoError(t, err)
+	require.Len(t, geminiRequest.Contents, 1)
+	assert.Equal(t, "a cat", geminiRequest.Contents[0].Parts[0].Text)
+	assert.Equal(t, []string{"TEXT", "IMAGE"}, geminiRequest.GenerationConfig.ResponseModalities)
+	assert.JSONEq(t, `{"aspectRatio":"16:9","imageSize":"2K"}`, string(geminiRequest.GenerationConfig.ImageConfig))
+	require.NotNil(t, geminiRequest.GenerationConfig.CandidateCount)
+	assert.Equal(t, 2, *geminiRequest.GenerationConfig.CandidateCount)
+
+	info.RelayMode = constant.RelayModeImagesEdits
+	_, err = ConvertImageRequest2GeminiNative(c, info, dto.ImageRequest{Prompt: "edit"})
+	assert.Error(t, err)
+}
+
+func TestGeminiNativeImageHandler(t *testing.T) {
+	payload := dto.GeminiChatResponse{
+		Candidates: []dto.GeminiChatCandidate{{
+			Content: dto.GeminiChatContent{
+				Role: "model",
+				Parts: []dto.GeminiPart{
+					{Text: "a fluffy cat"},
+					{InlineData: &dto.GeminiInlineData{MimeType: "image/png", Data: "aW1n"}},
+				},
+			},
+		}},
+		UsageMetadata: dto.GeminiUsageMetadata{
+			PromptTokenCount:     10,
+			CandidatesTokenCount: 1300,
+			TotalTokenCount:      1310,
+			CandidatesTokensDetails: []dto.GeminiPromptTokensDetails{
+				{Modality: "TEXT", TokenCount: 10},
+				{Modality: "IMAGE", TokenCount: 1290},
+			},
+		},
+	}
+	body, err := common.Marshal(payload)
+	require.NoError(t, err)
+
+	for _, format := range []string{"b64_json", "url"} {
+		gin.SetMode(gin.TestMode)
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/images/generations", nil)
+		info := &relaycommon.RelayInfo{
+			RelayMode:   constant.RelayModeImagesGenerations,
+			Request:     &dto.ImageRequest{Prompt: "a cat", ResponseFormat: format},
+			ChannelMeta: &relaycommon.ChannelMeta{UpstreamModelName: "gemini-2.5-flash-image"},
+		}
+
+		usage, apiErr := GeminiNativeImageHandler(c, info, &http.Response{Body: io.NopCloser(bytes.NewReader(body))})
+		require.Nil(t, apiErr)
+		assert.Equal(t, 10, usage.PromptTokens)
+		assert.Equal(t, 1300, usage.CompletionTokens)
+		assert.Equal(t, 1290, usage.CompletionTokenDetails.ImageTokens)
+		assert.Equal(t, float64(1), info.PriceData.OtherRatios["n"])
+
+		var resp dto.ImageResponse
+		require.NoError(t, common.Unmarshal(recorder.Body.Bytes(), &resp))
+		require.Len(t, resp.Data, 1)
+		assert.Equal(t, "a fluffy cat", resp.Data[0].RevisedPrompt)
+		if format == "url" {
+			assert.Equal(t, "data:image/png;base64,aW1n", resp.Data[0].Url)
+		} else {
+			assert.Equal(t, "aW1n", resp.Data[0].B64Json)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package gemini
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/relay/channel"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testUpgrader = websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+
+func readRealtimeEvent(t *testing.T, conn *websocket.Conn) dto.RealtimeEvent {
+	t.Helper()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, message, err := conn.ReadMessage()
+	require.NoError(t, err)
+	var event dto.RealtimeEvent
+	require.NoError(t, common.Unmarshal(message, &event))
+	return event
+}
+
+func TestGeminiLiveBridgeWithFakeUpstream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	upstreamMessages := make(chan dto.GeminiLiveClientMessage, 10)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := testUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var clientMessage dto.GeminiLiveClientMessage
+			_ = common.Unmarshal(message, &clientMessage)
+			upstreamMessages <- clientMessage
+			switch {
+			case clientMessage.Setup != nil:
+				_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"setupComplete":{}}`))
+			case clientMessage.RealtimeInput != nil && clientMessage.RealtimeInput.Audio != nil:
+				_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"serverContent":{"modelTurn":{"parts":[{"inlineData":{"mimeType":"audio/pcm;rate=24000","data":"AAAA"}}]},"outputTranscription":{"text":"hello"}}}`))
+				_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"serverContent":{"turnComplete":true},"usageMetadata":{"promptTokenCount":120,"responseTokenCount":80,"totalTokenCount":200,"promptTokensDetails":[{"modality":"TEXT","tokenCount":20},{"modality":"AUDIO","tokenCount":100}],"responseTokensDetails":[{"modality":"AUDIO","tokenCount":80}]}}`))
+			}
+		}
+	}))
+	defer upstream.Close()
+
+	usageChan := make(chan *dto.RealtimeUsage, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientConn, err := testUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer clientConn.Close()
+		targetConn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(upstream.URL, "http"), nil)
+		if err != nil {
+			return
+		}
+		defer targetConn.Close()
+
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = r
+		info := &relaycommon.RelayInfo{
+			ClientWs:          clientConn,
+			TargetWs:          targetConn,
+			UsePrice:          true,
+			InputAudioFormat:  "pcm16",
+			OutputAudioFormat: "pcm16",
+			IsFirstRequest:    true,
+			StartTime:         time.Now(),
+			ChannelMeta:       &relaycommon.ChannelMeta{UpstreamModelName: "gemini-live-2.5-flash-preview"},
+		}
+		_, usage := channel.RealtimeBridgeHandler(c, info, NewGeminiLiveBridge())
+		usageChan <- usage
+	}))
+	defer proxy.Close()
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(proxy.URL, "http"), nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, dto.RealtimeEventTypeSessionCreated, readRealtimeEvent(t, client).Type)
+
+	require.NoError(t, client.WriteMessage(websocket.TextMessage, []byte(`{"type":"session.update","session":{"instructions":"be brief","voice":"Kore","tools":[{"type":"function","name":"get_weather","description":"weather","parameters":{"type":"object"}}]}}`)))
+	assert.Equal(t, dto.RealtimeEventTypeSessionUpdated, readRealtimeEvent(t, client).Type)
+
+	audio := base64.StdEncoding.EncodeToString(make([]byte, 4800))
+	require.NoError(t, client.WriteMessage(websocket.TextMessage, []byte(`{"type":"input_audio_buffer.append","audio":"`+audio+`"}`)))
+
+	setup := <-upstreamMessages
+	require.NotNil(t, setup.Setup)
+	assert.Equal(t, "models/gemini-live-2.5-flash-preview", setup.Setup.Model)
+	assert.Equal(t, []string{"AUDIO"}, setup.Setup.GenerationConfig.ResponseModalities)
+	assert.JSONEq(t, `{"voiceConfig":{"prebuiltVoiceConfig":{"voiceName":"Kore"}}}`, string(setup.Setup.GenerationConfig.SpeechConfig))
+	assert.Equal(t, "be brief", setup.Setup.SystemInstruction.Parts[0].Text)
+	require.Len(t, setup.Setup.Tools, 1)
+	audioMessage := <-upstreamMessages
+	require.NotNil(t, audioMessage.RealtimeInput)
+	assert.Equal(t, audio, audioMessage.RealtimeInput.Audio.Data)
+	assert.Equal(t, "audio/pcm;rate=24000", audioMessage.RealtimeInput.Audio.MimeType)
+
+	assert.Equal(t, dto.RealtimeEventResponseCreated, readRealtimeEvent(t, client).Type)
+	audioDelta := readRealtimeEvent(t, client)
+	assert.Equal(t, dto.RealtimeEventResponseAudioDelta, audioDelta.Type)
+	assert.Equal(t, "AAAA", audioDelta.Delta)
+	transcript := readRealtimeEvent(t, client)
+	assert.Equal(t, dto.RealtimeEventResponseAudioTranscriptionDelta, transcript.Type)
+	assert.Equal(t, "hello", transcript.Delta)
+	done := readRealtimeEvent(t, client)
+	require.Equal(t, dto.RealtimeEventTypeResponseDone, done.Type)
+	require.NotNil(t, done.Response.Usage)
+	assert.Equal(t, 200, done.Response.Usage.TotalTokens)
+
+	require.NoError(t, client.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")))
+	_ = client.Close()
+
+	select {
+	case usage := <-usageChan:
+		require.NotNil(t, usage)
+		assert.Equal(t, 200, usage.TotalTokens)
+		assert.Equal(t, 20, usage.InputTokenDetails.TextTokens)
+		assert.Equal(t, 100, usage.InputTokenDetails.AudioTokens)
+		assert.Equal(t, 80, usage.OutputTokenDetails.AudioTokens)
+	case <-time.After(5 * time.Second):
+		t.Fatal("bridge did not finish")
+	}
+}
+
+func TestGeminiLiveBridgeToolCall(t *testing.T) {
+	info := &relaycommon.RelayInfo{ChannelMeta: &relaycommon.ChannelMeta{UpstreamModelName: "gemini-live-2.5-flash-preview"}}
+	bridge := NewGeminiLiveBridge()
+
+	result, err := bridge.FromClient(info, &dto.RealtimeEvent{Type: dto.RealtimeEventTypeSessionUpdate, Session: &dto.RealtimeSession{Modalities: []string{"text"}}},
+		[]byte(`{"type":"session.update","session":{"modalities":["text"],"turn_detection":null}}`))
+	require.NoError(t, err)
+	require.Len(t, result.Client, 1)
+
+	result, err = bridge.FromClient(info, &dto.RealtimeEvent{Type: dto.RealtimeEventTypeConversationCreate, Item: &dto.RealtimeItem{
+		Type: "message", Role: "user", Content: []dto.RealtimeContent{{Type: "input_text", Text: "weather?"}},
+	}}, nil)
+	require.NoError(t, err)
+	assert.Empty(t, result.Upstream)
+
+	result, err = bridge.FromClient(info, &dto.RealtimeEvent{Type: dto.RealtimeEventTypeResponseCreate}, nil)
+	require.NoError(t, err)
+	require.Len(t, result.Upstream, 1)
+	assert.Contains(t, string(result.Upstream[0]), `"responseModalities":["TEXT"]`)
+	assert.Contains(t, string(result.Upstream[0]), `"automaticActivityDetection":{"disabled":true}`)
+
+	// setupComplete 之后补发暂存的 clientContent
+	result, err = bridge.FromUpstream(info, []byte(`{"setupComplete":{}}`))
+	require.NoError(t, err)
+	require.Len(t, result.Upstream, 1)
+	assert.Contains(t, string(result.Upstream[0]), `"turns":[{"role":"user","parts":[{"text":"weather?"}]}],"turnComplete":true`)
+
+	result, err = bridge.FromUpstream(info, []byte(`{"toolCall":{"functionCalls":[{"id":"call_1","name":"get_weather","args":{"city":"Paris"}}]}}`))
+	require.NoError(t, err)
+	require.Len(t, result.Client, 3)
+	assert.Equal(t, dto.RealtimeEventResponseCreated, result.Client[0].Type)
+	assert.Equal(t, dto.RealtimeEventResponseFunctionCallArgumentsDone, result.Client[1].Type)
+	assert.Equal(t, "call_1", result.Client[1].CallId)
+	assert.JSONEq(t, `{"city":"Paris"}`, result.Client[1].Arguments)
+	assert.Equal(t, dto.RealtimeEventTypeResponseDone, result.Client[2].Type)
+
+	result, err = bridge.FromClient(info, &dto.RealtimeEvent{Type: dto.RealtimeEventTypeConversationCreate, Item: &dto.RealtimeItem{
+		Type: "function_call_output", CallId: "call_1", Output: "sunny",
+	}}, nil)
+	require.NoError(t, err)
+	require.Len(t, result.Upstream, 1)
+	assert.JSONEq(t, `{"toolResponse":{"functionResponses":[{"id":"call_1","name":"get_weather","response":{"output":"sunny"}}]}}`, string(result.Upstream[0]))
+
+	_, err = bridge.FromClient(info, &dto.RealtimeEvent{Type: dto.RealtimeEventTypeSessionUpdate, Session: &dto.RealtimeSession{}}, []byte(`{}`))
+	assert.Error(t, err)
+}
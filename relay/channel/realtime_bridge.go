@@ -0,0 +1,281 @@
+package channel
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	common2 "github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// RealtimeBridgeResult 一次事件转换的结果
+type RealtimeBridgeResult struct {
+	Upstream [][]byte             // 发往上游的消息
+	Client   []*dto.RealtimeEvent // 发往客户端的 OpenAI Realtime 事件
+	Usage    *dto.RealtimeUsage   // 上游报告的本轮用量，非空时代替本地估算计费
+}
+
+// RealtimeBridge 在 OpenAI Realtime 协议与上游双向流协议之间转换事件。
+// 由 RealtimeBridgeHandler 串行调用，实现无需自行加锁。
+type RealtimeBridge interface {
+	// Open 连接建立后调用，通常返回 session.created
+	Open(info *common.RelayInfo) (*RealtimeBridgeResult, error)
+	// FromClient 转换客户端发来的事件，返回的错误会以 error 事件告知客户端，不会中断会话
+	FromClient(info *common.RelayInfo, event *dto.RealtimeEvent, message []byte) (*RealtimeBridgeResult, error)
+	// FromUpstream 转换上游发来的消息
+	FromUpstream(info *common.RelayInfo, message []byte) (*RealtimeBridgeResult, error)
+	// Close 会话结束时调用，返回尚未结算的上游用量
+	Close(info *common.RelayInfo) *dto.RealtimeUsage
+}
+
+type realtimeBridgeSession struct {
+	c      *gin.Context
+	info   *common.RelayInfo
+	bridge RealtimeBridge
+
+	bridgeMu sync.Mutex
+	clientMu sync.Mutex
+	targetMu sync.Mutex
+	usageMu  sync.Mutex
+
+	localUsage *dto.RealtimeUsage
+	sumUsage   *dto.RealtimeUsage
+}
+
+// RealtimeBridgeHandler 通过 bridge 将 OpenAI Realtime 客户端接到非 OpenAI 协议的上游，
+// 计费方式与 OpenAI Realtime 一致：每轮响应结束时 PreWssConsumeQuota，结束后由 WssHelper 统一 PostWssConsumeQuota
+func RealtimeBridgeHandler(c *gin.Context, info *common.RelayInfo, bridge RealtimeBridge) (*types.NewAPIError, *dto.RealtimeUsage) {
+	if info == nil || info.ClientWs == nil || info.TargetWs == nil {
+		return types.NewError(fmt.Errorf("invalid websocket connection"), types.ErrorCodeBadResponse), nil
+	}
+	info.IsStream = true
+
+	s := &realtimeBridgeSession{
+		c:          c,
+		info:       info,
+		bridge:     bridge,
+		localUsage: &dto.RealtimeUsage{},
+		sumUsage:   &dto.RealtimeUsage{},
+	}
+
+	s.bridgeMu.Lock()
+	result, err := bridge.Open(info)
+	s.bridgeMu.Unlock()
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeBadResponse), nil
+	}
+	if err := s.dispatch(result, false); err != nil {
+		return types.NewError(err, types.ErrorCodeBadResponse), nil
+	}
+
+	clientClosed := make(chan struct{})
+	targetClosed := make(chan struct{})
+	errChan := make(chan error, 2)
+
+	gopool.Go(func() {
+		defer func() {
+			if r := recover(); r != nil {
+				errChan <- fmt.Errorf("panic in client reader: %v", r)
+			}
+		}()
+		for {
+			_, message, err := info.ClientWs.ReadMessage()
+			if err != nil {
+				if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					errChan <- fmt.Errorf("error reading from client: %v", err)
+				}
+				close(clientClosed)
+				return
+			}
+			event := &dto.RealtimeEvent{}
+			if err := common2.Unmarshal(message, event); err != nil {
+				s.writeClientError(fmt.Sprintf("invalid event: %v", err), "invalid_request_error")
+				continue
+			}
+			s.countLocal(event, true)
+
+			s.bridgeMu.Lock()
+			result, err := bridge.FromClient(info, event, message)
+			s.bridgeMu.Unlock()
+			if err != nil {
+				s.writeClientError(err.Error(), "invalid_request_error")
+				continue
+			}
+			if err := s.dispatch(result, true); err != nil {
+				errChan <- err
+				return
+			}
+		}
+	})
+
+	gopool.Go(func() {
+		defer func() {
+			if r := recover(); r != nil {
+				errChan <- fmt.Errorf("panic in target reader: %v", r)
+			}
+		}()
+		for {
+			_, message, err := info.TargetWs.ReadMessage()
+			if err != nil {
+				var closeErr *websocket.CloseError
+				if errors.As(err, &closeErr) && closeErr.Code != websocket.CloseNormalClosure {
+					// 上游通过 close frame 返回错误原因
+					s.writeClientError(fmt.Sprintf("upstream closed: %d %s", closeErr.Code, closeErr.Text), "upstream_error")
+				}
+				if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					errChan <- fmt.Errorf("error reading from target: %v", err)
+				}
+				close(targetClosed)
+				return
+			}
+			info.SetFirstResponseTime()
+
+			s.bridgeMu.Lock()
+			result, err := bridge.FromUpstream(info, message)
+			s.bridgeMu.Unlock()
+			if err != nil {
+				logger.LogError(c, fmt.Sprintf("realtime bridge upstream message error: %v", err))
+				continue
+			}
+			if err := s.dispatch(result, false); err != nil {
+				errChan <- err
+				return
+			}
+		}
+	})
+
+	select {
+	case <-clientClosed:
+	case <-targetClosed:
+	case err := <-errChan:
+		logger.LogError(c, "realtime bridge error: "+err.Error())
+	case <-c.Done():
+	}
+
+	s.bridgeMu.Lock()
+	restUsage := bridge.Close(info)
+	s.bridgeMu.Unlock()
+
+	s.usageMu.Lock()
+	defer s.usageMu.Unlock()
+	if restUsage != nil && restUsage.TotalTokens != 0 {
+		_ = s.consume(restUsage)
+		s.localUsage = &dto.RealtimeUsage{}
+	}
+	if s.localUsage.TotalTokens != 0 {
+		_ = s.consume(s.localUsage)
+	}
+	return nil, s.sumUsage
+}
+
+// dispatch 发送转换结果并在每轮响应结束时结算用量
+func (s *realtimeBridgeSession) dispatch(result *RealtimeBridgeResult, fromClient bool) error {
+	if result == nil {
+		return nil
+	}
+	for _, message := range result.Upstream {
+		s.targetMu.Lock()
+		err := helper.WssString(s.c, s.info.TargetWs, string(message))
+		s.targetMu.Unlock()
+		if err != nil {
+			return fmt.Errorf("error writing to target: %v", err)
+		}
+	}
+
+	responseDone := false
+	for _, event := range result.Client {
+		if event.Type == dto.RealtimeEventTypeResponseDone {
+			responseDone = true
+		} else {
+			// 由客户端事件产生的回执（如 conversation.item.created）计入输入，其余计入输出
+			s.countLocal(event, fromClient)
+		}
+		s.clientMu.Lock()
+		err := helper.WssObject(s.c, s.info.ClientWs, event)
+		s.clientMu.Unlock()
+		if err != nil {
+			return fmt.Errorf("error writing to client: %v", err)
+		}
+	}
+
+	if result.Usage == nil && !responseDone {
+		return nil
+	}
+	s.usageMu.Lock()
+	defer s.usageMu.Unlock()
+	if result.Usage != nil {
+		err := s.consume(result.Usage)
+		s.localUsage = &dto.RealtimeUsage{}
+		return err
+	}
+	textToken, _, err := service.CountTokenRealtime(s.info, dto.RealtimeEvent{Type: dto.RealtimeEventTypeResponseDone}, s.info.UpstreamModelName)
+	if err == nil {
+		s.localUsage.TotalTokens += textToken
+		s.localUsage.InputTokens += textToken
+		s.localUsage.InputTokenDetails.TextTokens += textToken
+	}
+	s.info.IsFirstRequest = false
+	err = s.consume(s.localUsage)
+	s.localUsage = &dto.RealtimeUsage{}
+	return err
+}
+
+// countLocal 上游未返回用量时使用的本地估算
+func (s *realtimeBridgeSession) countLocal(event *dto.RealtimeEvent, input bool) {
+	textToken, audioToken, err := service.CountTokenRealtime(s.info, *event, s.info.UpstreamModelName)
+	if err != nil {
+		logger.LogError(s.c, fmt.Sprintf("error counting realtime token: %v", err))
+		return
+	}
+	if textToken == 0 && audioToken == 0 {
+		return
+	}
+	s.usageMu.Lock()
+	defer s.usageMu.Unlock()
+	s.localUsage.TotalTokens += textToken + audioToken
+	if input {
+		s.localUsage.InputTokens += textToken + audioToken
+		s.localUsage.InputTokenDetails.TextTokens += textToken
+		s.localUsage.InputTokenDetails.AudioTokens += audioToken
+	} else {
+		s.localUsage.OutputTokens += textToken + audioToken
+		s.localUsage.OutputTokenDetails.TextTokens += textToken
+		s.localUsage.OutputTokenDetails.AudioTokens += audioToken
+	}
+}
+
+// consume 调用方需持有 usageMu
+func (s *realtimeBridgeSession) consume(usage *dto.RealtimeUsage) error {
+	s.sumUsage.TotalTokens += usage.TotalTokens
+	s.sumUsage.InputTokens += usage.InputTokens
+	s.sumUsage.OutputTokens += usage.OutputTokens
+	s.sumUsage.InputTokenDetails.CachedTokens += usage.InputTokenDetails.CachedTokens
+	s.sumUsage.InputTokenDetails.TextTokens += usage.InputTokenDetails.TextTokens
+	s.sumUsage.InputTokenDetails.AudioTokens += usage.InputTokenDetails.AudioTokens
+	s.sumUsage.OutputTokenDetails.TextTokens += usage.OutputTokenDetails.TextTokens
+	s.sumUsage.OutputTokenDetails.AudioTokens += usage.OutputTokenDetails.AudioTokens
+	if err := service.PreWssConsumeQuota(s.c, s.info, usage); err != nil {
+		logger.LogError(s.c, fmt.Sprintf("realtime bridge consume quota failed: %v", err))
+		return err
+	}
+	return nil
+}
+
+func (s *realtimeBridgeSession) writeClientError(message string, errorType string) {
+	s.clientMu.Lock()
+	defer s.clientMu.Unlock()
+	helper.WssError(s.c, s.info.ClientWs, types.OpenAIError{
+		Message: message,
+		Type:    errorType,
+	})
+}
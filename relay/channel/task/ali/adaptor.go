@@ -441,6 +441,30 @@ func (a *TaskAdaptor) FetchTask(baseUrl, key string, body map[string]any, proxy
 	return client.Do(req)
 }
 
+// CancelTask 取消任务，DashScope 仅允许取消 PENDING 状态的任务
+func (a *TaskAdaptor) CancelTask(baseUrl, key string, taskID string, proxy string) (float64, error) {
+	uri := fmt.Sprintf("%s/api/v1/tasks/%s/cancel", baseUrl, taskID)
+	req, err := http.NewRequest(http.MethodPost, uri, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+key)
+	client, err := service.GetHttpClientWithProxy(proxy)
+	if err != nil {
+		return 0, fmt.Errorf("new proxy http client failed: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return 0, fmt.Errorf("status code %d: %s", resp.StatusCode, string(body))
+	}
+	return 0, nil
+}
+
 func (a *TaskAdaptor) GetModelList() []string {
 	return ModelList
 }
@@ -191,6 +191,9 @@ func (a *TaskAdaptor) BuildRequestBody(c *gin.Context, info *relaycommon.RelayIn
 	} else {
 		info.UpstreamModelName = body.Model
 	}
+	if callbackURL := taskcommon.BuildCallbackURL(info); callbackURL != "" {
+		body.CallbackURL = callbackURL
+	}
 	data, err := common.Marshal(body)
 	if err != nil {
 		return nil, err
@@ -259,6 +262,31 @@ func (a *TaskAdaptor) FetchTask(baseUrl, key string, body map[string]any, proxy
 	return client.Do(req)
 }
 
+// CancelTask 取消排队中的任务，运行中的任务上游会拒绝
+func (a *TaskAdaptor) CancelTask(baseUrl, key string, taskID string, proxy string) (float64, error) {
+	uri := fmt.Sprintf("%s/api/v3/contents/generations/tasks/%s", baseUrl, taskID)
+	req, err := http.NewRequest(http.MethodDelete, uri, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+key)
+	client, err := service.GetHttpClientWithProxy(proxy)
+	if err != nil {
+		return 0, fmt.Errorf("new proxy http client failed: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return 0, fmt.Errorf("status code %d: %s", resp.StatusCode, string(body))
+	}
+	return 0, nil
+}
+
 func (a *TaskAdaptor) GetModelList() []string {
 	return ModelList
 }
@@ -303,6 +331,11 @@ func (a *TaskAdaptor) convertToRequestPayload(req *relaycommon.TaskSubmitReq) (*
 	return &r, nil
 }
 
+// NormalizeTaskCallback 回调推送内容与查询接口返回的任务对象一致
+func (a *TaskAdaptor) NormalizeTaskCallback(body []byte) ([]byte, error) {
+	return body, nil
+}
+
 func (a *TaskAdaptor) ParseTaskResult(respBody []byte) (*relaycommon.TaskInfo, error) {
 	resTask := responseTask{}
 	if err := common.Unmarshal(respBody, &resTask); err != nil {
@@ -286,6 +286,9 @@ func (a *TaskAdaptor) convertToRequestPayload(req *relaycommon.TaskSubmitReq, in
 	if err := taskcommon.UnmarshalMetadata(req.Metadata, &r); err != nil {
 		return nil, errors.Wrap(err, "unmarshal metadata failed")
 	}
+	if callbackURL := taskcommon.BuildCallbackURL(info); callbackURL != "" {
+		r.CallbackUrl = callbackURL
+	}
 	return &r, nil
 }
 
@@ -334,6 +337,19 @@ func (a *TaskAdaptor) createJWTTokenWithKey(apiKey string) (string, error) {
 	return token.SignedString([]byte(secretKey))
 }
 
+// NormalizeTaskCallback 回调推送的是查询接口中的 data 对象，包装为查询响应格式
+func (a *TaskAdaptor) NormalizeTaskCallback(body []byte) ([]byte, error) {
+	var data map[string]any
+	if err := common.Unmarshal(body, &data); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal callback body")
+	}
+	return common.Marshal(map[string]any{
+		"code":    0,
+		"message": "SUCCEED",
+		"data":    data,
+	})
+}
+
 func (a *TaskAdaptor) ParseTaskResult(respBody []byte) (*relaycommon.TaskInfo, error) {
 	taskInfo := &relaycommon.TaskInfo{}
 	resPayload := responsePayload{}
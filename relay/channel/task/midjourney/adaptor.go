@@ -0,0 +1,147 @@
+package midjourney
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/relay/channel"
+	taskcommon "github.com/QuantumNous/new-api/relay/channel/task/taskcommon"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TaskAdaptor 适用于 Midjourney 与 Midjourney-Plus 渠道（midjourney-proxy 协议）。
+// /mj/* 路由（relay.RelayMidjourneySubmit）通过该适配器构建并发送提交请求，自行处理 21/22 等状态码；
+// 任务统一保存在 tasks 表，由通用轮询循环调用 FetchTask 批量更新。
+type TaskAdaptor struct {
+	taskcommon.BaseBilling
+	ChannelType int
+}
+
+// ParseTaskResult 解析单个任务的查询结果（/mj/task/{id}/fetch），批量轮询使用 service.UpdateMidjourneyTasks
+func (a *TaskAdaptor) ParseTaskResult(respBody []byte) (*relaycommon.TaskInfo, error) {
+	var mjTask dto.MidjourneyDto
+	if err := common.Unmarshal(respBody, &mjTask); err != nil {
+		return nil, fmt.Errorf("unmarshal task result failed: %w", err)
+	}
+	taskInfo := &relaycommon.TaskInfo{
+		TaskID:   mjTask.MjId,
+		Status:   mjTask.Status,
+		Progress: mjTask.Progress,
+		Reason:   mjTask.FailReason,
+		Url:      mjTask.ImageUrl,
+	}
+	if mjTask.VideoUrl != "" {
+		taskInfo.Url = mjTask.VideoUrl
+	}
+	switch mjTask.Status {
+	case "", "MODAL":
+		taskInfo.Status = model.TaskStatusSubmitted
+	case model.TaskStatusFailure, model.TaskStatusSuccess:
+		taskInfo.Progress = "100%"
+	}
+	return taskInfo, nil
+}
+
+func (a *TaskAdaptor) Init(info *relaycommon.RelayInfo) {
+	a.ChannelType = info.ChannelType
+}
+
+func (a *TaskAdaptor) ValidateRequestAndSetAction(c *gin.Context, info *relaycommon.RelayInfo) *dto.TaskError {
+	var mjRequest dto.MidjourneyRequest
+	if err := common.UnmarshalBodyReusable(c, &mjRequest); err != nil {
+		return service.TaskErrorWrapperLocal(err, "invalid_request", http.StatusBadRequest)
+	}
+	if mjRequest.Action == "" {
+		return service.TaskErrorWrapperLocal(fmt.Errorf("action_is_required"), "invalid_request", http.StatusBadRequest)
+	}
+	info.Action = mjRequest.Action
+	return nil
+}
+
+func (a *TaskAdaptor) BuildRequestURL(info *relaycommon.RelayInfo) (string, error) {
+	return info.ChannelBaseUrl + RequestPath(info.RequestURLPath), nil
+}
+
+func (a *TaskAdaptor) BuildRequestHeader(c *gin.Context, req *http.Request, info *relaycommon.RelayInfo) error {
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", c.Request.Header.Get("Accept"))
+	req.Header.Set("mj-api-secret", strings.TrimPrefix(info.ApiKey, "Bearer "))
+	return nil
+}
+
+func (a *TaskAdaptor) BuildRequestBody(c *gin.Context, info *relaycommon.RelayInfo) (io.Reader, error) {
+	body, err := service.BuildMidjourneyRequestBody(c)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(body), nil
+}
+
+func (a *TaskAdaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (*http.Response, error) {
+	return channel.DoTaskApiRequest(a, c, info, requestBody)
+}
+
+// DoResponse 1-提交成功、21-任务已存在、22-排队中 均视为提交成功，返回上游任务 ID
+func (a *TaskAdaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (taskID string, taskData []byte, taskErr *dto.TaskError) {
+	mjResp, responseBody, err := service.ParseMidjourneyResponse(resp)
+	if err != nil {
+		taskErr = service.TaskErrorWrapper(err, mjResp.Response.Description, http.StatusInternalServerError)
+		return
+	}
+	mjResponse := mjResp.Response
+	if mjResponse.Code != 1 && mjResponse.Code != 21 && mjResponse.Code != 22 {
+		taskErr = service.TaskErrorWrapper(fmt.Errorf("%s", mjResponse.Description), fmt.Sprintf("%d", mjResponse.Code), http.StatusBadRequest)
+		return
+	}
+	c.Data(resp.StatusCode, "application/json", responseBody)
+	return mjResponse.Result, responseBody, nil
+}
+
+func (a *TaskAdaptor) GetModelList() []string {
+	return ModelList
+}
+
+func (a *TaskAdaptor) GetChannelName() string {
+	return ChannelName
+}
+
+// FetchTask 批量查询任务状态，body 为 {"ids": [...]}
+func (a *TaskAdaptor) FetchTask(baseUrl, key string, body map[string]any, proxy string) (*http.Response, error) {
+	requestUrl := fmt.Sprintf("%s/mj/task/list-by-condition", baseUrl)
+	byteBody, err := common.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, requestUrl, bytes.NewBuffer(byteBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("mj-api-secret", key)
+	client, err := service.GetHttpClientWithProxy(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("new proxy http client failed: %w", err)
+	}
+	return client.Do(req)
+}
+
+// RequestPath 去掉 /mj-fast、/mj-turbo 等模式前缀，返回上游的 /mj/... 路径
+func RequestPath(path string) string {
+	if strings.Contains(path, "/mj-") {
+		urls := strings.Split(path, "/mj/")
+		if len(urls) < 2 {
+			return path
+		}
+		return "/mj/" + urls[1]
+	}
+	return path
+}
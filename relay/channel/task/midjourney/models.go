@@ -0,0 +1,18 @@
+package midjourney
+
+import (
+	"sort"
+
+	"github.com/QuantumNous/new-api/constant"
+)
+
+var ModelList = func() []string {
+	models := make([]string, 0, len(constant.MidjourneyModel2Action))
+	for name := range constant.MidjourneyModel2Action {
+		models = append(models, name)
+	}
+	sort.Strings(models)
+	return models
+}()
+
+var ChannelName = "midjourney"
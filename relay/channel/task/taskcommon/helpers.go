@@ -3,6 +3,7 @@ package taskcommon
 import (
 	"encoding/base64"
 	"fmt"
+	"strconv"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
@@ -60,6 +61,27 @@ func DecodeLocalTaskID(id string) (string, error) {
 	return string(b), nil
 }
 
+// TaskCallbackToken returns the unguessable per-task token embedded in upstream callback URLs.
+func TaskCallbackToken(platform string, taskID string) string {
+	return common.GenerateHMAC(fmt.Sprintf("task_callback:%s:%s", platform, taskID))
+}
+
+// BuildCallbackURL returns the gateway callback URL for the task being submitted,
+// or "" when upstream callbacks are disabled. Adaptors that support push callbacks
+// put it into the upstream request; the task is then polled only as a fallback.
+func BuildCallbackURL(info *relaycommon.RelayInfo) string {
+	if !system_setting.GetTaskCallbackSetting().Enabled || system_setting.ServerAddress == "" {
+		return ""
+	}
+	if info == nil || info.TaskRelayInfo == nil || info.PublicTaskID == "" || info.ChannelMeta == nil {
+		return ""
+	}
+	platform := strconv.Itoa(info.ChannelType)
+	info.UpstreamCallback = true
+	return fmt.Sprintf("%s/api/task/callback/%s/%s/%s", system_setting.ServerAddress, platform, info.PublicTaskID,
+		TaskCallbackToken(platform, info.PublicTaskID))
+}
+
 // BuildProxyURL constructs the video proxy URL using the public task ID.
 // e.g., "https://your-server.com/v1/videos/task_xxxx/content"
 func BuildProxyURL(taskID string) string {
@@ -212,6 +212,35 @@ func (a *TaskAdaptor) FetchTask(baseUrl, key string, body map[string]any, proxy
 	return client.Do(req)
 }
 
+// CancelTask 取消尚未开始生成的任务
+func (a *TaskAdaptor) CancelTask(baseUrl, key string, taskID string, proxy string) (float64, error) {
+	url := fmt.Sprintf("%s/ent/v2/tasks/%s/cancel", baseUrl, taskID)
+	body, err := common.Marshal(map[string]string{"id": taskID})
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Token "+key)
+	client, err := service.GetHttpClientWithProxy(proxy)
+	if err != nil {
+		return 0, fmt.Errorf("new proxy http client failed: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return 0, fmt.Errorf("status code %d: %s", resp.StatusCode, string(respBody))
+	}
+	return 0, nil
+}
+
 func (a *TaskAdaptor) GetModelList() []string {
 	return []string{"viduq2", "viduq1", "vidu2.0", "vidu1.5"}
 }
@@ -237,9 +266,17 @@ func (a *TaskAdaptor) convertToRequestPayload(req *relaycommon.TaskSubmitReq, in
 	if err := taskcommon.UnmarshalMetadata(req.Metadata, &r); err != nil {
 		return nil, errors.Wrap(err, "unmarshal metadata failed")
 	}
+	if callbackURL := taskcommon.BuildCallbackURL(info); callbackURL != "" {
+		r.CallbackUrl = callbackURL
+	}
 	return &r, nil
 }
 
+// NormalizeTaskCallback 回调推送内容与查询接口返回结构一致
+func (a *TaskAdaptor) NormalizeTaskCallback(body []byte) ([]byte, error) {
+	return body, nil
+}
+
 func (a *TaskAdaptor) ParseTaskResult(respBody []byte) (*relaycommon.TaskInfo, error) {
 	taskInfo := &relaycommon.TaskInfo{}
 
@@ -182,7 +182,11 @@ func ClaudeHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *typ
 		}
 	}
 
+	info.StreamFailover = true
 	usage, newAPIError := adaptor.DoResponse(c, httpResp, info)
+	if failoverErr := helper.TakeStreamFailoverError(c, info); failoverErr != nil {
+		return failoverErr
+	}
 	//log.Printf("usage: %v", usage)
 	if newAPIError != nil {
 		// reset status code 重置状态码
@@ -58,6 +58,13 @@ type ResponsesUsageInfo struct {
 	BuiltInTools map[string]*BuildInToolInfo
 }
 
+// ModelRouteInfo 虚拟路由模型的选择结果，Rule 为空表示使用了默认模型
+type ModelRouteInfo struct {
+	RouterModel string
+	Rule        string
+	Model       string
+}
+
 type ChannelMeta struct {
 	ChannelType          int
 	ChannelId            int
@@ -101,6 +108,7 @@ type RelayInfo struct {
 	UsePrice               bool
 	RelayMode              int
 	OriginModelName        string
+	RequestedModelName     string // 客户端请求的模型，发生跨模型降级时与 OriginModelName 不同
 	RequestURLPath         string
 	RequestHeaders         map[string]string
 	ShouldIncludeUsage     bool
@@ -127,6 +135,8 @@ type RelayInfo struct {
 	// Billing 是计费会话，封装了预扣费/结算/退款的统一生命周期。
 	// 免费模型时为 nil。
 	Billing BillingSettler
+	// BillingAttempt 切换到降级模型后重新预扣费的次数
+	BillingAttempt int
 	// BillingSource indicates whether this request is billed from wallet quota or subscription.
 	// "" or "wallet" => wallet; "subscription" => subscription
 	BillingSource string
@@ -164,6 +174,13 @@ type RelayInfo struct {
 	FinalRequestRelayFormat types.RelayFormat
 
 	StreamStatus *StreamStatus
+	// StreamFailover 调用方会在 DoResponse 之后处理流在内容开始前的失败，此时流式输出在首个内容事件前被缓存
+	StreamFailover bool
+
+	// Hedge 发出对冲请求时的结果，未对冲时为 nil
+	Hedge *HedgeInfo
+	// Router 请求虚拟路由模型时选中的规则与实际模型，未路由时为 nil
+	Router *ModelRouteInfo
 
 	ThinkingContentInfo
 	TokenCountMeta
@@ -455,7 +472,8 @@ func genBaseRelayInfo(c *gin.Context, request dto.Request) *RelayInfo {
 		UserQuota:  common.GetContextKeyInt(c, constant.ContextKeyUserQuota),
 		UserEmail:  common.GetContextKeyString(c, constant.ContextKeyUserEmail),
 
-		OriginModelName: common.GetContextKeyString(c, constant.ContextKeyOriginalModel),
+		OriginModelName:    common.GetContextKeyString(c, constant.ContextKeyOriginalModel),
+		RequestedModelName: common.GetContextKeyString(c, constant.ContextKeyRequestedModel),
 
 		TokenId:        common.GetContextKeyInt(c, constant.ContextKeyTokenId),
 		TokenKey:       common.GetContextKeyString(c, constant.ContextKeyTokenKey),
@@ -571,6 +589,7 @@ func GenRelayInfo(c *gin.Context, relayFormat types.RelayFormat, request dto.Req
 		return nil, errors.New("failed to build relay info")
 	}
 
+	common.SetContextKey(c, constant.ContextKeyRelayFormat, string(relayFormat))
 	info.InitRequestConversionChain()
 	return info, nil
 }
@@ -647,6 +666,19 @@ func (info *RelayInfo) SetFirstResponseTime() {
 	}
 }
 
+// ResetStreamState 流式响应在输出内容前失败并换渠道重试时，清除上一次尝试留下的流式状态
+func (info *RelayInfo) ResetStreamState() {
+	info.SendResponseCount = 0
+	info.ReceivedResponseCount = 0
+	info.isFirstResponse = true
+	info.FirstResponseTime = time.Time{}
+	info.ThinkingContentInfo = ThinkingContentInfo{IsFirstThinkingContent: true}
+	if info.ClaudeConvertInfo != nil {
+		info.ClaudeConvertInfo = &ClaudeConvertInfo{LastMessagesType: LastMessageTypeNone}
+	}
+	info.StreamStatus = nil
+}
+
 func (info *RelayInfo) HasSendResponse() bool {
 	return info.FirstResponseTime.After(info.StartTime)
 }
@@ -657,6 +689,8 @@ type TaskRelayInfo struct {
 	// PublicTaskID 是提交时预生成的 task_xxxx 格式公开 ID，
 	// 供 DoResponse 在返回给客户端时使用（避免暴露上游真实 ID）。
 	PublicTaskID string
+	// UpstreamCallback 提交请求中已附带上游回调地址，轮询只作为兜底
+	UpstreamCallback bool
 
 	ConsumeQuota bool
 
@@ -0,0 +1,66 @@
+package common
+
+import (
+	"maps"
+	"reflect"
+	"slices"
+
+	"github.com/QuantumNous/new-api/dto"
+
+	"github.com/jinzhu/copier"
+)
+
+// HedgeInfo 对冲请求结果，仅在实际发出对冲请求时记录
+type HedgeInfo struct {
+	PrimaryChannelId int
+	HedgeChannelId   int
+	HedgeWon         bool // 胜出的是对冲渠道
+	// OverheadCost 落败请求的估算上游成本（额度单位），不向用户计费
+	OverheadCost int
+}
+
+// CloneForHedge 复制一份可与原 RelayInfo 并发使用的副本，渠道信息由副本重新初始化。
+// 计费会话共享，落败方的上下文会被标记为 ContextKeyHedgeLost，只有胜出的一方会结算
+func (info *RelayInfo) CloneForHedge() *RelayInfo {
+	clone := *info
+	clone.ChannelMeta = nil
+	clone.StreamStatus = nil
+	clone.LastError = nil
+	clone.Hedge = nil
+	clone.RequestConversionChain = slices.Clone(info.RequestConversionChain)
+	clone.ParamOverrideAudit = slices.Clone(info.ParamOverrideAudit)
+	clone.PriceData.OtherRatios = maps.Clone(info.PriceData.OtherRatios)
+	clone.PriceData.PricingRuleAttrs = maps.Clone(info.PriceData.PricingRuleAttrs)
+	clone.PriceData.PricingRuleApplied = slices.Clone(info.PriceData.PricingRuleApplied)
+	if info.ClaudeConvertInfo != nil {
+		claudeInfo := *info.ClaudeConvertInfo
+		clone.ClaudeConvertInfo = &claudeInfo
+	}
+	if info.ResponsesUsageInfo != nil {
+		builtInTools := make(map[string]*BuildInToolInfo, len(info.ResponsesUsageInfo.BuiltInTools))
+		for name, tool := range info.ResponsesUsageInfo.BuiltInTools {
+			toolCopy := *tool
+			builtInTools[name] = &toolCopy
+		}
+		clone.ResponsesUsageInfo = &ResponsesUsageInfo{BuiltInTools: builtInTools}
+	}
+	if info.Request != nil {
+		clone.Request = cloneRequest(info.Request)
+	}
+	return &clone
+}
+
+func cloneRequest(request dto.Request) dto.Request {
+	value := reflect.ValueOf(request)
+	if value.Kind() != reflect.Pointer || value.IsNil() {
+		return request
+	}
+	cloned := reflect.New(value.Elem().Type())
+	if err := copier.CopyWithOption(cloned.Interface(), request, copier.Option{DeepCopy: true, IgnoreEmpty: true}); err != nil {
+		return request
+	}
+	if clonedRequest, ok := cloned.Interface().(dto.Request); ok {
+		return clonedRequest
+	}
+	return request
+}
@@ -29,9 +29,12 @@ type StreamErrorEntry struct {
 }
 
 type StreamStatus struct {
-	EndReason  StreamEndReason
-	EndError   error
-	endOnce    sync.Once
+	EndReason StreamEndReason
+	EndError  error
+	endOnce   sync.Once
+
+	// FailedBeforeContent 上游在转发任何内容前结束或报错，缓存的输出已丢弃，可换渠道重试
+	FailedBeforeContent bool
 
 	mu         sync.Mutex
 	Errors     []StreamErrorEntry
@@ -100,6 +103,9 @@ func (s *StreamStatus) Summary() string {
 	}
 	b := &strings.Builder{}
 	fmt.Fprintf(b, "reason=%s", s.EndReason)
+	if s.FailedBeforeContent {
+		b.WriteString(" failed_before_content")
+	}
 	if s.EndError != nil {
 		fmt.Fprintf(b, " end_error=%q", s.EndError.Error())
 	}
@@ -198,7 +198,11 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 		}
 	}
 
+	info.StreamFailover = true
 	usage, newApiErr := adaptor.DoResponse(c, httpResp, info)
+	if failoverErr := helper.TakeStreamFailoverError(c, info); failoverErr != nil {
+		return failoverErr
+	}
 	if newApiErr != nil {
 		// reset status code 重置状态码
 		service.ResetStatusCode(newApiErr, statusCodeMappingStr)
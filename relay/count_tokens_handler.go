@@ -0,0 +1,104 @@
+package relay
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/relay/channel"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// ErrCountTokensUnsupported 当前渠道不支持原生 count_tokens，需要本地估算
+var ErrCountTokensUnsupported = errors.New("channel does not support count tokens")
+
+// supportsUpstreamCountTokens 当前渠道是否原生支持对应格式的 count_tokens 接口
+func supportsUpstreamCountTokens(info *relaycommon.RelayInfo) bool {
+	switch info.RelayFormat {
+	case types.RelayFormatClaude:
+		return info.ApiType == constant.APITypeAnthropic
+	case types.RelayFormatGemini:
+		return info.ApiType == constant.APITypeGemini
+	}
+	return false
+}
+
+// CountTokensHelper 将 count_tokens 请求原样转发给上游（仅替换映射后的模型名），返回上游统计的输入 token 数
+func CountTokensHelper(c *gin.Context, info *relaycommon.RelayInfo) (int, error) {
+	info.InitChannelMeta(c)
+	if !supportsUpstreamCountTokens(info) {
+		return 0, ErrCountTokensUnsupported
+	}
+	if err := helper.ModelMappedHelper(c, info, nil); err != nil {
+		return 0, err
+	}
+
+	adaptor := GetAdaptor(info.ApiType)
+	if adaptor == nil {
+		return 0, fmt.Errorf("invalid api type: %d", info.ApiType)
+	}
+	adaptor.Init(info)
+
+	bodyStorage, err := common.GetBodyStorage(c)
+	if err != nil {
+		return 0, err
+	}
+	body, err := bodyStorage.Bytes()
+	if err != nil {
+		return 0, err
+	}
+
+	var requestURL string
+	switch info.RelayFormat {
+	case types.RelayFormatClaude:
+		requestURL = fmt.Sprintf("%s/v1/messages/count_tokens", info.ChannelBaseUrl)
+		body, err = sjson.SetBytes(body, "model", info.UpstreamModelName)
+	default:
+		version := model_setting.GetGeminiVersionSetting(info.UpstreamModelName)
+		requestURL = fmt.Sprintf("%s/%s/models/%s:countTokens", info.ChannelBaseUrl, version, info.UpstreamModelName)
+		if gjson.GetBytes(body, "generateContentRequest.model").Exists() {
+			body, err = sjson.SetBytes(body, "generateContentRequest.model", "models/"+info.UpstreamModelName)
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := channel.DoApiRequestWithURL(adaptor, c, info, requestURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("upstream count tokens failed: status %d, body %s", resp.StatusCode, common.MaskSensitiveInfo(string(respBody)))
+	}
+
+	if info.RelayFormat == types.RelayFormatClaude {
+		var claudeResp dto.ClaudeCountTokensResponse
+		if err := common.Unmarshal(respBody, &claudeResp); err != nil {
+			return 0, err
+		}
+		return claudeResp.InputTokens, nil
+	}
+	var geminiResp dto.GeminiCountTokensResponse
+	if err := common.Unmarshal(respBody, &geminiResp); err != nil {
+		return 0, err
+	}
+	return geminiResp.TotalTokens, nil
+}
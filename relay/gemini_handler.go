@@ -188,7 +188,11 @@ func GeminiHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *typ
 		}
 	}
 
+	info.StreamFailover = true
 	usage, openaiErr := adaptor.DoResponse(c, resp.(*http.Response), info)
+	if failoverErr := helper.TakeStreamFailoverError(c, info); failoverErr != nil {
+		return failoverErr
+	}
 	if openaiErr != nil {
 		service.ResetStatusCode(openaiErr, statusCodeMappingStr)
 		return openaiErr
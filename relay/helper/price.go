@@ -2,8 +2,10 @@ package helper
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/logger"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
@@ -50,7 +52,6 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 
 	groupRatioInfo := HandleGroupRatio(c, info)
 
-	var preConsumedQuota int
 	var modelRatio float64
 	var completionRatio float64
 	var cacheRatio float64
@@ -60,12 +61,9 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 	var cacheCreationRatio1h float64
 	var audioRatio float64
 	var audioCompletionRatio float64
+	var imageCompletionRatio float64
 	var freeModel bool
 	if !usePrice {
-		preConsumedTokens := common.Max(promptTokens, common.PreConsumedQuota)
-		if meta.MaxTokens != 0 {
-			preConsumedTokens += meta.MaxTokens
-		}
 		var success bool
 		var matchName string
 		modelRatio, success, matchName = ratio_setting.GetModelRatio(info.OriginModelName)
@@ -87,13 +85,58 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 		imageRatio, _ = ratio_setting.GetImageRatio(info.OriginModelName)
 		audioRatio = ratio_setting.GetAudioRatio(info.OriginModelName)
 		audioCompletionRatio = ratio_setting.GetAudioCompletionRatio(info.OriginModelName)
-		ratio := modelRatio * groupRatioInfo.GroupRatio
-		preConsumedQuota = int(float64(preConsumedTokens) * ratio)
-	} else {
+		imageCompletionRatio, _ = ratio_setting.GetImageCompletionRatio(info.OriginModelName)
+	}
+
+	priceData := types.PriceData{
+		ModelPrice:           modelPrice,
+		ModelRatio:           modelRatio,
+		CompletionRatio:      completionRatio,
+		GroupRatioInfo:       groupRatioInfo,
+		UsePrice:             usePrice,
+		CacheRatio:           cacheRatio,
+		ImageRatio:           imageRatio,
+		AudioRatio:           audioRatio,
+		AudioCompletionRatio: audioCompletionRatio,
+		ImageCompletionRatio: imageCompletionRatio,
+		CacheCreationRatio:   cacheCreationRatio,
+		CacheCreation5mRatio: cacheCreationRatio5m,
+		CacheCreation1hRatio: cacheCreationRatio1h,
+	}
+	if usePrice {
+		priceData.ImagePriceRatio = meta.ImagePriceRatio
 		if meta.ImagePriceRatio != 0 {
-			modelPrice = modelPrice * meta.ImagePriceRatio
+			priceData.ModelPrice = modelPrice * meta.ImagePriceRatio
+		}
+	}
+	if rule, ok := ratio_setting.GetModelPricingRule(info.OriginModelName); ok {
+		priceData.PricingRule = rule
+		priceData.PricingRuleBase = types.PricingRatios{
+			ModelRatio:         modelRatio,
+			CompletionRatio:    completionRatio,
+			CacheRatio:         cacheRatio,
+			CacheCreationRatio: cacheCreationRatio,
+			ModelPrice:         modelPrice,
+		}
+		priceData.PricingRuleAttrs = pricingRuleAttrs(info)
+		priceData.PricingRuleTime = info.StartTime
+		if priceData.PricingRuleTime.IsZero() {
+			priceData.PricingRuleTime = time.Now()
 		}
-		preConsumedQuota = int(modelPrice * common.QuotaPerUnit * groupRatioInfo.GroupRatio)
+		// 预扣时输出按最大输出 token 估算
+		priceData.ApplyPricingRule(types.PricingUsage{PromptTokens: promptTokens, CompletionTokens: meta.MaxTokens})
+	}
+
+	var preConsumedQuota int
+	if !usePrice {
+		preConsumedTokens := common.Max(promptTokens, common.PreConsumedQuota)
+		if meta.MaxTokens != 0 {
+			preConsumedTokens += meta.MaxTokens
+		}
+		ratio := priceData.ModelRatio * groupRatioInfo.GroupRatio
+		preConsumedQuota = int(float64(preConsumedTokens) * ratio)
+	} else {
+		preConsumedQuota = int(priceData.ModelPrice * common.QuotaPerUnit * groupRatioInfo.GroupRatio)
 	}
 
 	// check if free model pre-consume is disabled
@@ -103,34 +146,19 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 			preConsumedQuota = 0
 			freeModel = true
 		} else if usePrice {
-			if modelPrice == 0 {
+			if priceData.ModelPrice == 0 {
 				preConsumedQuota = 0
 				freeModel = true
 			}
 		} else {
-			if modelRatio == 0 {
+			if priceData.ModelRatio == 0 {
 				preConsumedQuota = 0
 				freeModel = true
 			}
 		}
 	}
-
-	priceData := types.PriceData{
-		FreeModel:            freeModel,
-		ModelPrice:           modelPrice,
-		ModelRatio:           modelRatio,
-		CompletionRatio:      completionRatio,
-		GroupRatioInfo:       groupRatioInfo,
-		UsePrice:             usePrice,
-		CacheRatio:           cacheRatio,
-		ImageRatio:           imageRatio,
-		AudioRatio:           audioRatio,
-		AudioCompletionRatio: audioCompletionRatio,
-		CacheCreationRatio:   cacheCreationRatio,
-		CacheCreation5mRatio: cacheCreationRatio5m,
-		CacheCreation1hRatio: cacheCreationRatio1h,
-		QuotaToPreConsume:    preConsumedQuota,
-	}
+	priceData.FreeModel = freeModel
+	priceData.QuotaToPreConsume = preConsumedQuota
 
 	if common.DebugEnabled {
 		println(fmt.Sprintf("model_price_helper result: %s", priceData.ToSetting()))
@@ -166,6 +194,26 @@ func ModelPriceHelperPerCall(c *gin.Context, info *relaycommon.RelayInfo) (types
 		}
 	}
 
+	priceData := types.PriceData{
+		GroupRatioInfo: groupRatioInfo,
+	}
+	// 按次计费没有 token 用量，规则只按请求属性与时间条件生效
+	if rule, ok := ratio_setting.GetModelPricingRule(info.OriginModelName); ok {
+		priceData.PricingRule = rule
+		priceData.PricingRuleBase = types.PricingRatios{
+			ModelRatio: modelRatio,
+			ModelPrice: modelPrice,
+		}
+		priceData.PricingRuleAttrs = pricingRuleAttrs(info)
+		priceData.PricingRuleTime = info.StartTime
+		if priceData.PricingRuleTime.IsZero() {
+			priceData.PricingRuleTime = time.Now()
+		}
+		priceData.ApplyPricingRule(types.PricingUsage{})
+		modelRatio = priceData.ModelRatio
+		modelPrice = priceData.ModelPrice
+	}
+
 	var quota int
 	freeModel := false
 
@@ -189,17 +237,43 @@ func ModelPriceHelperPerCall(c *gin.Context, info *relaycommon.RelayInfo) (types
 		}
 	}
 
-	priceData := types.PriceData{
-		FreeModel:      freeModel,
-		ModelPrice:     modelPrice,
-		ModelRatio:     modelRatio,
-		UsePrice:       usePrice,
-		Quota:          quota,
-		GroupRatioInfo: groupRatioInfo,
-	}
+	priceData.FreeModel = freeModel
+	priceData.ModelPrice = modelPrice
+	priceData.ModelRatio = modelRatio
+	priceData.UsePrice = usePrice
+	priceData.Quota = quota
 	return priceData, nil
 }
 
+// pricingRuleAttrs 提取定价规则可匹配的请求字段
+func pricingRuleAttrs(info *relaycommon.RelayInfo) map[string]string {
+	attrs := make(map[string]string)
+	switch req := info.Request.(type) {
+	case *dto.GeneralOpenAIRequest:
+		if len(req.ServiceTier) > 0 {
+			var tier string
+			if err := common.Unmarshal(req.ServiceTier, &tier); err == nil {
+				attrs[types.PricingFieldServiceTier] = tier
+			}
+		}
+		attrs[types.PricingFieldReasoningEffort] = req.ReasoningEffort
+	case *dto.OpenAIResponsesRequest:
+		attrs[types.PricingFieldServiceTier] = req.ServiceTier
+		if req.Reasoning != nil {
+			attrs[types.PricingFieldReasoningEffort] = req.Reasoning.Effort
+		}
+	case *dto.ClaudeRequest:
+		attrs[types.PricingFieldServiceTier] = req.ServiceTier
+	case *dto.ImageRequest:
+		attrs[types.PricingFieldImageSize] = req.Size
+		attrs[types.PricingFieldImageQuality] = req.Quality
+	}
+	if attrs[types.PricingFieldReasoningEffort] == "" && info.ReasoningEffort != "" {
+		attrs[types.PricingFieldReasoningEffort] = info.ReasoningEffort
+	}
+	return attrs
+}
+
 func ContainPriceOrRatio(modelName string) bool {
 	_, ok := ratio_setting.GetModelPrice(modelName, false)
 	if ok {
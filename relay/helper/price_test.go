@@ -0,0 +1,43 @@
+package helper
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModelPriceHelperPerCallAppliesPricingRule(t *testing.T) {
+	savedPrice := ratio_setting.ModelPrice2JSONString()
+	savedRules := ratio_setting.ModelPricingRules2JSONString()
+	t.Cleanup(func() {
+		_ = ratio_setting.UpdateModelPriceByJSONString(savedPrice)
+		_ = ratio_setting.UpdateModelPricingRulesByJSONString(savedRules)
+	})
+	require.NoError(t, ratio_setting.UpdateModelPriceByJSONString(`{"test-per-call-video":0.5}`))
+	require.NoError(t, ratio_setting.UpdateModelPricingRulesByJSONString(
+		`{"test-per-call-video":{"time_windows":[{"start":"01:00","end":"02:00","timezone":"UTC","multiplier":2}]}}`))
+
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	info := &relaycommon.RelayInfo{
+		OriginModelName: "test-per-call-video",
+		StartTime:       time.Date(2026, 1, 1, 1, 30, 0, 0, time.UTC),
+	}
+	priceData, err := ModelPriceHelperPerCall(c, info)
+	require.NoError(t, err)
+	require.Equal(t, 1.0, priceData.ModelPrice)
+	require.Equal(t, int(1.0*common.QuotaPerUnit*priceData.GroupRatioInfo.GroupRatio), priceData.Quota)
+	require.NotEmpty(t, priceData.PricingRuleApplied)
+
+	info.StartTime = time.Date(2026, 1, 1, 3, 0, 0, 0, time.UTC)
+	priceData, err = ModelPriceHelperPerCall(c, info)
+	require.NoError(t, err)
+	require.Equal(t, 0.5, priceData.ModelPrice)
+	require.Empty(t, priceData.PricingRuleApplied)
+}
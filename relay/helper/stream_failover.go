@@ -0,0 +1,244 @@
+package helper
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/QuantumNous/new-api/common"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+const streamHoldWriterKey = "stream_hold_writer"
+
+type streamEventKind int
+
+const (
+	streamEventPreamble streamEventKind = iota // 角色、message_start 等尚未包含内容的事件
+	streamEventContent
+	streamEventError
+)
+
+// classifyStreamEvent 判断上游事件是否已经包含内容，无法识别的事件按内容处理
+func classifyStreamEvent(data string) streamEventKind {
+	if !gjson.Valid(data) {
+		return streamEventContent
+	}
+	event := gjson.Parse(data)
+	if event.Get("error").Exists() {
+		return streamEventError
+	}
+	switch eventType := event.Get("type").String(); eventType {
+	case "":
+	case "error", "response.failed":
+		return streamEventError
+	case "message_start", "ping", "response.created", "response.in_progress":
+		return streamEventPreamble
+	default:
+		return streamEventContent
+	}
+	choices := event.Get("choices")
+	if !choices.Exists() {
+		return streamEventContent
+	}
+	for _, choice := range choices.Array() {
+		if choice.Get("text").String() != "" || choice.Get("finish_reason").String() != "" {
+			return streamEventContent
+		}
+		hasContent := false
+		// delta 中除 role 以外的任何非空字段都视为内容
+		choice.Get("delta").ForEach(func(key, value gjson.Result) bool {
+			if key.String() != "role" && value.Type != gjson.Null && value.String() != "" {
+				hasContent = true
+				return false
+			}
+			return true
+		})
+		if hasContent {
+			return streamEventContent
+		}
+	}
+	if event.Get("usage").IsObject() {
+		return streamEventContent
+	}
+	return streamEventPreamble
+}
+
+// streamHoldWriter 在转发首个内容事件前缓存写入。上游在内容开始前失败时丢弃缓存，
+// 客户端看不到失败的尝试，可以透明地换渠道重试。以 ':' 开头的 SSE 注释（ping）在没有缓存数据时直接写出
+type streamHoldWriter struct {
+	gin.ResponseWriter
+	buf        bytes.Buffer
+	status     int
+	released   atomic.Bool
+	discarding bool
+}
+
+func (w *streamHoldWriter) flush() {
+	if w.status != 0 && !w.ResponseWriter.Written() {
+		w.ResponseWriter.WriteHeader(w.status)
+		w.status = 0
+	}
+	if w.buf.Len() > 0 {
+		_, _ = w.ResponseWriter.Write(w.buf.Bytes())
+		w.buf.Reset()
+	}
+}
+
+func (w *streamHoldWriter) WriteHeader(code int) {
+	if w.released.Load() {
+		w.flush()
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if code > 0 {
+		w.status = code
+	}
+}
+
+func (w *streamHoldWriter) WriteHeaderNow() {
+	if w.released.Load() {
+		w.flush()
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *streamHoldWriter) Write(data []byte) (int, error) {
+	if w.discarding {
+		return len(data), nil
+	}
+	if w.released.Load() {
+		w.flush()
+		return w.ResponseWriter.Write(data)
+	}
+	if w.buf.Len() == 0 && bytes.HasPrefix(data, []byte(":")) {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.buf.Write(data)
+}
+
+func (w *streamHoldWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *streamHoldWriter) Flush() {
+	if w.discarding {
+		return
+	}
+	if w.released.Load() {
+		w.flush()
+		w.ResponseWriter.Flush()
+		return
+	}
+	if w.buf.Len() == 0 && w.ResponseWriter.Written() {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// installStreamHold 仅在调用方会通过 TakeStreamFailoverError 处理失败、且尚未输出内容时启用
+func installStreamHold(c *gin.Context, info *relaycommon.RelayInfo) *streamHoldWriter {
+	if !info.StreamFailover || !operation_setting.GetGeneralSetting().StreamFailoverEnabled {
+		return nil
+	}
+	if info.SendResponseCount > 0 {
+		return nil
+	}
+	hold := &streamHoldWriter{ResponseWriter: c.Writer}
+	c.Writer = hold
+	c.Set(streamHoldWriterKey, hold)
+	return hold
+}
+
+// finishStreamHold 在扫描结束后决定释放缓存还是丢弃，返回流是否在内容开始前失败
+func finishStreamHold(c *gin.Context, info *relaycommon.RelayInfo, hold *streamHoldWriter, sawError bool) bool {
+	if hold == nil {
+		return false
+	}
+	if hold.released.Load() {
+		return false
+	}
+	reason := info.StreamStatus.EndReason
+	if reason == relaycommon.StreamEndReasonClientGone || (reason == relaycommon.StreamEndReasonDone && !sawError) {
+		// 客户端已断开或上游正常结束但没有内容，按原样输出
+		hold.released.Store(true)
+		return false
+	}
+	hold.discarding = true
+	hold.buf.Reset()
+	info.StreamStatus.FailedBeforeContent = true
+	return true
+}
+
+// restoreStreamHold 移除缓存写入器，未丢弃的缓存会先写出
+func restoreStreamHold(c *gin.Context) {
+	value, ok := c.Get(streamHoldWriterKey)
+	if !ok || value == nil {
+		return
+	}
+	hold := value.(*streamHoldWriter)
+	if !hold.discarding {
+		hold.flush()
+	}
+	c.Writer = hold.ResponseWriter
+	c.Set(streamHoldWriterKey, nil)
+}
+
+// TakeStreamFailoverError 在 DoResponse 之后调用：流在转发任何内容前失败时重置流式状态并返回可重试的错误，
+// 之后由渠道重试逻辑换渠道重新请求；失败的尝试不计费
+func TakeStreamFailoverError(c *gin.Context, info *relaycommon.RelayInfo) *types.NewAPIError {
+	restoreStreamHold(c)
+	if info.StreamStatus == nil || !info.StreamStatus.FailedBeforeContent {
+		return nil
+	}
+	summary := info.StreamStatus.Summary()
+	info.ResetStreamState()
+	return types.NewOpenAIError(fmt.Errorf("upstream stream ended before any content was sent: %s", summary), types.ErrorCodeStreamInterrupted, http.StatusBadGateway)
+}
+
+// StreamErrorEvent 以客户端请求的格式输出流式错误事件，让 SDK 能够正常结束而不是一直等待
+func StreamErrorEvent(c *gin.Context, relayFormat types.RelayFormat, apiErr *types.NewAPIError) error {
+	var event string
+	switch relayFormat {
+	case types.RelayFormatClaude:
+		claudeError := apiErr.ToClaudeError()
+		if claudeError.Type == "" {
+			claudeError.Type = "api_error"
+		}
+		payload, _ := common.Marshal(gin.H{"type": "error", "error": claudeError})
+		event = "event: error\ndata: " + string(payload) + "\n\n"
+	case types.RelayFormatOpenAIResponses:
+		openAIError := apiErr.ToOpenAIError()
+		payload, _ := common.Marshal(gin.H{"type": "error", "code": openAIError.Code, "message": openAIError.Message, "param": nil})
+		event = "event: error\ndata: " + string(payload) + "\n\n"
+	case types.RelayFormatGemini:
+		payload, _ := common.Marshal(gin.H{"error": gin.H{
+			"code":    apiErr.StatusCode,
+			"message": apiErr.Error(),
+			"status":  strings.ToUpper(strings.ReplaceAll(http.StatusText(apiErr.StatusCode), " ", "_")),
+		}})
+		event = "data: " + string(payload) + "\n\n"
+	default:
+		payload, _ := common.Marshal(gin.H{"error": apiErr.ToOpenAIError()})
+		event = "data: " + string(payload) + "\n\n"
+	}
+	if _, err := c.Writer.Write([]byte(event)); err != nil {
+		return err
+	}
+	return FlushWriter(c)
+}
+
+// IsEventStreamStarted 响应头已按 SSE 写出时，错误只能以流式事件的形式返回
+func IsEventStreamStarted(c *gin.Context) bool {
+	return c.Writer.Written() && strings.HasPrefix(c.Writer.Header().Get("Content-Type"), "text/event-stream")
+}
+
+func streamInterruptedError(status *relaycommon.StreamStatus) *types.NewAPIError {
+	return types.NewOpenAIError(fmt.Errorf("upstream stream interrupted: %s", status.Summary()), types.ErrorCodeStreamInterrupted, http.StatusBadGateway)
+}
@@ -0,0 +1,121 @@
+package helper
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type failingReader struct {
+	r   io.Reader
+	err error
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if err == io.EOF {
+		return n, f.err
+	}
+	return n, err
+}
+
+func setupFailoverStreamTest(t *testing.T, body io.Reader) (*gin.Context, *httptest.ResponseRecorder, *http.Response, *relaycommon.RelayInfo) {
+	t.Helper()
+	_, resp, info := setupStreamTest(t, body)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	info.StreamFailover = true
+	return c, recorder, resp, info
+}
+
+func forwardStreamData(c *gin.Context) func(data string, sr *StreamResult) {
+	return func(data string, sr *StreamResult) {
+		_ = StringData(c, data)
+	}
+}
+
+func TestClassifyStreamEvent(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]streamEventKind{
+		`{"choices":[{"delta":{"role":"assistant","content":""}}]}`: streamEventPreamble,
+		`{"choices":[{"delta":{"content":"hi"}}]}`:                  streamEventContent,
+		`{"choices":[{"delta":{"reasoning_content":"hm"}}]}`:        streamEventContent,
+		`{"choices":[{"delta":{},"finish_reason":"stop"}]}`:         streamEventContent,
+		`{"choices":[],"usage":{"prompt_tokens":1}}`:                streamEventContent,
+		`{"error":{"message":"overloaded"}}`:                        streamEventError,
+		`{"type":"message_start","message":{}}`:                     streamEventPreamble,
+		`{"type":"content_block_delta","delta":{"text":"hi"}}`:      streamEventContent,
+		`{"type":"error","error":{"type":"overloaded_error"}}`:      streamEventError,
+		`{"type":"response.created","response":{}}`:                 streamEventPreamble,
+		`{"type":"response.output_text.delta","delta":"hi"}`:        streamEventContent,
+		`{"candidates":[{"content":{"parts":[{"text":"hi"}]}}]}`:    streamEventContent,
+		`not json`: streamEventContent,
+	}
+	for data, expected := range cases {
+		assert.Equal(t, expected, classifyStreamEvent(data), data)
+	}
+}
+
+func TestStreamFailoverBeforeContent(t *testing.T) {
+	body := "data: {\"choices\":[{\"delta\":{\"role\":\"assistant\",\"content\":\"\"}}]}\n" +
+		"data: {\"error\":{\"message\":\"upstream overloaded\"}}\n"
+	c, recorder, resp, info := setupFailoverStreamTest(t, strings.NewReader(body))
+	writer := c.Writer
+	info.ClaudeConvertInfo = &relaycommon.ClaudeConvertInfo{LastMessagesType: relaycommon.LastMessageTypeText, Index: 2}
+
+	StreamScannerHandler(c, resp, info, forwardStreamData(c))
+	// 处理函数在扫描结束后的输出同样被丢弃
+	Done(c)
+
+	require.True(t, info.StreamStatus.FailedBeforeContent)
+	assert.Empty(t, recorder.Body.String())
+
+	apiErr := TakeStreamFailoverError(c, info)
+	require.NotNil(t, apiErr)
+	assert.Equal(t, types.ErrorCodeStreamInterrupted, apiErr.GetErrorCode())
+	assert.Equal(t, http.StatusBadGateway, apiErr.StatusCode)
+	assert.Same(t, writer, c.Writer)
+	assert.Nil(t, info.StreamStatus)
+	assert.Equal(t, 0, info.ReceivedResponseCount)
+	assert.Equal(t, relaycommon.LastMessageTypeNone, info.ClaudeConvertInfo.LastMessagesType)
+}
+
+func TestStreamFailoverReleasesOnContent(t *testing.T) {
+	body := "data: {\"choices\":[{\"delta\":{\"role\":\"assistant\",\"content\":\"\"}}]}\n" +
+		"data: {\"choices\":[{\"delta\":{\"content\":\"hello\"}}]}\n" +
+		"data: [DONE]\n"
+	c, recorder, resp, info := setupFailoverStreamTest(t, strings.NewReader(body))
+
+	StreamScannerHandler(c, resp, info, forwardStreamData(c))
+	Done(c)
+	assert.Nil(t, TakeStreamFailoverError(c, info))
+
+	assert.False(t, info.StreamStatus.FailedBeforeContent)
+	assert.Equal(t, "data: {\"choices\":[{\"delta\":{\"role\":\"assistant\",\"content\":\"\"}}]}\n\n"+
+		"data: {\"choices\":[{\"delta\":{\"content\":\"hello\"}}]}\n\n"+
+		"data: [DONE]\n\n", recorder.Body.String())
+}
+
+func TestStreamErrorEventAfterContent(t *testing.T) {
+	body := "data: {\"type\":\"content_block_delta\",\"delta\":{\"text\":\"hi\"}}\n"
+	c, recorder, resp, info := setupFailoverStreamTest(t, &failingReader{r: strings.NewReader(body), err: errors.New("connection reset")})
+	info.RelayFormat = types.RelayFormatClaude
+
+	StreamScannerHandler(c, resp, info, forwardStreamData(c))
+	assert.Nil(t, TakeStreamFailoverError(c, info))
+	assert.Equal(t, relaycommon.StreamEndReasonScannerErr, info.StreamStatus.EndReason)
+	output := recorder.Body.String()
+	assert.True(t, strings.HasPrefix(output, "data: {\"type\":\"content_block_delta\""))
+	assert.Contains(t, output, "event: error\ndata: {\"error\":{\"type\":\"stream_interrupted\"")
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
@@ -43,6 +44,24 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 	// 无条件新建 StreamStatus
 	info.StreamStatus = relaycommon.NewStreamStatus()
 
+	// 首个内容事件前的输出先缓存，上游在内容开始前失败时由调用方换渠道重试
+	hold := installStreamHold(c, info)
+	var sawErrorEvent atomic.Bool
+	defer func() {
+		if finishStreamHold(c, info, hold, sawErrorEvent.Load()) {
+			return
+		}
+		switch info.StreamStatus.EndReason {
+		case relaycommon.StreamEndReasonTimeout, relaycommon.StreamEndReasonScannerErr, relaycommon.StreamEndReasonPanic:
+			// 内容已经开始输出，以客户端格式发送错误事件，避免 SDK 一直等待
+			if c.Writer.Written() {
+				if err := StreamErrorEvent(c, info.RelayFormat, streamInterruptedError(info.StreamStatus)); err != nil {
+					logger.LogError(c, "send stream error event failed: "+err.Error())
+				}
+			}
+		}
+	}()
+
 	// 确保响应体总是被关闭
 	defer func() {
 		if resp.Body != nil {
@@ -253,6 +272,14 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 				continue
 			}
 			if !strings.HasPrefix(data, "[DONE]") {
+				if hold != nil && !hold.released.Load() {
+					switch classifyStreamEvent(data) {
+					case streamEventContent:
+						hold.released.Store(true)
+					case streamEventError:
+						sawErrorEvent.Store(true)
+					}
+				}
 				info.SetFirstResponseTime()
 				info.ReceivedResponseCount++
 
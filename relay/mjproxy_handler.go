@@ -15,25 +15,40 @@ import (
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/model"
+	taskmidjourney "github.com/QuantumNous/new-api/relay/channel/task/midjourney"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/relay/helper"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting"
 	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/QuantumNous/new-api/types"
 
 	"github.com/gin-gonic/gin"
 )
 
 func RelayMidjourneyImage(c *gin.Context) {
 	taskId := c.Param("id")
-	midjourneyTask := model.GetByOnlyMJId(taskId)
-	if midjourneyTask == nil {
+	task := model.GetByOnlyMJId(taskId)
+	if task == nil {
 		c.JSON(400, gin.H{
 			"error": "midjourney_task_not_found",
 		})
 		return
 	}
+	midjourneyTask := task.ToMidjourney()
+	if obj := service.FindPersistedMedia(model.MediaSourceMidjourney, midjourneyTask.MjId); obj != nil {
+		if body, err := service.OpenMediaObject(c.Request.Context(), obj); err == nil {
+			defer body.Close()
+			c.Writer.Header().Set("Content-Type", obj.ContentType)
+			c.Writer.Header().Set("Content-Length", strconv.FormatInt(obj.Size, 10))
+			c.Writer.WriteHeader(http.StatusOK)
+			if _, err := io.Copy(c.Writer, body); err != nil {
+				log.Println("copy stored midjourney image failed:", err)
+			}
+			return
+		}
+	}
 	var httpClient *http.Client
 	if channel, err := model.CacheGetChannel(midjourneyTask.ChannelId); err == nil {
 		proxy := channel.GetSetting().Proxy
@@ -98,8 +113,8 @@ func RelayMidjourneyNotify(c *gin.Context) *dto.MidjourneyResponse {
 			Result:      "",
 		}
 	}
-	midjourneyTask := model.GetByOnlyMJId(midjRequest.MjId)
-	if midjourneyTask == nil {
+	task := model.GetByOnlyMJId(midjRequest.MjId)
+	if task == nil {
 		return &dto.MidjourneyResponse{
 			Code:        4,
 			Description: "midjourney_task_not_found",
@@ -107,19 +122,8 @@ func RelayMidjourneyNotify(c *gin.Context) *dto.MidjourneyResponse {
 			Result:      "",
 		}
 	}
-	midjourneyTask.Progress = midjRequest.Progress
-	midjourneyTask.PromptEn = midjRequest.PromptEn
-	midjourneyTask.State = midjRequest.State
-	midjourneyTask.SubmitTime = midjRequest.SubmitTime
-	midjourneyTask.StartTime = midjRequest.StartTime
-	midjourneyTask.FinishTime = midjRequest.FinishTime
-	midjourneyTask.ImageUrl = midjRequest.ImageUrl
-	midjourneyTask.VideoUrl = midjRequest.VideoUrl
-	videoUrlsStr, _ := json.Marshal(midjRequest.VideoUrls)
-	midjourneyTask.VideoUrls = string(videoUrlsStr)
-	midjourneyTask.Status = midjRequest.Status
-	midjourneyTask.FailReason = midjRequest.FailReason
-	err = midjourneyTask.Update()
+	// 与轮询使用相同的 CAS 更新与失败退款逻辑
+	err = service.ApplyMidjourneyTaskResult(c, task, midjRequest)
 	if err != nil {
 		return &dto.MidjourneyResponse{
 			Code:        4,
@@ -215,10 +219,7 @@ func RelaySwapFace(c *gin.Context, info *relaycommon.RelayInfo) *dto.MidjourneyR
 			Description: "quota_not_enough",
 		}
 	}
-	requestURL := getMjRequestPath(c.Request.URL.String())
-	baseURL := c.GetString("base_url")
-	fullRequestURL := fmt.Sprintf("%s%s", baseURL, requestURL)
-	mjResp, _, err := service.DoMidjourneyHttpRequest(c, time.Second*60, fullRequestURL)
+	mjResp, _, err := doMidjourneySubmitRequest(c, info)
 	if err != nil {
 		return &mjResp.Response
 	}
@@ -265,8 +266,9 @@ func RelaySwapFace(c *gin.Context, info *relaycommon.RelayInfo) *dto.MidjourneyR
 		FailReason:  "",
 		ChannelId:   c.GetInt("channel_id"),
 		Quota:       priceData.Quota,
+		CallbackUrl: service.ResolveTaskCallbackURL(c),
 	}
-	err = midjourneyTask.Insert()
+	err = newMidjourneyTask(info, midjourneyTask, modelName, priceData, mjResp.StatusCode == 200 && midjResponse.Code == 1).Insert()
 	if err != nil {
 		return service.MidjourneyErrorWrapper(constant.MjRequestError, "insert_midjourney_task_failed")
 	}
@@ -299,7 +301,7 @@ func RelayMidjourneyTaskImageSeed(c *gin.Context) *dto.MidjourneyResponse {
 	c.Set("channel_id", originTask.ChannelId)
 	c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.Key))
 
-	requestURL := getMjRequestPath(c.Request.URL.String())
+	requestURL := taskmidjourney.RequestPath(c.Request.URL.String())
 	fullRequestURL := fmt.Sprintf("%s%s", channel.GetBaseURL(), requestURL)
 	midjResponseWithStatus, _, err := service.DoMidjourneyHttpRequest(c, time.Second*30, fullRequestURL)
 	if err != nil {
@@ -329,7 +331,7 @@ func RelayMidjourneyTask(c *gin.Context, relayMode int) *dto.MidjourneyResponse
 				Description: "task_no_found",
 			}
 		}
-		midjourneyTask := coverMidjourneyTaskDto(c, originTask)
+		midjourneyTask := coverMidjourneyTaskDto(c, originTask.ToMidjourney())
 		respBody, err = json.Marshal(midjourneyTask)
 		if err != nil {
 			return &dto.MidjourneyResponse{
@@ -352,7 +354,7 @@ func RelayMidjourneyTask(c *gin.Context, relayMode int) *dto.MidjourneyResponse
 		if len(condition.IDs) != 0 {
 			originTasks := model.GetByMJIds(userId, condition.IDs)
 			for _, originTask := range originTasks {
-				midjourneyTask := coverMidjourneyTaskDto(c, originTask)
+				midjourneyTask := coverMidjourneyTaskDto(c, originTask.ToMidjourney())
 				tasks = append(tasks, midjourneyTask)
 			}
 		}
@@ -473,9 +475,14 @@ func RelayMidjourneySubmit(c *gin.Context, relayInfo *relaycommon.RelayInfo) *dt
 			c.Set("base_url", channel.GetBaseURL())
 			c.Set("channel_id", originTask.ChannelId)
 			c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.Key))
+			relayInfo.ChannelId = originTask.ChannelId
+			relayInfo.ChannelType = channel.Type
+			relayInfo.ChannelBaseUrl = channel.GetBaseURL()
+			relayInfo.ApiKey = channel.Key
+			relayInfo.ChannelSetting = channel.GetSetting()
 			log.Printf("检测到此操作为放大、变换、重绘，获取原channel信息: %s,%s", strconv.Itoa(originTask.ChannelId), channel.GetBaseURL())
 		}
-		midjRequest.Prompt = originTask.Prompt
+		midjRequest.Prompt = originTask.Properties.Input
 
 		//if channelType == common.ChannelTypeMidjourneyPlus {
 		//	// plus
@@ -489,15 +496,8 @@ func RelayMidjourneySubmit(c *gin.Context, relayInfo *relaycommon.RelayInfo) *dt
 		consumeQuota = false
 	}
 
-	//baseURL := common.ChannelBaseURLs[channelType]
-	requestURL := getMjRequestPath(c.Request.URL.String())
-
-	baseURL := c.GetString("base_url")
-
 	//midjRequest.NotifyHook = "http://127.0.0.1:3000/mj/notify"
 
-	fullRequestURL := fmt.Sprintf("%s%s", baseURL, requestURL)
-
 	modelName := service.CovertMjpActionToModelName(midjRequest.Action)
 
 	priceData, err := helper.ModelPriceHelperPerCall(c, relayInfo)
@@ -523,7 +523,7 @@ func RelayMidjourneySubmit(c *gin.Context, relayInfo *relaycommon.RelayInfo) *dt
 		}
 	}
 
-	midjResponseWithStatus, responseBody, err := service.DoMidjourneyHttpRequest(c, time.Second*60, fullRequestURL)
+	midjResponseWithStatus, responseBody, err := doMidjourneySubmitRequest(c, relayInfo)
 	if err != nil {
 		return &midjResponseWithStatus.Response
 	}
@@ -578,6 +578,7 @@ func RelayMidjourneySubmit(c *gin.Context, relayInfo *relaycommon.RelayInfo) *dt
 		FailReason:  "",
 		ChannelId:   c.GetInt("channel_id"),
 		Quota:       priceData.Quota,
+		CallbackUrl: service.ResolveTaskCallbackURL(c),
 	}
 	if midjResponse.Code == 3 {
 		//无实例账号自动禁用渠道（No available account instance）
@@ -622,7 +623,7 @@ func RelayMidjourneySubmit(c *gin.Context, relayInfo *relaycommon.RelayInfo) *dt
 		midjourneyTask.Progress = "100%"
 		midjourneyTask.Status = "SUCCESS"
 	}
-	err = midjourneyTask.Insert()
+	err = newMidjourneyTask(relayInfo, midjourneyTask, modelName, priceData, consumeQuota && midjResponseWithStatus.StatusCode == 200).Insert()
 	if err != nil {
 		return &dto.MidjourneyResponse{
 			Code:        4,
@@ -660,20 +661,38 @@ func RelayMidjourneySubmit(c *gin.Context, relayInfo *relaycommon.RelayInfo) *dt
 	return nil
 }
 
-type taskChangeParams struct {
-	ID     string
-	Action string
-	Index  int
+// doMidjourneySubmitRequest 通过 Midjourney 任务适配器构建并发送提交请求
+func doMidjourneySubmitRequest(c *gin.Context, info *relaycommon.RelayInfo) (*dto.MidjourneyResponseWithStatusCode, []byte, error) {
+	adaptor := &taskmidjourney.TaskAdaptor{}
+	adaptor.Init(info)
+	requestBody, err := adaptor.BuildRequestBody(c, info)
+	if err != nil {
+		return service.MidjourneyErrorWithStatusCodeWrapper(constant.MjErrorUnknown, "read_request_body_failed", http.StatusInternalServerError), nil, err
+	}
+	resp, err := adaptor.DoRequest(c, info, requestBody)
+	if err != nil {
+		return service.MidjourneyErrorWithStatusCodeWrapper(constant.MjErrorUnknown, "do_request_failed", http.StatusInternalServerError), nil, err
+	}
+	return service.ParseMidjourneyResponse(resp)
 }
 
-func getMjRequestPath(path string) string {
-	requestURL := path
-	if strings.Contains(requestURL, "/mj-") {
-		urls := strings.Split(requestURL, "/mj/")
-		if len(urls) < 2 {
-			return requestURL
-		}
-		requestURL = "/mj/" + urls[1]
-	}
-	return requestURL
+// newMidjourneyTask 构建 tasks 表中的 MJ 任务，记录计费来源以便失败或超时时统一退款。
+// 未实际扣费的任务额度记为 0，避免被退款。
+func newMidjourneyTask(info *relaycommon.RelayInfo, midjourneyTask *model.Midjourney, modelName string, priceData types.PriceData, charged bool) *model.Task {
+	task := model.NewMidjourneyTask(midjourneyTask)
+	if !charged {
+		task.Quota = 0
+	}
+	task.Group = info.UsingGroup
+	task.Properties.OriginModelName = modelName
+	task.PrivateData.BillingSource = info.BillingSource
+	task.PrivateData.SubscriptionId = info.SubscriptionId
+	task.PrivateData.TokenId = info.TokenId
+	task.PrivateData.BillingContext = &model.TaskBillingContext{
+		ModelPrice:      priceData.ModelPrice,
+		GroupRatio:      priceData.GroupRatioInfo.GroupRatio,
+		OriginModelName: modelName,
+		PerCallBilling:  true,
+	}
+	return task
 }
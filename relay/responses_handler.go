@@ -127,7 +127,11 @@ func ResponsesHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *
 		}
 	}
 
+	info.StreamFailover = true
 	usage, newAPIError := adaptor.DoResponse(c, httpResp, info)
+	if failoverErr := helper.TakeStreamFailoverError(c, info); failoverErr != nil {
+		return failoverErr
+	}
 	if newAPIError != nil {
 		// reset status code 重置状态码
 		service.ResetStatusCode(newAPIError, statusCodeMappingStr)
@@ -93,6 +93,7 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.POST("/waffo/pay", middleware.CriticalRateLimit(), controller.RequestWaffoPay)
 				selfRoute.POST("/aff_transfer", controller.TransferAffQuota)
 				selfRoute.PUT("/setting", controller.UpdateUserSetting)
+				selfRoute.GET("/notify_events", controller.GetNotifyEvents)
 
 				// 2FA routes
 				selfRoute.GET("/2fa/status", controller.Get2FAStatus)
@@ -196,6 +197,27 @@ func SetApiRouter(router *gin.Engine) {
 			performanceRoute.POST("/gc", controller.ForceGC)
 			performanceRoute.GET("/logs", controller.GetLogFiles)
 			performanceRoute.DELETE("/logs", controller.CleanupLogFiles)
+			performanceRoute.GET("/leases", controller.GetJobLeases)
+		}
+		auditRoute := apiRouter.Group("/audit")
+		auditRoute.Use(middleware.RootAuth())
+		{
+			auditRoute.GET("/", controller.GetAuditLogs)
+			auditRoute.GET("/export", controller.ExportAuditLogs)
+			auditRoute.GET("/verify", controller.VerifyAuditLogs)
+		}
+		configRoute := apiRouter.Group("/config")
+		configRoute.Use(middleware.RootAuth())
+		{
+			configRoute.GET("/export", controller.ExportConfigBundle)
+			configRoute.POST("/diff", controller.DiffConfigBundle)
+			configRoute.POST("/apply", middleware.CriticalRateLimit(), controller.ApplyConfigBundle)
+			configRoute.GET("/snapshots", controller.GetConfigSnapshots)
+			configRoute.POST("/snapshots", controller.CreateConfigSnapshot)
+			configRoute.GET("/snapshots/:id", controller.DownloadConfigSnapshot)
+			configRoute.GET("/snapshots/:id/diff", controller.DiffConfigSnapshot)
+			configRoute.POST("/snapshots/:id/rollback", middleware.CriticalRateLimit(), controller.RollbackConfigSnapshot)
+			configRoute.DELETE("/snapshots/:id", controller.DeleteConfigSnapshot)
 		}
 		ratioSyncRoute := apiRouter.Group("/ratio_sync")
 		ratioSyncRoute.Use(middleware.RootAuth())
@@ -281,10 +303,24 @@ func SetApiRouter(router *gin.Engine) {
 			redemptionRoute.DELETE("/invalid", controller.DeleteInvalidRedemption)
 			redemptionRoute.DELETE("/:id", controller.DeleteRedemption)
 		}
+		statementRoute := apiRouter.Group("/statement")
+		{
+			statementRoute.GET("/self", middleware.UserAuth(), controller.GetUserStatements)
+			statementRoute.GET("/self/:id", middleware.UserAuth(), controller.GetUserStatement)
+			statementRoute.GET("/self/:id/download", middleware.UserAuth(), controller.DownloadUserStatement)
+			statementRoute.GET("/", middleware.AdminAuth(), controller.GetAllStatements)
+			statementRoute.POST("/generate", middleware.AdminAuth(), controller.GenerateStatement)
+			statementRoute.GET("/:id", middleware.AdminAuth(), controller.GetStatement)
+			statementRoute.GET("/:id/download", middleware.AdminAuth(), controller.DownloadStatement)
+		}
 		logRoute := apiRouter.Group("/log")
 		logRoute.GET("/", middleware.AdminAuth(), controller.GetAllLogs)
 		logRoute.DELETE("/", middleware.AdminAuth(), controller.DeleteHistoryLogs)
 		logRoute.GET("/stat", middleware.AdminAuth(), controller.GetLogsStat)
+		logRoute.GET("/margin", middleware.AdminAuth(), controller.GetMarginReport)
+		logRoute.GET("/usage", middleware.AdminAuth(), controller.GetUsageAnalytics)
+		logRoute.POST("/usage/backfill", middleware.RootAuth(), controller.BackfillUsageAnalytics)
+		logRoute.GET("/self/usage", middleware.UserAuth(), controller.GetUserUsageAnalytics)
 		logRoute.GET("/self/stat", middleware.UserAuth(), controller.GetLogsSelfStat)
 		logRoute.GET("/channel_affinity_usage_cache", middleware.AdminAuth(), controller.GetChannelAffinityUsageCacheStats)
 		logRoute.GET("/search", middleware.AdminAuth(), controller.SearchAllLogs)
@@ -322,7 +358,26 @@ func SetApiRouter(router *gin.Engine) {
 		taskRoute := apiRouter.Group("/task")
 		{
 			taskRoute.GET("/self", middleware.UserAuth(), controller.GetUserTask)
+			taskRoute.POST("/self/:task_id/cancel", middleware.UserAuth(), controller.CancelSelfTask)
 			taskRoute.GET("/", middleware.AdminAuth(), controller.GetAllTask)
+			taskRoute.GET("/webhook/self", middleware.UserAuth(), controller.GetSelfTaskWebhookDeliveries)
+			taskRoute.POST("/webhook/self/:id/retry", middleware.UserAuth(), controller.RetrySelfTaskWebhookDelivery)
+			taskRoute.GET("/webhook", middleware.AdminAuth(), controller.GetAllTaskWebhookDeliveries)
+			// 上游任务回调，URL 中的 token 即鉴权
+			taskRoute.POST("/callback/:platform/:task_id/:token", controller.TaskUpstreamCallback)
+		}
+
+		mediaRoute := apiRouter.Group("/media")
+		{
+			// 签名地址自带鉴权，供 <img>/<video> 等无法携带凭证的场景使用
+			mediaRoute.GET("/:id", controller.GetSignedMedia)
+			mediaRoute.GET("/self", middleware.UserAuth(), controller.GetSelfMediaObjects)
+			mediaRoute.DELETE("/self/:id", middleware.UserAuth(), controller.DeleteSelfMediaObject)
+			mediaRoute.GET("/", middleware.AdminAuth(), controller.GetAllMediaObjects)
+			mediaRoute.DELETE("/:id", middleware.AdminAuth(), controller.DeleteMediaObject)
+			mediaRoute.GET("/policy/:user_id", middleware.AdminAuth(), controller.GetMediaUserPolicy)
+			mediaRoute.PUT("/policy/:user_id", middleware.AdminAuth(), controller.UpdateMediaUserPolicy)
+			mediaRoute.DELETE("/policy/:user_id", middleware.AdminAuth(), controller.DeleteMediaUserPolicy)
 		}
 
 		vendorRoute := apiRouter.Group("/vendors")
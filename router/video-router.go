@@ -14,6 +14,8 @@ func SetVideoRouter(router *gin.Engine) {
 	videoProxyRouter.Use(middleware.TokenOrUserAuth())
 	{
 		videoProxyRouter.GET("/videos/:task_id/content", controller.VideoProxy)
+		videoProxyRouter.DELETE("/video/generations/:task_id", controller.RelayVideoCancel)
+		videoProxyRouter.POST("/videos/:task_id/cancel", controller.RelayVideoCancel)
 	}
 
 	videoV1Router := router.Group("/v1")
@@ -0,0 +1,328 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	QueuePositionHeader = "X-Queue-Position"
+	QueueWaitHeader     = "X-Queue-Wait-Ms"
+
+	// admissionPollInterval 除并发名额释放外的定时检查间隔，用于上游限流恢复、渠道重新启用等情况
+	admissionPollInterval = 500 * time.Millisecond
+)
+
+// admissionWaiter 一个排队中的请求，admit 在队列锁内调用，成功时请求离开队列
+type admissionWaiter struct {
+	userId   int
+	class    string
+	admit    func() bool
+	ready    chan struct{}
+	admitted bool
+}
+
+type admissionUserQueue struct {
+	userId  int
+	waiters []*admissionWaiter
+}
+
+// admissionClassQueue 同一优先级类别内按用户轮转放行，避免单个用户占满队列
+type admissionClassQueue struct {
+	name     string
+	priority int
+	users    []*admissionUserQueue
+	cursor   int
+	size     int
+}
+
+type admissionQueue struct {
+	mu      sync.Mutex
+	classes []*admissionClassQueue // 放行时按优先级排序
+	size    int
+	wake    chan struct{}
+	running bool
+}
+
+// 队列与渠道并发计数一样只保存在本实例内存中：多实例部署时每个实例各自排队、各自按渠道并发上限放行，
+// 渠道的实际并发上限为各实例之和，需要全局限制时应按实例数折算渠道并发设置
+var admissionQueues sync.Map // group/model -> *admissionQueue
+
+// admissionQueueKey 按分组与模型划分队列：不同分组可用的渠道不同，共用队列会让一个分组的请求阻塞另一个分组
+func admissionQueueKey(info *relaycommon.RelayInfo) string {
+	return info.UsingGroup + "/" + info.OriginModelName
+}
+
+func getAdmissionQueue(info *relaycommon.RelayInfo) *admissionQueue {
+	queue, _ := admissionQueues.LoadOrStore(admissionQueueKey(info), &admissionQueue{wake: make(chan struct{}, 1)})
+	return queue.(*admissionQueue)
+}
+
+// AdmissionQueueApplies 准入队列是否对本次请求生效，渠道测试不排队
+func AdmissionQueueApplies(info *relaycommon.RelayInfo) bool {
+	if info == nil || info.IsChannelTest {
+		return false
+	}
+	return operation_setting.GetAdmissionQueueSetting().Applies(info.OriginModelName)
+}
+
+// HasAdmissionWaiters 同一分组与模型的队列中已有请求等待时，新请求也需要排队，不能直接抢占释放的名额
+func HasAdmissionWaiters(info *relaycommon.RelayInfo) bool {
+	value, ok := admissionQueues.Load(admissionQueueKey(info))
+	if !ok {
+		return false
+	}
+	queue := value.(*admissionQueue)
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	return queue.size > 0
+}
+
+// WaitForAdmission 在分组与模型对应的队列中等待，直到 tryAdmit 成功、超过最长等待时间或客户端断开。
+// tryAdmit 在队列锁内调用，只应做渠道选择与并发名额占用这类快速操作。
+// 排队位置与累计等待时间通过响应头返回
+func WaitForAdmission(c *gin.Context, info *relaycommon.RelayInfo, tryAdmit func() bool) *types.NewAPIError {
+	setting := operation_setting.GetAdmissionQueueSetting()
+	class := setting.GetClass(info.UsingGroup, info.UserGroup)
+	start := time.Now()
+	if value, ok := common.GetContextKey(c, constant.ContextKeyAdmissionStart); ok {
+		start = value.(time.Time)
+	} else {
+		common.SetContextKey(c, constant.ContextKeyAdmissionStart, start)
+	}
+	maxWait := setting.GetMaxWait(class)
+	remaining := maxWait - time.Since(start)
+	if remaining <= 0 {
+		return admissionTimeoutError(c, info, start, maxWait)
+	}
+
+	queue := getAdmissionQueue(info)
+	waiter := &admissionWaiter{
+		userId: info.UserId,
+		class:  class.Name,
+		admit:  tryAdmit,
+		ready:  make(chan struct{}),
+	}
+	position, err := queue.enqueue(waiter, class, setting)
+	if err != nil {
+		setAdmissionHeaders(c, 0, start)
+		c.Header("Retry-After", "1")
+		return types.NewErrorWithStatusCode(fmt.Errorf("model %s: %w", info.OriginModelName, err), types.ErrorCodeAdmissionQueueFull, http.StatusTooManyRequests, types.ErrOptionWithSkipRetry())
+	}
+	c.Header(QueuePositionHeader, strconv.Itoa(position))
+
+	timer := time.NewTimer(remaining)
+	defer timer.Stop()
+	select {
+	case <-waiter.ready:
+	case <-timer.C:
+	case <-c.Request.Context().Done():
+	}
+	if !queue.leave(waiter) {
+		if c.Request.Context().Err() != nil {
+			return types.NewErrorWithStatusCode(errors.New("client disconnected while queued"), types.ErrorCodeAdmissionTimeout, http.StatusServiceUnavailable, types.ErrOptionWithSkipRetry())
+		}
+		return admissionTimeoutError(c, info, start, maxWait)
+	}
+	setAdmissionHeaders(c, position, start)
+	return nil
+}
+
+func setAdmissionHeaders(c *gin.Context, position int, start time.Time) {
+	if position > 0 {
+		c.Header(QueuePositionHeader, strconv.Itoa(position))
+	}
+	c.Header(QueueWaitHeader, strconv.FormatInt(time.Since(start).Milliseconds(), 10))
+}
+
+func admissionTimeoutError(c *gin.Context, info *relaycommon.RelayInfo, start time.Time, maxWait time.Duration) *types.NewAPIError {
+	setAdmissionHeaders(c, 0, start)
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(admissionPollInterval.Seconds()))))
+	return types.NewErrorWithStatusCode(fmt.Errorf("no capacity available for model %s within %s", info.OriginModelName, maxWait), types.ErrorCodeAdmissionTimeout, http.StatusServiceUnavailable, types.ErrOptionWithSkipRetry())
+}
+
+// enqueue 检查队列深度后加入队列，返回入队时的排队位置（从 1 开始）
+func (q *admissionQueue) enqueue(waiter *admissionWaiter, class operation_setting.AdmissionPriorityClass, setting *operation_setting.AdmissionQueueSetting) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.size >= setting.GetMaxDepth() {
+		return 0, errors.New("admission queue is full")
+	}
+	classQueue := q.getClass(class)
+	if class.MaxDepth > 0 && classQueue.size >= class.MaxDepth {
+		return 0, fmt.Errorf("admission queue for class %s is full", class.Name)
+	}
+	var userQueue *admissionUserQueue
+	for _, user := range classQueue.users {
+		if user.userId == waiter.userId {
+			userQueue = user
+			break
+		}
+	}
+	if userQueue != nil && setting.MaxPerUser > 0 && len(userQueue.waiters) >= setting.MaxPerUser {
+		return 0, errors.New("too many queued requests for this user")
+	}
+	if userQueue == nil {
+		userQueue = &admissionUserQueue{userId: waiter.userId}
+		// 新用户插在轮转位置之前，即排在本轮的最后
+		classQueue.users = slices.Insert(classQueue.users, classQueue.cursor, userQueue)
+		classQueue.cursor = (classQueue.cursor + 1) % len(classQueue.users)
+	}
+	userQueue.waiters = append(userQueue.waiters, waiter)
+	classQueue.size++
+	q.size++
+	position := slices.Index(q.serviceOrder(), waiter) + 1
+	if !q.running {
+		q.running = true
+		go q.run()
+	} else {
+		select {
+		case q.wake <- struct{}{}:
+		default:
+		}
+	}
+	return position, nil
+}
+
+func (q *admissionQueue) getClass(class operation_setting.AdmissionPriorityClass) *admissionClassQueue {
+	for _, classQueue := range q.classes {
+		if classQueue.name == class.Name {
+			classQueue.priority = class.Priority
+			return classQueue
+		}
+	}
+	classQueue := &admissionClassQueue{name: class.Name, priority: class.Priority}
+	q.classes = append(q.classes, classQueue)
+	return classQueue
+}
+
+// serviceOrder 按放行顺序列出排队中的请求：优先级从高到低，同一类别内从轮转位置开始每个用户依次取一个
+func (q *admissionQueue) serviceOrder() []*admissionWaiter {
+	classes := slices.Clone(q.classes)
+	slices.SortStableFunc(classes, func(a, b *admissionClassQueue) int {
+		return b.priority - a.priority
+	})
+	order := make([]*admissionWaiter, 0, q.size)
+	for _, class := range classes {
+		for depth := 0; ; depth++ {
+			added := false
+			for i := range class.users {
+				user := class.users[(class.cursor+i)%len(class.users)]
+				if depth < len(user.waiters) {
+					order = append(order, user.waiters[depth])
+					added = true
+				}
+			}
+			if !added {
+				break
+			}
+		}
+	}
+	return order
+}
+
+// remove 将请求移出队列；admitted 为 true 时轮转位置移到该用户之后
+func (q *admissionQueue) remove(waiter *admissionWaiter, admitted bool) {
+	for _, class := range q.classes {
+		if class.name != waiter.class {
+			continue
+		}
+		for _, user := range class.users {
+			if user.userId != waiter.userId {
+				continue
+			}
+			index := slices.Index(user.waiters, waiter)
+			if index < 0 {
+				return
+			}
+			user.waiters = slices.Delete(user.waiters, index, index+1)
+			class.size--
+			q.size--
+			if len(user.waiters) == 0 {
+				q.removeUser(class, user, admitted)
+			} else if admitted {
+				class.cursor = (slices.Index(class.users, user) + 1) % len(class.users)
+			}
+			return
+		}
+	}
+}
+
+func (q *admissionQueue) removeUser(class *admissionClassQueue, user *admissionUserQueue, admitted bool) {
+	index := slices.Index(class.users, user)
+	if index < 0 {
+		return
+	}
+	class.users = slices.Delete(class.users, index, index+1)
+	if len(class.users) == 0 {
+		class.cursor = 0
+		return
+	}
+	if admitted {
+		// 被放行用户之后的用户前移到该位置，下一轮从它开始
+		class.cursor = index
+	} else if index < class.cursor {
+		class.cursor--
+	}
+	class.cursor %= len(class.users)
+}
+
+// leave 等待结束时调用，返回请求是否已被放行
+func (q *admissionQueue) leave(waiter *admissionWaiter) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if waiter.admitted {
+		return true
+	}
+	q.remove(waiter, false)
+	return false
+}
+
+// dispatch 按放行顺序依次尝试，某个请求无法获得名额时继续尝试后面的请求（它们可能使用不同的渠道）
+func (q *admissionQueue) dispatch() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, waiter := range q.serviceOrder() {
+		if waiter.admit() {
+			waiter.admitted = true
+			q.remove(waiter, true)
+			close(waiter.ready)
+		}
+	}
+}
+
+func (q *admissionQueue) run() {
+	ticker := time.NewTicker(admissionPollInterval)
+	defer ticker.Stop()
+	for {
+		freed := model.ChannelSlotFreed()
+		q.dispatch()
+		q.mu.Lock()
+		if q.size == 0 {
+			q.running = false
+			q.mu.Unlock()
+			return
+		}
+		q.mu.Unlock()
+		select {
+		case <-freed:
+		case <-q.wake:
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newAdmissionTestContext() (*gin.Context, *httptest.ResponseRecorder) {
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	return c, rec
+}
+
+func useAdmissionSetting(t *testing.T, setting operation_setting.AdmissionQueueSetting) {
+	saved := *operation_setting.GetAdmissionQueueSetting()
+	*operation_setting.GetAdmissionQueueSetting() = setting
+	t.Cleanup(func() { *operation_setting.GetAdmissionQueueSetting() = saved })
+}
+
+func TestAdmissionQueueOrder(t *testing.T) {
+	setting := &operation_setting.AdmissionQueueSetting{
+		MaxDepth: 10,
+		Classes:  []operation_setting.AdmissionPriorityClass{{Name: "paid", Groups: []string{"vip"}, Priority: 10}},
+	}
+	queue := &admissionQueue{wake: make(chan struct{}, 1), running: true}
+	var capacity atomic.Int32
+	newWaiter := func(userId int, group string) *admissionWaiter {
+		return &admissionWaiter{
+			userId: userId,
+			class:  setting.GetClass(group).Name,
+			admit:  func() bool { return capacity.Add(-1) >= 0 },
+			ready:  make(chan struct{}),
+		}
+	}
+	enqueue := func(waiter *admissionWaiter, group string) int {
+		position, err := queue.enqueue(waiter, setting.GetClass(group), setting)
+		require.NoError(t, err)
+		return position
+	}
+
+	a1, a2, a3 := newWaiter(1, "default"), newWaiter(1, "default"), newWaiter(1, "default")
+	b1 := newWaiter(2, "default")
+	vip := newWaiter(3, "vip")
+	assert.Equal(t, 1, enqueue(a1, "default"))
+	assert.Equal(t, 2, enqueue(a2, "default"))
+	assert.Equal(t, 3, enqueue(a3, "default"))
+	// 同一类别内按用户轮转，新用户排在已有用户的下一个请求之前
+	assert.Equal(t, 2, enqueue(b1, "default"))
+	// 高优先级类别排在最前
+	assert.Equal(t, 1, enqueue(vip, "vip"))
+	assert.Equal(t, []*admissionWaiter{vip, a1, b1, a2, a3}, queue.serviceOrder())
+
+	capacity.Store(2)
+	queue.dispatch()
+	assert.True(t, vip.admitted)
+	assert.True(t, a1.admitted)
+	assert.False(t, b1.admitted)
+	// 放行用户 1 后轮到用户 2
+	assert.Equal(t, []*admissionWaiter{b1, a2, a3}, queue.serviceOrder())
+
+	queue.leave(a2)
+	assert.Equal(t, []*admissionWaiter{b1, a3}, queue.serviceOrder())
+
+	setting.MaxPerUser = 1
+	_, err := queue.enqueue(newWaiter(1, "default"), setting.GetClass("default"), setting)
+	assert.Error(t, err)
+	setting.MaxDepth = 2
+	_, err = queue.enqueue(newWaiter(4, "default"), setting.GetClass("default"), setting)
+	assert.Error(t, err)
+}
+
+func TestWaitForAdmission(t *testing.T) {
+	useAdmissionSetting(t, operation_setting.AdmissionQueueSetting{Enabled: true, MaxWaitMs: 5000, MaxDepth: 10})
+	modelName := "admission-test-model"
+	info := &relaycommon.RelayInfo{OriginModelName: modelName, UserId: 1, UsingGroup: "default"}
+	t.Cleanup(func() { admissionQueues.Delete(admissionQueueKey(info)) })
+
+	c, rec := newAdmissionTestContext()
+	var open atomic.Bool
+	done := make(chan *types.NewAPIError)
+	go func() {
+		done <- WaitForAdmission(c, info, open.Load)
+	}()
+	assert.Eventually(t, func() bool { return HasAdmissionWaiters(info) }, time.Second, 10*time.Millisecond)
+	// 其他分组的同名模型使用独立的队列
+	assert.False(t, HasAdmissionWaiters(&relaycommon.RelayInfo{OriginModelName: modelName, UsingGroup: "vip"}))
+	open.Store(true)
+	require.Nil(t, <-done)
+	assert.Equal(t, "1", rec.Header().Get(QueuePositionHeader))
+	assert.NotEmpty(t, rec.Header().Get(QueueWaitHeader))
+	assert.False(t, HasAdmissionWaiters(info))
+}
+
+func TestWaitForAdmissionTimeout(t *testing.T) {
+	useAdmissionSetting(t, operation_setting.AdmissionQueueSetting{
+		Enabled:   true,
+		MaxWaitMs: 5000,
+		MaxDepth:  10,
+		Classes:   []operation_setting.AdmissionPriorityClass{{Name: "free", Groups: []string{"default"}, MaxWaitMs: 50}},
+	})
+	modelName := "admission-timeout-test-model"
+	info := &relaycommon.RelayInfo{OriginModelName: modelName, UserId: 1, UsingGroup: "default"}
+	t.Cleanup(func() { admissionQueues.Delete(admissionQueueKey(info)) })
+
+	c, rec := newAdmissionTestContext()
+	apiErr := WaitForAdmission(c, info, func() bool { return false })
+	require.NotNil(t, apiErr)
+	assert.Equal(t, types.ErrorCodeAdmissionTimeout, apiErr.GetErrorCode())
+	assert.Equal(t, http.StatusServiceUnavailable, apiErr.StatusCode)
+	assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+	assert.False(t, HasAdmissionWaiters(info))
+
+	// 累计等待时间从首次入队开始计算，超时后再次排队立即失败
+	apiErr = WaitForAdmission(c, info, func() bool { return true })
+	require.NotNil(t, apiErr)
+	assert.Equal(t, types.ErrorCodeAdmissionTimeout, apiErr.GetErrorCode())
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	AuditActionOptionUpdate      = "option.update"
+	AuditActionChannelCreate     = "channel.create"
+	AuditActionChannelUpdate     = "channel.update"
+	AuditActionChannelDelete     = "channel.delete"
+	AuditActionChannelTagEdit    = "channel.tag_edit"
+	AuditActionChannelTagEnable  = "channel.tag_enable"
+	AuditActionChannelTagDisable = "channel.tag_disable"
+	AuditActionUserCreate        = "user.create"
+	AuditActionUserUpdate        = "user.update"
+	AuditActionUserDelete        = "user.delete"
+	AuditActionUserManage        = "user.manage"
+	AuditActionRedemptionCreate  = "redemption.create"
+	AuditActionSubscriptionBind  = "subscription.bind"
+	AuditActionConfigApply       = "config.apply"
+	AuditActionConfigRollback    = "config.rollback"
+)
+
+const (
+	AuditTargetOption       = "option"
+	AuditTargetChannel      = "channel"
+	AuditTargetChannelTag   = "channel_tag"
+	AuditTargetUser         = "user"
+	AuditTargetRedemption   = "redemption"
+	AuditTargetSubscription = "subscription"
+	AuditTargetConfig       = "config"
+)
+
+const auditMaskedValue = "******"
+
+var auditSensitiveSuffixes = []string{"key", "secret", "token", "password", "credential", "credentials"}
+
+// AuditChange 记录单个字段的变更前后值
+type AuditChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// isSensitiveFieldName 判断字段是否需要脱敏，规则与 GetOptions 隐藏敏感配置保持一致
+func isSensitiveFieldName(name string) bool {
+	lower := strings.ToLower(strings.TrimSpace(name))
+	for _, suffix := range auditSensitiveSuffixes {
+		if lower == suffix || strings.HasSuffix(lower, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func maskAuditValue(name string, value any) any {
+	if isSensitiveFieldName(name) {
+		if value == nil || value == "" {
+			return value
+		}
+		return auditMaskedValue
+	}
+	if nested, ok := value.(map[string]any); ok {
+		masked := make(map[string]any, len(nested))
+		for k, v := range nested {
+			masked[k] = maskAuditValue(k, v)
+		}
+		return masked
+	}
+	return value
+}
+
+// toAuditMap 将任意结构体/映射转换为扁平的字段映射，非对象值以 "value" 字段表示
+func toAuditMap(v any) map[string]any {
+	if v == nil {
+		return map[string]any{}
+	}
+	if m, ok := v.(map[string]any); ok {
+		return m
+	}
+	data, err := common.Marshal(v)
+	if err != nil {
+		return map[string]any{"value": fmt.Sprintf("%v", v)}
+	}
+	result := make(map[string]any)
+	if err := common.Unmarshal(data, &result); err != nil {
+		var raw any
+		_ = common.Unmarshal(data, &raw)
+		return map[string]any{"value": raw}
+	}
+	return result
+}
+
+// BuildAuditDiff 比较 before/after，返回发生变化的字段，敏感字段会被脱敏
+func BuildAuditDiff(before any, after any) map[string]AuditChange {
+	beforeMap := toAuditMap(before)
+	afterMap := toAuditMap(after)
+	diff := make(map[string]AuditChange)
+	for k, bv := range beforeMap {
+		av, ok := afterMap[k]
+		if ok && reflect.DeepEqual(bv, av) {
+			continue
+		}
+		change := AuditChange{Before: maskAuditValue(k, bv)}
+		if ok {
+			change.After = maskAuditValue(k, av)
+		}
+		// 敏感字段脱敏后无法区分，标记为已修改
+		if isSensitiveFieldName(k) && ok && change.Before == change.After {
+			change.After = auditMaskedValue + " (changed)"
+		}
+		diff[k] = change
+	}
+	for k, av := range afterMap {
+		if _, ok := beforeMap[k]; ok {
+			continue
+		}
+		diff[k] = AuditChange{After: maskAuditValue(k, av)}
+	}
+	return diff
+}
+
+// RecordAudit 记录一次管理操作，before/after 可以为 nil（创建/删除）。
+// 审计写入失败不会影响业务请求，只记录系统日志。
+func RecordAudit(c *gin.Context, action string, targetType string, targetId any, before any, after any) {
+	diffStr := "{}"
+	if diff := BuildAuditDiff(before, after); len(diff) > 0 {
+		if data, err := common.Marshal(diff); err == nil {
+			diffStr = string(data)
+		}
+	}
+	entry := &model.AuditLog{
+		ActorId:    c.GetInt("id"),
+		ActorName:  c.GetString("username"),
+		ActorRole:  c.GetInt("role"),
+		Ip:         c.ClientIP(),
+		Action:     action,
+		TargetType: targetType,
+		TargetId:   fmt.Sprintf("%v", targetId),
+		Diff:       diffStr,
+		RequestId:  c.GetString(common.RequestIdKey),
+	}
+	if err := model.InsertAuditLog(entry); err != nil {
+		common.SysError(fmt.Sprintf("failed to record audit log (action=%s, target=%s:%v): %s", action, targetType, targetId, err.Error()))
+	}
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildAuditDiffMasksSecrets(t *testing.T) {
+	t.Parallel()
+
+	before := map[string]any{"name": "old", "key": "sk-old", "weight": 1, "setting": map[string]any{"api_key": "a"}}
+	after := map[string]any{"name": "new", "key": "sk-new", "weight": 1, "setting": map[string]any{"api_key": "b"}}
+
+	diff := BuildAuditDiff(before, after)
+
+	require.NotContains(t, diff, "weight")
+	require.Equal(t, AuditChange{Before: "old", After: "new"}, diff["name"])
+	require.Equal(t, auditMaskedValue, diff["key"].Before)
+	require.Equal(t, auditMaskedValue+" (changed)", diff["key"].After)
+	require.Equal(t, map[string]any{"api_key": auditMaskedValue}, diff["setting"].Before)
+}
+
+func TestBuildAuditDiffCreateAndDelete(t *testing.T) {
+	t.Parallel()
+
+	type target struct {
+		Name         string `json:"name"`
+		SMTPToken    string `json:"SMTPToken"`
+		MaxTokens    int    `json:"max_tokens"`
+		ClientSecret string `json:"client_secret"`
+	}
+	created := BuildAuditDiff(nil, target{Name: "a", SMTPToken: "t", MaxTokens: 10, ClientSecret: "s"})
+	require.Equal(t, "a", created["name"].After)
+	require.Equal(t, auditMaskedValue, created["SMTPToken"].After)
+	require.Equal(t, auditMaskedValue, created["client_secret"].After)
+	require.EqualValues(t, 10, created["max_tokens"].After)
+
+	deleted := BuildAuditDiff(map[string]any{"name": "a"}, nil)
+	require.Equal(t, AuditChange{Before: "a"}, deleted["name"])
+}
@@ -78,10 +78,24 @@ func (s *BillingSession) Settle(actualQuota int) error {
 
 // Refund 退还所有预扣费，幂等安全，异步执行。
 func (s *BillingSession) Refund(c *gin.Context) {
+	if refund := s.prepareRefund(c); refund != nil {
+		gopool.Go(refund)
+	}
+}
+
+// RefundNow 同步退还所有预扣费，用于随后需要按新额度重新预扣的场景。
+func (s *BillingSession) RefundNow(c *gin.Context) {
+	if refund := s.prepareRefund(c); refund != nil {
+		refund()
+	}
+}
+
+// prepareRefund 标记会话已退款并返回退款操作，无需退款时返回 nil
+func (s *BillingSession) prepareRefund(c *gin.Context) func() {
 	s.mu.Lock()
 	if s.settled || s.refunded || !s.needsRefundLocked() {
 		s.mu.Unlock()
-		return
+		return nil
 	}
 	s.refunded = true
 	s.mu.Unlock()
@@ -99,7 +113,7 @@ func (s *BillingSession) Refund(c *gin.Context) {
 	tokenConsumed := s.tokenConsumed
 	funding := s.funding
 
-	gopool.Go(func() {
+	return func() {
 		// 1) 退还资金来源
 		if err := funding.Refund(); err != nil {
 			common.SysLog("error refunding billing source: " + err.Error())
@@ -110,7 +124,7 @@ func (s *BillingSession) Refund(c *gin.Context) {
 				common.SysLog("error refunding token quota: " + err.Error())
 			}
 		}
-	})
+	}
 }
 
 // NeedsRefund 返回是否存在需要退还的预扣状态。
@@ -251,6 +265,14 @@ func (s *BillingSession) syncRelayInfo() {
 // NewBillingSession 工厂 — 根据计费偏好创建会话并处理回退
 // ---------------------------------------------------------------------------
 
+// subscriptionRequestId 订阅预扣记录按请求 ID 幂等，降级模型重新预扣时使用新的记录
+func subscriptionRequestId(relayInfo *relaycommon.RelayInfo) string {
+	if relayInfo.BillingAttempt > 0 {
+		return fmt.Sprintf("%s-%d", relayInfo.RequestId, relayInfo.BillingAttempt)
+	}
+	return relayInfo.RequestId
+}
+
 // NewBillingSession 根据用户计费偏好创建 BillingSession，处理 subscription_first / wallet_first 的回退。
 func NewBillingSession(c *gin.Context, relayInfo *relaycommon.RelayInfo, preConsumedQuota int) (*BillingSession, *types.NewAPIError) {
 	if relayInfo == nil {
@@ -297,7 +319,7 @@ func NewBillingSession(c *gin.Context, relayInfo *relaycommon.RelayInfo, preCons
 		session := &BillingSession{
 			relayInfo: relayInfo,
 			funding: &SubscriptionFunding{
-				requestId: relayInfo.RequestId,
+				requestId: subscriptionRequestId(relayInfo),
 				userId:    relayInfo.UserId,
 				modelName: relayInfo.OriginModelName,
 				amount:    subConsume,
@@ -31,7 +31,7 @@ func DisableChannel(channelError types.ChannelError, reason string) {
 	if success {
 		subject := fmt.Sprintf("通道「%s」（#%d）已被禁用", channelError.ChannelName, channelError.ChannelId)
 		content := fmt.Sprintf("通道「%s」（#%d）已被禁用，原因：%s", channelError.ChannelName, channelError.ChannelId, reason)
-		NotifyRootUser(formatNotifyType(channelError.ChannelId, common.ChannelStatusAutoDisabled), subject, content)
+		NotifyRootUserEvent(dto.NotifyEventChannelDisabled, formatNotifyType(channelError.ChannelId, common.ChannelStatusAutoDisabled), subject, content)
 	}
 }
 
@@ -40,7 +40,7 @@ func EnableChannel(channelId int, usingKey string, channelName string) {
 	if success {
 		subject := fmt.Sprintf("通道「%s」（#%d）已被启用", channelName, channelId)
 		content := fmt.Sprintf("通道「%s」（#%d）已被启用", channelName, channelId)
-		NotifyRootUser(formatNotifyType(channelId, common.ChannelStatusEnabled), subject, content)
+		NotifyRootUserEvent(dto.NotifyEventChannelRecovered, formatNotifyType(channelId, common.ChannelStatusEnabled), subject, content)
 	}
 }
 
@@ -57,7 +57,9 @@ func ShouldDisableChannel(channelType int, err *types.NewAPIError) bool {
 	if types.IsSkipRetryError(err) {
 		return false
 	}
-	if operation_setting.ShouldDisableByStatusCode(err.StatusCode) {
+	// 429 只冷却当前 key，不计入渠道自动禁用；额度耗尽等明确的错误类型仍按下面的规则禁用
+	rateLimited := err.StatusCode == http.StatusTooManyRequests && operation_setting.GetChannelRateLimitSetting().CooldownEnabled
+	if operation_setting.ShouldDisableByStatusCode(err.StatusCode) && !rateLimited {
 		return true
 	}
 	//if err.StatusCode == http.StatusUnauthorized {
@@ -96,6 +98,10 @@ func ShouldDisableChannel(channelType int, err *types.NewAPIError) bool {
 		return true
 	}
 
+	if rateLimited {
+		return false
+	}
+
 	lowerMessage := strings.ToLower(err.Error())
 	search, _ := AcSearch(lowerMessage, operation_setting.AutomaticDisableKeywords, true)
 	return search
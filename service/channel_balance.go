@@ -0,0 +1,239 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/QuantumNous/new-api/types"
+)
+
+// BalanceFetcher 查询上游账户余额，新的服务商实现该接口并通过 RegisterBalanceFetcher 注册即可
+type BalanceFetcher interface {
+	FetchBalance(channel *model.Channel) (float64, error)
+}
+
+// BalanceFetcherFunc 允许直接使用函数作为 BalanceFetcher
+type BalanceFetcherFunc func(channel *model.Channel) (float64, error)
+
+func (f BalanceFetcherFunc) FetchBalance(channel *model.Channel) (float64, error) {
+	return f(channel)
+}
+
+var (
+	balanceFetchers     = make(map[int]BalanceFetcher)
+	balanceFetchersLock sync.RWMutex
+
+	// 各渠道上次低余额告警时间，只在执行余额更新的节点上使用
+	channelBalanceAlertTimes sync.Map
+)
+
+// RegisterBalanceFetcher 为渠道类型注册余额查询实现，重复注册时覆盖
+func RegisterBalanceFetcher(channelType int, fetcher BalanceFetcher) {
+	balanceFetchersLock.Lock()
+	defer balanceFetchersLock.Unlock()
+	balanceFetchers[channelType] = fetcher
+}
+
+func GetBalanceFetcher(channelType int) (BalanceFetcher, bool) {
+	balanceFetchersLock.RLock()
+	defer balanceFetchersLock.RUnlock()
+	fetcher, ok := balanceFetchers[channelType]
+	return fetcher, ok
+}
+
+// channelBalancePolicy 渠道设置覆盖全局默认后的阈值
+type channelBalancePolicy struct {
+	alertThreshold float64
+	floor          float64
+	floorAction    string
+}
+
+func getChannelBalancePolicy(settings dto.ChannelOtherSettings) channelBalancePolicy {
+	global := system_setting.GetChannelBalanceSetting()
+	policy := channelBalancePolicy{
+		alertThreshold: global.DefaultAlertThreshold,
+		floor:          global.DefaultFloor,
+		floorAction:    global.FloorAction,
+	}
+	if settings.BalanceAlertThreshold > 0 {
+		policy.alertThreshold = settings.BalanceAlertThreshold
+	}
+	if settings.BalanceFloor > 0 {
+		policy.floor = settings.BalanceFloor
+	}
+	if settings.BalanceFloorAction != "" {
+		policy.floorAction = settings.BalanceFloorAction
+	}
+	return policy
+}
+
+// CheckChannelBalance 在余额更新后调用：记录快照、低余额告警，并在低于下限时降权或禁用渠道。
+// 返回是否调整了优先级；调用方在一批渠道检查完成后调用一次 model.InitChannelCache 刷新缓存
+func CheckChannelBalance(channel *model.Channel, balance float64) bool {
+	if err := model.RecordChannelBalanceSnapshot(channel.Id, balance, channel.UsedQuota); err != nil {
+		common.SysLog(fmt.Sprintf("failed to record balance snapshot: channel_id=%d, error=%v", channel.Id, err))
+	}
+	settings := channel.GetOtherSettings()
+	policy := getChannelBalancePolicy(settings)
+	checkChannelBalanceAlert(channel, balance, policy)
+	return applyChannelBalanceFloor(channel, balance, policy, settings)
+}
+
+func checkChannelBalanceAlert(channel *model.Channel, balance float64, policy channelBalancePolicy) {
+	global := system_setting.GetChannelBalanceSetting()
+	if policy.alertThreshold <= 0 || balance >= policy.alertThreshold {
+		// 余额恢复后重新跌破阈值时立即告警
+		channelBalanceAlertTimes.Delete(channel.Id)
+		return
+	}
+	if !global.AlertEnabled {
+		return
+	}
+	now := time.Now()
+	if last, ok := channelBalanceAlertTimes.Load(channel.Id); ok {
+		if now.Sub(last.(time.Time)) < time.Duration(global.AlertIntervalHours)*time.Hour {
+			return
+		}
+	}
+	channelBalanceAlertTimes.Store(channel.Id, now)
+
+	subject := fmt.Sprintf("通道「%s」（#%d）余额不足", channel.Name, channel.Id)
+	content := fmt.Sprintf("通道「%s」（#%d）当前余额 %.2f，低于告警阈值 %.2f", channel.Name, channel.Id, balance, policy.alertThreshold)
+	if forecast := GetChannelBalanceForecast(channel, balance); forecast != nil && forecast.DaysLeft > 0 {
+		content += fmt.Sprintf("，近 %.0f 小时日均消耗 %.2f，预计 %s", forecast.WindowHours, forecast.BurnPerDay, forecast.Summary)
+	}
+	NotifyRootUserEvent(dto.NotifyEventChannelBalance, fmt.Sprintf("%s_%d", dto.NotifyTypeChannelBalance, channel.Id), subject, content)
+}
+
+func applyChannelBalanceFloor(channel *model.Channel, balance float64, policy channelBalancePolicy, settings dto.ChannelOtherSettings) bool {
+	global := system_setting.GetChannelBalanceSetting()
+	belowFloor := policy.floor > 0 && balance < policy.floor
+
+	if !belowFloor {
+		restoreChannelBalanceFloorDisable(channel, settings)
+		return restoreChannelBalancePriority(channel, settings)
+	}
+
+	reason := fmt.Sprintf("余额 %.2f 低于下限 %.2f", balance, policy.floor)
+	switch policy.floorAction {
+	case system_setting.ChannelBalanceFloorDisable:
+		if channel.Status != common.ChannelStatusEnabled {
+			return false
+		}
+		DisableChannel(*types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, "", channel.GetAutoBan()), reason)
+		if disabled, err := model.GetChannelById(channel.Id, false); err == nil && disabled.Status == common.ChannelStatusAutoDisabled {
+			channel.Status = disabled.Status
+			settings.BalanceFloorDisabled = true
+			channel.SetOtherSettings(settings)
+			if err := model.UpdateChannelBalanceSettings(channel); err != nil {
+				common.SysLog(fmt.Sprintf("failed to mark channel floor disabled: channel_id=%d, error=%v", channel.Id, err))
+			}
+		}
+		return false
+	default:
+		if settings.BalanceOriginalPriority != nil || channel.GetPriority() <= global.DeprioritizedPriority {
+			return false
+		}
+		original := channel.GetPriority()
+		deprioritized := global.DeprioritizedPriority
+		settings.BalanceOriginalPriority = &original
+		settings.BalanceDeprioritizedPriority = &deprioritized
+		channel.SetOtherSettings(settings)
+		if err := model.UpdateChannelBalancePriority(channel, deprioritized); err != nil {
+			common.SysLog(fmt.Sprintf("failed to deprioritize channel: channel_id=%d, error=%v", channel.Id, err))
+			return false
+		}
+		subject := fmt.Sprintf("通道「%s」（#%d）已降低优先级", channel.Name, channel.Id)
+		content := fmt.Sprintf("通道「%s」（#%d）%s，优先级由 %d 调整为 %d，余额恢复后自动还原", channel.Name, channel.Id, reason, original, deprioritized)
+		NotifyRootUserEvent(dto.NotifyEventChannelBalance, fmt.Sprintf("%s_%d_floor", dto.NotifyTypeChannelBalance, channel.Id), subject, content)
+		return true
+	}
+}
+
+// restoreChannelBalancePriority 余额恢复或取消下限后还原降权前的优先级；降权期间优先级被手动修改过时只清除标记
+func restoreChannelBalancePriority(channel *model.Channel, settings dto.ChannelOtherSettings) bool {
+	if settings.BalanceOriginalPriority == nil {
+		return false
+	}
+	priority := *settings.BalanceOriginalPriority
+	manuallyChanged := settings.BalanceDeprioritizedPriority != nil && channel.GetPriority() != *settings.BalanceDeprioritizedPriority
+	settings.BalanceOriginalPriority = nil
+	settings.BalanceDeprioritizedPriority = nil
+	channel.SetOtherSettings(settings)
+	if manuallyChanged {
+		if err := model.UpdateChannelBalanceSettings(channel); err != nil {
+			common.SysLog(fmt.Sprintf("failed to clear channel balance priority: channel_id=%d, error=%v", channel.Id, err))
+		}
+		common.SysLog(fmt.Sprintf("channel #%d balance recovered, priority was changed manually to %d, not restored", channel.Id, channel.GetPriority()))
+		return false
+	}
+	if err := model.UpdateChannelBalancePriority(channel, priority); err != nil {
+		common.SysLog(fmt.Sprintf("failed to restore channel priority: channel_id=%d, error=%v", channel.Id, err))
+		return false
+	}
+	common.SysLog(fmt.Sprintf("channel #%d balance recovered, priority restored to %d", channel.Id, priority))
+	return true
+}
+
+// restoreChannelBalanceFloorDisable 余额恢复后重新启用因低于下限被自动禁用的渠道；期间被手动启用或禁用时只清除标记
+func restoreChannelBalanceFloorDisable(channel *model.Channel, settings dto.ChannelOtherSettings) {
+	if !settings.BalanceFloorDisabled {
+		return
+	}
+	settings.BalanceFloorDisabled = false
+	channel.SetOtherSettings(settings)
+	if err := model.UpdateChannelBalanceSettings(channel); err != nil {
+		common.SysLog(fmt.Sprintf("failed to clear channel floor disabled: channel_id=%d, error=%v", channel.Id, err))
+		return
+	}
+	if channel.Status == common.ChannelStatusAutoDisabled {
+		EnableChannel(channel.Id, "", channel.Name)
+		channel.Status = common.ChannelStatusEnabled
+	}
+}
+
+func channelBalanceForecastWindow() time.Duration {
+	hours := system_setting.GetChannelBalanceSetting().ForecastWindowHours
+	if hours <= 0 {
+		hours = 72
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// GetChannelBalanceForecast 计算单个渠道在指定余额下的耗尽预测
+func GetChannelBalanceForecast(channel *model.Channel, balance float64) *model.ChannelBalanceForecast {
+	c := *channel
+	c.Balance = balance
+	channels := []*model.Channel{&c}
+	if c.BalanceUpdatedTime == 0 {
+		c.BalanceUpdatedTime = common.GetTimestamp()
+	}
+	if err := model.FillChannelBalanceForecasts(channels, channelBalanceForecastWindow()); err != nil {
+		return nil
+	}
+	return c.BalanceForecast
+}
+
+// FillChannelBalanceForecasts 为渠道列表填充余额预测，失败时仅记录日志
+func FillChannelBalanceForecasts(channels []*model.Channel) {
+	if err := model.FillChannelBalanceForecasts(channels, channelBalanceForecastWindow()); err != nil {
+		common.SysLog(fmt.Sprintf("failed to compute channel balance forecasts: %v", err))
+	}
+}
+
+// CleanupChannelBalanceSnapshots 清理过期的余额快照
+func CleanupChannelBalanceSnapshots() {
+	days := system_setting.GetChannelBalanceSetting().SnapshotRetentionDays
+	if days <= 0 {
+		return
+	}
+	cutoff := time.Now().AddDate(0, 0, -days).Unix()
+	if _, err := model.DeleteChannelBalanceSnapshotsBefore(cutoff); err != nil {
+		common.SysLog(fmt.Sprintf("failed to cleanup channel balance snapshots: %v", err))
+	}
+}
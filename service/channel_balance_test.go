@@ -0,0 +1,133 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func seedBalanceChannel(t *testing.T, id int, priority int64, settings string) *model.Channel {
+	t.Helper()
+	ch := &model.Channel{Id: id, Name: "balance_channel", Key: "sk-test", Status: common.ChannelStatusEnabled,
+		Priority: &priority, Group: "default", Models: "gpt-4o", OtherSettings: settings}
+	require.NoError(t, model.DB.Create(ch).Error)
+	require.NoError(t, ch.AddAbilities(nil))
+	t.Cleanup(func() {
+		model.DB.Exec("DELETE FROM abilities")
+		model.DB.Exec("DELETE FROM channel_balance_snapshots")
+	})
+	return ch
+}
+
+func seedRootUser(t *testing.T) {
+	t.Helper()
+	require.NoError(t, model.DB.Create(&model.User{Id: 1, Username: "root", Role: common.RoleRootUser, Status: common.UserStatusEnabled}).Error)
+}
+
+func getChannelPriorities(t *testing.T, id int) (int64, int64) {
+	t.Helper()
+	ch, err := model.GetChannelById(id, true)
+	require.NoError(t, err)
+	var ability model.Ability
+	require.NoError(t, model.DB.Where("channel_id = ?", id).First(&ability).Error)
+	return ch.GetPriority(), *ability.Priority
+}
+
+func TestCheckChannelBalance_DeprioritizeAndRestore(t *testing.T) {
+	truncate(t)
+	seedRootUser(t)
+	ch := seedBalanceChannel(t, 1, 10, `{"balance_floor":5}`)
+
+	assert.True(t, CheckChannelBalance(ch, 3))
+	channelPriority, abilityPriority := getChannelPriorities(t, ch.Id)
+	deprioritized := system_setting.GetChannelBalanceSetting().DeprioritizedPriority
+	assert.Equal(t, deprioritized, channelPriority)
+	assert.Equal(t, deprioritized, abilityPriority)
+
+	reloaded, err := model.GetChannelById(ch.Id, true)
+	require.NoError(t, err)
+	original := reloaded.GetOtherSettings().BalanceOriginalPriority
+	require.NotNil(t, original)
+	assert.Equal(t, int64(10), *original)
+
+	// 仍低于下限时不会覆盖原优先级
+	assert.False(t, CheckChannelBalance(reloaded, 2))
+	reloaded, err = model.GetChannelById(ch.Id, true)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), *reloaded.GetOtherSettings().BalanceOriginalPriority)
+
+	assert.True(t, CheckChannelBalance(reloaded, 20))
+	channelPriority, abilityPriority = getChannelPriorities(t, ch.Id)
+	assert.Equal(t, int64(10), channelPriority)
+	assert.Equal(t, int64(10), abilityPriority)
+	reloaded, err = model.GetChannelById(ch.Id, true)
+	require.NoError(t, err)
+	assert.Nil(t, reloaded.GetOtherSettings().BalanceOriginalPriority)
+}
+
+func TestCheckChannelBalance_FloorDisable(t *testing.T) {
+	truncate(t)
+	seedRootUser(t)
+	ch := seedBalanceChannel(t, 1, 0, `{"balance_floor":5,"balance_floor_action":"disable"}`)
+
+	CheckChannelBalance(ch, 1)
+	reloaded, err := model.GetChannelById(ch.Id, true)
+	require.NoError(t, err)
+	assert.Equal(t, common.ChannelStatusAutoDisabled, reloaded.Status)
+	assert.True(t, reloaded.GetOtherSettings().BalanceFloorDisabled)
+
+	// 余额恢复后自动启用
+	CheckChannelBalance(reloaded, 20)
+	reloaded, err = model.GetChannelById(ch.Id, true)
+	require.NoError(t, err)
+	assert.Equal(t, common.ChannelStatusEnabled, reloaded.Status)
+	assert.False(t, reloaded.GetOtherSettings().BalanceFloorDisabled)
+}
+
+func TestCheckChannelBalance_KeepManualPriority(t *testing.T) {
+	truncate(t)
+	seedRootUser(t)
+	ch := seedBalanceChannel(t, 1, 10, `{"balance_floor":5}`)
+	require.True(t, CheckChannelBalance(ch, 3))
+
+	// 降权期间手动调整优先级
+	reloaded, err := model.GetChannelById(ch.Id, true)
+	require.NoError(t, err)
+	require.NoError(t, model.UpdateChannelBalancePriority(reloaded, 7))
+
+	reloaded, err = model.GetChannelById(ch.Id, true)
+	require.NoError(t, err)
+	assert.False(t, CheckChannelBalance(reloaded, 20))
+	channelPriority, abilityPriority := getChannelPriorities(t, ch.Id)
+	assert.Equal(t, int64(7), channelPriority)
+	assert.Equal(t, int64(7), abilityPriority)
+	reloaded, err = model.GetChannelById(ch.Id, true)
+	require.NoError(t, err)
+	assert.Nil(t, reloaded.GetOtherSettings().BalanceOriginalPriority)
+	assert.Nil(t, reloaded.GetOtherSettings().BalanceDeprioritizedPriority)
+}
+
+func TestFillChannelBalanceForecasts(t *testing.T) {
+	truncate(t)
+	ch := seedBalanceChannel(t, 1, 0, "")
+	// 两天前已用额度为 0，现在已用 20 美元，日均消耗 10 美元
+	require.NoError(t, model.DB.Create(&model.ChannelBalanceSnapshot{
+		ChannelId: ch.Id,
+		Balance:   50,
+		CreatedAt: time.Now().Add(-48 * time.Hour).Unix(),
+	}).Error)
+	ch.Balance = 30
+	ch.BalanceUpdatedTime = time.Now().Unix()
+	ch.UsedQuota = int64(20 * common.QuotaPerUnit)
+
+	FillChannelBalanceForecasts([]*model.Channel{ch})
+	require.NotNil(t, ch.BalanceForecast)
+	assert.InDelta(t, 10, ch.BalanceForecast.BurnPerDay, 0.01)
+	assert.InDelta(t, 3, ch.BalanceForecast.DaysLeft, 0.01)
+	assert.Equal(t, "runs out in ~3 days", ch.BalanceForecast.Summary)
+}
@@ -30,10 +30,7 @@ var (
 
 func StartCodexCredentialAutoRefreshTask() {
 	codexCredentialRefreshOnce.Do(func() {
-		if !common.IsMasterNode {
-			return
-		}
-
+		model.RegisterLeaseJob(model.JobCodexCredentialRefresh)
 		gopool.Go(func() {
 			logger.LogInfo(context.Background(), fmt.Sprintf("codex credential auto-refresh task started: tick=%s threshold=%s", codexCredentialRefreshTickInterval, codexCredentialRefreshThreshold))
 
@@ -49,19 +46,22 @@ func StartCodexCredentialAutoRefreshTask() {
 }
 
 func runCodexCredentialAutoRefreshOnce() {
+	ctx, ok := model.JobLeaderContext(model.JobCodexCredentialRefresh)
+	if !ok {
+		return
+	}
 	if !codexCredentialRefreshRunning.CompareAndSwap(false, true) {
 		return
 	}
 	defer codexCredentialRefreshRunning.Store(false)
 
-	ctx := context.Background()
 	now := time.Now()
 
 	var refreshed int
 	var scanned int
 
 	offset := 0
-	for {
+	for ctx.Err() == nil {
 		var channels []*model.Channel
 		err := model.DB.
 			Select("id", "name", "key", "status", "channel_info").
@@ -0,0 +1,673 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// ConfigBundleSchemaVersion 导出包格式版本，不兼容变更时递增
+const ConfigBundleSchemaVersion = 1
+
+const (
+	ConfigKeyModeOmit      = "omit"
+	ConfigKeyModeEncrypted = "encrypted"
+	// configKeyModePlain 仅用于内部比较，不对外导出明文
+	configKeyModePlain = "plain"
+)
+
+const (
+	ConfigSectionOptions           = "options"
+	ConfigSectionChannels          = "channels"
+	ConfigSectionModels            = "models"
+	ConfigSectionVendors           = "vendors"
+	ConfigSectionPrefillGroups     = "prefill_groups"
+	ConfigSectionSubscriptionPlans = "subscription_plans"
+)
+
+const (
+	ConfigChangeCreate = "create"
+	ConfigChangeUpdate = "update"
+	ConfigChangeDelete = "delete"
+)
+
+// ConfigBundle 完整网关配置导出包。
+// 倍率、分组等均保存在 options 中；渠道按名称 + 类型匹配（同一环境内改名的渠道按 id 匹配），
+// 模型/供应商/预填组按名称匹配，订阅套餐按 id 匹配。
+type ConfigBundle struct {
+	SchemaVersion     int                      `json:"schema_version"`
+	SystemVersion     string                   `json:"system_version"`
+	ExportedAt        int64                    `json:"exported_at"`
+	KeyMode           string                   `json:"key_mode"`
+	Options           map[string]string        `json:"options"`
+	Channels          []model.Channel          `json:"channels"`
+	Models            []ConfigBundleModel      `json:"models"`
+	Vendors           []model.Vendor           `json:"vendors"`
+	PrefillGroups     []model.PrefillGroup     `json:"prefill_groups"`
+	SubscriptionPlans []model.SubscriptionPlan `json:"subscription_plans"`
+}
+
+// ConfigBundleModel 模型元数据，使用供应商名称代替跨环境不稳定的 vendor_id
+type ConfigBundleModel struct {
+	model.Model
+	VendorName string `json:"vendor_name,omitempty"`
+}
+
+type ConfigChange struct {
+	Section string                 `json:"section"`
+	Op      string                 `json:"op"`
+	Key     string                 `json:"key"`
+	Changes map[string]AuditChange `json:"changes,omitempty"`
+
+	// channel 已解析的目标渠道（密钥已解密，更新时 id 为匹配到的当前渠道），仅渠道变更使用
+	channel *model.Channel
+}
+
+type ConfigBundleDiff struct {
+	Changes []ConfigChange `json:"changes"`
+	Summary map[string]int `json:"summary"`
+}
+
+func (d *ConfigBundleDiff) add(section string, op string, key string, before any, after any) {
+	change := ConfigChange{Section: section, Op: op, Key: key}
+	if op != ConfigChangeDelete {
+		change.Changes = BuildAuditDiff(before, after)
+	}
+	d.Changes = append(d.Changes, change)
+	d.Summary[section+"."+op]++
+}
+
+func (d *ConfigBundleDiff) changesOf(section string) []ConfigChange {
+	result := make([]ConfigChange, 0)
+	for _, change := range d.Changes {
+		if change.Section == section {
+			result = append(result, change)
+		}
+	}
+	return result
+}
+
+func protectSecret(value string, keyMode string) (string, bool, error) {
+	switch keyMode {
+	case configKeyModePlain:
+		return value, true, nil
+	case ConfigKeyModeEncrypted:
+		if value == "" {
+			return "", true, nil
+		}
+		encrypted, err := common.EncryptWithSecret(value)
+		return encrypted, true, err
+	default:
+		return "", false, nil
+	}
+}
+
+func revealSecret(value string) (string, error) {
+	if !strings.HasPrefix(value, common.EncryptedValuePrefix) {
+		return value, nil
+	}
+	return common.DecryptWithSecret(value)
+}
+
+// normalizeBundleChannel 清除运行时字段，只保留可声明的配置
+func normalizeBundleChannel(channel *model.Channel) {
+	channel.CreatedTime = 0
+	channel.TestTime = 0
+	channel.ResponseTime = 0
+	channel.Balance = 0
+	channel.BalanceUpdatedTime = 0
+	channel.UsedQuota = 0
+	channel.ChannelInfo.MultiKeyPollingIndex = 0
+	channel.Keys = nil
+}
+
+// BuildConfigBundle 从数据库与内存配置构建导出包
+func BuildConfigBundle(keyMode string) (*ConfigBundle, error) {
+	if keyMode != ConfigKeyModeEncrypted && keyMode != configKeyModePlain {
+		keyMode = ConfigKeyModeOmit
+	}
+	bundle := &ConfigBundle{
+		SchemaVersion: ConfigBundleSchemaVersion,
+		SystemVersion: common.Version,
+		ExportedAt:    common.GetTimestamp(),
+		KeyMode:       keyMode,
+		Options:       make(map[string]string),
+	}
+	if keyMode == configKeyModePlain {
+		bundle.KeyMode = ""
+	}
+
+	common.OptionMapRWMutex.RLock()
+	options := make(map[string]string, len(common.OptionMap))
+	for k, v := range common.OptionMap {
+		options[k] = v
+	}
+	common.OptionMapRWMutex.RUnlock()
+	for k, v := range options {
+		if !isSensitiveFieldName(k) {
+			bundle.Options[k] = v
+			continue
+		}
+		protected, keep, err := protectSecret(v, keyMode)
+		if err != nil {
+			return nil, err
+		}
+		if keep {
+			bundle.Options[k] = protected
+		}
+	}
+
+	channels, err := model.GetAllChannels(0, 0, true, true)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(channels, func(i, j int) bool { return channels[i].Id < channels[j].Id })
+	for _, channel := range channels {
+		item := *channel
+		normalizeBundleChannel(&item)
+		if item.Key, _, err = protectSecret(item.Key, keyMode); err != nil {
+			return nil, err
+		}
+		bundle.Channels = append(bundle.Channels, item)
+	}
+
+	var vendors []model.Vendor
+	if err := model.DB.Order("name asc").Find(&vendors).Error; err != nil {
+		return nil, err
+	}
+	vendorNames := make(map[int]string, len(vendors))
+	for i := range vendors {
+		vendorNames[vendors[i].Id] = vendors[i].Name
+		vendors[i].Id = 0
+		vendors[i].CreatedTime = 0
+		vendors[i].UpdatedTime = 0
+	}
+	bundle.Vendors = vendors
+
+	var models []model.Model
+	if err := model.DB.Order("model_name asc").Find(&models).Error; err != nil {
+		return nil, err
+	}
+	for _, m := range models {
+		item := ConfigBundleModel{Model: m, VendorName: vendorNames[m.VendorID]}
+		item.Id = 0
+		item.VendorID = 0
+		item.CreatedTime = 0
+		item.UpdatedTime = 0
+		bundle.Models = append(bundle.Models, item)
+	}
+
+	var groups []model.PrefillGroup
+	if err := model.DB.Order("name asc").Find(&groups).Error; err != nil {
+		return nil, err
+	}
+	for i := range groups {
+		groups[i].Id = 0
+		groups[i].CreatedTime = 0
+		groups[i].UpdatedTime = 0
+	}
+	bundle.PrefillGroups = groups
+
+	var plans []model.SubscriptionPlan
+	if err := model.DB.Order("id asc").Find(&plans).Error; err != nil {
+		return nil, err
+	}
+	for i := range plans {
+		// 套餐按标题跨环境匹配，id 由目标环境分配
+		plans[i].Id = 0
+		plans[i].CreatedAt = 0
+		plans[i].UpdatedAt = 0
+	}
+	bundle.SubscriptionPlans = plans
+	return bundle, nil
+}
+
+// MarshalConfigBundle 以 json 或 yaml 编码导出包，yaml 由 json 结构转换以保持字段名一致
+func MarshalConfigBundle(bundle *ConfigBundle, format string) ([]byte, error) {
+	data, err := common.Marshal(bundle)
+	if err != nil {
+		return nil, err
+	}
+	if format != "yaml" {
+		return data, nil
+	}
+	var generic any
+	if err := common.Unmarshal(data, &generic); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(generic)
+}
+
+// ParseConfigBundle 解析 json 或 yaml 格式的导出包
+func ParseConfigBundle(data []byte) (*ConfigBundle, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, errors.New("empty config bundle")
+	}
+	if trimmed[0] != '{' {
+		var generic any
+		if err := yaml.Unmarshal(trimmed, &generic); err != nil {
+			return nil, fmt.Errorf("invalid yaml: %w", err)
+		}
+		converted, err := common.Marshal(generic)
+		if err != nil {
+			return nil, err
+		}
+		trimmed = converted
+	}
+	var bundle ConfigBundle
+	if err := common.Unmarshal(trimmed, &bundle); err != nil {
+		return nil, fmt.Errorf("invalid config bundle: %w", err)
+	}
+	if bundle.SchemaVersion == 0 || bundle.SchemaVersion > ConfigBundleSchemaVersion {
+		return nil, fmt.Errorf("unsupported config bundle schema version: %d", bundle.SchemaVersion)
+	}
+	return &bundle, nil
+}
+
+// DiffConfigBundle 计算将目标导出包应用到当前系统会产生的变更。
+// 目标包中缺失的密钥/敏感配置视为保持不变；prune 为 true 时目标包中不存在的条目会被删除（订阅套餐仅禁用）。
+func DiffConfigBundle(target *ConfigBundle, prune bool) (*ConfigBundleDiff, error) {
+	current, err := BuildConfigBundle(configKeyModePlain)
+	if err != nil {
+		return nil, err
+	}
+	diff := &ConfigBundleDiff{Changes: make([]ConfigChange, 0), Summary: make(map[string]int)}
+
+	keys := make([]string, 0, len(target.Options))
+	for k := range target.Options {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		value, err := revealSecret(target.Options[k])
+		if err != nil {
+			return nil, fmt.Errorf("option %s: %w", k, err)
+		}
+		old, ok := current.Options[k]
+		if !ok {
+			diff.add(ConfigSectionOptions, ConfigChangeCreate, k, nil, map[string]any{k: value})
+		} else if old != value {
+			diff.add(ConfigSectionOptions, ConfigChangeUpdate, k, map[string]any{k: old}, map[string]any{k: value})
+		}
+	}
+
+	matches := matchBundleChannels(current.Channels, target.Channels)
+	currentChannels := make(map[int]model.Channel, len(current.Channels))
+	for _, ch := range current.Channels {
+		currentChannels[ch.Id] = ch
+	}
+	seenChannels := make(map[int]bool)
+	for i, ch := range target.Channels {
+		item := ch
+		normalizeBundleChannel(&item)
+		if item.Key, err = revealSecret(item.Key); err != nil {
+			return nil, fmt.Errorf("channel %d: %w", ch.Id, err)
+		}
+		currentId, ok := matches[i]
+		if !ok {
+			item.Id = 0
+			diff.add(ConfigSectionChannels, ConfigChangeCreate, fmt.Sprintf("%d:%s", ch.Id, item.Name), nil, item)
+			diff.Changes[len(diff.Changes)-1].channel = &item
+			continue
+		}
+		seenChannels[currentId] = true
+		old := currentChannels[currentId]
+		item.Id = currentId
+		if item.Key == "" {
+			item.Key = old.Key
+		}
+		if changes := BuildAuditDiff(old, item); len(changes) > 0 {
+			diff.add(ConfigSectionChannels, ConfigChangeUpdate, fmt.Sprintf("%d:%s", currentId, item.Name), old, item)
+			diff.Changes[len(diff.Changes)-1].channel = &item
+		}
+	}
+	if prune {
+		for _, ch := range current.Channels {
+			if !seenChannels[ch.Id] {
+				deleted := ch
+				diff.add(ConfigSectionChannels, ConfigChangeDelete, fmt.Sprintf("%d:%s", ch.Id, ch.Name), ch, nil)
+				diff.Changes[len(diff.Changes)-1].channel = &deleted
+			}
+		}
+	}
+
+	diffNamed(diff, ConfigSectionVendors, prune, current.Vendors, target.Vendors, func(v model.Vendor) string { return v.Name })
+	diffNamed(diff, ConfigSectionModels, prune, current.Models, target.Models, func(m ConfigBundleModel) string { return m.ModelName })
+	diffNamed(diff, ConfigSectionPrefillGroups, prune, current.PrefillGroups, target.PrefillGroups, func(g model.PrefillGroup) string { return g.Name })
+	diffNamed(diff, ConfigSectionSubscriptionPlans, prune, current.SubscriptionPlans, target.SubscriptionPlans, func(p model.SubscriptionPlan) string { return p.Title })
+	return diff, nil
+}
+
+func bundleChannelKey(channel model.Channel) string {
+	return fmt.Sprintf("%d/%s", channel.Type, channel.Name)
+}
+
+// matchBundleChannels 为目标包中的每个渠道找到当前系统中对应的渠道，返回目标下标到当前渠道 id 的映射。
+// 依次尝试：id 相同且名称、类型一致；名称 + 类型一致（跨环境导入、重复应用或回滚后重建的渠道 id 会变化）；
+// id 相同（同一环境内修改了名称或类型）。每个当前渠道最多匹配一次，未匹配的目标渠道需要新建
+func matchBundleChannels(current []model.Channel, target []model.Channel) map[int]int {
+	byId := make(map[int]model.Channel, len(current))
+	byKey := make(map[string][]int, len(current))
+	for _, ch := range current {
+		byId[ch.Id] = ch
+		byKey[bundleChannelKey(ch)] = append(byKey[bundleChannelKey(ch)], ch.Id)
+	}
+	matches := make(map[int]int, len(target))
+	used := make(map[int]bool, len(current))
+	match := func(i int, id int) {
+		matches[i] = id
+		used[id] = true
+	}
+	for i, ch := range target {
+		if old, ok := byId[ch.Id]; ok && bundleChannelKey(old) == bundleChannelKey(ch) {
+			match(i, ch.Id)
+		}
+	}
+	for i, ch := range target {
+		if _, ok := matches[i]; ok {
+			continue
+		}
+		for _, id := range byKey[bundleChannelKey(ch)] {
+			if !used[id] {
+				match(i, id)
+				break
+			}
+		}
+	}
+	for i, ch := range target {
+		if _, ok := matches[i]; ok {
+			continue
+		}
+		if _, ok := byId[ch.Id]; ok && !used[ch.Id] {
+			match(i, ch.Id)
+		}
+	}
+	return matches
+}
+
+func diffNamed[T any](diff *ConfigBundleDiff, section string, prune bool, current []T, target []T, keyOf func(T) string) {
+	currentByKey := make(map[string]T, len(current))
+	for _, item := range current {
+		currentByKey[keyOf(item)] = item
+	}
+	seen := make(map[string]bool, len(target))
+	for _, item := range target {
+		key := keyOf(item)
+		seen[key] = true
+		old, ok := currentByKey[key]
+		if !ok {
+			diff.add(section, ConfigChangeCreate, key, nil, item)
+			continue
+		}
+		if changes := BuildAuditDiff(old, item); len(changes) > 0 {
+			diff.add(section, ConfigChangeUpdate, key, old, item)
+		}
+	}
+	if !prune {
+		return
+	}
+	for _, item := range current {
+		if key := keyOf(item); !seen[key] {
+			diff.add(section, ConfigChangeDelete, key, item, nil)
+		}
+	}
+}
+
+// ApplyConfigBundle 将导出包应用到当前系统，返回实际执行的变更。
+// 所有数据库写入在同一事务中完成，任一步失败都不会留下部分应用的配置；事务提交后再刷新内存配置与缓存
+func ApplyConfigBundle(target *ConfigBundle, prune bool) (*ConfigBundleDiff, error) {
+	diff, err := DiffConfigBundle(target, prune)
+	if err != nil {
+		return nil, err
+	}
+	if len(diff.Changes) == 0 {
+		return diff, nil
+	}
+
+	options := make(map[string]string)
+	for _, change := range diff.changesOf(ConfigSectionOptions) {
+		options[change.Key], _ = revealSecret(target.Options[change.Key])
+	}
+	var planIds []int
+	err = model.DB.Transaction(func(tx *gorm.DB) error {
+		for key, value := range options {
+			if err := model.SaveOptionWithTx(tx, key, value); err != nil {
+				return fmt.Errorf("option %s: %w", key, err)
+			}
+		}
+		if err := applyVendors(tx, target, diff); err != nil {
+			return err
+		}
+		if err := applyModels(tx, target, diff); err != nil {
+			return err
+		}
+		if err := applyPrefillGroups(tx, target, diff); err != nil {
+			return err
+		}
+		ids, err := applySubscriptionPlans(tx, target, diff)
+		if err != nil {
+			return err
+		}
+		planIds = ids
+		return applyChannels(tx, diff)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for key, value := range options {
+		if err := model.ApplyOptionValue(key, value); err != nil {
+			return nil, fmt.Errorf("option %s: %w", key, err)
+		}
+	}
+	for _, planId := range planIds {
+		model.InvalidateSubscriptionPlanCache(planId)
+	}
+	model.InitChannelCache()
+	ResetProxyClientCache()
+	model.RefreshPricing()
+	return diff, nil
+}
+
+func applyVendors(tx *gorm.DB, target *ConfigBundle, diff *ConfigBundleDiff) error {
+	byName := make(map[string]model.Vendor, len(target.Vendors))
+	for _, v := range target.Vendors {
+		byName[v.Name] = v
+	}
+	now := common.GetTimestamp()
+	for _, change := range diff.changesOf(ConfigSectionVendors) {
+		var existing model.Vendor
+		if err := tx.Where("name = ?", change.Key).Limit(1).Find(&existing).Error; err != nil {
+			return fmt.Errorf("vendor %s: %w", change.Key, err)
+		}
+		v := byName[change.Key]
+		var err error
+		switch change.Op {
+		case ConfigChangeCreate:
+			v.Id = 0
+			v.CreatedTime, v.UpdatedTime = now, now
+			err = tx.Create(&v).Error
+		case ConfigChangeUpdate:
+			v.Id = existing.Id
+			v.CreatedTime, v.UpdatedTime = existing.CreatedTime, now
+			err = tx.Select("*").Omit("deleted_at").Save(&v).Error
+		case ConfigChangeDelete:
+			err = tx.Delete(&existing).Error
+		}
+		if err != nil {
+			return fmt.Errorf("vendor %s: %w", change.Key, err)
+		}
+	}
+	return nil
+}
+
+func applyModels(tx *gorm.DB, target *ConfigBundle, diff *ConfigBundleDiff) error {
+	var vendors []model.Vendor
+	if err := tx.Find(&vendors).Error; err != nil {
+		return err
+	}
+	vendorIds := make(map[string]int, len(vendors))
+	for _, v := range vendors {
+		vendorIds[v.Name] = v.Id
+	}
+	byName := make(map[string]ConfigBundleModel, len(target.Models))
+	for _, m := range target.Models {
+		byName[m.ModelName] = m
+	}
+	now := common.GetTimestamp()
+	for _, change := range diff.changesOf(ConfigSectionModels) {
+		var existing model.Model
+		if err := tx.Where("model_name = ?", change.Key).Limit(1).Find(&existing).Error; err != nil {
+			return fmt.Errorf("model %s: %w", change.Key, err)
+		}
+		item := byName[change.Key].Model
+		item.VendorID = vendorIds[byName[change.Key].VendorName]
+		var err error
+		switch change.Op {
+		case ConfigChangeCreate:
+			item.Id = 0
+			item.CreatedTime, item.UpdatedTime = now, now
+			if err = tx.Create(&item).Error; err == nil {
+				// Create 会对零值的 status / sync_official 使用默认值，创建后写回原值
+				err = tx.Model(&model.Model{}).Where("id = ?", item.Id).Updates(map[string]interface{}{
+					"status":        byName[change.Key].Status,
+					"sync_official": byName[change.Key].SyncOfficial,
+				}).Error
+			}
+		case ConfigChangeUpdate:
+			item.Id = existing.Id
+			item.CreatedTime, item.UpdatedTime = existing.CreatedTime, now
+			err = tx.Select("*").Omit("deleted_at").Save(&item).Error
+		case ConfigChangeDelete:
+			err = tx.Delete(&existing).Error
+		}
+		if err != nil {
+			return fmt.Errorf("model %s: %w", change.Key, err)
+		}
+	}
+	return nil
+}
+
+func applyPrefillGroups(tx *gorm.DB, target *ConfigBundle, diff *ConfigBundleDiff) error {
+	byName := make(map[string]model.PrefillGroup, len(target.PrefillGroups))
+	for _, g := range target.PrefillGroups {
+		byName[g.Name] = g
+	}
+	now := common.GetTimestamp()
+	for _, change := range diff.changesOf(ConfigSectionPrefillGroups) {
+		var existing model.PrefillGroup
+		if err := tx.Where("name = ?", change.Key).Limit(1).Find(&existing).Error; err != nil {
+			return fmt.Errorf("prefill group %s: %w", change.Key, err)
+		}
+		g := byName[change.Key]
+		var err error
+		switch change.Op {
+		case ConfigChangeCreate:
+			g.Id = 0
+			g.CreatedTime, g.UpdatedTime = now, now
+			err = tx.Create(&g).Error
+		case ConfigChangeUpdate:
+			g.Id = existing.Id
+			g.CreatedTime, g.UpdatedTime = existing.CreatedTime, now
+			err = tx.Select("*").Omit("deleted_at").Save(&g).Error
+		case ConfigChangeDelete:
+			err = tx.Delete(&model.PrefillGroup{}, existing.Id).Error
+		}
+		if err != nil {
+			return fmt.Errorf("prefill group %s: %w", change.Key, err)
+		}
+	}
+	return nil
+}
+
+// applySubscriptionPlans 按标题匹配当前套餐，返回变更的套餐 id 供事务提交后刷新缓存
+func applySubscriptionPlans(tx *gorm.DB, target *ConfigBundle, diff *ConfigBundleDiff) ([]int, error) {
+	byTitle := make(map[string]model.SubscriptionPlan, len(target.SubscriptionPlans))
+	for _, p := range target.SubscriptionPlans {
+		byTitle[p.Title] = p
+	}
+	var planIds []int
+	for _, change := range diff.changesOf(ConfigSectionSubscriptionPlans) {
+		var existing model.SubscriptionPlan
+		if err := tx.Where("title = ?", change.Key).Order("id asc").Limit(1).Find(&existing).Error; err != nil {
+			return nil, fmt.Errorf("subscription plan %s: %w", change.Key, err)
+		}
+		p := byTitle[change.Key]
+		var err error
+		switch change.Op {
+		case ConfigChangeCreate:
+			p.Id = 0
+			if err = tx.Create(&p).Error; err == nil {
+				// Create 会对零值的 enabled 使用默认值，创建后写回原值
+				err = tx.Model(&model.SubscriptionPlan{}).Where("id = ?", p.Id).Update("enabled", byTitle[change.Key].Enabled).Error
+			}
+		case ConfigChangeUpdate:
+			p.Id = existing.Id
+			err = tx.Select("*").Omit("created_at").Save(&p).Error
+		case ConfigChangeDelete:
+			// 已售出的套餐仍被用户订阅引用，只禁用不删除
+			p.Id = existing.Id
+			err = tx.Model(&model.SubscriptionPlan{}).Where("id = ?", existing.Id).Update("enabled", false).Error
+		}
+		if err != nil {
+			return nil, fmt.Errorf("subscription plan %s: %w", change.Key, err)
+		}
+		planIds = append(planIds, p.Id)
+	}
+	return planIds, nil
+}
+
+// bundleChannelRuntimeColumns 运行时统计字段，不随导出包覆盖
+var bundleChannelRuntimeColumns = []string{"created_time", "test_time", "response_time", "balance", "balance_updated_time", "used_quota"}
+
+// applyChannels 新建的渠道由数据库分配 id，之后按名称 + 类型匹配，重复应用或回滚都不会产生重复渠道。
+// 更新时写入全部可声明字段（包括零值），回滚可以恢复被清空的字段
+func applyChannels(tx *gorm.DB, diff *ConfigBundleDiff) error {
+	toDelete := make([]int, 0)
+	for _, change := range diff.changesOf(ConfigSectionChannels) {
+		ch := *change.channel
+		if ch.ChannelInfo.IsMultiKey {
+			ch.ChannelInfo.MultiKeySize = len(ch.GetKeys())
+		}
+		switch change.Op {
+		case ConfigChangeCreate:
+			ch.Id = 0
+			ch.CreatedTime = common.GetTimestamp()
+			if ch.Key == "" {
+				// 导出包未携带密钥的新渠道无法使用，先手动禁用
+				ch.Status = common.ChannelStatusManuallyDisabled
+			}
+			if err := tx.Create(&ch).Error; err != nil {
+				return fmt.Errorf("channel %s: %w", change.Key, err)
+			}
+			if err := ch.AddAbilities(tx); err != nil {
+				return fmt.Errorf("channel %s: %w", change.Key, err)
+			}
+		case ConfigChangeUpdate:
+			if err := tx.Model(&ch).Select("*").Omit(bundleChannelRuntimeColumns...).Updates(&ch).Error; err != nil {
+				return fmt.Errorf("channel %s: %w", change.Key, err)
+			}
+			if err := ch.UpdateAbilities(tx); err != nil {
+				return fmt.Errorf("channel %s: %w", change.Key, err)
+			}
+		case ConfigChangeDelete:
+			toDelete = append(toDelete, ch.Id)
+		}
+	}
+	if len(toDelete) == 0 {
+		return nil
+	}
+	if err := tx.Where("id in (?)", toDelete).Delete(&model.Channel{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("channel_id in (?)", toDelete).Delete(&model.Ability{}).Error
+}
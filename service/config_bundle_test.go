@@ -0,0 +1,117 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/samber/lo"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigBundleYAMLRoundTrip(t *testing.T) {
+	encrypted, err := common.EncryptWithSecret("sk-secret")
+	require.NoError(t, err)
+
+	bundle := &ConfigBundle{
+		SchemaVersion: ConfigBundleSchemaVersion,
+		KeyMode:       ConfigKeyModeEncrypted,
+		Options:       map[string]string{"GroupRatio": `{"default":1}`, "RegisterEnabled": "true", "SMTPToken": encrypted},
+		Channels:      []model.Channel{{Id: 7, Name: "openai", Key: encrypted, Models: "gpt-4o"}},
+		Models:        []ConfigBundleModel{{Model: model.Model{ModelName: "gpt-4o"}, VendorName: "OpenAI"}},
+	}
+
+	data, err := MarshalConfigBundle(bundle, "yaml")
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "sk-secret")
+
+	parsed, err := ParseConfigBundle(data)
+	require.NoError(t, err)
+	require.Equal(t, "true", parsed.Options["RegisterEnabled"])
+	require.Equal(t, `{"default":1}`, parsed.Options["GroupRatio"])
+	require.Equal(t, 7, parsed.Channels[0].Id)
+	require.Equal(t, "OpenAI", parsed.Models[0].VendorName)
+
+	key, err := revealSecret(parsed.Channels[0].Key)
+	require.NoError(t, err)
+	require.Equal(t, "sk-secret", key)
+}
+
+func TestParseConfigBundleRejectsUnknownSchema(t *testing.T) {
+	_, err := ParseConfigBundle([]byte(`{"schema_version": 99}`))
+	require.Error(t, err)
+	_, err = ParseConfigBundle([]byte("options: {}"))
+	require.Error(t, err)
+}
+
+func TestApplyConfigBundleIsIdempotentAndRollsBack(t *testing.T) {
+	t.Cleanup(func() {
+		model.DB.Exec("DELETE FROM channels")
+		model.DB.Exec("DELETE FROM abilities")
+	})
+	existing := &model.Channel{Type: 1, Name: "primary", Key: "sk-a", Models: "gpt-4o", Group: "default", Status: common.ChannelStatusEnabled, Priority: lo.ToPtr(int64(0))}
+	require.NoError(t, model.DB.Create(existing).Error)
+
+	snapshot, err := BuildConfigBundle(configKeyModePlain)
+	require.NoError(t, err)
+	snapshot.SchemaVersion = ConfigBundleSchemaVersion
+
+	target, err := BuildConfigBundle(configKeyModePlain)
+	require.NoError(t, err)
+	target.Channels[0].Priority = lo.ToPtr(int64(5))
+	target.Channels = append(target.Channels, model.Channel{Id: 9999, Type: 1, Name: "backup", Key: "sk-b", Models: "gpt-4o", Group: "default", Status: common.ChannelStatusEnabled})
+
+	for i := 0; i < 2; i++ {
+		_, err = ApplyConfigBundle(target, false)
+		require.NoError(t, err)
+		var count int64
+		require.NoError(t, model.DB.Model(&model.Channel{}).Where("name = ?", "backup").Count(&count).Error)
+		require.EqualValues(t, 1, count, "re-applying must not duplicate channels")
+	}
+	updated, err := model.GetChannelById(existing.Id, true)
+	require.NoError(t, err)
+	require.EqualValues(t, 5, updated.GetPriority())
+
+	// 回滚到快照：新增的渠道被删除，改为零值的字段也会恢复
+	_, err = ApplyConfigBundle(snapshot, true)
+	require.NoError(t, err)
+	var channels []model.Channel
+	require.NoError(t, model.DB.Find(&channels).Error)
+	require.Len(t, channels, 1)
+	require.Equal(t, existing.Id, channels[0].Id)
+	require.EqualValues(t, 0, channels[0].GetPriority())
+}
+
+func TestApplyConfigBundleMatchesPlansByTitle(t *testing.T) {
+	t.Cleanup(func() {
+		model.DB.Exec("DELETE FROM subscription_plans")
+	})
+	pro := &model.SubscriptionPlan{Title: "Pro", PriceAmount: 10, Enabled: true}
+	basic := &model.SubscriptionPlan{Title: "Basic", PriceAmount: 5, Enabled: true}
+	require.NoError(t, model.DB.Create(pro).Error)
+	require.NoError(t, model.DB.Create(basic).Error)
+
+	target, err := BuildConfigBundle(configKeyModePlain)
+	require.NoError(t, err)
+	// 来自其他环境的包：id 与本地的 Basic 相同，但标题对应 Pro
+	target.SubscriptionPlans = []model.SubscriptionPlan{
+		{Id: basic.Id, Title: "Pro", PriceAmount: 20, Enabled: true},
+		{Title: "Team", PriceAmount: 50, Enabled: false},
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err = ApplyConfigBundle(target, false)
+		require.NoError(t, err)
+	}
+	var plans []model.SubscriptionPlan
+	require.NoError(t, model.DB.Order("id asc").Find(&plans).Error)
+	require.Len(t, plans, 3)
+	require.Equal(t, pro.Id, plans[0].Id)
+	require.EqualValues(t, 20, plans[0].PriceAmount)
+	require.Equal(t, "Basic", plans[1].Title)
+	require.EqualValues(t, 5, plans[1].PriceAmount)
+	require.True(t, plans[1].Enabled)
+	require.Equal(t, "Team", plans[2].Title)
+	require.False(t, plans[2].Enabled)
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	hedgeLatencySampleSize = 200
+	hedgeLatencyMinSamples = 20
+	hedgeBudgetWindow      = time.Minute
+)
+
+// hedgeBudget 按规则统计最近一到两个窗口内命中规则的请求数与对冲数
+type hedgeBudget struct {
+	mu           sync.Mutex
+	windowStart  time.Time
+	requests     int
+	hedges       int
+	prevRequests int
+	prevHedges   int
+}
+
+func (b *hedgeBudget) rotate(now time.Time) {
+	if now.Sub(b.windowStart) < hedgeBudgetWindow {
+		return
+	}
+	if now.Sub(b.windowStart) < 2*hedgeBudgetWindow {
+		b.prevRequests, b.prevHedges = b.requests, b.hedges
+	} else {
+		b.prevRequests, b.prevHedges = 0, 0
+	}
+	b.windowStart = now
+	b.requests, b.hedges = 0, 0
+}
+
+type hedgeLatencySamples struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+var (
+	hedgeBudgets   sync.Map // rule index -> *hedgeBudget
+	hedgeLatencies sync.Map // model -> *hedgeLatencySamples
+)
+
+// IsLostHedgeLeg 返回是否为对冲请求中落败的一方，落败方不结算、不记录消费日志
+func IsLostHedgeLeg(c *gin.Context) bool {
+	return common.GetContextKeyBool(c, constant.ContextKeyHedgeLost)
+}
+
+// GetHedgeRule 返回请求命中的对冲规则，渠道测试不做对冲
+func GetHedgeRule(info *relaycommon.RelayInfo) (*operation_setting.HedgeRule, int, bool) {
+	if info == nil || info.IsChannelTest {
+		return nil, -1, false
+	}
+	return operation_setting.GetHedgeSetting().GetRule(info.OriginModelName, info.UsingGroup)
+}
+
+func getHedgeBudget(ruleIndex int) *hedgeBudget {
+	budget, _ := hedgeBudgets.LoadOrStore(ruleIndex, &hedgeBudget{windowStart: time.Now()})
+	return budget.(*hedgeBudget)
+}
+
+// RecordHedgeEligible 记录一次命中对冲规则的请求，作为对冲预算的分母
+func RecordHedgeEligible(ruleIndex int) {
+	budget := getHedgeBudget(ruleIndex)
+	budget.mu.Lock()
+	defer budget.mu.Unlock()
+	budget.rotate(time.Now())
+	budget.requests++
+}
+
+// TryAcquireHedge 对冲数占命中请求数的比例不超过 maxRate 时占用一次对冲预算
+func TryAcquireHedge(ruleIndex int, maxRate float64) bool {
+	budget := getHedgeBudget(ruleIndex)
+	budget.mu.Lock()
+	defer budget.mu.Unlock()
+	budget.rotate(time.Now())
+	requests := budget.requests + budget.prevRequests
+	hedges := budget.hedges + budget.prevHedges
+	if float64(hedges+1) > maxRate*float64(requests) {
+		return false
+	}
+	budget.hedges++
+	return true
+}
+
+// RecordFirstByteLatency 记录模型的首字节耗时，用于计算 p95 对冲延迟
+func RecordFirstByteLatency(modelName string, latency time.Duration) {
+	value, _ := hedgeLatencies.LoadOrStore(modelName, &hedgeLatencySamples{})
+	samples := value.(*hedgeLatencySamples)
+	samples.mu.Lock()
+	defer samples.mu.Unlock()
+	if len(samples.samples) < hedgeLatencySampleSize {
+		samples.samples = append(samples.samples, latency)
+		return
+	}
+	samples.samples[samples.next] = latency
+	samples.next = (samples.next + 1) % hedgeLatencySampleSize
+}
+
+func firstByteLatencyP95(modelName string) (time.Duration, bool) {
+	value, ok := hedgeLatencies.Load(modelName)
+	if !ok {
+		return 0, false
+	}
+	samples := value.(*hedgeLatencySamples)
+	samples.mu.Lock()
+	sorted := slices.Clone(samples.samples)
+	samples.mu.Unlock()
+	if len(sorted) < hedgeLatencyMinSamples {
+		return 0, false
+	}
+	slices.Sort(sorted)
+	index := int(math.Ceil(float64(len(sorted))*0.95)) - 1
+	return sorted[index], true
+}
+
+// HedgeDelay 返回发出对冲请求前等待首字节的时间
+func HedgeDelay(rule *operation_setting.HedgeRule, modelName string) time.Duration {
+	if rule.UseP95 {
+		if p95, ok := firstByteLatencyP95(modelName); ok {
+			return max(p95, time.Duration(rule.MinDelayMs)*time.Millisecond)
+		}
+	}
+	return time.Duration(rule.FallbackDelayMs()) * time.Millisecond
+}
+
+// EstimateHedgeOverheadCost 估算落败请求的上游成本。落败方在输出首字节前即被取消，只按输入计算
+func EstimateHedgeOverheadCost(info *relaycommon.RelayInfo, otherSettings dto.ChannelOtherSettings) int {
+	if info == nil {
+		return 0
+	}
+	estimate := *info
+	estimate.ChannelMeta = &relaycommon.ChannelMeta{
+		ChannelOtherSettings: otherSettings,
+		UpstreamModelName:    info.OriginModelName,
+	}
+	promptTokens := info.GetEstimatePromptTokens()
+	priceData := info.PriceData
+	var quota float64
+	if priceData.UsePrice {
+		quota = priceData.ModelPrice * common.QuotaPerUnit * priceData.GroupRatioInfo.GroupRatio
+	} else {
+		quota = float64(promptTokens) * priceData.ModelRatio * priceData.GroupRatioInfo.GroupRatio
+	}
+	return CalculateUpstreamCost(&estimate, int(math.Round(quota)), promptTokens, 0, 0)
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type countingSettler struct {
+	settled int
+}
+
+func (s *countingSettler) Settle(actualQuota int) error { s.settled++; return nil }
+func (s *countingSettler) Refund(c *gin.Context)        {}
+func (s *countingSettler) NeedsRefund() bool            { return false }
+func (s *countingSettler) GetPreConsumedQuota() int     { return 0 }
+
+func TestHedgeSettlesOnce(t *testing.T) {
+	truncate(t)
+	seedUser(t, 1, 10000)
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+
+	// 两方共享同一个计费会话，落败方即使拿到用量也不结算
+	billing := &countingSettler{}
+	newLeg := func() (*gin.Context, *relaycommon.RelayInfo) {
+		info := &relaycommon.RelayInfo{UserId: 1, OriginModelName: "gpt-4o", StartTime: time.Now(), Billing: billing,
+			ChannelMeta: &relaycommon.ChannelMeta{}}
+		info.PriceData.ModelRatio = 1
+		info.PriceData.GroupRatioInfo.GroupRatio = 1
+		return c.Copy(), info
+	}
+	winnerCtx, winnerInfo := newLeg()
+	loserCtx, loserInfo := newLeg()
+	common.SetContextKey(loserCtx, constant.ContextKeyHedgeLost, true)
+
+	usage := &dto.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}
+	PostTextConsumeQuota(loserCtx, loserInfo, usage, nil)
+	PostTextConsumeQuota(winnerCtx, winnerInfo, usage, nil)
+
+	assert.Equal(t, 1, billing.settled)
+	var logs int64
+	require.NoError(t, model.LOG_DB.Model(&model.Log{}).Where("user_id = ?", 1).Count(&logs).Error)
+	assert.Equal(t, int64(1), logs)
+}
+
+func TestHedgeBudget(t *testing.T) {
+	ruleIndex := 1001
+	t.Cleanup(func() { hedgeBudgets.Delete(ruleIndex) })
+
+	for i := 0; i < 10; i++ {
+		RecordHedgeEligible(ruleIndex)
+	}
+	assert.True(t, TryAcquireHedge(ruleIndex, 0.2))
+	assert.True(t, TryAcquireHedge(ruleIndex, 0.2))
+	assert.False(t, TryAcquireHedge(ruleIndex, 0.2))
+
+	budget := getHedgeBudget(ruleIndex)
+	budget.windowStart = budget.windowStart.Add(-3 * hedgeBudgetWindow)
+	RecordHedgeEligible(ruleIndex)
+	assert.False(t, TryAcquireHedge(ruleIndex, 0.2))
+}
+
+func TestHedgeDelay(t *testing.T) {
+	modelName := "hedge-delay-test-model"
+	t.Cleanup(func() { hedgeLatencies.Delete(modelName) })
+
+	rule := &operation_setting.HedgeRule{DelayMs: 800, UseP95: true, MinDelayMs: 50}
+	assert.Equal(t, 800*time.Millisecond, HedgeDelay(rule, modelName))
+
+	for i := 1; i <= 100; i++ {
+		RecordFirstByteLatency(modelName, time.Duration(i)*time.Millisecond)
+	}
+	assert.Equal(t, 95*time.Millisecond, HedgeDelay(rule, modelName))
+
+	rule.MinDelayMs = 500
+	assert.Equal(t, 500*time.Millisecond, HedgeDelay(rule, modelName))
+
+	rule.UseP95 = false
+	assert.Equal(t, 800*time.Millisecond, HedgeDelay(rule, modelName))
+}
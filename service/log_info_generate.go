@@ -77,9 +77,48 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 	appendBillingInfo(relayInfo, other)
 	appendParamOverrideInfo(relayInfo, other)
 	appendStreamStatus(relayInfo, other)
+	appendModelFallbackInfo(relayInfo, other)
+	appendModelRouterInfo(relayInfo, other)
+	appendHedgeInfo(relayInfo, other)
 	return other
 }
 
+func appendHedgeInfo(relayInfo *relaycommon.RelayInfo, other map[string]interface{}) {
+	if relayInfo == nil || other == nil || relayInfo.Hedge == nil {
+		return
+	}
+	other["hedge"] = map[string]interface{}{
+		"primary_channel_id": relayInfo.Hedge.PrimaryChannelId,
+		"hedge_channel_id":   relayInfo.Hedge.HedgeChannelId,
+		"hedge_won":          relayInfo.Hedge.HedgeWon,
+		"overhead_cost":      relayInfo.Hedge.OverheadCost,
+	}
+}
+
+func appendModelFallbackInfo(relayInfo *relaycommon.RelayInfo, other map[string]interface{}) {
+	if relayInfo == nil || other == nil {
+		return
+	}
+	if relayInfo.RequestedModelName != "" && relayInfo.RequestedModelName != relayInfo.OriginModelName {
+		// 虚拟路由模型选中的模型不算降级
+		if relayInfo.Router == nil || relayInfo.Router.Model != relayInfo.OriginModelName {
+			other["model_fallback"] = true
+		}
+		other["requested_model"] = relayInfo.RequestedModelName
+	}
+}
+
+func appendModelRouterInfo(relayInfo *relaycommon.RelayInfo, other map[string]interface{}) {
+	if relayInfo == nil || other == nil || relayInfo.Router == nil {
+		return
+	}
+	other["model_router"] = map[string]interface{}{
+		"router_model": relayInfo.Router.RouterModel,
+		"rule":         relayInfo.Router.Rule,
+		"model":        relayInfo.Router.Model,
+	}
+}
+
 func appendParamOverrideInfo(relayInfo *relaycommon.RelayInfo, other map[string]interface{}) {
 	if relayInfo == nil || other == nil || len(relayInfo.ParamOverrideAudit) == 0 {
 		return
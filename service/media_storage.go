@@ -0,0 +1,466 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/mediastore"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	mediaCleanupTickInterval = 10 * time.Minute
+	mediaCleanupBatchSize    = 100
+	mediaPersistTimeout      = 10 * time.Minute
+	// 同步转存图片响应的总耗时上限，超时的图片保留上游原地址
+	mediaImagePersistTimeout = 30 * time.Second
+)
+
+var ErrMediaQuotaExceeded = model.ErrMediaQuotaExceeded
+
+var (
+	mediaStoreLock      sync.Mutex
+	mediaStore          mediastore.Store
+	mediaStoreSignature string
+	mediaCleanupOnce    sync.Once
+)
+
+// MediaStorageEnabled 是否开启生成内容持久化
+func MediaStorageEnabled() bool {
+	return system_setting.GetMediaStorageSetting().Enabled
+}
+
+// GetMediaStore 按当前配置返回存储后端，配置变更后自动重建
+func GetMediaStore() (mediastore.Store, error) {
+	setting := system_setting.GetMediaStorageSetting()
+	signature := strings.Join([]string{
+		setting.Backend, setting.LocalPath, setting.S3Endpoint, setting.S3Region, setting.S3Bucket,
+		setting.S3AccessKeyId, setting.S3Secret, strconv.FormatBool(setting.S3PathStyle),
+	}, "|")
+
+	mediaStoreLock.Lock()
+	defer mediaStoreLock.Unlock()
+	if mediaStore != nil && mediaStoreSignature == signature {
+		return mediaStore, nil
+	}
+	var store mediastore.Store
+	var err error
+	switch setting.Backend {
+	case system_setting.MediaStorageBackendS3:
+		store, err = mediastore.NewS3Store(mediastore.S3Config{
+			Endpoint:        setting.S3Endpoint,
+			Region:          setting.S3Region,
+			Bucket:          setting.S3Bucket,
+			AccessKeyId:     setting.S3AccessKeyId,
+			SecretAccessKey: setting.S3Secret,
+			PathStyle:       setting.S3PathStyle,
+		}, nil)
+	case system_setting.MediaStorageBackendLocal, "":
+		store, err = mediastore.NewLocalStore(setting.LocalPath)
+	default:
+		err = fmt.Errorf("unsupported media storage backend %q", setting.Backend)
+	}
+	if err != nil {
+		return nil, err
+	}
+	mediaStore = store
+	mediaStoreSignature = signature
+	return store, nil
+}
+
+// getUserMediaPolicy 返回用户生效的保留天数与配额（字节，0 表示不限制）
+func getUserMediaPolicy(userId int) (int, int64) {
+	setting := system_setting.GetMediaStorageSetting()
+	retentionDays := setting.DefaultRetentionDays
+	quotaBytes := setting.DefaultUserQuotaMB * 1024 * 1024
+	policy, err := model.GetMediaUserPolicy(userId)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to load media policy for user %d: %s", userId, err.Error()))
+		return retentionDays, quotaBytes
+	}
+	if policy != nil {
+		if policy.RetentionDays != nil {
+			retentionDays = *policy.RetentionDays
+		}
+		if policy.QuotaBytes != nil {
+			quotaBytes = *policy.QuotaBytes
+		}
+	}
+	return retentionDays, quotaBytes
+}
+
+func mediaObjectKey(userId int, contentType string) string {
+	ext := ""
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+			ext = exts[0]
+		}
+	}
+	return fmt.Sprintf("%d/%s/%s%s", userId, time.Now().Format("20060102"), common.GetRandomString(24), ext)
+}
+
+// PersistMedia 保存一份生成内容并记录归属，超出单对象大小或用户配额时返回错误
+func PersistMedia(ctx context.Context, userId int, sourceType string, sourceId string, sourceUrl string, body io.Reader, contentType string) (*model.MediaObject, error) {
+	store, err := GetMediaStore()
+	if err != nil {
+		return nil, err
+	}
+	setting := system_setting.GetMediaStorageSetting()
+
+	// 先落到临时文件，拿到准确大小后再做配额检查与上传
+	tmp, err := os.CreateTemp("", "new-api-media-*")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+	reader := body
+	maxSize := setting.MaxObjectSizeMB * 1024 * 1024
+	if maxSize > 0 {
+		reader = io.LimitReader(body, maxSize+1)
+	}
+	size, err := io.Copy(tmp, reader)
+	if err != nil {
+		return nil, err
+	}
+	if maxSize > 0 && size > maxSize {
+		return nil, fmt.Errorf("media object exceeds %d MB", setting.MaxObjectSizeMB)
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	// 先做一次预检查，明显超额时不必上传；最终以写入记录时的事务检查为准
+	retentionDays, quotaBytes := getUserMediaPolicy(userId)
+	if quotaBytes > 0 {
+		usage, err := model.GetUserMediaUsage(userId)
+		if err != nil {
+			return nil, err
+		}
+		if usage+size > quotaBytes {
+			return nil, ErrMediaQuotaExceeded
+		}
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	key := mediaObjectKey(userId, contentType)
+	if err := store.Put(ctx, key, tmp, size, contentType); err != nil {
+		return nil, err
+	}
+	obj := &model.MediaObject{
+		UserId:      userId,
+		Key:         key,
+		Backend:     store.Name(),
+		SourceType:  sourceType,
+		SourceId:    sourceId,
+		SourceUrl:   sourceUrl,
+		ContentType: contentType,
+		Size:        size,
+		ExpiresAt:   model.MediaExpiresAt(retentionDays),
+	}
+	if err := model.CreateMediaObjectWithinQuota(obj, quotaBytes); err != nil {
+		_ = store.Delete(ctx, key)
+		return nil, err
+	}
+	return obj, nil
+}
+
+// PersistMediaFromURL 下载远程地址（或解析 data URL）并保存
+func PersistMediaFromURL(ctx context.Context, client *http.Client, userId int, sourceType string, sourceId string, rawURL string) (*model.MediaObject, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if strings.HasPrefix(rawURL, "data:") {
+		contentType, data, err := decodeMediaDataURL(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		return PersistMedia(ctx, userId, sourceType, sourceId, "", bytes.NewReader(data), contentType)
+	}
+	fetchSetting := system_setting.GetFetchSetting()
+	if err := common.ValidateURLWithFetchSetting(rawURL, fetchSetting.EnableSSRFProtection, fetchSetting.AllowPrivateIp, fetchSetting.DomainFilterMode, fetchSetting.IpFilterMode, fetchSetting.DomainList, fetchSetting.IpList, fetchSetting.AllowedPorts, fetchSetting.ApplyIPFilterForDomain); err != nil {
+		return nil, fmt.Errorf("request blocked: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		client = GetHttpClient()
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("upstream returned status %d", resp.StatusCode)
+	}
+	return PersistMedia(ctx, userId, sourceType, sourceId, rawURL, resp.Body, resp.Header.Get("Content-Type"))
+}
+
+func decodeMediaDataURL(dataURL string) (string, []byte, error) {
+	header, payload, ok := strings.Cut(dataURL, ",")
+	if !ok || !strings.HasSuffix(header, ";base64") {
+		return "", nil, errors.New("unsupported data url")
+	}
+	contentType := strings.TrimSuffix(strings.TrimPrefix(header, "data:"), ";base64")
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		if data, err = base64.RawStdEncoding.DecodeString(payload); err != nil {
+			return "", nil, err
+		}
+	}
+	return contentType, data, nil
+}
+
+// OpenMediaObject 读取已保存的对象
+func OpenMediaObject(ctx context.Context, obj *model.MediaObject) (io.ReadCloser, error) {
+	store, err := GetMediaStore()
+	if err != nil {
+		return nil, err
+	}
+	if obj.Backend != store.Name() {
+		return nil, fmt.Errorf("media object %d is stored in backend %s", obj.Id, obj.Backend)
+	}
+	return store.Open(ctx, obj.Key)
+}
+
+// FindPersistedMedia 返回某个来源已保存的第一个对象，未开启或不存在时返回 nil
+func FindPersistedMedia(sourceType string, sourceId string) *model.MediaObject {
+	if !MediaStorageEnabled() || sourceId == "" {
+		return nil
+	}
+	objs, err := model.GetMediaObjectsBySource(sourceType, sourceId)
+	if err != nil || len(objs) == 0 {
+		return nil
+	}
+	return objs[0]
+}
+
+// DeleteMediaObject 删除存储中的对象及其记录
+func DeleteMediaObject(ctx context.Context, obj *model.MediaObject) error {
+	store, err := GetMediaStore()
+	if err != nil {
+		return err
+	}
+	if obj.Backend == store.Name() {
+		if err := store.Delete(ctx, obj.Key); err != nil {
+			return err
+		}
+	}
+	return model.DeleteMediaObjectById(obj.Id)
+}
+
+func mediaSignature(id int, expires int64) string {
+	return common.GenerateHMAC(fmt.Sprintf("media:%d:%d", id, expires))
+}
+
+// BuildSignedMediaURL 生成带过期时间的网关访问地址
+func BuildSignedMediaURL(obj *model.MediaObject) string {
+	ttl := system_setting.GetMediaStorageSetting().SignedUrlTTLSeconds
+	if ttl <= 0 {
+		ttl = 3600
+	}
+	expires := time.Now().Unix() + int64(ttl)
+	if obj.ExpiresAt > 0 && obj.ExpiresAt < expires {
+		expires = obj.ExpiresAt
+	}
+	return fmt.Sprintf("%s/api/media/%d?expires=%d&sig=%s", system_setting.ServerAddress, obj.Id, expires, mediaSignature(obj.Id, expires))
+}
+
+// VerifyMediaSignature 校验网关地址签名及有效期
+func VerifyMediaSignature(id int, expires int64, sig string) bool {
+	if expires < time.Now().Unix() {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(sig), []byte(mediaSignature(id, expires))) == 1
+}
+
+// OpenTaskContentFunc 打开异步任务结果内容，由 main 注入（需要渠道鉴权的结果只能在 controller 中解析）
+var OpenTaskContentFunc func(ctx context.Context, task *model.Task) (io.ReadCloser, string, error)
+
+// PersistTaskResultAsync 任务成功后异步保存结果
+func PersistTaskResultAsync(task *model.Task) {
+	setting := system_setting.GetMediaStorageSetting()
+	if !setting.Enabled || !setting.PersistTaskResults || OpenTaskContentFunc == nil {
+		return
+	}
+	taskCopy := *task
+	gopool.Go(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mediaPersistTimeout)
+		defer cancel()
+		if FindPersistedMedia(model.MediaSourceTask, taskCopy.TaskID) != nil {
+			return
+		}
+		body, contentType, err := OpenTaskContentFunc(ctx, &taskCopy)
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("failed to fetch result of task %s for storage: %s", taskCopy.TaskID, err.Error()))
+			return
+		}
+		defer body.Close()
+		if _, err := PersistMedia(ctx, taskCopy.UserId, model.MediaSourceTask, taskCopy.TaskID, taskCopy.GetResultURL(), body, contentType); err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("failed to persist result of task %s: %s", taskCopy.TaskID, err.Error()))
+		}
+	})
+}
+
+// PersistMidjourneyImageAsync Midjourney 任务成功后异步保存图片
+func PersistMidjourneyImageAsync(task *model.Task) {
+	setting := system_setting.GetMediaStorageSetting()
+	if !setting.Enabled || !setting.PersistTaskResults || task.PrivateData.ResultURL == "" {
+		return
+	}
+	userId, mjId, imageUrl, channelId := task.UserId, task.TaskID, task.PrivateData.ResultURL, task.ChannelId
+	gopool.Go(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mediaPersistTimeout)
+		defer cancel()
+		if FindPersistedMedia(model.MediaSourceMidjourney, mjId) != nil {
+			return
+		}
+		client := GetHttpClient()
+		if channel, err := model.CacheGetChannel(channelId); err == nil {
+			if c, err := GetHttpClientWithProxy(channel.GetSetting().Proxy); err == nil {
+				client = c
+			}
+		}
+		if _, err := PersistMediaFromURL(ctx, client, userId, model.MediaSourceMidjourney, mjId, imageUrl); err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("failed to persist midjourney image %s: %s", mjId, err.Error()))
+		}
+	})
+}
+
+// StartMediaCleanupTask 定期删除超过保留期的对象
+func StartMediaCleanupTask() {
+	mediaCleanupOnce.Do(func() {
+		model.RegisterLeaseJob(model.JobMediaCleanup)
+		gopool.Go(func() {
+			ticker := time.NewTicker(mediaCleanupTickInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				runMediaCleanupOnce()
+			}
+		})
+	})
+}
+
+func runMediaCleanupOnce() {
+	if !MediaStorageEnabled() {
+		return
+	}
+	ctx, ok := model.JobLeaderContext(model.JobMediaCleanup)
+	if !ok {
+		return
+	}
+	deleted := 0
+	for ctx.Err() == nil {
+		objs, err := model.GetExpiredMediaObjects(time.Now().Unix(), mediaCleanupBatchSize)
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("media cleanup query failed: %v", err))
+			return
+		}
+		failed := 0
+		for _, obj := range objs {
+			if err := DeleteMediaObject(ctx, obj); err != nil {
+				failed++
+				logger.LogWarn(ctx, fmt.Sprintf("failed to delete media object %d: %v", obj.Id, err))
+				continue
+			}
+			deleted++
+		}
+		// 整批失败时停止，避免存储不可用时空转
+		if len(objs) < mediaCleanupBatchSize || failed == len(objs) {
+			break
+		}
+	}
+	if deleted > 0 {
+		logger.LogInfo(ctx, fmt.Sprintf("media cleanup removed %d expired objects", deleted))
+	}
+}
+
+// PersistImageResponse 将图片接口返回的临时地址转存，并替换为签名网关地址；任一步失败时保留原响应
+func PersistImageResponse(ctx context.Context, info *relaycommon.RelayInfo, body []byte) []byte {
+	setting := system_setting.GetMediaStorageSetting()
+	if !setting.Enabled || !setting.PersistImageResponse || info == nil {
+		return body
+	}
+	var imageResp dto.ImageResponse
+	if err := common.Unmarshal(body, &imageResp); err != nil || len(imageResp.Data) == 0 {
+		return body
+	}
+	client, err := GetHttpClientWithProxy(info.ChannelSetting.Proxy)
+	if err != nil {
+		client = GetHttpClient()
+	}
+	// 多张图片并发转存，整体受超时限制，避免逐张下载拖慢响应
+	persistCtx, cancel := context.WithTimeout(ctx, mediaImagePersistTimeout)
+	defer cancel()
+	urls := make([]string, len(imageResp.Data))
+	var wg sync.WaitGroup
+	for i := range imageResp.Data {
+		if imageResp.Data[i].Url == "" {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, rawURL string) {
+			defer wg.Done()
+			obj, err := PersistMediaFromURL(persistCtx, client, info.UserId, model.MediaSourceImage, info.RequestId, rawURL)
+			if err != nil {
+				logger.LogWarn(ctx, fmt.Sprintf("failed to persist image response: %s", err.Error()))
+				return
+			}
+			urls[i] = BuildSignedMediaURL(obj)
+		}(i, imageResp.Data[i].Url)
+	}
+	wg.Wait()
+	changed := false
+	for i, u := range urls {
+		if u != "" {
+			imageResp.Data[i].Url = u
+			changed = true
+		}
+	}
+	if !changed {
+		return body
+	}
+	// 只替换 data[].url，保留上游返回的其他字段
+	var raw map[string]any
+	if err := common.Unmarshal(body, &raw); err != nil {
+		return body
+	}
+	items, ok := raw["data"].([]any)
+	if !ok || len(items) != len(imageResp.Data) {
+		return body
+	}
+	for i, item := range items {
+		if m, ok := item.(map[string]any); ok && urls[i] != "" {
+			m["url"] = imageResp.Data[i].Url
+		}
+	}
+	newBody, err := common.Marshal(raw)
+	if err != nil {
+		return body
+	}
+	return newBody
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPersistMediaRespectsUserQuota(t *testing.T) {
+	setting := system_setting.GetMediaStorageSetting()
+	saved := *setting
+	t.Cleanup(func() {
+		*setting = saved
+		model.DB.Exec("DELETE FROM media_objects")
+		model.DB.Exec("DELETE FROM media_user_policies")
+	})
+	setting.Enabled = true
+	setting.Backend = system_setting.MediaStorageBackendLocal
+	setting.LocalPath = t.TempDir()
+	setting.DefaultRetentionDays = 7
+
+	quota := int64(8)
+	require.NoError(t, model.UpsertMediaUserPolicy(&model.MediaUserPolicy{UserId: 1, QuotaBytes: &quota}))
+
+	ctx := context.Background()
+	obj, err := PersistMedia(ctx, 1, model.MediaSourceTask, "task_1", "", strings.NewReader("hello"), "video/mp4")
+	require.NoError(t, err)
+	require.EqualValues(t, 5, obj.Size)
+	require.Greater(t, obj.ExpiresAt, time.Now().Unix())
+
+	body, err := OpenMediaObject(ctx, obj)
+	require.NoError(t, err)
+	data, _ := io.ReadAll(body)
+	body.Close()
+	require.Equal(t, "hello", string(data))
+
+	_, err = PersistMedia(ctx, 1, model.MediaSourceTask, "task_2", "", strings.NewReader("world"), "video/mp4")
+	require.ErrorIs(t, err, ErrMediaQuotaExceeded)
+
+	require.NotNil(t, FindPersistedMedia(model.MediaSourceTask, "task_1"))
+	require.Nil(t, FindPersistedMedia(model.MediaSourceTask, "task_2"))
+}
+
+func TestMediaSignature(t *testing.T) {
+	expires := time.Now().Add(time.Minute).Unix()
+	sig := mediaSignature(42, expires)
+	require.True(t, VerifyMediaSignature(42, expires, sig))
+	require.False(t, VerifyMediaSignature(43, expires, sig))
+	require.False(t, VerifyMediaSignature(42, expires+1, sig))
+
+	past := time.Now().Add(-time.Minute).Unix()
+	require.False(t, VerifyMediaSignature(42, past, mediaSignature(42, past)))
+}
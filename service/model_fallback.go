@@ -0,0 +1,154 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ModelFallbackHeader 客户端传 off / false / 0 时关闭本次请求的跨模型降级
+const ModelFallbackHeader = "X-Model-Fallback"
+
+// ServedModelHeader 发生跨模型降级时告知客户端实际提供服务的模型
+const ServedModelHeader = "X-Served-Model"
+
+func modelFallbackDisabledByClient(c *gin.Context) bool {
+	switch strings.ToLower(strings.TrimSpace(c.GetHeader(ModelFallbackHeader))) {
+	case "off", "false", "0", "no", "disable", "disabled":
+		return true
+	}
+	return false
+}
+
+// ModelFallbackErrorClass 将错误归类为降级触发条件
+func ModelFallbackErrorClass(err *types.NewAPIError) string {
+	switch err.GetErrorCode() {
+	case types.ErrorCodeGetChannelFailed, types.ErrorCodeModelNotFound:
+		return operation_setting.ModelFallbackOnNoChannel
+	}
+	return model.UsageErrorClassFromStatus(err.StatusCode)
+}
+
+func getModelFallbackRule(c *gin.Context, requestedModel string, usingGroup string) (*operation_setting.ModelFallbackRule, bool) {
+	if modelFallbackDisabledByClient(c) {
+		return nil, false
+	}
+	// 指定渠道的令牌不做跨模型降级
+	if _, ok := common.GetContextKey(c, constant.ContextKeyTokenSpecificChannelId); ok {
+		return nil, false
+	}
+	autoGroup := common.GetContextKeyString(c, constant.ContextKeyAutoGroup)
+	return operation_setting.GetModelFallbackSetting().GetRule(requestedModel, usingGroup, autoGroup)
+}
+
+// tokenAllowsModel 降级模型同样受令牌模型限制约束
+func tokenAllowsModel(c *gin.Context, modelName string) bool {
+	if !common.GetContextKeyBool(c, constant.ContextKeyTokenModelLimitEnabled) {
+		return true
+	}
+	limit, ok := common.GetContextKeyType[map[string]bool](c, constant.ContextKeyTokenModelLimit)
+	if !ok {
+		return false
+	}
+	_, ok = limit[ratio_setting.FormatMatchingModelName(modelName)]
+	return ok
+}
+
+// resetAutoGroupState 切换模型后从第一个自动分组重新选择渠道
+func resetAutoGroupState(c *gin.Context) {
+	common.SetContextKey(c, constant.ContextKeyAutoGroupIndex, 0)
+	common.SetContextKey(c, constant.ContextKeyAutoGroupRetryIndex, 0)
+}
+
+// SelectModelFallbackChannel 请求的模型在分组下没有可用渠道时，按降级链返回第一个有可用渠道的模型
+func SelectModelFallbackChannel(c *gin.Context, requestedModel string, usingGroup string) (string, *model.Channel, bool) {
+	rule, ok := getModelFallbackRule(c, requestedModel, usingGroup)
+	if !ok || !rule.ShouldTrigger(operation_setting.ModelFallbackOnNoChannel) {
+		return "", nil, false
+	}
+	for _, fallbackModel := range rule.NextModels(requestedModel) {
+		if !tokenAllowsModel(c, fallbackModel) {
+			continue
+		}
+		resetAutoGroupState(c)
+		channel, _, err := CacheGetRandomSatisfiedChannel(&RetryParam{
+			Ctx:        c,
+			ModelName:  fallbackModel,
+			TokenGroup: usingGroup,
+			Retry:      common.GetPointer(0),
+		})
+		if err == nil && channel != nil {
+			logger.LogInfo(c, "model fallback: "+requestedModel+" -> "+fallbackModel+" (no available channel)")
+			return fallbackModel, channel, true
+		}
+	}
+	return "", nil, false
+}
+
+// NextModelFallback 当前模型的所有渠道都失败后返回降级链中的下一个模型。
+// 已经向客户端输出内容（流式已开始）或 websocket 请求不会降级
+func NextModelFallback(c *gin.Context, info *relaycommon.RelayInfo, err *types.NewAPIError) (string, bool) {
+	if err == nil || info.RelayFormat == types.RelayFormatOpenAIRealtime || c.Writer.Written() {
+		return "", false
+	}
+	if ShouldSkipRetryAfterChannelAffinityFailure(c) {
+		return "", false
+	}
+	errorClass := ModelFallbackErrorClass(err)
+	if types.IsSkipRetryError(err) && errorClass != operation_setting.ModelFallbackOnNoChannel {
+		return "", false
+	}
+	requestedModel := info.RequestedModelName
+	if requestedModel == "" {
+		requestedModel = info.OriginModelName
+	}
+	rule, ok := getModelFallbackRule(c, requestedModel, info.UsingGroup)
+	if !ok || !rule.ShouldTrigger(errorClass) {
+		return "", false
+	}
+	for _, fallbackModel := range rule.NextModels(info.OriginModelName) {
+		if tokenAllowsModel(c, fallbackModel) {
+			return fallbackModel, true
+		}
+	}
+	return "", false
+}
+
+// RebillFallbackModel 按降级模型重新预扣费：先同步退还当前模型的预扣，再按降级模型的预扣额度创建计费会话并检查额度。
+// 原模型免费（没有计费会话）时同样会为降级模型创建计费会话
+func RebillFallbackModel(c *gin.Context, info *relaycommon.RelayInfo, priceData types.PriceData) *types.NewAPIError {
+	if session, ok := info.Billing.(*BillingSession); ok {
+		session.RefundNow(c)
+	} else if info.Billing != nil {
+		info.Billing.Refund(c)
+	}
+	info.Billing = nil
+	info.FinalPreConsumedQuota = 0
+	info.BillingAttempt++
+	if priceData.FreeModel {
+		return nil
+	}
+	return PreConsumeBilling(c, priceData.QuotaToPreConsume, info)
+}
+
+// SwitchRelayModel 切换到降级模型，之后的渠道选择与计费都使用该模型
+func SwitchRelayModel(c *gin.Context, info *relaycommon.RelayInfo, fallbackModel string) {
+	if info.RequestedModelName == "" {
+		info.RequestedModelName = info.OriginModelName
+	}
+	logger.LogInfo(c, "model fallback: "+info.OriginModelName+" -> "+fallbackModel)
+	info.OriginModelName = fallbackModel
+	common.SetContextKey(c, constant.ContextKeyRequestedModel, info.RequestedModelName)
+	common.SetContextKey(c, constant.ContextKeyOriginalModel, fallbackModel)
+	resetAutoGroupState(c)
+	c.Header(ServedModelHeader, fallbackModel)
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func withModelFallbackRules(t *testing.T, rules ...operation_setting.ModelFallbackRule) {
+	t.Helper()
+	setting := operation_setting.GetModelFallbackSetting()
+	saved := *setting
+	setting.Enabled = true
+	setting.Rules = rules
+	t.Cleanup(func() { *setting = saved })
+}
+
+func newModelFallbackContext(header string) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	if header != "" {
+		c.Request.Header.Set(ModelFallbackHeader, header)
+	}
+	return c
+}
+
+func TestModelFallbackRuleSelection(t *testing.T) {
+	withModelFallbackRules(t,
+		operation_setting.ModelFallbackRule{Model: "model-a", Fallbacks: []string{"model-b", "model-c"}},
+		operation_setting.ModelFallbackRule{Model: "model-a", Groups: []string{"vip"}, Fallbacks: []string{"model-d"}, TriggerOn: []string{operation_setting.ModelFallbackOnClient}},
+	)
+	setting := operation_setting.GetModelFallbackSetting()
+
+	rule, ok := setting.GetRule("model-a", "vip")
+	require.True(t, ok)
+	assert.Equal(t, []string{"model-d"}, rule.Fallbacks)
+	assert.True(t, rule.ShouldTrigger(operation_setting.ModelFallbackOnClient))
+	assert.False(t, rule.ShouldTrigger(operation_setting.ModelFallbackOnUpstream))
+
+	rule, ok = setting.GetRule("model-a", "default")
+	require.True(t, ok)
+	assert.True(t, rule.ShouldTrigger(operation_setting.ModelFallbackOnRateLimit))
+	assert.False(t, rule.ShouldTrigger(operation_setting.ModelFallbackOnClient))
+	assert.Equal(t, []string{"model-b", "model-c"}, rule.NextModels("model-a"))
+	assert.Equal(t, []string{"model-c"}, rule.NextModels("model-b"))
+	assert.Empty(t, rule.NextModels("model-c"))
+
+	_, ok = setting.GetRule("model-x", "default")
+	assert.False(t, ok)
+}
+
+func TestNextModelFallback(t *testing.T) {
+	withModelFallbackRules(t, operation_setting.ModelFallbackRule{Model: "model-a", Fallbacks: []string{"model-b", "model-c"}})
+	upstreamErr := types.NewErrorWithStatusCode(errors.New("bad gateway"), types.ErrorCodeBadResponseStatusCode, http.StatusBadGateway)
+
+	c := newModelFallbackContext("")
+	info := &relaycommon.RelayInfo{OriginModelName: "model-a", UsingGroup: "default"}
+	fallbackModel, ok := NextModelFallback(c, info, upstreamErr)
+	require.True(t, ok)
+	assert.Equal(t, "model-b", fallbackModel)
+
+	SwitchRelayModel(c, info, fallbackModel)
+	assert.Equal(t, "model-a", info.RequestedModelName)
+	assert.Equal(t, "model-b", info.OriginModelName)
+	assert.Equal(t, "model-b", c.Writer.Header().Get(ServedModelHeader))
+
+	fallbackModel, ok = NextModelFallback(c, info, upstreamErr)
+	require.True(t, ok)
+	assert.Equal(t, "model-c", fallbackModel)
+
+	// 客户端错误不在默认触发条件内
+	clientErr := types.NewErrorWithStatusCode(errors.New("bad request"), types.ErrorCodeBadResponseStatusCode, http.StatusBadRequest)
+	_, ok = NextModelFallback(newModelFallbackContext(""), &relaycommon.RelayInfo{OriginModelName: "model-a"}, clientErr)
+	assert.False(t, ok)
+
+	_, ok = NextModelFallback(newModelFallbackContext("off"), &relaycommon.RelayInfo{OriginModelName: "model-a"}, upstreamErr)
+	assert.False(t, ok)
+
+	// 已经向客户端输出内容后不再降级
+	written := newModelFallbackContext("")
+	written.Writer.WriteHeaderNow()
+	_, ok = NextModelFallback(written, &relaycommon.RelayInfo{OriginModelName: "model-a"}, upstreamErr)
+	assert.False(t, ok)
+}
+
+func TestRebillFallbackModel(t *testing.T) {
+	truncate(t)
+	const userID = 70
+	seedUser(t, userID, 10000)
+
+	c := newModelFallbackContext("")
+	// Playground 请求不涉及令牌额度，只校验钱包预扣
+	info := &relaycommon.RelayInfo{
+		UserId:       userID,
+		RequestId:    "req-fallback-rebill",
+		IsPlayground: true,
+	}
+
+	// 原模型免费，降级到付费模型时创建计费会话
+	require.Nil(t, RebillFallbackModel(c, info, types.PriceData{QuotaToPreConsume: 1000}))
+	require.NotNil(t, info.Billing)
+	assert.Equal(t, 1000, info.FinalPreConsumedQuota)
+	assert.Equal(t, 9000, getUserQuota(t, userID))
+
+	// 切换到更贵的模型时按新价格预扣，只保留一份预扣
+	require.Nil(t, RebillFallbackModel(c, info, types.PriceData{QuotaToPreConsume: 3000}))
+	assert.Equal(t, 3000, info.FinalPreConsumedQuota)
+	assert.Equal(t, 7000, getUserQuota(t, userID))
+
+	// 额度不足时返回错误，之前的预扣已退还
+	apiErr := RebillFallbackModel(c, info, types.PriceData{QuotaToPreConsume: 20000})
+	require.NotNil(t, apiErr)
+	assert.Equal(t, types.ErrorCodeInsufficientUserQuota, apiErr.GetErrorCode())
+	assert.Nil(t, info.Billing)
+	assert.Equal(t, 10000, getUserQuota(t, userID))
+
+	// 降级到免费模型时不保留预扣
+	require.Nil(t, RebillFallbackModel(c, info, types.PriceData{QuotaToPreConsume: 1000}))
+	require.Nil(t, RebillFallbackModel(c, info, types.PriceData{FreeModel: true}))
+	assert.Nil(t, info.Billing)
+	assert.Equal(t, 10000, getUserQuota(t, userID))
+}
@@ -0,0 +1,338 @@
+package service
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ModelRouteFeatures 路由规则使用的请求特征
+type ModelRouteFeatures struct {
+	PromptTokens    int
+	MaxTokens       int
+	HasImages       bool
+	HasTools        bool
+	ReasoningEffort string
+	Groups          []string
+	TimeBudget      time.Duration // 0 表示请求未携带时间预算
+}
+
+// GetRouterModel 返回当前分组可见的虚拟路由模型
+func GetRouterModel(c *gin.Context, modelName string) (*operation_setting.RouterModel, bool) {
+	routerModel, ok := operation_setting.GetModelRouterSetting().GetRouterModel(modelName)
+	if !ok {
+		return nil, false
+	}
+	usingGroup := common.GetContextKeyString(c, constant.ContextKeyUsingGroup)
+	userGroup := common.GetContextKeyString(c, constant.ContextKeyUserGroup)
+	if !routerModel.VisibleTo(usingGroup, userGroup) {
+		return nil, false
+	}
+	return routerModel, true
+}
+
+// SupportsModelRouting 虚拟路由模型只在 relay 会解析路由的对话类接口上可用：
+// chat/completions、completions、responses、Claude messages 与 Gemini
+func SupportsModelRouting(path string) bool {
+	if strings.HasPrefix(path, "/v1/messages") {
+		return true
+	}
+	switch relayconstant.Path2RelayMode(path) {
+	case relayconstant.RelayModeChatCompletions, relayconstant.RelayModeCompletions,
+		relayconstant.RelayModeResponses, relayconstant.RelayModeGemini:
+		return true
+	}
+	return false
+}
+
+func parseTimeBudget(c *gin.Context) time.Duration {
+	value := strings.TrimSpace(c.GetHeader(operation_setting.TimeBudgetHeader))
+	if value == "" {
+		return 0
+	}
+	ms, err := strconv.Atoi(value)
+	if err != nil || ms <= 0 {
+		return 0
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// claudeThinkingEffort 未指定 effort 时按 thinking 预算折算推理强度
+func claudeThinkingEffort(r *dto.ClaudeRequest) string {
+	if effort := r.GetEfforts(); effort != "" {
+		return effort
+	}
+	if r.Thinking == nil || r.Thinking.Type == "disabled" {
+		return ""
+	}
+	switch budget := r.Thinking.GetBudgetTokens(); {
+	case budget == 0:
+		return "medium"
+	case budget < 4096:
+		return "low"
+	case budget < 16384:
+		return "medium"
+	default:
+		return "high"
+	}
+}
+
+func requestReasoningEffort(request dto.Request) string {
+	switch r := request.(type) {
+	case *dto.GeneralOpenAIRequest:
+		return r.ReasoningEffort
+	case *dto.OpenAIResponsesRequest:
+		if r.Reasoning != nil {
+			return r.Reasoning.Effort
+		}
+	case *dto.ClaudeRequest:
+		return claudeThinkingEffort(r)
+	case *dto.GeminiChatRequest:
+		if r.GenerationConfig.ThinkingConfig != nil {
+			return r.GenerationConfig.ThinkingConfig.ThinkingLevel
+		}
+	}
+	return ""
+}
+
+func requestHasTools(request dto.Request, meta *types.TokenCountMeta) bool {
+	if meta != nil && meta.ToolsCount > 0 {
+		return true
+	}
+	switch r := request.(type) {
+	case *dto.OpenAIResponsesRequest:
+		tools := strings.TrimSpace(string(r.Tools))
+		return tools != "" && tools != "[]" && tools != "null"
+	case *dto.GeminiChatRequest:
+		return len(r.GetTools()) > 0
+	}
+	return false
+}
+
+// ExtractModelRouteFeatures 从请求与 token 估算结果中提取路由特征。未开启 token 统计时按文本粗略估算输入 token
+func ExtractModelRouteFeatures(c *gin.Context, info *relaycommon.RelayInfo, request dto.Request, meta *types.TokenCountMeta, promptTokens int) ModelRouteFeatures {
+	features := ModelRouteFeatures{
+		PromptTokens:    promptTokens,
+		HasTools:        requestHasTools(request, meta),
+		ReasoningEffort: strings.ToLower(strings.TrimSpace(requestReasoningEffort(request))),
+		Groups:          []string{info.UsingGroup, info.UserGroup},
+		TimeBudget:      parseTimeBudget(c),
+	}
+	if meta != nil {
+		features.MaxTokens = meta.MaxTokens
+		if features.PromptTokens == 0 && meta.CombineText != "" {
+			features.PromptTokens = EstimateTokenByModel(info.OriginModelName, meta.CombineText)
+		}
+		for _, file := range meta.Files {
+			if file != nil && file.FileType == types.FileTypeImage {
+				features.HasImages = true
+				break
+			}
+		}
+	}
+	if autoGroup := common.GetContextKeyString(c, constant.ContextKeyAutoGroup); autoGroup != "" {
+		features.Groups = append(features.Groups, autoGroup)
+	}
+	return features
+}
+
+// MatchModelRouterRule 规则中已配置的条件都满足时返回 true
+func MatchModelRouterRule(rule *operation_setting.ModelRouterRule, features ModelRouteFeatures) bool {
+	if rule.MinPromptTokens > 0 && features.PromptTokens < rule.MinPromptTokens {
+		return false
+	}
+	if rule.MaxPromptTokens > 0 && features.PromptTokens > rule.MaxPromptTokens {
+		return false
+	}
+	if rule.HasImages != nil && *rule.HasImages != features.HasImages {
+		return false
+	}
+	if rule.HasTools != nil && *rule.HasTools != features.HasTools {
+		return false
+	}
+	if len(rule.ReasoningEfforts) > 0 {
+		effort := features.ReasoningEffort
+		if effort == "" {
+			effort = operation_setting.ReasoningEffortNone
+		}
+		if !slices.ContainsFunc(rule.ReasoningEfforts, func(e string) bool { return strings.EqualFold(e, effort) }) {
+			return false
+		}
+	}
+	if len(rule.Groups) > 0 && !slices.ContainsFunc(features.Groups, func(g string) bool { return g != "" && slices.Contains(rule.Groups, g) }) {
+		return false
+	}
+	if rule.MaxTimeBudgetMs > 0 && (features.TimeBudget <= 0 || features.TimeBudget > time.Duration(rule.MaxTimeBudgetMs)*time.Millisecond) {
+		return false
+	}
+	return true
+}
+
+// EstimateModelCost 按按次价格或模型倍率估算单次请求的成本（美元），模型未配置价格时返回 false
+func EstimateModelCost(modelName string, promptTokens int, completionTokens int) (float64, bool) {
+	if price, ok := ratio_setting.GetModelPrice(modelName, false); ok {
+		return price, true
+	}
+	ratio, ok, _ := ratio_setting.GetModelRatio(modelName)
+	if !ok {
+		return 0, false
+	}
+	quota := (float64(promptTokens) + float64(completionTokens)*ratio_setting.GetCompletionRatio(modelName)) * ratio
+	return quota / common.QuotaPerUnit, true
+}
+
+// modelHasTags 模型元数据的标签包含全部 tags
+func modelHasTags(modelName string, tags []string) bool {
+	if len(tags) == 0 {
+		return true
+	}
+	for _, pricing := range model.GetPricing() {
+		if pricing.ModelName != modelName {
+			continue
+		}
+		modelTags := strings.Split(pricing.Tags, ",")
+		for i := range modelTags {
+			modelTags[i] = strings.TrimSpace(modelTags[i])
+		}
+		for _, tag := range tags {
+			if !slices.Contains(modelTags, tag) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+type routeCandidate struct {
+	model   string
+	cost    float64
+	latency time.Duration
+}
+
+// rankRouteCandidates 过滤不满足标签、成本与延迟目标的候选模型，并按策略排序。
+// 未知成本或没有延迟样本的模型排在已知的模型之后
+func rankRouteCandidates(rule *operation_setting.ModelRouterRule, features ModelRouteFeatures) []string {
+	latencyTarget := time.Duration(rule.MaxLatencyMs) * time.Millisecond
+	if features.TimeBudget > 0 && (latencyTarget == 0 || features.TimeBudget < latencyTarget) {
+		latencyTarget = features.TimeBudget
+	}
+	candidates := make([]routeCandidate, 0, len(rule.Models)+1)
+	for _, name := range rule.Candidates() {
+		if !modelHasTags(name, rule.Tags) {
+			continue
+		}
+		candidate := routeCandidate{model: name, cost: math.Inf(1), latency: time.Duration(math.MaxInt64)}
+		if cost, ok := EstimateModelCost(name, features.PromptTokens, features.MaxTokens); ok {
+			candidate.cost = cost
+		} else if rule.MaxCost > 0 {
+			continue
+		}
+		if rule.MaxCost > 0 && candidate.cost > rule.MaxCost {
+			continue
+		}
+		if p95, ok := firstByteLatencyP95(name); ok {
+			if latencyTarget > 0 && p95 > latencyTarget {
+				continue
+			}
+			candidate.latency = p95
+		}
+		candidates = append(candidates, candidate)
+	}
+	switch rule.Strategy {
+	case operation_setting.ModelRouterStrategyCheapest:
+		slices.SortStableFunc(candidates, func(a, b routeCandidate) int {
+			return cmp.Compare(a.cost, b.cost)
+		})
+	case operation_setting.ModelRouterStrategyFastest:
+		slices.SortStableFunc(candidates, func(a, b routeCandidate) int {
+			return cmp.Compare(a.latency, b.latency)
+		})
+	}
+	models := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		models[i] = candidate.model
+	}
+	return models
+}
+
+// selectRouteChannel 返回第一个在分组下有可用渠道的模型
+func selectRouteChannel(c *gin.Context, usingGroup string, models []string) (string, *model.Channel, bool) {
+	for _, name := range models {
+		resetAutoGroupState(c)
+		channel, _, err := CacheGetRandomSatisfiedChannel(&RetryParam{
+			Ctx:        c,
+			ModelName:  name,
+			TokenGroup: usingGroup,
+			Retry:      common.GetPointer(0),
+		})
+		if err == nil && channel != nil {
+			return name, channel, true
+		}
+	}
+	return "", nil, false
+}
+
+// RouteModel 为虚拟路由模型选择实际模型与渠道：依次匹配规则，规则的候选模型都不可用时继续匹配后续规则，
+// 最后使用默认模型。虚拟模型本身的访问权限即代表其候选模型的访问权限，候选模型不再受令牌模型限制约束
+func RouteModel(c *gin.Context, info *relaycommon.RelayInfo, request dto.Request, meta *types.TokenCountMeta, promptTokens int) (*model.Channel, *types.NewAPIError) {
+	routerModel, ok := GetRouterModel(c, info.OriginModelName)
+	if !ok {
+		return nil, types.NewErrorWithStatusCode(fmt.Errorf("router model %s not found", info.OriginModelName), types.ErrorCodeModelNotFound, http.StatusNotFound, types.ErrOptionWithSkipRetry())
+	}
+	features := ExtractModelRouteFeatures(c, info, request, meta, promptTokens)
+	route := &relaycommon.ModelRouteInfo{RouterModel: routerModel.Name}
+	var (
+		target  string
+		channel *model.Channel
+		found   bool
+	)
+	for i := range routerModel.Rules {
+		rule := &routerModel.Rules[i]
+		if !MatchModelRouterRule(rule, features) {
+			continue
+		}
+		if target, channel, found = selectRouteChannel(c, info.UsingGroup, rankRouteCandidates(rule, features)); found {
+			route.Rule = rule.Name
+			if route.Rule == "" {
+				route.Rule = fmt.Sprintf("#%d", i+1)
+			}
+			break
+		}
+	}
+	if !found && routerModel.Default != "" {
+		target, channel, found = selectRouteChannel(c, info.UsingGroup, []string{routerModel.Default})
+	}
+	if !found {
+		return nil, types.NewErrorWithStatusCode(errors.New("no available model for router model "+routerModel.Name), types.ErrorCodeModelNotFound, http.StatusServiceUnavailable, types.ErrOptionWithSkipRetry())
+	}
+
+	route.Model = target
+	info.Router = route
+	info.RequestedModelName = routerModel.Name
+	info.OriginModelName = target
+	common.SetContextKey(c, constant.ContextKeyRequestedModel, routerModel.Name)
+	common.SetContextKey(c, constant.ContextKeyOriginalModel, target)
+	c.Header(ServedModelHeader, target)
+	logger.LogInfo(c, fmt.Sprintf("model router: %s -> %s (rule: %s, prompt tokens: %d)", routerModel.Name, target, common.GetStringIfEmpty(route.Rule, "default"), features.PromptTokens))
+	return channel, nil
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchModelRouterRule(t *testing.T) {
+	features := ModelRouteFeatures{
+		PromptTokens: 12000,
+		HasImages:    true,
+		Groups:       []string{"vip", "default"},
+		TimeBudget:   2 * time.Second,
+	}
+
+	assert.True(t, MatchModelRouterRule(&operation_setting.ModelRouterRule{}, features))
+	assert.True(t, MatchModelRouterRule(&operation_setting.ModelRouterRule{MinPromptTokens: 8000, HasImages: common.GetPointer(true)}, features))
+	assert.False(t, MatchModelRouterRule(&operation_setting.ModelRouterRule{MaxPromptTokens: 8000}, features))
+	assert.False(t, MatchModelRouterRule(&operation_setting.ModelRouterRule{HasTools: common.GetPointer(true)}, features))
+	assert.True(t, MatchModelRouterRule(&operation_setting.ModelRouterRule{ReasoningEfforts: []string{"none"}}, features))
+	assert.False(t, MatchModelRouterRule(&operation_setting.ModelRouterRule{ReasoningEfforts: []string{"high"}}, features))
+	assert.True(t, MatchModelRouterRule(&operation_setting.ModelRouterRule{Groups: []string{"vip"}}, features))
+	assert.False(t, MatchModelRouterRule(&operation_setting.ModelRouterRule{Groups: []string{"svip"}}, features))
+	assert.True(t, MatchModelRouterRule(&operation_setting.ModelRouterRule{MaxTimeBudgetMs: 3000}, features))
+	assert.False(t, MatchModelRouterRule(&operation_setting.ModelRouterRule{MaxTimeBudgetMs: 1000}, features))
+
+	features.TimeBudget = 0
+	features.ReasoningEffort = "high"
+	assert.False(t, MatchModelRouterRule(&operation_setting.ModelRouterRule{MaxTimeBudgetMs: 3000}, features))
+	assert.True(t, MatchModelRouterRule(&operation_setting.ModelRouterRule{ReasoningEfforts: []string{"medium", "HIGH"}}, features))
+}
+
+func TestRankRouteCandidates(t *testing.T) {
+	savedPrice, savedRatio := ratio_setting.ModelPrice2JSONString(), ratio_setting.ModelRatio2JSONString()
+	t.Cleanup(func() {
+		_ = ratio_setting.UpdateModelPriceByJSONString(savedPrice)
+		_ = ratio_setting.UpdateModelRatioByJSONString(savedRatio)
+	})
+	require.NoError(t, ratio_setting.UpdateModelPriceByJSONString(`{"router-test-flat": 0.05}`))
+	require.NoError(t, ratio_setting.UpdateModelRatioByJSONString(`{"router-test-large": 5, "router-test-small": 0.1}`))
+
+	features := ModelRouteFeatures{PromptTokens: 10000}
+	rule := &operation_setting.ModelRouterRule{
+		Model:  "router-test-large",
+		Models: []string{"router-test-flat", "router-test-unpriced", "router-test-small"},
+	}
+	assert.Equal(t, []string{"router-test-large", "router-test-flat", "router-test-unpriced", "router-test-small"}, rankRouteCandidates(rule, features))
+
+	rule.Strategy = operation_setting.ModelRouterStrategyCheapest
+	assert.Equal(t, []string{"router-test-small", "router-test-flat", "router-test-large", "router-test-unpriced"}, rankRouteCandidates(rule, features))
+
+	// 10000 * 5 / 500000 = $0.1，超过成本上限；未配置价格的模型无法判断成本，同样排除
+	rule.MaxCost = 0.06
+	assert.Equal(t, []string{"router-test-small", "router-test-flat"}, rankRouteCandidates(rule, features))
+
+	cost, ok := EstimateModelCost("router-test-small", 10000, 0)
+	require.True(t, ok)
+	assert.InDelta(t, 10000*0.1/common.QuotaPerUnit, cost, 1e-12)
+}
+
+func TestSupportsModelRouting(t *testing.T) {
+	for _, path := range []string{"/v1/chat/completions", "/pg/chat/completions", "/v1/completions", "/v1/responses", "/v1/messages", "/v1beta/models/gemini-2.5-pro:generateContent"} {
+		assert.True(t, SupportsModelRouting(path), path)
+	}
+	for _, path := range []string{"/v1/realtime", "/v1/embeddings", "/v1/images/generations", "/v1/video/generations", "/suno/submit/music", "/mj/submit/imagine"} {
+		assert.False(t, SupportsModelRouting(path), path)
+	}
+}
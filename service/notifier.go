@@ -0,0 +1,417 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+// NotifyTarget 通知接收方
+type NotifyTarget struct {
+	UserId  int
+	Email   string
+	Setting dto.UserSetting
+}
+
+// Notifier 通知渠道插件，按用户设置中的 notify_type 选择，新的渠道通过 RegisterNotifier 注册
+type Notifier interface {
+	Send(target NotifyTarget, data dto.Notify) error
+}
+
+// NotifierValidator 可选接口，保存用户设置前校验渠道配置
+type NotifierValidator interface {
+	Validate(setting dto.UserSetting) error
+}
+
+var (
+	notifiers     = make(map[string]Notifier)
+	notifiersLock sync.RWMutex
+)
+
+func RegisterNotifier(notifyType string, notifier Notifier) {
+	notifiersLock.Lock()
+	defer notifiersLock.Unlock()
+	notifiers[notifyType] = notifier
+}
+
+func GetNotifier(notifyType string) (Notifier, bool) {
+	notifiersLock.RLock()
+	defer notifiersLock.RUnlock()
+	notifier, ok := notifiers[notifyType]
+	return notifier, ok
+}
+
+// ValidateNotifySetting 校验用户选择的通知渠道及其配置
+func ValidateNotifySetting(notifyType string, setting dto.UserSetting) error {
+	notifier, ok := GetNotifier(notifyType)
+	if !ok {
+		return fmt.Errorf("不支持的通知类型：%s", notifyType)
+	}
+	if validator, ok := notifier.(NotifierValidator); ok {
+		return validator.Validate(setting)
+	}
+	return nil
+}
+
+func init() {
+	RegisterNotifier(dto.NotifyTypeEmail, emailNotifier{})
+	RegisterNotifier(dto.NotifyTypeWebhook, webhookNotifier{})
+	RegisterNotifier(dto.NotifyTypeBark, barkNotifier{})
+	RegisterNotifier(dto.NotifyTypeGotify, gotifyNotifier{})
+	RegisterNotifier(dto.NotifyTypeSlack, slackNotifier{})
+	RegisterNotifier(dto.NotifyTypeDiscord, discordNotifier{})
+	RegisterNotifier(dto.NotifyTypeTelegram, telegramNotifier{})
+	RegisterNotifier(dto.NotifyTypeFeishu, feishuNotifier{})
+	RegisterNotifier(dto.NotifyTypeDingTalk, dingTalkNotifier{})
+	RegisterNotifier(dto.NotifyTypeWeCom, weComNotifier{})
+	RegisterNotifier(dto.NotifyTypeNtfy, ntfyNotifier{})
+}
+
+// renderNotifyContent 替换内容中的 {{value}} 占位符
+func renderNotifyContent(data dto.Notify) string {
+	content := data.Content
+	for _, value := range data.Values {
+		content = strings.Replace(content, dto.ContentValueParam, fmt.Sprintf("%v", value), 1)
+	}
+	return content
+}
+
+func validateNotifyURL(name string, rawURL string) error {
+	if rawURL == "" {
+		return fmt.Errorf("%s 地址不能为空", name)
+	}
+	if _, err := url.ParseRequestURI(rawURL); err != nil {
+		return fmt.Errorf("%s 地址格式不正确", name)
+	}
+	if !strings.HasPrefix(rawURL, "https://") && !strings.HasPrefix(rawURL, "http://") {
+		return fmt.Errorf("%s 地址必须以 http:// 或 https:// 开头", name)
+	}
+	return nil
+}
+
+// postNotifyJSON 以 JSON 发送通知请求，支持 Worker 转发与 SSRF 防护，返回响应体
+func postNotifyJSON(targetURL string, headers map[string]string, payload any) ([]byte, error) {
+	payloadBytes, err := common.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal notify payload: %v", err)
+	}
+	allHeaders := map[string]string{
+		"Content-Type": "application/json; charset=utf-8",
+		"User-Agent":   "NewAPI-Notify/1.0",
+	}
+	for k, v := range headers {
+		allHeaders[k] = v
+	}
+
+	var resp *http.Response
+	if system_setting.EnableWorker() {
+		resp, err = DoWorkerRequest(&WorkerRequest{
+			URL:     targetURL,
+			Key:     system_setting.WorkerValidKey,
+			Method:  http.MethodPost,
+			Headers: allHeaders,
+			Body:    payloadBytes,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to send notify request through worker: %v", err)
+		}
+	} else {
+		fetchSetting := system_setting.GetFetchSetting()
+		if err := common.ValidateURLWithFetchSetting(targetURL, fetchSetting.EnableSSRFProtection, fetchSetting.AllowPrivateIp, fetchSetting.DomainFilterMode, fetchSetting.IpFilterMode, fetchSetting.DomainList, fetchSetting.IpList, fetchSetting.AllowedPorts, fetchSetting.ApplyIPFilterForDomain); err != nil {
+			return nil, fmt.Errorf("request reject: %v", err)
+		}
+		req, err := http.NewRequest(http.MethodPost, targetURL, bytes.NewBuffer(payloadBytes))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create notify request: %v", err)
+		}
+		for k, v := range allHeaders {
+			req.Header.Set(k, v)
+		}
+		resp, err = GetHttpClient().Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to send notify request: %v", err)
+		}
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return body, fmt.Errorf("notify request failed with status code: %d", resp.StatusCode)
+	}
+	return body, nil
+}
+
+// checkBotResponse 飞书、钉钉、企业微信在 HTTP 200 中以 code/errcode 返回业务错误
+func checkBotResponse(body []byte) error {
+	var result struct {
+		Code    *int   `json:"code"`
+		Msg     string `json:"msg"`
+		ErrCode *int   `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if len(body) == 0 || common.Unmarshal(body, &result) != nil {
+		return nil
+	}
+	if result.Code != nil && *result.Code != 0 {
+		return fmt.Errorf("bot returned code %d: %s", *result.Code, result.Msg)
+	}
+	if result.ErrCode != nil && *result.ErrCode != 0 {
+		return fmt.Errorf("bot returned errcode %d: %s", *result.ErrCode, result.ErrMsg)
+	}
+	return nil
+}
+
+func notifyText(data dto.Notify) string {
+	return data.Title + "\n" + renderNotifyContent(data)
+}
+
+type emailNotifier struct{}
+
+func (emailNotifier) Send(target NotifyTarget, data dto.Notify) error {
+	// 优先使用设置中的通知邮箱，如果为空则使用用户的默认邮箱
+	emailToUse := target.Setting.NotificationEmail
+	if emailToUse == "" {
+		emailToUse = target.Email
+	}
+	if emailToUse == "" {
+		common.SysLog(fmt.Sprintf("user %d has no email, skip sending email", target.UserId))
+		return nil
+	}
+	return sendEmailNotify(emailToUse, data)
+}
+
+type webhookNotifier struct{}
+
+func (webhookNotifier) Send(target NotifyTarget, data dto.Notify) error {
+	if target.Setting.WebhookUrl == "" {
+		common.SysLog(fmt.Sprintf("user %d has no webhook url, skip sending webhook", target.UserId))
+		return nil
+	}
+	return SendWebhookNotify(target.Setting.WebhookUrl, target.Setting.WebhookSecret, data)
+}
+
+type barkNotifier struct{}
+
+func (barkNotifier) Send(target NotifyTarget, data dto.Notify) error {
+	if target.Setting.BarkUrl == "" {
+		common.SysLog(fmt.Sprintf("user %d has no bark url, skip sending bark", target.UserId))
+		return nil
+	}
+	return sendBarkNotify(target.Setting.BarkUrl, data)
+}
+
+type gotifyNotifier struct{}
+
+func (gotifyNotifier) Send(target NotifyTarget, data dto.Notify) error {
+	if target.Setting.GotifyUrl == "" || target.Setting.GotifyToken == "" {
+		common.SysLog(fmt.Sprintf("user %d has no gotify url or token, skip sending gotify", target.UserId))
+		return nil
+	}
+	return sendGotifyNotify(target.Setting.GotifyUrl, target.Setting.GotifyToken, target.Setting.GotifyPriority, data)
+}
+
+type slackNotifier struct{}
+
+func (slackNotifier) Validate(setting dto.UserSetting) error {
+	return validateNotifyURL("Slack Webhook", setting.SlackWebhookUrl)
+}
+
+func (slackNotifier) Send(target NotifyTarget, data dto.Notify) error {
+	if target.Setting.SlackWebhookUrl == "" {
+		return nil
+	}
+	_, err := postNotifyJSON(target.Setting.SlackWebhookUrl, nil, map[string]any{
+		"text": "*" + data.Title + "*\n" + renderNotifyContent(data),
+	})
+	return err
+}
+
+type discordNotifier struct{}
+
+// discordContentLimit Discord 单条消息最多 2000 个字符
+const discordContentLimit = 2000
+
+func (discordNotifier) Validate(setting dto.UserSetting) error {
+	return validateNotifyURL("Discord Webhook", setting.DiscordWebhookUrl)
+}
+
+func (discordNotifier) Send(target NotifyTarget, data dto.Notify) error {
+	if target.Setting.DiscordWebhookUrl == "" {
+		return nil
+	}
+	content := []rune("**" + data.Title + "**\n" + renderNotifyContent(data))
+	if len(content) > discordContentLimit {
+		content = content[:discordContentLimit]
+	}
+	_, err := postNotifyJSON(target.Setting.DiscordWebhookUrl, nil, map[string]any{
+		"content": string(content),
+	})
+	return err
+}
+
+type telegramNotifier struct{}
+
+func (telegramNotifier) Validate(setting dto.UserSetting) error {
+	if setting.TelegramBotToken == "" || setting.TelegramChatId == "" {
+		return errors.New("Telegram Bot Token 与 Chat ID 不能为空")
+	}
+	return nil
+}
+
+func (telegramNotifier) Send(target NotifyTarget, data dto.Notify) error {
+	if target.Setting.TelegramBotToken == "" || target.Setting.TelegramChatId == "" {
+		return nil
+	}
+	apiURL := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", target.Setting.TelegramBotToken)
+	_, err := postNotifyJSON(apiURL, nil, map[string]any{
+		"chat_id":                  target.Setting.TelegramChatId,
+		"text":                     notifyText(data),
+		"disable_web_page_preview": true,
+	})
+	return err
+}
+
+// botSign 飞书与钉钉机器人签名：以 "timestamp\nsecret" 作为 HMAC-SHA256 的参与方，结果 Base64 编码
+func botSign(key []byte, message []byte) string {
+	h := hmac.New(sha256.New, key)
+	h.Write(message)
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+type feishuNotifier struct{}
+
+func (feishuNotifier) Validate(setting dto.UserSetting) error {
+	return validateNotifyURL("飞书 Webhook", setting.FeishuWebhookUrl)
+}
+
+func (feishuNotifier) Send(target NotifyTarget, data dto.Notify) error {
+	if target.Setting.FeishuWebhookUrl == "" {
+		return nil
+	}
+	payload := map[string]any{
+		"msg_type": "text",
+		"content":  map[string]string{"text": notifyText(data)},
+	}
+	if secret := target.Setting.FeishuSecret; secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		payload["timestamp"] = timestamp
+		payload["sign"] = botSign([]byte(timestamp+"\n"+secret), nil)
+	}
+	body, err := postNotifyJSON(target.Setting.FeishuWebhookUrl, nil, payload)
+	if err != nil {
+		return err
+	}
+	return checkBotResponse(body)
+}
+
+type dingTalkNotifier struct{}
+
+func (dingTalkNotifier) Validate(setting dto.UserSetting) error {
+	return validateNotifyURL("钉钉 Webhook", setting.DingTalkWebhookUrl)
+}
+
+func (dingTalkNotifier) Send(target NotifyTarget, data dto.Notify) error {
+	webhookURL := target.Setting.DingTalkWebhookUrl
+	if webhookURL == "" {
+		return nil
+	}
+	if secret := target.Setting.DingTalkSecret; secret != "" {
+		timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		sign := botSign([]byte(secret), []byte(timestamp+"\n"+secret))
+		separator := "?"
+		if strings.Contains(webhookURL, "?") {
+			separator = "&"
+		}
+		webhookURL += separator + "timestamp=" + timestamp + "&sign=" + url.QueryEscape(sign)
+	}
+	body, err := postNotifyJSON(webhookURL, nil, map[string]any{
+		"msgtype": "text",
+		"text":    map[string]string{"content": notifyText(data)},
+	})
+	if err != nil {
+		return err
+	}
+	return checkBotResponse(body)
+}
+
+type weComNotifier struct{}
+
+func (weComNotifier) Validate(setting dto.UserSetting) error {
+	return validateNotifyURL("企业微信 Webhook", setting.WeComWebhookUrl)
+}
+
+func (weComNotifier) Send(target NotifyTarget, data dto.Notify) error {
+	if target.Setting.WeComWebhookUrl == "" {
+		return nil
+	}
+	body, err := postNotifyJSON(target.Setting.WeComWebhookUrl, nil, map[string]any{
+		"msgtype": "text",
+		"text":    map[string]string{"content": notifyText(data)},
+	})
+	if err != nil {
+		return err
+	}
+	return checkBotResponse(body)
+}
+
+type ntfyNotifier struct{}
+
+func (ntfyNotifier) Validate(setting dto.UserSetting) error {
+	if err := validateNotifyURL("ntfy", setting.NtfyUrl); err != nil {
+		return err
+	}
+	if _, _, err := splitNtfyURL(setting.NtfyUrl); err != nil {
+		return err
+	}
+	return nil
+}
+
+// splitNtfyURL 将主题地址拆分为服务器地址与主题，ntfy 的 JSON 发布接口需要 POST 到服务器根路径
+func splitNtfyURL(topicURL string) (string, string, error) {
+	u, err := url.Parse(strings.TrimSuffix(topicURL, "/"))
+	if err != nil {
+		return "", "", err
+	}
+	idx := strings.LastIndex(u.Path, "/")
+	if idx < 0 || idx == len(u.Path)-1 {
+		return "", "", errors.New("ntfy 地址需要包含主题，例如 https://ntfy.sh/my-topic")
+	}
+	topic := u.Path[idx+1:]
+	u.Path = u.Path[:idx+1]
+	u.RawQuery = ""
+	return u.String(), topic, nil
+}
+
+func (ntfyNotifier) Send(target NotifyTarget, data dto.Notify) error {
+	if target.Setting.NtfyUrl == "" {
+		return nil
+	}
+	server, topic, err := splitNtfyURL(target.Setting.NtfyUrl)
+	if err != nil {
+		return err
+	}
+	var headers map[string]string
+	if target.Setting.NtfyToken != "" {
+		headers = map[string]string{"Authorization": "Bearer " + target.Setting.NtfyToken}
+	}
+	_, err = postNotifyJSON(server, headers, map[string]any{
+		"topic":   topic,
+		"title":   data.Title,
+		"message": renderNotifyContent(data),
+		"tags":    []string{data.Event},
+	})
+	return err
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingNotifier struct {
+	sent []dto.Notify
+}
+
+func (n *recordingNotifier) Send(target NotifyTarget, data dto.Notify) error {
+	n.sent = append(n.sent, data)
+	return nil
+}
+
+func TestNotifyUser_RespectsEventSubscriptions(t *testing.T) {
+	notifier := &recordingNotifier{}
+	RegisterNotifier("test_recording", notifier)
+	savedLimit := constant.NotifyLimitCount
+	constant.NotifyLimitCount = 10
+	t.Cleanup(func() { constant.NotifyLimitCount = savedLimit })
+
+	setting := dto.UserSetting{
+		NotifyType:   "test_recording",
+		NotifyEvents: map[string]bool{dto.NotifyEventTopUpSuccess: false},
+	}
+	require.NoError(t, NotifyUser(9001, "", setting, dto.NewNotify(dto.NotifyEventTopUpSuccess, "t", "c", nil)))
+	assert.Empty(t, notifier.sent)
+
+	// 默认关闭的事件需要显式订阅
+	require.NoError(t, NotifyUser(9001, "", setting, dto.NewNotify(dto.NotifyEventTaskFailed, "t", "c", nil)))
+	assert.Empty(t, notifier.sent)
+	setting.NotifyEvents[dto.NotifyEventTaskFailed] = true
+	require.NoError(t, NotifyUser(9001, "", setting, dto.NewNotify(dto.NotifyEventTaskFailed, "t", "c", nil)))
+	require.Len(t, notifier.sent, 1)
+
+	// 目录外的通知（例如带后缀的渠道更新）总是发送
+	require.NoError(t, NotifyUser(9001, "", setting, dto.NewNotify("channel_update_1_3", "t", "c", nil)))
+	assert.Len(t, notifier.sent, 2)
+}
+
+func TestNotifyUser_AppliesRateLimitToAllNotifiers(t *testing.T) {
+	notifier := &recordingNotifier{}
+	RegisterNotifier("test_limited", notifier)
+	savedLimit := constant.NotifyLimitCount
+	savedDuration := constant.NotificationLimitDurationMinute
+	constant.NotifyLimitCount = 2
+	constant.NotificationLimitDurationMinute = 10
+	t.Cleanup(func() {
+		constant.NotifyLimitCount = savedLimit
+		constant.NotificationLimitDurationMinute = savedDuration
+	})
+
+	setting := dto.UserSetting{NotifyType: "test_limited"}
+	data := dto.NewNotify(dto.NotifyEventLoginNewIp, "t", "c", nil)
+	require.NoError(t, NotifyUser(9002, "", setting, data))
+	require.NoError(t, NotifyUser(9002, "", setting, data))
+	assert.Error(t, NotifyUser(9002, "", setting, data))
+	assert.Len(t, notifier.sent, 2)
+}
+
+func TestSplitNtfyURL(t *testing.T) {
+	server, topic, err := splitNtfyURL("https://ntfy.example.com/alerts/")
+	require.NoError(t, err)
+	assert.Equal(t, "https://ntfy.example.com/", server)
+	assert.Equal(t, "alerts", topic)
+
+	_, _, err = splitNtfyURL("https://ntfy.example.com/")
+	assert.Error(t, err)
+}
+
+func TestValidateNotifySetting(t *testing.T) {
+	assert.Error(t, ValidateNotifySetting("unknown", dto.UserSetting{}))
+	assert.Error(t, ValidateNotifySetting(dto.NotifyTypeTelegram, dto.UserSetting{TelegramBotToken: "x"}))
+	assert.Error(t, ValidateNotifySetting(dto.NotifyTypeSlack, dto.UserSetting{SlackWebhookUrl: "ftp://a"}))
+	assert.NoError(t, ValidateNotifySetting(dto.NotifyTypeWeCom, dto.UserSetting{WeComWebhookUrl: "https://qyapi.weixin.qq.com/cgi-bin/webhook/send?key=k"}))
+	assert.NoError(t, ValidateNotifySetting(dto.NotifyTypeEmail, dto.UserSetting{}))
+}
+
+func TestWeComNotifier_ReportsBotError(t *testing.T) {
+	InitHttpClient()
+	fetchSetting := system_setting.GetFetchSetting()
+	saved := fetchSetting.EnableSSRFProtection
+	fetchSetting.EnableSSRFProtection = false
+	t.Cleanup(func() { fetchSetting.EnableSSRFProtection = saved })
+
+	var gotBody string
+	errcode := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		if errcode != 0 {
+			_, _ = w.Write([]byte(`{"errcode":93000,"errmsg":"invalid webhook url"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	defer server.Close()
+
+	target := NotifyTarget{UserId: 1, Setting: dto.UserSetting{WeComWebhookUrl: server.URL}}
+	data := dto.NewNotify(dto.NotifyEventTopUpSuccess, "充值成功", "到账 {{value}}", []interface{}{"$10"})
+	require.NoError(t, weComNotifier{}.Send(target, data))
+	assert.Contains(t, gotBody, `"msgtype":"text"`)
+	assert.Contains(t, gotBody, "到账 $10")
+
+	errcode = 93000
+	assert.Error(t, weComNotifier{}.Send(target, data))
+}
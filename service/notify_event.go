@@ -0,0 +1,159 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const notifyEventScanInterval = 10 * time.Minute
+
+var (
+	notifyEventScanOnce sync.Once
+	// 上次扫描时间，每次只处理 (上次扫描, 本次扫描] 窗口内到点的事件，避免重复提醒
+	notifyEventLastScan int64
+)
+
+func init() {
+	model.TopUpNotifyFunc = notifyTopUpSuccess
+}
+
+// NotifyUserEvent 异步通知用户，t 为限流使用的类型，通常与 event 相同
+func NotifyUserEvent(userId int, event string, t string, title string, content string) {
+	gopool.Go(func() {
+		user, err := model.GetUserCache(userId)
+		if err != nil {
+			common.SysLog(fmt.Sprintf("failed to load user %d for %s notification: %s", userId, event, err.Error()))
+			return
+		}
+		if err := NotifyUser(user.Id, user.Email, user.GetSetting(), dto.NewEventNotify(event, t, title, content, nil)); err != nil {
+			common.SysLog(fmt.Sprintf("failed to notify user %d for %s: %s", userId, event, err.Error()))
+		}
+	})
+}
+
+// notifyTopUpSuccess 在线支付到账后通知用户，管理员补单与兑换码充值不通知
+func notifyTopUpSuccess(userId int, content string) {
+	NotifyUserEvent(userId, dto.NotifyEventTopUpSuccess, dto.NotifyEventTopUpSuccess, "充值成功", content)
+}
+
+// NotifyTaskFailed 异步任务失败时通知提交任务的用户
+func NotifyTaskFailed(task *model.Task) {
+	if task == nil || task.Status != model.TaskStatusFailure {
+		return
+	}
+	content := fmt.Sprintf("任务 %s（%s）执行失败", task.TaskID, task.Platform)
+	if task.FailReason != "" {
+		content += "，原因：" + task.FailReason
+	}
+	if task.Quota != 0 {
+		content += "，已预扣额度将退回"
+	}
+	NotifyUserEvent(task.UserId, dto.NotifyEventTaskFailed, dto.NotifyEventTaskFailed, "异步任务失败", content)
+}
+
+// RecordLoginIp 记录登录 IP，从未出现过的 IP 登录时提醒用户；首次记录不提醒
+func RecordLoginIp(userId int, ip string) {
+	size := system_setting.GetNotifyEventSetting().LoginIpHistorySize
+	if size <= 0 || ip == "" {
+		return
+	}
+	gopool.Go(func() {
+		isNew, err := model.RecordUserLoginIp(userId, ip, size)
+		if err != nil {
+			common.SysLog(fmt.Sprintf("failed to record login ip for user %d: %s", userId, err.Error()))
+			return
+		}
+		if !isNew {
+			return
+		}
+		user, err := model.GetUserCache(userId)
+		if err != nil {
+			return
+		}
+		content := fmt.Sprintf("您的账号「%s」于 %s 在新的 IP 地址 %s 登录，如非本人操作请及时修改密码",
+			user.Username, time.Now().Format("2006-01-02 15:04:05"), ip)
+		if err := NotifyUser(user.Id, user.Email, user.GetSetting(), dto.NewNotify(dto.NotifyEventLoginNewIp, "新 IP 登录提醒", content, nil)); err != nil {
+			common.SysLog(fmt.Sprintf("failed to notify user %d for new login ip: %s", userId, err.Error()))
+		}
+	})
+}
+
+// StartNotifyEventTask 定时检测即将过期的令牌与订阅
+func StartNotifyEventTask() {
+	notifyEventScanOnce.Do(func() {
+		model.RegisterLeaseJob(model.JobNotifyEventScan)
+		gopool.Go(func() {
+			ticker := time.NewTicker(notifyEventScanInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				if !model.IsJobLeader(model.JobNotifyEventScan) {
+					notifyEventLastScan = 0
+					continue
+				}
+				now := time.Now().Unix()
+				last := notifyEventLastScan
+				if last == 0 {
+					last = now - int64(notifyEventScanInterval.Seconds())
+				}
+				scanNotifyEvents(last, now)
+				notifyEventLastScan = now
+			}
+		})
+	})
+}
+
+func scanNotifyEvents(last int64, now int64) {
+	setting := system_setting.GetNotifyEventSetting()
+	if setting.TokenExpiringLeadHours > 0 {
+		lead := int64(setting.TokenExpiringLeadHours) * 3600
+		tokens, err := model.GetTokensExpiringBetween(last+lead, now+lead)
+		if err != nil {
+			common.SysLog("failed to scan expiring tokens: " + err.Error())
+		}
+		for _, token := range tokens {
+			content := fmt.Sprintf("令牌「%s」将于 %s 过期，请及时续期", token.Name, formatNotifyTime(token.ExpiredTime))
+			NotifyUserEvent(token.UserId, dto.NotifyEventTokenExpiring, fmt.Sprintf("%s_%d", dto.NotifyEventTokenExpiring, token.Id), "令牌即将过期", content)
+		}
+	}
+
+	if setting.SubscriptionRenewingLeadHours > 0 {
+		lead := int64(setting.SubscriptionRenewingLeadHours) * 3600
+		subs, err := model.GetUserSubscriptionsEndingBetween(last+lead, now+lead, []string{"active"})
+		if err != nil {
+			common.SysLog("failed to scan renewing subscriptions: " + err.Error())
+		}
+		for _, sub := range subs {
+			content := fmt.Sprintf("您的订阅「%s」将于 %s 到期，如需继续使用请及时续费", subscriptionPlanTitle(sub.PlanId), formatNotifyTime(sub.EndTime))
+			NotifyUserEvent(sub.UserId, dto.NotifyEventSubscriptionRenewing, dto.NotifyEventSubscriptionRenewing, "订阅即将到期", content)
+		}
+	}
+
+	// 到期处理任务可能尚未把状态改为 expired，两种状态都需要检查
+	subs, err := model.GetUserSubscriptionsEndingBetween(last, now, []string{"active", "expired"})
+	if err != nil {
+		common.SysLog("failed to scan expired subscriptions: " + err.Error())
+	}
+	for _, sub := range subs {
+		content := fmt.Sprintf("您的订阅「%s」已于 %s 到期", subscriptionPlanTitle(sub.PlanId), formatNotifyTime(sub.EndTime))
+		NotifyUserEvent(sub.UserId, dto.NotifyEventSubscriptionExpired, dto.NotifyEventSubscriptionExpired, "订阅已到期", content)
+	}
+}
+
+func subscriptionPlanTitle(planId int) string {
+	if plan, err := model.GetSubscriptionPlanById(planId); err == nil && plan != nil && plan.Title != "" {
+		return plan.Title
+	}
+	return fmt.Sprintf("#%d", planId)
+}
+
+func formatNotifyTime(ts int64) string {
+	return time.Unix(ts, 0).Format("2006-01-02 15:04")
+}
@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const statementCloseTickInterval = 1 * time.Hour
+
+var (
+	statementCloseOnce       sync.Once
+	statementLastClosePeriod string
+)
+
+// statementMovements 一段时间内钱包余额的变动
+type statementMovements struct {
+	topUps        []model.StatementTopUp
+	redemptions   []model.StatementRedemption
+	subscriptions []model.StatementSubscription
+	models        []model.StatementModelUsage
+
+	topUpQuota        int64
+	topUpMoney        float64
+	redemptionQuota   int64
+	subscriptionMoney float64
+	consumedQuota     int64
+	subConsumedQuota  int64
+	refundQuota       int64
+	requestCount      int64
+}
+
+// walletNet 钱包净变动（充值 + 兑换 - 消费 + 退款）
+func (m *statementMovements) walletNet() int64 {
+	return m.topUpQuota + m.redemptionQuota - m.consumedQuota + m.refundQuota
+}
+
+func collectStatementMovements(userId int, start int64, end int64) (*statementMovements, error) {
+	m := &statementMovements{}
+
+	topUps, err := model.GetUserCompletedTopUps(userId, start, end)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range topUps {
+		quota := t.CreditedQuota()
+		m.topUps = append(m.topUps, model.StatementTopUp{
+			TradeNo:       t.TradeNo,
+			PaymentMethod: t.PaymentMethod,
+			Money:         t.Money,
+			Quota:         quota,
+			CompleteTime:  t.CompleteTime,
+		})
+		m.topUpQuota += quota
+		m.topUpMoney += t.Money
+	}
+
+	redemptions, err := model.GetUserRedeemedRedemptions(userId, start, end)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range redemptions {
+		m.redemptions = append(m.redemptions, model.StatementRedemption{
+			Id:           r.Id,
+			Name:         r.Name,
+			Quota:        int64(r.Quota),
+			RedeemedTime: r.RedeemedTime,
+		})
+		m.redemptionQuota += int64(r.Quota)
+	}
+
+	orders, err := model.GetUserCompletedSubscriptionOrders(userId, start, end)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range orders {
+		sub := model.StatementSubscription{
+			TradeNo:       o.TradeNo,
+			PlanId:        o.PlanId,
+			PaymentMethod: o.PaymentMethod,
+			Money:         o.Money,
+			CompleteTime:  o.CompleteTime,
+		}
+		if plan, err := model.GetSubscriptionPlanById(o.PlanId); err == nil && plan != nil {
+			sub.PlanTitle = plan.Title
+		}
+		m.subscriptions = append(m.subscriptions, sub)
+		m.subscriptionMoney += o.Money
+	}
+
+	m.models, err = model.GetUserStatementUsage(userId, start, end)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range m.models {
+		m.consumedQuota += u.Quota
+		m.subConsumedQuota += u.SubscriptionQuota - u.SubscriptionRefundedQuota
+		m.refundQuota += u.RefundQuota
+		m.requestCount += u.Requests
+	}
+	return m, nil
+}
+
+// GenerateStatement 生成用户指定账期的对账单；账期已出账时写入新的修订版，原对账单保持不变。
+// 期末余额在首次出账时由当前余额减去账期结束后的净变动得到并固化，之后的修订版沿用该快照，
+// 不再依赖可能已被清理的日志倒推；期初余额优先沿用上期对账单的期末余额，
+// 无法归类的变动（管理员调整、签到奖励等）计入调整项。
+func GenerateStatement(userId int, period string) (*model.Statement, error) {
+	start, end, err := model.StatementPeriodRange(period)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	if end > now {
+		return nil, errors.New("账期尚未结束")
+	}
+	user, err := model.GetUserById(userId, false)
+	if err != nil {
+		return nil, err
+	}
+
+	inPeriod, err := collectStatementMovements(userId, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	var closing int64
+	latest, err := model.GetLatestStatement(userId, period)
+	if err != nil {
+		return nil, err
+	}
+	if latest != nil {
+		closing = latest.ClosingBalance
+	} else {
+		afterPeriod, err := collectStatementMovements(userId, end, now+1)
+		if err != nil {
+			return nil, err
+		}
+		closing = int64(user.Quota) - afterPeriod.walletNet()
+	}
+	opening := closing - inPeriod.walletNet()
+	prev, err := model.GetPreviousStatement(userId, period)
+	if err != nil {
+		return nil, err
+	}
+	if prev != nil && prev.PeriodEnd == start {
+		opening = prev.ClosingBalance
+	}
+
+	setting := system_setting.GetStatementSetting()
+	statement := &model.Statement{
+		UserId:                    userId,
+		Username:                  user.Username,
+		Period:                    period,
+		PeriodStart:               start,
+		PeriodEnd:                 end,
+		OpeningBalance:            opening,
+		TopUpQuota:                inPeriod.topUpQuota,
+		TopUpMoney:                inPeriod.topUpMoney,
+		RedemptionQuota:           inPeriod.redemptionQuota,
+		SubscriptionMoney:         inPeriod.subscriptionMoney,
+		ConsumedQuota:             inPeriod.consumedQuota,
+		SubscriptionConsumedQuota: inPeriod.subConsumedQuota,
+		RefundQuota:               inPeriod.refundQuota,
+		AdjustmentQuota:           closing - opening - inPeriod.walletNet(),
+		ClosingBalance:            closing,
+		RequestCount:              inPeriod.requestCount,
+		CreatedAt:                 now,
+	}
+	if err := statement.SetDetails(&model.StatementDetails{
+		TopUps:        inPeriod.topUps,
+		Redemptions:   inPeriod.redemptions,
+		Subscriptions: inPeriod.subscriptions,
+		Models:        inPeriod.models,
+	}); err != nil {
+		return nil, err
+	}
+	if err := model.CreateStatementRevision(statement, setting.InvoicePrefix); err != nil {
+		return nil, err
+	}
+	return statement, nil
+}
+
+// CloseStatementPeriod 为账期内有活动且尚未出账的用户生成对账单，返回生成数量
+func CloseStatementPeriod(ctx context.Context, period string) (int, error) {
+	start, end, err := model.StatementPeriodRange(period)
+	if err != nil {
+		return 0, err
+	}
+	userIds, err := model.GetUserStatementActiveUserIds(start, end)
+	if err != nil {
+		return 0, err
+	}
+	closed, err := model.GetStatementClosedUserIds(period)
+	if err != nil {
+		return 0, err
+	}
+	generated := 0
+	for _, userId := range userIds {
+		if closed[userId] {
+			continue
+		}
+		if _, err := GenerateStatement(userId, period); err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("generate statement for user %d period %s failed: %v", userId, period, err))
+			continue
+		}
+		generated++
+	}
+	return generated, nil
+}
+
+// StartStatementCloseTask 每月初自动为上月出账
+func StartStatementCloseTask() {
+	statementCloseOnce.Do(func() {
+		model.RegisterLeaseJob(model.JobStatementClose)
+		gopool.Go(func() {
+			ticker := time.NewTicker(statementCloseTickInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				runStatementCloseOnce()
+			}
+		})
+	})
+}
+
+func runStatementCloseOnce() {
+	if !system_setting.GetStatementSetting().AutoCloseEnabled || !model.IsJobLeader(model.JobStatementClose) {
+		return
+	}
+	now := time.Now()
+	period := model.StatementPeriodOf(time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local).AddDate(0, -1, 0))
+	if period == statementLastClosePeriod {
+		return
+	}
+	ctx := context.Background()
+	generated, err := CloseStatementPeriod(ctx, period)
+	if err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("close statement period %s failed: %v", period, err))
+		return
+	}
+	statementLastClosePeriod = period
+	common.SysLog(fmt.Sprintf("statement period %s closed, %d statements generated", period, generated))
+}
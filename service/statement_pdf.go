@@ -0,0 +1,239 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+)
+
+// 页面尺寸为 A4（单位 pt）
+const (
+	statementPDFWidth  = 595.0
+	statementPDFHeight = 842.0
+	statementPDFMargin = 50.0
+	statementPDFLine   = 16.0
+)
+
+// statementPDF 极简 PDF 生成器，仅使用内置的 Helvetica 字体，无需外部依赖。
+// 内置字体只覆盖拉丁字符，其余字符以 ? 代替
+type statementPDF struct {
+	pages []*bytes.Buffer
+	page  *bytes.Buffer
+	y     float64
+}
+
+func newStatementPDF() *statementPDF {
+	p := &statementPDF{}
+	p.newPage()
+	return p
+}
+
+func (p *statementPDF) newPage() {
+	p.page = &bytes.Buffer{}
+	p.pages = append(p.pages, p.page)
+	p.y = statementPDFHeight - statementPDFMargin
+}
+
+// ensure 剩余空间不足时换页
+func (p *statementPDF) ensure(lines int) {
+	if p.y-float64(lines)*statementPDFLine < statementPDFMargin {
+		p.newPage()
+	}
+}
+
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r > 0x7e:
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// pdfTextWidth 估算 Helvetica 下的文本宽度，用于右对齐金额
+func pdfTextWidth(s string, size float64) float64 {
+	var w float64
+	for _, r := range s {
+		switch r {
+		case '.', ',', ' ', '/':
+			w += 278
+		case '-', '(', ')':
+			w += 333
+		default:
+			w += 556
+		}
+	}
+	return w * size / 1000
+}
+
+func (p *statementPDF) text(x float64, size float64, bold bool, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(p.page, "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, p.y, pdfEscape(s))
+}
+
+func (p *statementPDF) textRight(x float64, size float64, bold bool, s string) {
+	p.text(x-pdfTextWidth(s, size), size, bold, s)
+}
+
+func (p *statementPDF) rule() {
+	fmt.Fprintf(p.page, "0.85 G %.2f %.2f m %.2f %.2f l S 0 G\n",
+		statementPDFMargin, p.y-4, statementPDFWidth-statementPDFMargin, p.y-4)
+}
+
+func (p *statementPDF) next() {
+	p.y -= statementPDFLine
+}
+
+// row 输出一行表格，cols 为各列左侧 x 坐标，right 标记的列按下一列起点（或页边距）右对齐
+func (p *statementPDF) row(cols []float64, right []bool, bold bool, values ...string) {
+	p.ensure(1)
+	for i, v := range values {
+		if i < len(right) && right[i] {
+			end := statementPDFWidth - statementPDFMargin
+			if i+1 < len(cols) {
+				end = cols[i+1] - 8
+			}
+			p.textRight(end, 9, bold, v)
+		} else {
+			p.text(cols[i], 9, bold, v)
+		}
+	}
+	p.rule()
+	p.next()
+}
+
+func (p *statementPDF) bytes() []byte {
+	var out bytes.Buffer
+	var offsets []int
+	obj := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	out.WriteString("%PDF-1.4\n")
+
+	// 1 目录，2 页面树，3/4 字体，之后每页依次为页面对象与内容流
+	kids := make([]string, len(p.pages))
+	for i := range p.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+i*2)
+	}
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages)))
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, page := range p.pages {
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] "+
+			"/Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			statementPDFWidth, statementPDFHeight, 6+i*2))
+		obj(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
+
+// RenderStatementPDF 输出 PDF 发票，内容与 HTML 版本一致
+func RenderStatementPDF(statement *model.Statement) ([]byte, error) {
+	invoice, err := BuildStatementInvoice(statement)
+	if err != nil {
+		return nil, err
+	}
+	quota := func(v int64) string { return logger.FormatQuota(int(v)) }
+	money := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+	left := statementPDFMargin
+	right := statementPDFWidth - statementPDFMargin
+
+	p := newStatementPDF()
+	p.text(left, 22, true, "Invoice")
+	company := []string{invoice.Setting.CompanyName, invoice.Setting.CompanyAddress, invoice.Setting.CompanyEmail}
+	if invoice.Setting.CompanyTaxId != "" {
+		company = append(company, "Tax ID: "+invoice.Setting.CompanyTaxId)
+	}
+	headers := []string{
+		statement.InvoiceNo,
+		"Period: " + statement.Period,
+		"Issued: " + invoice.IssuedAt,
+		fmt.Sprintf("Bill to: %s (#%d)", statement.Username, statement.UserId),
+	}
+	p.next()
+	p.next()
+	for i := 0; i < len(headers) || i < len(company); i++ {
+		if i < len(headers) {
+			p.text(left, 10, false, headers[i])
+		}
+		if i < len(company) && company[i] != "" {
+			p.textRight(right, 10, i == 0, company[i])
+		}
+		p.next()
+	}
+	p.next()
+
+	payCols := []float64{left, left + 80, left + 280, left + 400}
+	payRight := []bool{false, false, false, true}
+	p.row(payCols, payRight, true, "Date", "Description", "Reference", "Amount ("+invoice.Setting.Currency+")")
+	for _, line := range invoice.Lines {
+		p.row(payCols, payRight, false, line.Date, line.Description, line.Reference, money(line.Amount))
+	}
+	if len(invoice.Lines) == 0 {
+		p.row(payCols, payRight, false, "", "No payments in this period")
+	}
+	taxName := invoice.Setting.TaxName
+	if invoice.Setting.TaxInclusive {
+		taxName += " (included)"
+	}
+	p.row(payCols, payRight, false, "", "", "Subtotal", money(invoice.Subtotal))
+	p.row(payCols, payRight, false, "", "", taxName, money(invoice.Tax))
+	p.row(payCols, payRight, true, "", "", "Total", money(invoice.Total))
+	p.next()
+
+	p.ensure(10)
+	p.text(left, 12, true, "Account Summary")
+	p.next()
+	sumCols := []float64{left, left + 300}
+	sumRight := []bool{false, true}
+	p.row(sumCols, sumRight, false, "Opening balance", quota(statement.OpeningBalance))
+	p.row(sumCols, sumRight, false, "Top-ups", quota(statement.TopUpQuota))
+	p.row(sumCols, sumRight, false, "Redemptions", quota(statement.RedemptionQuota))
+	p.row(sumCols, sumRight, false, "Consumption", "-"+quota(statement.ConsumedQuota))
+	p.row(sumCols, sumRight, false, "Refunds", quota(statement.RefundQuota))
+	p.row(sumCols, sumRight, false, "Adjustments", quota(statement.AdjustmentQuota))
+	p.row(sumCols, sumRight, true, "Closing balance", quota(statement.ClosingBalance))
+	p.row(sumCols, sumRight, false, "Covered by subscription", quota(statement.SubscriptionConsumedQuota))
+	p.next()
+
+	p.ensure(3)
+	p.text(left, 12, true, "Usage by Model")
+	p.next()
+	modelCols := []float64{left, left + 170, left + 230, left + 300, left + 370, left + 430}
+	modelRight := []bool{false, true, true, true, true, true}
+	p.row(modelCols, modelRight, true, "Model", "Requests", "Prompt", "Completion", "Wallet", "Subscription")
+	for _, m := range invoice.Details.Models {
+		p.row(modelCols, modelRight, false, m.ModelName, strconv.FormatInt(m.Requests, 10),
+			strconv.FormatInt(m.PromptTokens, 10), strconv.FormatInt(m.CompletionTokens, 10),
+			quota(m.Quota), quota(m.SubscriptionQuota))
+	}
+	if invoice.Setting.Footer != "" {
+		p.next()
+		p.ensure(1)
+		p.text(left, 9, false, invoice.Setting.Footer)
+	}
+	return p.bytes(), nil
+}
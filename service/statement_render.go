@@ -0,0 +1,223 @@
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+// StatementInvoiceLine 发票中的收款明细
+type StatementInvoiceLine struct {
+	Date        string
+	Description string
+	Reference   string
+	Amount      float64
+}
+
+// StatementInvoice 发票渲染数据
+type StatementInvoice struct {
+	Setting   system_setting.StatementSetting
+	Statement *model.Statement
+	Details   *model.StatementDetails
+	IssuedAt  string
+	Lines     []StatementInvoiceLine
+	Subtotal  float64
+	Tax       float64
+	Total     float64
+}
+
+func formatStatementDate(ts int64) string {
+	if ts == 0 {
+		return ""
+	}
+	return time.Unix(ts, 0).In(time.Local).Format("2006-01-02")
+}
+
+// BuildStatementInvoice 以账期内的实际支付（充值与订阅）作为发票金额，按配置计算税额
+func BuildStatementInvoice(statement *model.Statement) (*StatementInvoice, error) {
+	details, err := statement.GetDetails()
+	if err != nil {
+		return nil, err
+	}
+	invoice := &StatementInvoice{
+		Setting:   *system_setting.GetStatementSetting(),
+		Statement: statement,
+		Details:   details,
+		IssuedAt:  formatStatementDate(statement.CreatedAt),
+	}
+	var paid float64
+	for _, t := range details.TopUps {
+		invoice.Lines = append(invoice.Lines, StatementInvoiceLine{
+			Date:        formatStatementDate(t.CompleteTime),
+			Description: fmt.Sprintf("Top-up (%s)", t.PaymentMethod),
+			Reference:   t.TradeNo,
+			Amount:      t.Money,
+		})
+		paid += t.Money
+	}
+	for _, s := range details.Subscriptions {
+		desc := "Subscription"
+		if s.PlanTitle != "" {
+			desc = "Subscription: " + s.PlanTitle
+		}
+		invoice.Lines = append(invoice.Lines, StatementInvoiceLine{
+			Date:        formatStatementDate(s.CompleteTime),
+			Description: desc,
+			Reference:   s.TradeNo,
+			Amount:      s.Money,
+		})
+		paid += s.Money
+	}
+
+	rate := invoice.Setting.TaxRate / 100
+	if invoice.Setting.TaxInclusive {
+		invoice.Total = paid
+		invoice.Tax = paid * rate / (1 + rate)
+		invoice.Subtotal = paid - invoice.Tax
+	} else {
+		invoice.Subtotal = paid
+		invoice.Tax = paid * rate
+		invoice.Total = paid + invoice.Tax
+	}
+	return invoice, nil
+}
+
+// RenderStatementCSV 输出对账单 CSV：汇总、支付明细与按模型的消费明细
+func RenderStatementCSV(statement *model.Statement) ([]byte, error) {
+	invoice, err := BuildStatementInvoice(statement)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	quota := func(v int64) string { return logger.FormatQuota(int(v)) }
+	money := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+
+	rows := [][]string{
+		{"Invoice No", statement.InvoiceNo},
+		{"Period", statement.Period},
+		{"User", statement.Username},
+		{"Opening Balance", quota(statement.OpeningBalance)},
+		{"Top-ups", quota(statement.TopUpQuota)},
+		{"Redemptions", quota(statement.RedemptionQuota)},
+		{"Consumption", quota(statement.ConsumedQuota)},
+		{"Subscription Consumption", quota(statement.SubscriptionConsumedQuota)},
+		{"Refunds", quota(statement.RefundQuota)},
+		{"Adjustments", quota(statement.AdjustmentQuota)},
+		{"Closing Balance", quota(statement.ClosingBalance)},
+		{},
+		{"Date", "Description", "Reference", "Amount (" + invoice.Setting.Currency + ")"},
+	}
+	for _, line := range invoice.Lines {
+		rows = append(rows, []string{line.Date, line.Description, line.Reference, money(line.Amount)})
+	}
+	rows = append(rows,
+		[]string{"", "Subtotal", "", money(invoice.Subtotal)},
+		[]string{"", invoice.Setting.TaxName, "", money(invoice.Tax)},
+		[]string{"", "Total", "", money(invoice.Total)},
+		[]string{},
+		[]string{"Model", "Requests", "Prompt Tokens", "Completion Tokens", "Wallet Quota", "Subscription Quota", "Refunds"},
+	)
+	for _, m := range invoice.Details.Models {
+		rows = append(rows, []string{m.ModelName, strconv.FormatInt(m.Requests, 10),
+			strconv.FormatInt(m.PromptTokens, 10), strconv.FormatInt(m.CompletionTokens, 10),
+			quota(m.Quota), quota(m.SubscriptionQuota), quota(m.RefundQuota + m.SubscriptionRefundedQuota)})
+	}
+	if len(invoice.Details.Redemptions) > 0 {
+		rows = append(rows, []string{}, []string{"Redeemed At", "Redemption", "Id", "Quota"})
+		for _, r := range invoice.Details.Redemptions {
+			rows = append(rows, []string{formatStatementDate(r.RedeemedTime), r.Name, strconv.Itoa(r.Id), quota(r.Quota)})
+		}
+	}
+	if err := w.WriteAll(rows); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var statementHTMLTemplate = template.Must(template.New("invoice").Funcs(template.FuncMap{
+	"quota": func(v int64) string { return logger.FormatQuota(int(v)) },
+	"money": func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Statement.InvoiceNo}}</title>
+<style>
+body{font-family:-apple-system,"Segoe UI",Helvetica,Arial,sans-serif;color:#222;max-width:800px;margin:40px auto;font-size:14px}
+h1{font-size:24px;margin:0}
+table{width:100%;border-collapse:collapse;margin:16px 0}
+th,td{padding:6px 8px;border-bottom:1px solid #e5e5e5;text-align:left}
+td.num,th.num{text-align:right}
+.header{display:flex;justify-content:space-between}
+.muted{color:#777}
+@media print{body{margin:0}}
+</style>
+</head>
+<body>
+<div class="header">
+<div>
+<h1>Invoice</h1>
+<div class="muted">{{.Statement.InvoiceNo}}</div>
+<div>Period: {{.Statement.Period}}</div>
+<div>Issued: {{.IssuedAt}}</div>
+</div>
+<div>
+{{with .Setting.CompanyName}}<strong>{{.}}</strong><br>{{end}}
+{{with .Setting.CompanyAddress}}{{.}}<br>{{end}}
+{{with .Setting.CompanyTaxId}}Tax ID: {{.}}<br>{{end}}
+{{with .Setting.CompanyEmail}}{{.}}{{end}}
+</div>
+</div>
+<p>Bill to: <strong>{{.Statement.Username}}</strong> (#{{.Statement.UserId}})</p>
+
+<table>
+<tr><th>Date</th><th>Description</th><th>Reference</th><th class="num">Amount ({{.Setting.Currency}})</th></tr>
+{{range .Lines}}<tr><td>{{.Date}}</td><td>{{.Description}}</td><td>{{.Reference}}</td><td class="num">{{money .Amount}}</td></tr>
+{{else}}<tr><td colspan="4" class="muted">No payments in this period</td></tr>
+{{end}}<tr><td colspan="3" class="num">Subtotal</td><td class="num">{{money .Subtotal}}</td></tr>
+<tr><td colspan="3" class="num">{{.Setting.TaxName}}{{if .Setting.TaxInclusive}} (included){{end}}</td><td class="num">{{money .Tax}}</td></tr>
+<tr><td colspan="3" class="num"><strong>Total</strong></td><td class="num"><strong>{{money .Total}}</strong></td></tr>
+</table>
+
+<h3>Account Summary</h3>
+<table>
+<tr><td>Opening balance</td><td class="num">{{quota .Statement.OpeningBalance}}</td></tr>
+<tr><td>Top-ups</td><td class="num">{{quota .Statement.TopUpQuota}}</td></tr>
+<tr><td>Redemptions</td><td class="num">{{quota .Statement.RedemptionQuota}}</td></tr>
+<tr><td>Consumption</td><td class="num">-{{quota .Statement.ConsumedQuota}}</td></tr>
+<tr><td>Refunds</td><td class="num">{{quota .Statement.RefundQuota}}</td></tr>
+<tr><td>Adjustments</td><td class="num">{{quota .Statement.AdjustmentQuota}}</td></tr>
+<tr><td><strong>Closing balance</strong></td><td class="num"><strong>{{quota .Statement.ClosingBalance}}</strong></td></tr>
+<tr><td class="muted">Covered by subscription</td><td class="num muted">{{quota .Statement.SubscriptionConsumedQuota}}</td></tr>
+</table>
+
+<h3>Usage by Model</h3>
+<table>
+<tr><th>Model</th><th class="num">Requests</th><th class="num">Prompt</th><th class="num">Completion</th><th class="num">Wallet</th><th class="num">Subscription</th></tr>
+{{range .Details.Models}}<tr><td>{{.ModelName}}</td><td class="num">{{.Requests}}</td><td class="num">{{.PromptTokens}}</td><td class="num">{{.CompletionTokens}}</td><td class="num">{{quota .Quota}}</td><td class="num">{{quota .SubscriptionQuota}}</td></tr>
+{{end}}</table>
+{{with .Setting.Footer}}<p class="muted">{{.}}</p>{{end}}
+</body>
+</html>
+`))
+
+// RenderStatementHTML 输出可打印的 HTML 发票
+func RenderStatementHTML(statement *model.Statement) ([]byte, error) {
+	invoice, err := BuildStatementInvoice(statement)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := statementHTMLTemplate.Execute(&buf, invoice); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateStatement(t *testing.T) {
+	truncate(t)
+	t.Cleanup(func() {
+		model.DB.Exec("DELETE FROM top_ups")
+		model.DB.Exec("DELETE FROM redemptions")
+		model.DB.Exec("DELETE FROM statements")
+	})
+
+	const userID = 80
+	// 当前余额 100000，账期结束后又消费了 5000
+	seedUser(t, userID, 100000)
+
+	start, end, err := model.StatementPeriodRange("2024-03")
+	require.NoError(t, err)
+	mid := start + 86400
+
+	require.NoError(t, model.DB.Create(&model.TopUp{UserId: userID, Amount: 2, Money: 14, TradeNo: "stmt-epay-1",
+		PaymentMethod: "alipay", CompleteTime: mid, Status: common.TopUpStatusSuccess}).Error)
+	require.NoError(t, model.DB.Create(&model.TopUp{UserId: userID, Amount: 9, Money: 63, TradeNo: "stmt-pending",
+		PaymentMethod: "alipay", CompleteTime: mid, Status: common.TopUpStatusPending}).Error)
+	require.NoError(t, model.DB.Create(&model.Redemption{Key: strings.Repeat("a", 32), Name: "promo", Quota: 20000,
+		Status: common.RedemptionCodeStatusUsed, UsedUserId: userID, RedeemedTime: mid}).Error)
+
+	logs := []*model.Log{
+		{UserId: userID, CreatedAt: mid, Type: model.LogTypeConsume, ModelName: "gpt-4o", Quota: 30000, PromptTokens: 100, CompletionTokens: 10},
+		{UserId: userID, CreatedAt: mid, Type: model.LogTypeConsume, ModelName: "gpt-4o", Quota: 7000,
+			Other: `{"billing_source":"subscription","subscription_id":1}`},
+		{UserId: userID, CreatedAt: mid, Type: model.LogTypeRefund, ModelName: "sora-2", Quota: 4000},
+		{UserId: userID, CreatedAt: end + 10, Type: model.LogTypeConsume, ModelName: "gpt-4o", Quota: 5000},
+	}
+	require.NoError(t, model.LOG_DB.Create(&logs).Error)
+
+	statement, err := GenerateStatement(userID, "2024-03")
+	require.NoError(t, err)
+
+	topUpQuota := int64(2 * common.QuotaPerUnit)
+	assert.Equal(t, topUpQuota, statement.TopUpQuota)
+	assert.Equal(t, 14.0, statement.TopUpMoney)
+	assert.Equal(t, int64(20000), statement.RedemptionQuota)
+	assert.Equal(t, int64(30000), statement.ConsumedQuota)
+	assert.Equal(t, int64(7000), statement.SubscriptionConsumedQuota)
+	assert.Equal(t, int64(4000), statement.RefundQuota)
+	assert.Equal(t, int64(2), statement.RequestCount)
+	assert.Equal(t, int64(105000), statement.ClosingBalance)
+	assert.Equal(t, int64(105000)-(topUpQuota+20000-30000+4000), statement.OpeningBalance)
+	assert.Equal(t, int64(0), statement.AdjustmentQuota)
+
+	details, err := statement.GetDetails()
+	require.NoError(t, err)
+	assert.Len(t, details.TopUps, 1)
+	require.Len(t, details.Models, 2)
+
+	// 重新生成写入新修订版，原对账单不变，期末余额沿用首次出账的快照
+	model.LOG_DB.Where("user_id = ? and created_at > ?", userID, end).Delete(&model.Log{})
+	again, err := GenerateStatement(userID, "2024-03")
+	require.NoError(t, err)
+	assert.NotEqual(t, statement.Id, again.Id)
+	assert.Equal(t, 2, again.Revision)
+	assert.Equal(t, statement.InvoiceNo+"-R2", again.InvoiceNo)
+	assert.Equal(t, statement.ClosingBalance, again.ClosingBalance)
+	original, err := model.GetStatementById(statement.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 1, original.Revision)
+	assert.Equal(t, statement.InvoiceNo, original.InvoiceNo)
+
+	// 下一账期沿用上期期末余额
+	next, err := GenerateStatement(userID, "2024-04")
+	require.NoError(t, err)
+	assert.Equal(t, statement.ClosingBalance, next.OpeningBalance)
+
+	csvData, err := RenderStatementCSV(statement)
+	require.NoError(t, err)
+	assert.Contains(t, string(csvData), statement.InvoiceNo)
+	assert.Contains(t, string(csvData), "stmt-epay-1")
+
+	html, err := RenderStatementHTML(statement)
+	require.NoError(t, err)
+	assert.Contains(t, string(html), "gpt-4o")
+
+	pdf, err := RenderStatementPDF(statement)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(pdf), "%PDF-"))
+	assert.Contains(t, string(pdf), "(gpt-4o) Tj")
+	assert.True(t, strings.HasSuffix(string(pdf), "%%EOF\n"))
+
+	_, err = GenerateStatement(userID, model.StatementPeriodOf(time.Now()))
+	assert.Error(t, err)
+}
@@ -28,9 +28,7 @@ var (
 
 func StartSubscriptionQuotaResetTask() {
 	subscriptionResetOnce.Do(func() {
-		if !common.IsMasterNode {
-			return
-		}
+		model.RegisterLeaseJob(model.JobSubscriptionReset)
 		gopool.Go(func() {
 			logger.LogInfo(context.Background(), fmt.Sprintf("subscription quota reset task started: tick=%s", subscriptionResetTickInterval))
 			ticker := time.NewTicker(subscriptionResetTickInterval)
@@ -45,15 +43,18 @@ func StartSubscriptionQuotaResetTask() {
 }
 
 func runSubscriptionQuotaResetOnce() {
+	ctx, ok := model.JobLeaderContext(model.JobSubscriptionReset)
+	if !ok {
+		return
+	}
 	if !subscriptionResetRunning.CompareAndSwap(false, true) {
 		return
 	}
 	defer subscriptionResetRunning.Store(false)
 
-	ctx := context.Background()
 	totalReset := 0
 	totalExpired := 0
-	for {
+	for ctx.Err() == nil {
 		n, err := model.ExpireDueSubscriptions(subscriptionResetBatchSize)
 		if err != nil {
 			logger.LogWarn(ctx, fmt.Sprintf("subscription expire task failed: %v", err))
@@ -67,7 +68,7 @@ func runSubscriptionQuotaResetOnce() {
 			break
 		}
 	}
-	for {
+	for ctx.Err() == nil {
 		n, err := model.ResetDueSubscriptions(subscriptionResetBatchSize)
 		if err != nil {
 			logger.LogWarn(ctx, fmt.Sprintf("subscription quota reset task failed: %v", err))
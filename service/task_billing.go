@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"fmt"
+	"math"
 	"strings"
 
 	"github.com/QuantumNous/new-api/common"
@@ -51,14 +52,15 @@ func LogTaskConsumption(c *gin.Context, info *relaycommon.RelayInfo) {
 		other["upstream_model_name"] = info.UpstreamModelName
 	}
 	model.RecordConsumeLog(c, info.UserId, model.RecordConsumeLogParams{
-		ChannelId: info.ChannelId,
-		ModelName: info.OriginModelName,
-		TokenName: tokenName,
-		Quota:     info.PriceData.Quota,
-		Content:   logContent,
-		TokenId:   info.TokenId,
-		Group:     info.UsingGroup,
-		Other:     other,
+		ChannelId:    info.ChannelId,
+		ModelName:    info.OriginModelName,
+		TokenName:    tokenName,
+		Quota:        info.PriceData.Quota,
+		UpstreamCost: CalculateUpstreamCost(info, info.PriceData.Quota, 0, 0, 0),
+		Content:      logContent,
+		TokenId:      info.TokenId,
+		Group:        info.UsingGroup,
+		Other:        other,
 	})
 	model.UpdateUserUsedQuotaAndRequestCount(info.UserId, info.PriceData.Quota)
 	model.UpdateChannelUsedQuota(info.ChannelId, info.PriceData.Quota)
@@ -131,6 +133,9 @@ func taskBillingOther(task *model.Task) map[string]interface{} {
 			}
 		}
 	}
+	if task.PrivateData.BillingSource != "" {
+		other["billing_source"] = task.PrivateData.BillingSource
+	}
 	props := task.Properties
 	if props.UpstreamModelName != "" && props.UpstreamModelName != props.OriginModelName {
 		other["is_model_mapped"] = true
@@ -139,6 +144,32 @@ func taskBillingOther(task *model.Task) map[string]interface{} {
 	return other
 }
 
+// taskRefundUpstreamCost 按退款占预扣额度的比例估算退还部分对应的上游成本，
+// 与提交时记录的成本使用同样的渠道成本配置
+func taskRefundUpstreamCost(task *model.Task, refundQuota int, preConsumedQuota int) int {
+	if refundQuota <= 0 || preConsumedQuota <= 0 {
+		return 0
+	}
+	ch, err := model.CacheGetChannel(task.ChannelId)
+	if err != nil || ch == nil {
+		return 0
+	}
+	upstreamModel := task.Properties.UpstreamModelName
+	if upstreamModel == "" {
+		upstreamModel = taskModelName(task)
+	}
+	info := &relaycommon.RelayInfo{OriginModelName: taskModelName(task)}
+	info.ChannelMeta = &relaycommon.ChannelMeta{
+		ChannelOtherSettings: ch.GetOtherSettings(),
+		UpstreamModelName:    upstreamModel,
+	}
+	if bc := task.PrivateData.BillingContext; bc != nil {
+		info.PriceData.GroupRatioInfo.GroupRatio = bc.GroupRatio
+	}
+	cost := CalculateUpstreamCost(info, preConsumedQuota, 0, 0, 0)
+	return int(math.Round(float64(cost) * float64(min(refundQuota, preConsumedQuota)) / float64(preConsumedQuota)))
+}
+
 // taskModelName 从 BillingContext 或 Properties 中获取模型名称。
 func taskModelName(task *model.Task) string {
 	if bc := task.PrivateData.BillingContext; bc != nil && bc.OriginModelName != "" {
@@ -169,15 +200,16 @@ func RefundTaskQuota(ctx context.Context, task *model.Task, reason string) {
 	other["task_id"] = task.TaskID
 	other["reason"] = reason
 	model.RecordTaskBillingLog(model.RecordTaskBillingLogParams{
-		UserId:    task.UserId,
-		LogType:   model.LogTypeRefund,
-		Content:   "",
-		ChannelId: task.ChannelId,
-		ModelName: taskModelName(task),
-		Quota:     quota,
-		TokenId:   task.PrivateData.TokenId,
-		Group:     task.Group,
-		Other:     other,
+		UserId:       task.UserId,
+		LogType:      model.LogTypeRefund,
+		Content:      "",
+		ChannelId:    task.ChannelId,
+		ModelName:    taskModelName(task),
+		Quota:        quota,
+		UpstreamCost: taskRefundUpstreamCost(task, quota, quota),
+		TokenId:      task.PrivateData.TokenId,
+		Group:        task.Group,
+		Other:        other,
 	})
 }
 
@@ -218,6 +250,7 @@ func RecalculateTaskQuota(ctx context.Context, task *model.Task, actualQuota int
 
 	var logType int
 	var logQuota int
+	var upstreamCost int
 	if quotaDelta > 0 {
 		logType = model.LogTypeConsume
 		logQuota = quotaDelta
@@ -226,21 +259,23 @@ func RecalculateTaskQuota(ctx context.Context, task *model.Task, actualQuota int
 	} else {
 		logType = model.LogTypeRefund
 		logQuota = -quotaDelta
+		upstreamCost = taskRefundUpstreamCost(task, logQuota, preConsumedQuota)
 	}
 	other := taskBillingOther(task)
 	other["task_id"] = task.TaskID
 	other["pre_consumed_quota"] = preConsumedQuota
 	other["actual_quota"] = actualQuota
 	model.RecordTaskBillingLog(model.RecordTaskBillingLogParams{
-		UserId:    task.UserId,
-		LogType:   logType,
-		Content:   reason,
-		ChannelId: task.ChannelId,
-		ModelName: taskModelName(task),
-		Quota:     logQuota,
-		TokenId:   task.PrivateData.TokenId,
-		Group:     task.Group,
-		Other:     other,
+		UserId:       task.UserId,
+		LogType:      logType,
+		Content:      reason,
+		ChannelId:    task.ChannelId,
+		ModelName:    taskModelName(task),
+		Quota:        logQuota,
+		UpstreamCost: upstreamCost,
+		TokenId:      task.PrivateData.TokenId,
+		Group:        task.Group,
+		Other:        other,
 	})
 }
 
@@ -260,6 +295,10 @@ func RecalculateTaskQuotaByTokens(ctx context.Context, task *model.Task, totalTo
 	if !hasRatioSetting || modelRatio <= 0 {
 		return
 	}
+	// 优先使用提交时记录的倍率，其中已包含定价规则的调整
+	if bc := task.PrivateData.BillingContext; bc != nil && bc.ModelRatio > 0 {
+		modelRatio = bc.ModelRatio
+	}
 
 	// 获取用户和组的倍率信息
 	group := task.Group
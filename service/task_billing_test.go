@@ -43,6 +43,19 @@ func TestMain(m *testing.M) {
 		&model.Log{},
 		&model.Channel{},
 		&model.UserSubscription{},
+		&model.MediaObject{},
+		&model.MediaUserPolicy{},
+		&model.TaskWebhookDelivery{},
+		&model.TopUp{},
+		&model.Redemption{},
+		&model.SubscriptionOrder{},
+		&model.Statement{},
+		&model.Ability{},
+		&model.ChannelBalanceSnapshot{},
+		&model.Vendor{},
+		&model.Model{},
+		&model.PrefillGroup{},
+		&model.SubscriptionPlan{},
 	); err != nil {
 		panic("failed to migrate: " + err.Error())
 	}
@@ -217,6 +230,34 @@ func TestRefundTaskQuota_Wallet(t *testing.T) {
 	assert.Equal(t, "test-model", log.ModelName)
 }
 
+func TestRefundTaskQuota_RecordsUpstreamCost(t *testing.T) {
+	truncate(t)
+	ctx := context.Background()
+
+	const userID, tokenID, channelID = 5, 5, 5
+	seedUser(t, userID, 10000)
+	seedToken(t, tokenID, userID, "sk-test-cost", 5000)
+	ch := &model.Channel{Id: channelID, Name: "cost_channel", Key: "sk-test", Status: common.ChannelStatusEnabled,
+		OtherSettings: `{"upstream_cost_multiplier":0.5}`}
+	require.NoError(t, model.DB.Create(ch).Error)
+
+	// 退款日志记录退还部分的上游成本，毛利报表据此冲减
+	task := makeTask(userID, channelID, 3000, tokenID, BillingSourceWallet, 0)
+	RefundTaskQuota(ctx, task, "task failed")
+	log := getLastLog(t)
+	require.NotNil(t, log)
+	assert.Equal(t, model.LogTypeRefund, log.Type)
+	assert.Equal(t, 1500, log.UpstreamCost)
+
+	task = makeTask(userID, channelID, 3000, tokenID, BillingSourceWallet, 0)
+	RecalculateTaskQuota(ctx, task, 1000, "adaptor调整")
+	log = getLastLog(t)
+	require.NotNil(t, log)
+	assert.Equal(t, model.LogTypeRefund, log.Type)
+	assert.Equal(t, 2000, log.Quota)
+	assert.Equal(t, 1000, log.UpstreamCost)
+}
+
 func TestRefundTaskQuota_Subscription(t *testing.T) {
 	truncate(t)
 	ctx := context.Background()
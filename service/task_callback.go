@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/relay/channel/task/taskcommon"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+var (
+	ErrTaskCallbackInvalidToken = errors.New("invalid callback token")
+	ErrTaskCallbackUnsupported  = errors.New("platform does not support callbacks")
+)
+
+// TaskCallbackAdaptor 支持上游推送回调的任务适配器。
+// 推送内容先转换为 FetchTask 的响应格式，再走与轮询相同的 ParseTaskResult 与结算流程。
+type TaskCallbackAdaptor interface {
+	NormalizeTaskCallback(body []byte) ([]byte, error)
+}
+
+// HandleTaskCallback 处理上游回调推送
+func HandleTaskCallback(ctx context.Context, platform string, taskID string, token string, body []byte) error {
+	expected := taskcommon.TaskCallbackToken(platform, taskID)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+		return ErrTaskCallbackInvalidToken
+	}
+	task, exists, err := model.GetByOnlyTaskId(taskID)
+	if err != nil {
+		return err
+	}
+	if !exists || string(task.Platform) != platform {
+		return fmt.Errorf("task %s not found", taskID)
+	}
+	if task.Status.IsFinished() {
+		// 终态任务忽略重复推送
+		return nil
+	}
+	adaptor := GetTaskAdaptorFunc(constant.TaskPlatform(platform))
+	if adaptor == nil {
+		return ErrTaskCallbackUnsupported
+	}
+	callbackAdaptor, ok := adaptor.(TaskCallbackAdaptor)
+	if !ok {
+		return ErrTaskCallbackUnsupported
+	}
+	ch, err := model.CacheGetChannel(task.ChannelId)
+	if err != nil {
+		return err
+	}
+	info := &relaycommon.RelayInfo{}
+	info.ChannelMeta = &relaycommon.ChannelMeta{
+		ChannelBaseUrl: ch.GetBaseURL(),
+	}
+	// 多密钥渠道需使用提交任务时的密钥
+	info.ApiKey = ch.Key
+	if task.PrivateData.Key != "" {
+		info.ApiKey = task.PrivateData.Key
+	}
+	adaptor.Init(info)
+
+	normalized, err := callbackAdaptor.NormalizeTaskCallback(body)
+	if err != nil {
+		return err
+	}
+	logger.LogDebug(ctx, fmt.Sprintf("task %s received upstream callback: %s", taskID, string(body)))
+	return applyVideoTaskResult(ctx, adaptor, task, normalized)
+}
+
+// waitingForTaskCallback 已配置上游回调且尚未超过兜底时间的任务不参与轮询
+func waitingForTaskCallback(task *model.Task, now int64) bool {
+	if !task.PrivateData.UpstreamCallback {
+		return false
+	}
+	fallback := int64(system_setting.GetTaskCallbackSetting().PollingFallbackSeconds)
+	last := task.SubmitTime
+	if task.UpdatedAt > last {
+		last = task.UpdatedAt
+	}
+	return now-last < fallback
+}
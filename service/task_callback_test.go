@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/relay/channel/task/taskcommon"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/stretchr/testify/require"
+)
+
+type callbackMockAdaptor struct {
+	mockAdaptor
+	key string
+}
+
+func (m *callbackMockAdaptor) Init(info *relaycommon.RelayInfo) { m.key = info.ApiKey }
+
+func (m *callbackMockAdaptor) NormalizeTaskCallback(body []byte) ([]byte, error) { return body, nil }
+
+func (m *callbackMockAdaptor) ParseTaskResult(body []byte) (*relaycommon.TaskInfo, error) {
+	return &relaycommon.TaskInfo{Status: string(body), Url: "https://example.com/video.mp4"}, nil
+}
+
+func TestHandleTaskCallback(t *testing.T) {
+	truncate(t)
+	seedUser(t, 1, 0)
+	seedChannel(t, 1)
+	task := makeTask(1, 1, 0, 0, BillingSourceWallet, 0)
+	task.Platform = "52"
+	task.PrivateData.UpstreamTaskID = "upstream_1"
+	task.PrivateData.BillingContext.PerCallBilling = true
+	task.PrivateData.Key = "sk-submit-key"
+	require.NoError(t, model.DB.Create(task).Error)
+
+	adaptor := &callbackMockAdaptor{}
+	saved := GetTaskAdaptorFunc
+	GetTaskAdaptorFunc = func(platform constant.TaskPlatform) TaskPollingAdaptor {
+		return adaptor
+	}
+	t.Cleanup(func() { GetTaskAdaptorFunc = saved })
+
+	ctx := context.Background()
+	err := HandleTaskCallback(ctx, "52", task.TaskID, "bad-token", []byte(model.TaskStatusSuccess))
+	require.ErrorIs(t, err, ErrTaskCallbackInvalidToken)
+
+	token := taskcommon.TaskCallbackToken("52", task.TaskID)
+	require.Error(t, HandleTaskCallback(ctx, "53", task.TaskID, taskcommon.TaskCallbackToken("53", task.TaskID), []byte(model.TaskStatusSuccess)))
+	require.NoError(t, HandleTaskCallback(ctx, "52", task.TaskID, token, []byte(model.TaskStatusSuccess)))
+	require.Equal(t, "sk-submit-key", adaptor.key)
+
+	reloaded, exists, err := model.GetByOnlyTaskId(task.TaskID)
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.EqualValues(t, model.TaskStatusSuccess, reloaded.Status)
+	require.Equal(t, "https://example.com/video.mp4", reloaded.GetResultURL())
+}
+
+func TestWaitingForTaskCallback(t *testing.T) {
+	task := &model.Task{SubmitTime: 1000}
+	require.False(t, waitingForTaskCallback(task, 1010))
+	task.PrivateData.UpstreamCallback = true
+	require.True(t, waitingForTaskCallback(task, 1010))
+	require.False(t, waitingForTaskCallback(task, 2000))
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+var (
+	ErrTaskCancelDisabled    = errors.New("task cancellation is disabled")
+	ErrTaskNotCancellable    = errors.New("task has already finished")
+	ErrTaskCancelUnsupported = errors.New("platform does not support cancelling tasks")
+)
+
+const taskCancelReason = "用户取消"
+
+// TaskCancelAdaptor 支持调用上游取消接口的任务适配器。
+// 返回值为上游已完成工作的比例（0~1），0 表示全额退款；上游拒绝取消时返回 error。
+type TaskCancelAdaptor interface {
+	CancelTask(baseUrl, key string, upstreamTaskID string, proxy string) (float64, error)
+}
+
+// CancelTask 取消未完成的任务：先调用上游取消接口（如支持），再标记为已取消并退还预扣额度。
+// 上游报告已完成部分工作时，仅退还未完成部分。
+func CancelTask(ctx context.Context, task *model.Task) error {
+	setting := system_setting.GetTaskCancelSetting()
+	if !setting.Enabled {
+		return ErrTaskCancelDisabled
+	}
+	if task.Status.IsFinished() {
+		return ErrTaskNotCancellable
+	}
+
+	chargeRatio := 0.0
+	var adaptor TaskPollingAdaptor
+	if GetTaskAdaptorFunc != nil {
+		adaptor = GetTaskAdaptorFunc(task.Platform)
+	}
+	if cancelAdaptor, ok := adaptor.(TaskCancelAdaptor); ok {
+		ch, err := model.CacheGetChannel(task.ChannelId)
+		if err != nil {
+			return err
+		}
+		baseURL := constant.ChannelBaseURLs[ch.Type]
+		if ch.GetBaseURL() != "" {
+			baseURL = ch.GetBaseURL()
+		}
+		info := &relaycommon.RelayInfo{}
+		info.ChannelMeta = &relaycommon.ChannelMeta{
+			ChannelBaseUrl: baseURL,
+		}
+		// 多密钥渠道需使用提交任务时的密钥
+		key := ch.Key
+		if task.PrivateData.Key != "" {
+			key = task.PrivateData.Key
+		}
+		info.ApiKey = key
+		adaptor.Init(info)
+		ratio, err := cancelAdaptor.CancelTask(baseURL, key, task.GetUpstreamTaskID(), ch.GetSetting().Proxy)
+		if err != nil {
+			return fmt.Errorf("upstream cancel failed: %w", err)
+		}
+		chargeRatio = min(max(ratio, 0), 1)
+	} else if !setting.AllowLocalCancel {
+		return ErrTaskCancelUnsupported
+	}
+
+	oldStatus := task.Status
+	task.Status = model.TaskStatusCancelled
+	task.Progress = "100%"
+	task.FinishTime = time.Now().Unix()
+	task.FailReason = taskCancelReason
+	won, err := task.UpdateWithStatus(oldStatus)
+	if err != nil {
+		return err
+	}
+	if !won {
+		// 轮询已先一步将任务推进到其他状态
+		return ErrTaskNotCancellable
+	}
+	logger.LogInfo(ctx, fmt.Sprintf("task %s cancelled by user %d, charge ratio %.2f", task.TaskID, task.UserId, chargeRatio))
+
+	if actualQuota := int(float64(task.Quota) * chargeRatio); actualQuota > 0 {
+		RecalculateTaskQuota(ctx, task, actualQuota, taskCancelReason)
+	} else {
+		RefundTaskQuota(ctx, task, taskCancelReason)
+	}
+	EnqueueTaskWebhook(task)
+	return nil
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockCancelAdaptor struct {
+	mockAdaptor
+	ratio float64
+	err   error
+	key   string
+	calls int
+}
+
+func (m *mockCancelAdaptor) CancelTask(_ string, key string, _ string, _ string) (float64, error) {
+	m.calls++
+	m.key = key
+	return m.ratio, m.err
+}
+
+func useCancelAdaptor(t *testing.T, adaptor TaskPollingAdaptor) {
+	saved := GetTaskAdaptorFunc
+	GetTaskAdaptorFunc = func(constant.TaskPlatform) TaskPollingAdaptor { return adaptor }
+	t.Cleanup(func() { GetTaskAdaptorFunc = saved })
+}
+
+func TestCancelTask_FullRefund(t *testing.T) {
+	truncate(t)
+	ctx := context.Background()
+
+	const userID, tokenID, channelID = 60, 60, 60
+	const initQuota, preConsumed, tokenRemain = 10000, 3000, 5000
+	seedUser(t, userID, initQuota)
+	seedToken(t, tokenID, userID, "sk-cancel-full", tokenRemain)
+	seedChannel(t, channelID)
+
+	adaptor := &mockCancelAdaptor{}
+	useCancelAdaptor(t, adaptor)
+
+	task := makeTask(userID, channelID, preConsumed, tokenID, BillingSourceWallet, 0)
+	require.NoError(t, task.Insert())
+
+	require.NoError(t, CancelTask(ctx, task))
+	assert.Equal(t, 1, adaptor.calls)
+
+	reloaded, exist, err := model.GetByTaskId(userID, task.TaskID)
+	require.NoError(t, err)
+	require.True(t, exist)
+	assert.Equal(t, model.TaskStatus(model.TaskStatusCancelled), reloaded.Status)
+	assert.Equal(t, initQuota+preConsumed, getUserQuota(t, userID))
+	assert.Equal(t, tokenRemain+preConsumed, getTokenRemainQuota(t, tokenID))
+	assert.Equal(t, model.LogTypeRefund, getLastLog(t).Type)
+
+	// 已取消的任务不能再次取消
+	assert.ErrorIs(t, CancelTask(ctx, reloaded), ErrTaskNotCancellable)
+	assert.Equal(t, initQuota+preConsumed, getUserQuota(t, userID))
+}
+
+func TestCancelTask_PartialRefund(t *testing.T) {
+	truncate(t)
+	ctx := context.Background()
+
+	const userID, tokenID, channelID = 64, 64, 64
+	const initQuota, preConsumed, tokenRemain = 10000, 4000, 5000
+	seedUser(t, userID, initQuota)
+	seedToken(t, tokenID, userID, "sk-cancel-partial", tokenRemain)
+	seedChannel(t, channelID)
+
+	useCancelAdaptor(t, &mockCancelAdaptor{ratio: 0.5})
+
+	task := makeTask(userID, channelID, preConsumed, tokenID, BillingSourceWallet, 0)
+	require.NoError(t, task.Insert())
+
+	require.NoError(t, CancelTask(ctx, task))
+	assert.Equal(t, preConsumed/2, task.Quota)
+	assert.Equal(t, initQuota+preConsumed/2, getUserQuota(t, userID))
+	assert.Equal(t, tokenRemain+preConsumed/2, getTokenRemainQuota(t, tokenID))
+}
+
+func TestCancelTask_UsesTaskKey(t *testing.T) {
+	truncate(t)
+	ctx := context.Background()
+
+	const userID, tokenID, channelID = 61, 61, 61
+	const initQuota, preConsumed, tokenRemain = 10000, 4000, 5000
+	seedUser(t, userID, initQuota)
+	seedToken(t, tokenID, userID, "sk-cancel-key", tokenRemain)
+	seedChannel(t, channelID)
+
+	adaptor := &mockCancelAdaptor{}
+	useCancelAdaptor(t, adaptor)
+
+	task := makeTask(userID, channelID, preConsumed, tokenID, BillingSourceWallet, 0)
+	task.PrivateData.Key = "sk-submit-key"
+	require.NoError(t, task.Insert())
+
+	require.NoError(t, CancelTask(ctx, task))
+	assert.Equal(t, "sk-submit-key", adaptor.key)
+	assert.Equal(t, initQuota+preConsumed, getUserQuota(t, userID))
+}
+
+func TestCancelTask_LocalCancelDisabledByDefault(t *testing.T) {
+	truncate(t)
+	ctx := context.Background()
+
+	const userID, tokenID, channelID = 63, 63, 63
+	seedUser(t, userID, 10000)
+	seedToken(t, tokenID, userID, "sk-cancel-local", 5000)
+	seedChannel(t, channelID)
+
+	useCancelAdaptor(t, &mockAdaptor{})
+
+	task := makeTask(userID, channelID, 2000, tokenID, BillingSourceWallet, 0)
+	require.NoError(t, task.Insert())
+
+	assert.ErrorIs(t, CancelTask(ctx, task), ErrTaskCancelUnsupported)
+	assert.Equal(t, 10000, getUserQuota(t, userID))
+}
+
+func TestCancelTask_UpstreamRejects(t *testing.T) {
+	truncate(t)
+	ctx := context.Background()
+
+	const userID, tokenID, channelID = 62, 62, 62
+	const initQuota, preConsumed, tokenRemain = 10000, 2000, 5000
+	seedUser(t, userID, initQuota)
+	seedToken(t, tokenID, userID, "sk-cancel-reject", tokenRemain)
+	seedChannel(t, channelID)
+
+	useCancelAdaptor(t, &mockCancelAdaptor{err: errors.New("task is running")})
+
+	task := makeTask(userID, channelID, preConsumed, tokenID, BillingSourceWallet, 0)
+	require.NoError(t, task.Insert())
+
+	require.Error(t, CancelTask(ctx, task))
+
+	reloaded, _, err := model.GetByTaskId(userID, task.TaskID)
+	require.NoError(t, err)
+	assert.Equal(t, model.TaskStatus(model.TaskStatusInProgress), reloaded.Status)
+	assert.Equal(t, initQuota, getUserQuota(t, userID))
+	assert.Equal(t, int64(0), countLogs(t))
+}
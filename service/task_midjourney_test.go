@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeMidjourneyTask(t *testing.T, userId, channelId, quota, tokenId int) *model.Task {
+	t.Helper()
+	task := model.NewMidjourneyTask(&model.Midjourney{
+		UserId:     userId,
+		Action:     constant.MjActionImagine,
+		MjId:       "mj_" + time.Now().Format("150405.000"),
+		Prompt:     "a cat",
+		SubmitTime: time.Now().UnixMilli(),
+		Progress:   "0%",
+		ChannelId:  channelId,
+		Quota:      quota,
+		Code:       1,
+	})
+	task.PrivateData.BillingSource = BillingSourceWallet
+	task.PrivateData.TokenId = tokenId
+	task.PrivateData.BillingContext = &model.TaskBillingContext{OriginModelName: "mj_imagine", PerCallBilling: true}
+	require.NoError(t, task.Insert())
+	return task
+}
+
+func TestApplyMidjourneyTaskResult_FailureRefunds(t *testing.T) {
+	truncate(t)
+	ctx := context.Background()
+
+	const userID, tokenID, channelID = 1, 1, 1
+	const initQuota, preConsumed, tokenRemain = 10000, 2000, 5000
+	seedUser(t, userID, initQuota)
+	seedToken(t, tokenID, userID, "sk-test-key", tokenRemain)
+	seedChannel(t, channelID)
+
+	task := makeMidjourneyTask(t, userID, channelID, preConsumed, tokenID)
+	require.NoError(t, ApplyMidjourneyTaskResult(ctx, task, dto.MidjourneyDto{
+		MjId:       task.TaskID,
+		Status:     "FAILURE",
+		Progress:   "100%",
+		FailReason: "banned prompt",
+	}))
+
+	reloaded := model.GetByMJId(userID, task.TaskID)
+	require.NotNil(t, reloaded)
+	assert.Equal(t, model.TaskStatus(model.TaskStatusFailure), reloaded.Status)
+	assert.Equal(t, "banned prompt", reloaded.FailReason)
+	assert.Equal(t, initQuota+preConsumed, getUserQuota(t, userID))
+	assert.Equal(t, tokenRemain+preConsumed, getTokenRemainQuota(t, tokenID))
+
+	log := getLastLog(t)
+	require.NotNil(t, log)
+	assert.Equal(t, model.LogTypeRefund, log.Type)
+	assert.Equal(t, "mj_imagine", log.ModelName)
+
+	// 重复的失败状态不会再次退款
+	require.NoError(t, ApplyMidjourneyTaskResult(ctx, reloaded, dto.MidjourneyDto{
+		MjId:       task.TaskID,
+		Status:     "FAILURE",
+		Progress:   "100%",
+		FailReason: "banned prompt again",
+	}))
+	assert.Equal(t, initQuota+preConsumed, getUserQuota(t, userID))
+}
+
+func TestApplyMidjourneyTaskResult_Success(t *testing.T) {
+	truncate(t)
+	ctx := context.Background()
+
+	seedUser(t, 1, 10000)
+	seedChannel(t, 1)
+	task := makeMidjourneyTask(t, 1, 1, 1000, 0)
+	require.NoError(t, ApplyMidjourneyTaskResult(ctx, task, dto.MidjourneyDto{
+		MjId:     task.TaskID,
+		Status:   "SUCCESS",
+		Progress: "100%",
+		ImageUrl: "https://cdn.example.com/1.png",
+		Buttons:  []dto.ActionButton{{CustomId: "MJ::JOB::upsample::1"}},
+	}))
+
+	reloaded := model.GetByMJId(1, task.TaskID)
+	require.NotNil(t, reloaded)
+	assert.Equal(t, model.TaskStatus(model.TaskStatusSuccess), reloaded.Status)
+	assert.Equal(t, "https://cdn.example.com/1.png", reloaded.GetResultURL())
+	assert.Contains(t, reloaded.ToMidjourney().Buttons, "MJ::JOB::upsample::1")
+	assert.Equal(t, 10000, getUserQuota(t, 1))
+}
+
+func TestApplyMidjourneyTaskResult_LegacyTaskRefunds(t *testing.T) {
+	truncate(t)
+	ctx := context.Background()
+
+	seedUser(t, 2, 10000)
+	seedChannel(t, 2)
+	// 迁移自旧表、没有计费上下文的任务
+	task := model.NewMidjourneyTask(&model.Midjourney{
+		UserId:     2,
+		Action:     constant.MjActionUpscale,
+		MjId:       "mj_legacy_" + time.Now().Format("150405.000"),
+		SubmitTime: time.Now().UnixMilli(),
+		Progress:   "0%",
+		ChannelId:  2,
+		Quota:      1500,
+		Code:       1,
+	})
+	require.NoError(t, task.Insert())
+
+	require.NoError(t, ApplyMidjourneyTaskResult(ctx, task, dto.MidjourneyDto{
+		MjId:       task.TaskID,
+		Status:     "FAILURE",
+		Progress:   "100%",
+		FailReason: "upstream error",
+	}))
+	assert.Equal(t, 10000+1500, getUserQuota(t, 2))
+	log := getLastLog(t)
+	assert.Equal(t, model.LogTypeRefund, log.Type)
+	assert.Equal(t, "mj_upscale", log.ModelName)
+}
@@ -80,6 +80,8 @@ func sweepTimedOutTasks(ctx context.Context) {
 		if !isLegacy && task.Quota != 0 {
 			RefundTaskQuota(ctx, task, reason)
 		}
+		EnqueueTaskWebhook(task)
+		NotifyTaskFailed(task)
 	}
 
 	if timedOutCount > 0 {
@@ -89,17 +91,29 @@ func sweepTimedOutTasks(ctx context.Context) {
 
 // TaskPollingLoop 主轮询循环，每 15 秒检查一次未完成的任务
 func TaskPollingLoop() {
+	model.RegisterLeaseJob(model.JobTaskPolling)
 	for {
 		time.Sleep(time.Duration(15) * time.Second)
+		// 租约丢失时 ctx 被取消，停止本轮剩余的更新
+		ctx, ok := model.JobLeaderContext(model.JobTaskPolling)
+		if !ok {
+			continue
+		}
 		common.SysLog("任务进度轮询开始")
-		ctx := context.TODO()
 		sweepTimedOutTasks(ctx)
 		allTasks := model.GetAllUnFinishSyncTasks(constant.TaskQueryLimit)
 		platformTask := make(map[constant.TaskPlatform][]*model.Task)
+		now := time.Now().Unix()
 		for _, t := range allTasks {
+			if waitingForTaskCallback(t, now) {
+				continue
+			}
 			platformTask[t.Platform] = append(platformTask[t.Platform], t)
 		}
 		for platform, tasks := range platformTask {
+			if ctx.Err() != nil {
+				break
+			}
 			if len(tasks) == 0 {
 				continue
 			}
@@ -131,21 +145,21 @@ func TaskPollingLoop() {
 				continue
 			}
 
-			DispatchPlatformUpdate(platform, taskChannelM, taskM)
+			DispatchPlatformUpdate(ctx, platform, taskChannelM, taskM)
 		}
 		common.SysLog("任务进度轮询完成")
 	}
 }
 
 // DispatchPlatformUpdate 按平台分发轮询更新
-func DispatchPlatformUpdate(platform constant.TaskPlatform, taskChannelM map[int][]string, taskM map[string]*model.Task) {
+func DispatchPlatformUpdate(ctx context.Context, platform constant.TaskPlatform, taskChannelM map[int][]string, taskM map[string]*model.Task) {
 	switch platform {
 	case constant.TaskPlatformMidjourney:
-		// MJ 轮询由其自身处理，这里预留入口
+		_ = UpdateMidjourneyTasks(ctx, taskChannelM, taskM)
 	case constant.TaskPlatformSuno:
-		_ = UpdateSunoTasks(context.Background(), taskChannelM, taskM)
+		_ = UpdateSunoTasks(ctx, taskChannelM, taskM)
 	default:
-		if err := UpdateVideoTasks(context.Background(), platform, taskChannelM, taskM); err != nil {
+		if err := UpdateVideoTasks(ctx, platform, taskChannelM, taskM); err != nil {
 			common.SysLog(fmt.Sprintf("UpdateVideoTasks fail: %s", err))
 		}
 	}
@@ -154,6 +168,9 @@ func DispatchPlatformUpdate(platform constant.TaskPlatform, taskChannelM map[int
 // UpdateSunoTasks 按渠道更新所有 Suno 任务
 func UpdateSunoTasks(ctx context.Context, taskChannelM map[int][]string, taskM map[string]*model.Task) error {
 	for channelId, taskIds := range taskChannelM {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		err := updateSunoTasks(ctx, channelId, taskIds, taskM)
 		if err != nil {
 			logger.LogError(ctx, fmt.Sprintf("渠道 #%d 更新异步任务失败: %s", channelId, err.Error()))
@@ -225,6 +242,7 @@ func updateSunoTasks(ctx context.Context, channelId int, taskIds []string, taskM
 		if !taskNeedsUpdate(task, responseItem) {
 			continue
 		}
+		preStatus := task.Status
 
 		task.Status = lo.If(model.TaskStatus(responseItem.Status) != "", model.TaskStatus(responseItem.Status)).Else(task.Status)
 		task.FailReason = lo.If(responseItem.FailReason != "", responseItem.FailReason).Else(task.FailReason)
@@ -244,6 +262,9 @@ func updateSunoTasks(ctx context.Context, channelId int, taskIds []string, taskM
 		err = task.Update()
 		if err != nil {
 			common.SysLog("UpdateSunoTask task error: " + err.Error())
+		} else if preStatus != task.Status {
+			EnqueueTaskWebhook(task)
+			NotifyTaskFailed(task)
 		}
 	}
 	return nil
@@ -287,9 +308,200 @@ func taskNeedsUpdate(oldTask *model.Task, newTask dto.SunoDataResponse) bool {
 	return false
 }
 
+// UpdateMidjourneyTasks 按渠道批量更新 Midjourney 任务
+func UpdateMidjourneyTasks(ctx context.Context, taskChannelM map[int][]string, taskM map[string]*model.Task) error {
+	for channelId, taskIds := range taskChannelM {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		err := updateMidjourneyTasks(ctx, channelId, taskIds, taskM)
+		if err != nil {
+			logger.LogError(ctx, fmt.Sprintf("渠道 #%d 更新 Midjourney 任务失败: %s", channelId, err.Error()))
+		}
+	}
+	return nil
+}
+
+func updateMidjourneyTasks(ctx context.Context, channelId int, taskIds []string, taskM map[string]*model.Task) error {
+	logger.LogInfo(ctx, fmt.Sprintf("渠道 #%d 未完成的任务有: %d", channelId, len(taskIds)))
+	if len(taskIds) == 0 {
+		return nil
+	}
+	ch, err := model.CacheGetChannel(channelId)
+	if err != nil {
+		var failedIDs []int64
+		for _, upstreamID := range taskIds {
+			if t, ok := taskM[upstreamID]; ok {
+				failedIDs = append(failedIDs, t.ID)
+			}
+		}
+		err = model.TaskBulkUpdateByID(failedIDs, map[string]any{
+			"fail_reason": fmt.Sprintf("获取渠道信息失败，请联系管理员，渠道ID：%d", channelId),
+			"status":      "FAILURE",
+			"progress":    "100%",
+		})
+		if err != nil {
+			common.SysLog(fmt.Sprintf("UpdateMidjourneyTask error: %v", err))
+		}
+		return err
+	}
+	adaptor := GetTaskAdaptorFunc(constant.TaskPlatformMidjourney)
+	if adaptor == nil {
+		return errors.New("adaptor not found")
+	}
+	resp, err := adaptor.FetchTask(ch.GetBaseURL(), ch.Key, map[string]any{
+		"ids": taskIds,
+	}, ch.GetSetting().Proxy)
+	if err != nil {
+		return fmt.Errorf("Get Task Do req error: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Get Task status code: %d", resp.StatusCode)
+	}
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var responseItems []dto.MidjourneyDto
+	if err = common.Unmarshal(responseBody, &responseItems); err != nil {
+		logger.LogError(ctx, fmt.Sprintf("Get Mjp Task parse body error: %v, body: %s", err, string(responseBody)))
+		return err
+	}
+	for _, responseItem := range responseItems {
+		task, ok := taskM[responseItem.MjId]
+		if !ok {
+			continue
+		}
+		if err := ApplyMidjourneyTaskResult(ctx, task, responseItem); err != nil {
+			logger.LogError(ctx, "UpdateMidjourneyTask task error: "+err.Error())
+		}
+	}
+	return nil
+}
+
+// ApplyMidjourneyTaskResult 将上游返回（轮询或回调通知）的任务状态写入 tasks 表，并处理失败退款、结果保存与回调。
+// 状态更新使用 CAS，轮询与回调并发时只有一方会退款
+func ApplyMidjourneyTaskResult(ctx context.Context, task *model.Task, responseItem dto.MidjourneyDto) error {
+	mj := task.ToMidjourney()
+	// 如果时间超过一小时，且进度不是100%，则认为任务失败
+	if time.Now().Unix()-task.SubmitTime > 3600 && mj.Progress != "100%" {
+		responseItem.FailReason = "上游任务超时（超过1小时）"
+		responseItem.Status = "FAILURE"
+	}
+	if !midjourneyTaskNeedsUpdate(mj, responseItem) {
+		return nil
+	}
+	preStatus := task.Status
+	mj.Code = 1
+	mj.Progress = responseItem.Progress
+	mj.PromptEn = responseItem.PromptEn
+	mj.State = responseItem.State
+	mj.SubmitTime = responseItem.SubmitTime
+	mj.StartTime = responseItem.StartTime
+	mj.FinishTime = responseItem.FinishTime
+	mj.ImageUrl = responseItem.ImageUrl
+	mj.Status = responseItem.Status
+	mj.FailReason = responseItem.FailReason
+	if responseItem.Properties != nil {
+		propertiesStr, _ := common.Marshal(responseItem.Properties)
+		mj.Properties = string(propertiesStr)
+	}
+	if responseItem.Buttons != nil {
+		buttonStr, _ := common.Marshal(responseItem.Buttons)
+		mj.Buttons = string(buttonStr)
+	}
+	mj.VideoUrl = responseItem.VideoUrl
+	mj.VideoUrls = ""
+	if len(responseItem.VideoUrls) > 0 {
+		videoUrlsStr, _ := common.Marshal(responseItem.VideoUrls)
+		mj.VideoUrls = string(videoUrlsStr)
+	}
+
+	shouldRefund := false
+	if (mj.Progress != "100%" && responseItem.FailReason != "") || (mj.Progress == "100%" && mj.Status == "FAILURE") {
+		logger.LogInfo(ctx, mj.MjId+" 构建失败，"+mj.FailReason)
+		mj.Progress = "100%"
+		mj.Status = model.TaskStatusFailure
+		shouldRefund = task.Quota != 0 && preStatus != model.TaskStatusFailure
+	}
+	task.SetMidjourney(mj)
+
+	won, err := task.UpdateWithStatus(preStatus)
+	if err != nil {
+		return err
+	}
+	if !won {
+		return nil
+	}
+	if task.Status == model.TaskStatusSuccess && preStatus != model.TaskStatusSuccess {
+		PersistMidjourneyImageAsync(task)
+	} else if shouldRefund {
+		task.FillMidjourneyBillingDefaults()
+		RefundTaskQuota(ctx, task, "构图失败")
+	}
+	if preStatus != task.Status {
+		EnqueueTaskWebhook(task)
+		NotifyTaskFailed(task)
+	}
+	return nil
+}
+
+// midjourneyTaskNeedsUpdate 检查 Midjourney 任务是否需要更新
+func midjourneyTaskNeedsUpdate(oldTask *model.Midjourney, newTask dto.MidjourneyDto) bool {
+	if oldTask.Code != 1 {
+		return true
+	}
+	if oldTask.Progress != newTask.Progress {
+		return true
+	}
+	if oldTask.PromptEn != newTask.PromptEn {
+		return true
+	}
+	if oldTask.State != newTask.State {
+		return true
+	}
+	if oldTask.SubmitTime != newTask.SubmitTime {
+		return true
+	}
+	if oldTask.StartTime != newTask.StartTime {
+		return true
+	}
+	if oldTask.FinishTime != newTask.FinishTime {
+		return true
+	}
+	if oldTask.ImageUrl != newTask.ImageUrl {
+		return true
+	}
+	if oldTask.Status != newTask.Status {
+		return true
+	}
+	if oldTask.FailReason != newTask.FailReason {
+		return true
+	}
+	if oldTask.Progress != "100%" && newTask.FailReason != "" {
+		return true
+	}
+	if oldTask.VideoUrl != newTask.VideoUrl {
+		return true
+	}
+	if len(newTask.VideoUrls) > 0 {
+		newVideoUrlsStr, _ := common.Marshal(newTask.VideoUrls)
+		if oldTask.VideoUrls != string(newVideoUrlsStr) {
+			return true
+		}
+	} else if oldTask.VideoUrls != "" {
+		return true
+	}
+	return false
+}
+
 // UpdateVideoTasks 按渠道更新所有视频任务
 func UpdateVideoTasks(ctx context.Context, platform constant.TaskPlatform, taskChannelM map[int][]string, taskM map[string]*model.Task) error {
 	for channelId, taskIds := range taskChannelM {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		if err := updateVideoTasks(ctx, platform, channelId, taskIds, taskM); err != nil {
 			logger.LogError(ctx, fmt.Sprintf("Channel #%d failed to update video async tasks: %s", channelId, err.Error()))
 		}
@@ -332,6 +544,9 @@ func updateVideoTasks(ctx context.Context, platform constant.TaskPlatform, chann
 	info.ApiKey = cacheGetChannel.Key
 	adaptor.Init(info)
 	for _, taskId := range taskIds {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		if err := updateVideoSingleTask(ctx, adaptor, cacheGetChannel, taskId, taskM); err != nil {
 			logger.LogError(ctx, fmt.Sprintf("Failed to update video task %s: %s", taskId, err.Error()))
 		}
@@ -374,6 +589,13 @@ func updateVideoSingleTask(ctx context.Context, adaptor TaskPollingAdaptor, ch *
 
 	logger.LogDebug(ctx, fmt.Sprintf("updateVideoSingleTask response: %s", string(responseBody)))
 
+	return applyVideoTaskResult(ctx, adaptor, task, responseBody)
+}
+
+// applyVideoTaskResult 解析上游任务结果（轮询响应或回调推送）并更新任务状态、结算计费
+func applyVideoTaskResult(ctx context.Context, adaptor TaskPollingAdaptor, task *model.Task, responseBody []byte) error {
+	var err error
+	taskId := task.GetUpstreamTaskID()
 	snap := task.Snapshot()
 
 	taskResult := &relaycommon.TaskInfo{}
@@ -471,6 +693,7 @@ func updateVideoSingleTask(ctx context.Context, adaptor TaskPollingAdaptor, ch *
 	}
 
 	isDone := task.Status == model.TaskStatusSuccess || task.Status == model.TaskStatusFailure
+	statusChanged := false
 	if isDone && snap.Status != task.Status {
 		won, err := task.UpdateWithStatus(snap.Status)
 		if err != nil {
@@ -481,10 +704,14 @@ func updateVideoSingleTask(ctx context.Context, adaptor TaskPollingAdaptor, ch *
 			logger.LogWarn(ctx, fmt.Sprintf("Task %s already transitioned by another process, skip billing", task.TaskID))
 			shouldRefund = false
 			shouldSettle = false
+		} else {
+			statusChanged = true
 		}
 	} else if !snap.Equal(task.Snapshot()) {
-		if _, err := task.UpdateWithStatus(snap.Status); err != nil {
+		if won, err := task.UpdateWithStatus(snap.Status); err != nil {
 			logger.LogError(ctx, fmt.Sprintf("Failed to update task %s: %s", task.TaskID, err.Error()))
+		} else if won && snap.Status != task.Status {
+			statusChanged = true
 		}
 	} else {
 		// No changes, skip update
@@ -493,10 +720,15 @@ func updateVideoSingleTask(ctx context.Context, adaptor TaskPollingAdaptor, ch *
 
 	if shouldSettle {
 		settleTaskBillingOnComplete(ctx, adaptor, task, taskResult)
+		PersistTaskResultAsync(task)
 	}
 	if shouldRefund {
 		RefundTaskQuota(ctx, task, task.FailReason)
 	}
+	if statusChanged {
+		EnqueueTaskWebhook(task)
+		NotifyTaskFailed(task)
+	}
 
 	return nil
 }
@@ -0,0 +1,229 @@
+package service
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	TaskWebhookEventType = "task.updated"
+
+	taskWebhookTickInterval    = 5 * time.Second
+	taskWebhookBatchSize       = 100
+	taskWebhookMaxAttempts     = 8
+	taskWebhookBaseBackoff     = 30 * time.Second
+	taskWebhookMaxBackoff      = time.Hour
+	taskWebhookRetention       = 30 * 24 * time.Hour
+	taskWebhookCleanupInterval = time.Hour
+)
+
+var (
+	taskWebhookOnce        sync.Once
+	taskWebhookRunning     atomic.Bool
+	taskWebhookCleanupLast atomic.Int64
+)
+
+// TaskWebhookPayload 任务状态回调负载，签名方式与额度通知 webhook 相同（X-Webhook-Signature）
+type TaskWebhookPayload struct {
+	Type       string `json:"type"`
+	TaskId     string `json:"task_id"`
+	Platform   string `json:"platform"`
+	Action     string `json:"action"`
+	Status     string `json:"status"`
+	Progress   string `json:"progress"`
+	FailReason string `json:"fail_reason,omitempty"`
+	ResultUrl  string `json:"result_url,omitempty"`
+	SubmitTime int64  `json:"submit_time"`
+	FinishTime int64  `json:"finish_time,omitempty"`
+	Timestamp  int64  `json:"timestamp"`
+}
+
+// ValidateTaskCallbackURL 回调地址仅允许 http/https
+func ValidateTaskCallbackURL(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	if len(raw) > 512 {
+		return fmt.Errorf("callback_url is too long")
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid callback_url")
+	}
+	return nil
+}
+
+// ResolveTaskCallbackURL 请求体中的 callback_url 优先，其次使用令牌上配置的回调地址
+func ResolveTaskCallbackURL(c *gin.Context) string {
+	var req struct {
+		CallbackUrl string `json:"callback_url" form:"callback_url"`
+	}
+	if err := common.UnmarshalBodyReusable(c, &req); err == nil {
+		callbackUrl := strings.TrimSpace(req.CallbackUrl)
+		if callbackUrl != "" {
+			if err := ValidateTaskCallbackURL(callbackUrl); err == nil {
+				return callbackUrl
+			}
+			logger.LogWarn(c, fmt.Sprintf("ignore invalid callback_url: %s", callbackUrl))
+		}
+	}
+	return common.GetContextKeyString(c, constant.ContextKeyTokenCallbackUrl)
+}
+
+func enqueueTaskWebhook(userId int, callbackUrl string, payload TaskWebhookPayload) {
+	if callbackUrl == "" {
+		return
+	}
+	payload.Type = TaskWebhookEventType
+	payload.Timestamp = time.Now().Unix()
+	data, err := common.Marshal(payload)
+	if err != nil {
+		common.SysError("failed to marshal task webhook payload: " + err.Error())
+		return
+	}
+	err = model.CreateTaskWebhookDelivery(&model.TaskWebhookDelivery{
+		UserId:     userId,
+		TaskId:     payload.TaskId,
+		Platform:   payload.Platform,
+		TaskStatus: payload.Status,
+		Url:        callbackUrl,
+		Payload:    string(data),
+	})
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to enqueue webhook for task %s: %s", payload.TaskId, err.Error()))
+	}
+}
+
+// EnqueueTaskWebhook 任务状态变更后登记一次回调
+func EnqueueTaskWebhook(task *model.Task) {
+	if task == nil || task.PrivateData.CallbackURL == "" {
+		return
+	}
+	payload := TaskWebhookPayload{
+		TaskId:     task.TaskID,
+		Platform:   string(task.Platform),
+		Action:     task.Action,
+		Status:     string(task.Status),
+		Progress:   task.Progress,
+		FailReason: task.FailReason,
+		SubmitTime: task.SubmitTime,
+		FinishTime: task.FinishTime,
+	}
+	if task.Status == model.TaskStatusSuccess {
+		payload.ResultUrl = task.GetResultURL()
+	}
+	enqueueTaskWebhook(task.UserId, task.PrivateData.CallbackURL, payload)
+}
+
+// taskWebhookBackoff 第 n 次失败后的重试间隔：30s、1m、2m ... 最长 1h
+func taskWebhookBackoff(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	backoff := taskWebhookBaseBackoff
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= taskWebhookMaxBackoff {
+			return taskWebhookMaxBackoff
+		}
+	}
+	return backoff
+}
+
+// deliverTaskWebhook 投递一次并记录结果，失败时按退避时间重新排队
+func deliverTaskWebhook(d *model.TaskWebhookDelivery, secret string) {
+	d.Attempts++
+	statusCode, err := postWebhook(d.Url, secret, []byte(d.Payload))
+	d.ResponseCode = statusCode
+	if err == nil && (statusCode < 200 || statusCode >= 300) {
+		err = fmt.Errorf("webhook request failed with status code: %d", statusCode)
+	}
+	if err == nil {
+		d.Status = model.TaskWebhookStatusSuccess
+		d.LastError = ""
+	} else {
+		d.LastError = err.Error()
+		if d.Attempts >= taskWebhookMaxAttempts {
+			d.Status = model.TaskWebhookStatusFailed
+		} else {
+			d.Status = model.TaskWebhookStatusPending
+			d.NextAttemptAt = time.Now().Add(taskWebhookBackoff(d.Attempts)).Unix()
+		}
+	}
+	if err := model.SaveTaskWebhookAttempt(d); err != nil {
+		common.SysError(fmt.Sprintf("failed to save webhook delivery %d: %s", d.Id, err.Error()))
+	}
+}
+
+// RetryTaskWebhookDelivery 手动重新投递，已达最大次数的记录也会再尝试一次
+func RetryTaskWebhookDelivery(d *model.TaskWebhookDelivery) error {
+	d.Status = model.TaskWebhookStatusPending
+	d.NextAttemptAt = time.Now().Unix()
+	return model.SaveTaskWebhookAttempt(d)
+}
+
+func StartTaskWebhookDispatcher() {
+	taskWebhookOnce.Do(func() {
+		model.RegisterLeaseJob(model.JobTaskWebhookDelivery)
+		gopool.Go(func() {
+			ticker := time.NewTicker(taskWebhookTickInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				runTaskWebhookDispatchOnce()
+			}
+		})
+	})
+}
+
+func runTaskWebhookDispatchOnce() {
+	ctx, ok := model.JobLeaderContext(model.JobTaskWebhookDelivery)
+	if !ok {
+		return
+	}
+	if !taskWebhookRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer taskWebhookRunning.Store(false)
+
+	deliveries, err := model.GetDueTaskWebhookDeliveries(time.Now().Unix(), taskWebhookBatchSize)
+	if err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("task webhook query failed: %v", err))
+		return
+	}
+	secrets := make(map[int]string)
+	for _, d := range deliveries {
+		if ctx.Err() != nil {
+			return
+		}
+		secret, ok := secrets[d.UserId]
+		if !ok {
+			if setting, err := model.GetUserSetting(d.UserId, false); err == nil {
+				secret = setting.WebhookSecret
+			}
+			secrets[d.UserId] = secret
+		}
+		deliverTaskWebhook(d, secret)
+	}
+
+	now := time.Now()
+	last := taskWebhookCleanupLast.Load()
+	if now.Unix()-last >= int64(taskWebhookCleanupInterval/time.Second) && taskWebhookCleanupLast.CompareAndSwap(last, now.Unix()) {
+		if n, err := model.DeleteTaskWebhookDeliveriesBefore(now.Add(-taskWebhookRetention).Unix()); err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("task webhook cleanup failed: %v", err))
+		} else if n > 0 {
+			logger.LogInfo(ctx, fmt.Sprintf("task webhook cleanup removed %d deliveries", n))
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTaskWebhookBackoff(t *testing.T) {
+	require.Equal(t, 30*time.Second, taskWebhookBackoff(1))
+	require.Equal(t, 2*time.Minute, taskWebhookBackoff(3))
+	require.Equal(t, time.Hour, taskWebhookBackoff(10))
+}
+
+func TestDeliverTaskWebhookSignsAndRetries(t *testing.T) {
+	InitHttpClient()
+	fetchSetting := system_setting.GetFetchSetting()
+	saved := fetchSetting.EnableSSRFProtection
+	fetchSetting.EnableSSRFProtection = false
+	t.Cleanup(func() {
+		fetchSetting.EnableSSRFProtection = saved
+		model.DB.Exec("DELETE FROM task_webhook_deliveries")
+	})
+
+	var gotSignature string
+	var gotBody string
+	fail := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		gotSignature = r.Header.Get("X-Webhook-Signature")
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	d := &model.TaskWebhookDelivery{UserId: 1, TaskId: "task_1", Url: server.URL, Payload: `{"task_id":"task_1"}`}
+	require.NoError(t, model.CreateTaskWebhookDelivery(d))
+
+	deliverTaskWebhook(d, "secret")
+	require.Equal(t, model.TaskWebhookStatusPending, d.Status)
+	require.Equal(t, 1, d.Attempts)
+	require.Equal(t, http.StatusInternalServerError, d.ResponseCode)
+	require.Greater(t, d.NextAttemptAt, time.Now().Unix())
+
+	fail = false
+	deliverTaskWebhook(d, "secret")
+	require.Equal(t, model.TaskWebhookStatusSuccess, d.Status)
+	require.Equal(t, `{"task_id":"task_1"}`, gotBody)
+	require.Equal(t, generateSignature("secret", []byte(gotBody)), gotSignature)
+
+	stored, err := model.GetTaskWebhookDeliveryById(d.Id)
+	require.NoError(t, err)
+	require.Equal(t, model.TaskWebhookStatusSuccess, stored.Status)
+	require.Equal(t, 2, stored.Attempts)
+}
+
+func TestSweepTimedOutTasksEnqueuesWebhook(t *testing.T) {
+	truncate(t)
+	savedTimeout := constant.TaskTimeoutMinutes
+	constant.TaskTimeoutMinutes = 1
+	t.Cleanup(func() {
+		constant.TaskTimeoutMinutes = savedTimeout
+		model.DB.Exec("DELETE FROM task_webhook_deliveries")
+	})
+	seedUser(t, 1, 0)
+
+	task := makeTask(1, 0, 0, 0, BillingSourceWallet, 0)
+	task.SubmitTime = time.Now().Unix() - 3600
+	task.PrivateData.CallbackURL = "https://example.com/callback"
+	require.NoError(t, model.DB.Create(task).Error)
+
+	sweepTimedOutTasks(context.Background())
+
+	var deliveries []*model.TaskWebhookDelivery
+	require.NoError(t, model.DB.Where("task_id = ?", task.TaskID).Find(&deliveries).Error)
+	require.Len(t, deliveries, 1)
+	require.Equal(t, model.TaskStatusFailure, deliveries[0].TaskStatus)
+}
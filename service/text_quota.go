@@ -27,6 +27,7 @@ type textQuotaSummary struct {
 	CacheCreationTokens5m    int
 	CacheCreationTokens1h    int
 	ImageTokens              int
+	ImageCompletionTokens    int
 	AudioTokens              int
 	ModelName                string
 	TokenName                string
@@ -34,6 +35,7 @@ type textQuotaSummary struct {
 	CompletionRatio          float64
 	CacheRatio               float64
 	ImageRatio               float64
+	ImageCompletionRatio     float64
 	ModelRatio               float64
 	GroupRatio               float64
 	ModelPrice               float64
@@ -77,7 +79,27 @@ func isLegacyClaudeDerivedOpenAIUsage(relayInfo *relaycommon.RelayInfo, usage *d
 	return usage.ClaudeCacheCreation5mTokens > 0 || usage.ClaudeCacheCreation1hTokens > 0
 }
 
+// pricingRuleUsage 返回定价分档使用的 token 数，输入 token 总数包含缓存读写
+func pricingRuleUsage(relayInfo *relaycommon.RelayInfo, usage *dto.Usage) types.PricingUsage {
+	if usage == nil {
+		return types.PricingUsage{PromptTokens: relayInfo.GetEstimatePromptTokens()}
+	}
+	result := types.PricingUsage{
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		CacheTokens:      usage.PromptTokensDetails.CachedTokens + usage.PromptTokensDetails.CachedCreationTokens,
+	}
+	if usageSemanticFromUsage(relayInfo, usage) == "anthropic" {
+		result.PromptTokens += result.CacheTokens
+	}
+	return result
+}
+
 func calculateTextQuotaSummary(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage *dto.Usage) textQuotaSummary {
+	if relayInfo.PriceData.PricingRule != nil {
+		// 分档按实际用量结算，可能与预扣时的估算不同
+		relayInfo.PriceData.ApplyPricingRule(pricingRuleUsage(relayInfo, usage))
+	}
 	summary := textQuotaSummary{
 		ModelName:            relayInfo.OriginModelName,
 		TokenName:            ctx.GetString("token_name"),
@@ -85,6 +107,7 @@ func calculateTextQuotaSummary(ctx *gin.Context, relayInfo *relaycommon.RelayInf
 		CompletionRatio:      relayInfo.PriceData.CompletionRatio,
 		CacheRatio:           relayInfo.PriceData.CacheRatio,
 		ImageRatio:           relayInfo.PriceData.ImageRatio,
+		ImageCompletionRatio: relayInfo.PriceData.ImageCompletionRatio,
 		ModelRatio:           relayInfo.PriceData.ModelRatio,
 		GroupRatio:           relayInfo.PriceData.GroupRatioInfo.GroupRatio,
 		ModelPrice:           relayInfo.PriceData.ModelPrice,
@@ -111,6 +134,9 @@ func calculateTextQuotaSummary(ctx *gin.Context, relayInfo *relaycommon.RelayInf
 	summary.CacheCreationTokens5m = usage.ClaudeCacheCreation5mTokens
 	summary.CacheCreationTokens1h = usage.ClaudeCacheCreation1hTokens
 	summary.ImageTokens = usage.PromptTokensDetails.ImageTokens
+	if summary.ImageCompletionRatio > 0 {
+		summary.ImageCompletionTokens = min(usage.CompletionTokenDetails.ImageTokens, usage.CompletionTokens)
+	}
 	summary.AudioTokens = usage.PromptTokensDetails.AudioTokens
 	legacyClaudeDerived := isLegacyClaudeDerivedOpenAIUsage(relayInfo, usage)
 	isOpenRouterClaudeBilling := relayInfo.ChannelMeta != nil &&
@@ -239,7 +265,10 @@ func calculateTextQuotaSummary(ctx *gin.Context, relayInfo *relaycommon.RelayInf
 		}
 
 		promptQuota := baseTokens.Add(cachedTokensWithRatio).Add(imageTokensWithRatio).Add(cachedCreationTokensWithRatio)
-		completionQuota := dCompletionTokens.Mul(dCompletionRatio)
+		// 图片输出 token 单独按图片补全倍率计费
+		dImageCompletionTokens := decimal.NewFromInt(int64(summary.ImageCompletionTokens))
+		completionQuota := dCompletionTokens.Sub(dImageCompletionTokens).Mul(dCompletionRatio).
+			Add(dImageCompletionTokens.Mul(decimal.NewFromFloat(summary.ImageCompletionRatio)))
 		quotaCalculateDecimal := promptQuota.Add(completionQuota).Mul(ratio)
 		quotaCalculateDecimal = quotaCalculateDecimal.Add(dWebSearchQuota)
 		quotaCalculateDecimal = quotaCalculateDecimal.Add(dClaudeWebSearchQuota)
@@ -292,12 +321,16 @@ func usageSemanticFromUsage(relayInfo *relaycommon.RelayInfo, usage *dto.Usage)
 }
 
 func PostTextConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage *dto.Usage, extraContent []string) {
+	if IsLostHedgeLeg(ctx) {
+		return
+	}
 	originUsage := usage
 	if usage == nil {
 		extraContent = append(extraContent, "上游无计费信息")
 	}
 	if originUsage != nil {
 		ObserveChannelAffinityUsageCacheByRelayFormat(ctx, usage, relayInfo.GetFinalRequestRelayFormat())
+		RecordUpstreamTokenUsage(relayInfo, usage.CompletionTokens)
 	}
 
 	adminRejectReason := common.GetContextKeyString(ctx, constant.ContextKeyAdminRejectReason)
@@ -358,11 +391,18 @@ func PostTextConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, us
 	if adminRejectReason != "" {
 		other["reject_reason"] = adminRejectReason
 	}
+	if len(relayInfo.PriceData.PricingRuleApplied) > 0 {
+		other["pricing_rules"] = relayInfo.PriceData.PricingRuleApplied
+	}
 	if summary.ImageTokens != 0 {
 		other["image"] = true
 		other["image_ratio"] = summary.ImageRatio
 		other["image_output"] = summary.ImageTokens
 	}
+	if summary.ImageCompletionTokens != 0 {
+		other["image_completion_ratio"] = summary.ImageCompletionRatio
+		other["image_completion_tokens"] = summary.ImageCompletionTokens
+	}
 	if summary.WebSearchCallCount > 0 {
 		other["web_search"] = true
 		other["web_search_call_count"] = summary.WebSearchCallCount
@@ -398,6 +438,9 @@ func PostTextConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, us
 		other["cache_creation_tokens_1h"] = summary.CacheCreationTokens1h
 		other["cache_creation_ratio_1h"] = summary.CacheCreationRatio1h
 	}
+	if usage != nil && usage.CompletionTokenDetails.ReasoningTokens > 0 {
+		other["reasoning_tokens"] = usage.CompletionTokenDetails.ReasoningTokens
+	}
 	cacheWriteTokens := cacheWriteTokensTotal(summary)
 	if cacheWriteTokens > 0 {
 		// cache_write_tokens: normalized cache creation total for UI display.
@@ -413,6 +456,18 @@ func PostTextConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, us
 		other["input_tokens_total"] = usage.InputTokens
 	}
 
+	costInputTokens := summary.PromptTokens
+	if summary.IsClaudeUsageSemantic {
+		costInputTokens += summary.CacheCreationTokens
+	} else {
+		costInputTokens -= summary.CacheTokens
+	}
+	upstreamCost := CalculateUpstreamCost(relayInfo, summary.Quota, costInputTokens, summary.CacheTokens, summary.CompletionTokens)
+	if relayInfo.Hedge != nil {
+		// 对冲落败方的成本计入上游成本，但不向用户计费
+		upstreamCost += relayInfo.Hedge.OverheadCost
+	}
+
 	model.RecordConsumeLog(ctx, relayInfo.UserId, model.RecordConsumeLogParams{
 		ChannelId:        relayInfo.ChannelId,
 		PromptTokens:     summary.PromptTokens,
@@ -420,6 +475,7 @@ func PostTextConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, us
 		ModelName:        logModel,
 		TokenName:        summary.TokenName,
 		Quota:            summary.Quota,
+		UpstreamCost:     upstreamCost,
 		Content:          logContent,
 		TokenId:          relayInfo.TokenId,
 		UseTimeSeconds:   int(summary.UseTimeSeconds),
@@ -316,3 +316,134 @@ func TestCalculateTextQuotaSummaryKeepsPrePRClaudeOpenRouterBilling(t *testing.T
 	require.Equal(t, 172, summary.PromptTokens)
 	require.Equal(t, 798, summary.Quota)
 }
+
+func TestCalculateTextQuotaSummaryAppliesPricingRuleTier(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+
+	longModelRatio := 2.0
+	longCompletionRatio := 1.5
+	base := types.PricingRatios{ModelRatio: 1, CompletionRatio: 4, CacheRatio: 0.1, CacheCreationRatio: 1.25}
+	newRelayInfo := func() *relaycommon.RelayInfo {
+		return &relaycommon.RelayInfo{
+			RelayFormat:     types.RelayFormatOpenAI,
+			OriginModelName: "gemini-2.5-pro",
+			PriceData: types.PriceData{
+				ModelRatio:      1,
+				CompletionRatio: 4,
+				CacheRatio:      0.1,
+				GroupRatioInfo:  types.GroupRatioInfo{GroupRatio: 1},
+				PricingRule: &types.PricingRule{
+					Tiers: []types.PricingTier{{
+						AbovePromptTokens: 200000,
+						PricingRatioOverride: types.PricingRatioOverride{
+							ModelRatio:      &longModelRatio,
+							CompletionRatio: &longCompletionRatio,
+						},
+					}},
+				},
+				PricingRuleBase: base,
+			},
+			StartTime: time.Now(),
+		}
+	}
+
+	short := calculateTextQuotaSummary(ctx, newRelayInfo(), &dto.Usage{PromptTokens: 1000, CompletionTokens: 100})
+	require.Equal(t, 1400, short.Quota)
+
+	long := calculateTextQuotaSummary(ctx, newRelayInfo(), &dto.Usage{PromptTokens: 300000, CompletionTokens: 100})
+	// (300000 + 100*1.5) * 2
+	require.Equal(t, 600300, long.Quota)
+}
+
+func TestCalculateTextQuotaSummaryAppliesCompletionAndCacheTiers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+
+	longCompletionRatio := 8.0
+	cachedRatio := 0.5
+	relayInfo := &relaycommon.RelayInfo{
+		RelayFormat:     types.RelayFormatOpenAI,
+		OriginModelName: "gpt-tiered",
+		PriceData: types.PriceData{
+			ModelRatio:      1,
+			CompletionRatio: 4,
+			CacheRatio:      0.1,
+			GroupRatioInfo:  types.GroupRatioInfo{GroupRatio: 1},
+			PricingRule: &types.PricingRule{
+				CompletionTiers: []types.PricingTokenTier{{
+					AboveTokens:          1000,
+					PricingRatioOverride: types.PricingRatioOverride{CompletionRatio: &longCompletionRatio},
+				}},
+				CacheTiers: []types.PricingTokenTier{{
+					AboveTokens:          100,
+					PricingRatioOverride: types.PricingRatioOverride{CacheRatio: &cachedRatio},
+				}},
+			},
+			PricingRuleBase: types.PricingRatios{ModelRatio: 1, CompletionRatio: 4, CacheRatio: 0.1},
+		},
+		StartTime: time.Now(),
+	}
+
+	usage := &dto.Usage{PromptTokens: 1000, CompletionTokens: 2000}
+	usage.PromptTokensDetails.CachedTokens = 200
+	summary := calculateTextQuotaSummary(ctx, relayInfo, usage)
+	// (1000 - 200) + 200*0.5 + 2000*8
+	require.Equal(t, 16900, summary.Quota)
+	require.Equal(t, []string{"completion>1000", "cache>100"}, relayInfo.PriceData.PricingRuleApplied)
+}
+
+func TestApplyPricingRuleKeepsImagePriceRatio(t *testing.T) {
+	rulePrice := 0.2
+	priceData := types.PriceData{
+		UsePrice:        true,
+		ImagePriceRatio: 2,
+		PricingRule: &types.PricingRule{
+			Conditions: []types.PricingCondition{{
+				Field:                types.PricingFieldImageQuality,
+				Values:               []string{"hd"},
+				PricingRatioOverride: types.PricingRatioOverride{ModelPrice: &rulePrice},
+			}},
+		},
+		PricingRuleBase:  types.PricingRatios{ModelPrice: 0.04},
+		PricingRuleAttrs: map[string]string{types.PricingFieldImageQuality: "hd"},
+	}
+	priceData.ApplyPricingRule(types.PricingUsage{})
+	require.InDelta(t, 0.4, priceData.ModelPrice, 1e-9)
+
+	// 结算时重新应用规则不会重复乘算
+	priceData.ApplyPricingRule(types.PricingUsage{PromptTokens: 10})
+	require.InDelta(t, 0.4, priceData.ModelPrice, 1e-9)
+}
+
+func TestCalculateTextQuotaSummaryPricesImageOutputTokensSeparately(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+
+	relayInfo := &relaycommon.RelayInfo{
+		RelayFormat:     types.RelayFormatOpenAI,
+		OriginModelName: "gemini-2.5-flash-image",
+		PriceData: types.PriceData{
+			ModelRatio:           1,
+			CompletionRatio:      2,
+			ImageCompletionRatio: 10,
+			GroupRatioInfo:       types.GroupRatioInfo{GroupRatio: 1},
+		},
+		StartTime: time.Now(),
+	}
+	usage := &dto.Usage{PromptTokens: 100, CompletionTokens: 1300}
+	usage.CompletionTokenDetails.ImageTokens = 1290
+
+	summary := calculateTextQuotaSummary(ctx, relayInfo, usage)
+	require.Equal(t, 1290, summary.ImageCompletionTokens)
+	// 100 + 10*2 + 1290*10
+	require.Equal(t, 13020, summary.Quota)
+
+	// 未配置图片补全倍率时图片 token 按补全倍率计费
+	relayInfo.PriceData.ImageCompletionRatio = 0
+	summary = calculateTextQuotaSummary(ctx, relayInfo, usage)
+	require.Equal(t, 0, summary.ImageCompletionTokens)
+	require.Equal(t, 2700, summary.Quota)
+}
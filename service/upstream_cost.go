@@ -0,0 +1,36 @@
+package service
+
+import (
+	"math"
+
+	"github.com/QuantumNous/new-api/common"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+)
+
+// CalculateUpstreamCost 计算本次请求支付给上游渠道的成本（额度单位），渠道未配置成本时返回 0。
+// inputTokens 不包含缓存命中的 token，cacheTokens 单独按缓存价格计算。
+func CalculateUpstreamCost(relayInfo *relaycommon.RelayInfo, quota int, inputTokens int, cacheTokens int, completionTokens int) int {
+	if relayInfo == nil || relayInfo.ChannelMeta == nil {
+		return 0
+	}
+	settings := &relayInfo.ChannelOtherSettings
+	if price, ok := settings.GetUpstreamModelPrice(relayInfo.UpstreamModelName, relayInfo.OriginModelName); ok {
+		cacheReadPrice := price.CacheRead
+		if cacheReadPrice == 0 {
+			cacheReadPrice = price.Input
+		}
+		usd := price.PerRequest +
+			(float64(inputTokens)*price.Input+
+				float64(cacheTokens)*cacheReadPrice+
+				float64(completionTokens)*price.Output)/1000000
+		return int(math.Round(usd * common.QuotaPerUnit))
+	}
+	if settings.UpstreamCostMultiplier > 0 {
+		groupRatio := relayInfo.PriceData.GroupRatioInfo.GroupRatio
+		if groupRatio <= 0 {
+			return 0
+		}
+		return int(math.Round(float64(quota) / groupRatio * settings.UpstreamCostMultiplier))
+	}
+	return 0
+}
@@ -0,0 +1,32 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCalculateUpstreamCost(t *testing.T) {
+	info := &relaycommon.RelayInfo{
+		OriginModelName: "gpt-4o",
+		ChannelMeta: &relaycommon.ChannelMeta{
+			ChannelOtherSettings: dto.ChannelOtherSettings{UpstreamCostMultiplier: 0.8},
+		},
+		PriceData: types.PriceData{GroupRatioInfo: types.GroupRatioInfo{GroupRatio: 2}},
+	}
+	// 成本倍率按不含分组倍率的额度计算
+	require.Equal(t, 400, CalculateUpstreamCost(info, 1000, 0, 0, 0))
+
+	info.ChannelOtherSettings.UpstreamModelPrices = map[string]dto.UpstreamModelPrice{
+		"gpt-4o": {Input: 2.5, Output: 10, CacheRead: 1.25},
+	}
+	expected := int((2.5 + 1.25 + 10) * common.QuotaPerUnit)
+	require.Equal(t, expected, CalculateUpstreamCost(info, 1000, 1000000, 1000000, 1000000))
+
+	require.Equal(t, 0, CalculateUpstreamCost(&relaycommon.RelayInfo{}, 1000, 10, 0, 10))
+}
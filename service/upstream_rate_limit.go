@@ -0,0 +1,160 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 各上游的限流响应头，按 [剩余, 重置时间] 成对列出
+var (
+	requestRateLimitHeaders = [][2]string{
+		{"x-ratelimit-remaining-requests", "x-ratelimit-reset-requests"},
+		{"anthropic-ratelimit-requests-remaining", "anthropic-ratelimit-requests-reset"},
+	}
+	tokenRateLimitHeaders = [][2]string{
+		{"x-ratelimit-remaining-tokens", "x-ratelimit-reset-tokens"},
+		{"anthropic-ratelimit-tokens-remaining", "anthropic-ratelimit-tokens-reset"},
+		{"anthropic-ratelimit-input-tokens-remaining", "anthropic-ratelimit-input-tokens-reset"},
+		{"anthropic-ratelimit-output-tokens-remaining", "anthropic-ratelimit-output-tokens-reset"},
+	}
+)
+
+// parseRateLimitReset 支持 OpenAI 的时长（"6m0s"、"20ms"）、秒数、Unix 时间戳与 Anthropic 的 RFC 3339 时间
+func parseRateLimitReset(value string, now time.Time) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, false
+	}
+	if duration, err := time.ParseDuration(value); err == nil {
+		return now.Add(duration), true
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		if seconds > 1e9 {
+			return time.Unix(int64(seconds), 0), true
+		}
+		return now.Add(time.Duration(seconds * float64(time.Second))), true
+	}
+	if reset, err := time.Parse(time.RFC3339, value); err == nil {
+		return reset, true
+	}
+	return time.Time{}, false
+}
+
+// parseRemaining 取多组响应头中余量最少的一组
+func parseRemaining(header http.Header, pairs [][2]string, now time.Time, defaultReset time.Duration) (int, time.Time) {
+	remaining, reset := -1, time.Time{}
+	for _, pair := range pairs {
+		value := header.Get(pair[0])
+		if value == "" {
+			continue
+		}
+		current, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || current < 0 {
+			continue
+		}
+		if remaining >= 0 && current >= remaining {
+			continue
+		}
+		remaining = current
+		var ok bool
+		if reset, ok = parseRateLimitReset(header.Get(pair[1]), now); !ok {
+			reset = now.Add(defaultReset)
+		}
+	}
+	return remaining, reset
+}
+
+// ParseUpstreamRateLimit 解析 OpenAI（x-ratelimit-*）与 Anthropic（anthropic-ratelimit-*）的限流响应头
+func ParseUpstreamRateLimit(header http.Header, now time.Time) (model.UpstreamRateLimit, bool) {
+	defaultReset := operation_setting.GetChannelRateLimitSetting().GetDefaultCooldown()
+	limit := model.UpstreamRateLimit{}
+	limit.RequestsRemaining, limit.RequestsReset = parseRemaining(header, requestRateLimitHeaders, now, defaultReset)
+	limit.TokensRemaining, limit.TokensReset = parseRemaining(header, tokenRateLimitHeaders, now, defaultReset)
+	return limit, limit.RequestsRemaining >= 0 || limit.TokensRemaining >= 0
+}
+
+// ParseRetryAfter 解析 retry-after-ms 与 retry-after（秒数或 HTTP 日期）
+func ParseRetryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	if value := strings.TrimSpace(header.Get("retry-after-ms")); value != "" {
+		if ms, err := strconv.ParseFloat(value, 64); err == nil && ms >= 0 {
+			return time.Duration(ms * float64(time.Millisecond)), true
+		}
+	}
+	value := strings.TrimSpace(header.Get("retry-after"))
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds >= 0 {
+		return time.Duration(seconds * float64(time.Second)), true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// upstreamCooldown 计算 429 后 key 的冷却时长：优先 retry-after，其次已耗尽额度的重置时间，都没有时使用默认值
+func upstreamCooldown(header http.Header, limit model.UpstreamRateLimit, now time.Time) time.Duration {
+	setting := operation_setting.GetChannelRateLimitSetting()
+	cooldown, ok := ParseRetryAfter(header, now)
+	if !ok {
+		if limit.RequestsRemaining == 0 {
+			cooldown = limit.RequestsReset.Sub(now)
+		}
+		if limit.TokensRemaining == 0 {
+			cooldown = max(cooldown, limit.TokensReset.Sub(now))
+		}
+		if cooldown <= 0 {
+			cooldown = setting.GetDefaultCooldown()
+		}
+	}
+	return min(cooldown, setting.GetMaxCooldown())
+}
+
+func channelKeyIndex(info *relaycommon.RelayInfo) int {
+	if info.ChannelIsMultiKey {
+		return info.ChannelMultiKeyIndex
+	}
+	return 0
+}
+
+// ObserveUpstreamRateLimit 记录上游响应中的限流余量；429 时冷却当前 key 直到重置时间
+func ObserveUpstreamRateLimit(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Response) {
+	if info == nil || info.ChannelMeta == nil || resp == nil || !operation_setting.GetChannelRateLimitSetting().CooldownEnabled {
+		return
+	}
+	now := time.Now()
+	keyIndex := channelKeyIndex(info)
+	limit, ok := ParseUpstreamRateLimit(resp.Header, now)
+	if ok {
+		model.UpdateChannelKeyRateLimit(info.ChannelId, keyIndex, limit)
+	}
+	if resp.StatusCode != http.StatusTooManyRequests {
+		return
+	}
+	cooldown := upstreamCooldown(resp.Header, limit, now)
+	model.CooldownChannelKey(info.ChannelId, keyIndex, now.Add(cooldown))
+	logger.LogWarn(c, fmt.Sprintf("channel #%d key #%d rate limited by upstream, cooling down for %s", info.ChannelId, keyIndex, cooldown.Round(time.Millisecond)))
+}
+
+// RecordUpstreamTokenUsage 请求完成后将输出 token 计入渠道与 key 的 TPM
+func RecordUpstreamTokenUsage(info *relaycommon.RelayInfo, completionTokens int) {
+	if info == nil || info.ChannelMeta == nil {
+		return
+	}
+	// 没有 TPM 上限时无需计数
+	if settings := info.ChannelOtherSettings; settings.TPMLimit <= 0 && settings.KeyTPMLimit <= 0 {
+		return
+	}
+	model.RecordChannelKeyTokens(info.ChannelId, channelKeyIndex(info), completionTokens)
+}
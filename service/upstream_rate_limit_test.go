@@ -0,0 +1,131 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseUpstreamRateLimit(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	header := http.Header{}
+	header.Set("x-ratelimit-remaining-requests", "0")
+	header.Set("x-ratelimit-reset-requests", "6m0s")
+	header.Set("x-ratelimit-remaining-tokens", "1200")
+	header.Set("x-ratelimit-reset-tokens", "20ms")
+	limit, ok := ParseUpstreamRateLimit(header, now)
+	require.True(t, ok)
+	assert.Equal(t, 0, limit.RequestsRemaining)
+	assert.Equal(t, now.Add(6*time.Minute), limit.RequestsReset)
+	assert.Equal(t, 1200, limit.TokensRemaining)
+	assert.Equal(t, now.Add(20*time.Millisecond), limit.TokensReset)
+
+	header = http.Header{}
+	header.Set("anthropic-ratelimit-input-tokens-remaining", "500")
+	header.Set("anthropic-ratelimit-input-tokens-reset", "2026-01-02T03:05:00Z")
+	header.Set("anthropic-ratelimit-output-tokens-remaining", "0")
+	header.Set("anthropic-ratelimit-output-tokens-reset", "2026-01-02T03:04:35Z")
+	limit, ok = ParseUpstreamRateLimit(header, now)
+	require.True(t, ok)
+	assert.Equal(t, -1, limit.RequestsRemaining)
+	assert.Equal(t, 0, limit.TokensRemaining)
+	assert.Equal(t, now.Add(30*time.Second), limit.TokensReset)
+
+	_, ok = ParseUpstreamRateLimit(http.Header{}, now)
+	assert.False(t, ok)
+
+	header = http.Header{}
+	header.Set("retry-after", "12")
+	retryAfter, ok := ParseRetryAfter(header, now)
+	require.True(t, ok)
+	assert.Equal(t, 12*time.Second, retryAfter)
+	header.Set("retry-after-ms", "1500")
+	retryAfter, _ = ParseRetryAfter(header, now)
+	assert.Equal(t, 1500*time.Millisecond, retryAfter)
+}
+
+func enableRateLimitCooldown(t *testing.T) {
+	t.Helper()
+	setting := operation_setting.GetChannelRateLimitSetting()
+	saved := setting.CooldownEnabled
+	setting.CooldownEnabled = true
+	t.Cleanup(func() { setting.CooldownEnabled = saved })
+}
+
+func TestObserveUpstreamRateLimitCooldownDisabledByDefault(t *testing.T) {
+	assert.False(t, operation_setting.GetChannelRateLimitSetting().CooldownEnabled)
+	channel := &model.Channel{Id: 90492, Key: "key-0"}
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	info := &relaycommon.RelayInfo{ChannelMeta: &relaycommon.ChannelMeta{ChannelId: channel.Id}}
+	resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+	resp.Header.Set("retry-after", "60")
+
+	ObserveUpstreamRateLimit(c, info, resp)
+	assert.True(t, model.GetChannelKeyCooldown(channel.Id, 0).IsZero())
+	assert.False(t, model.IsChannelSaturated(channel))
+}
+
+func TestObserveUpstreamRateLimitCoolsDownKey(t *testing.T) {
+	enableRateLimitCooldown(t)
+	channel := &model.Channel{
+		Id:  90491,
+		Key: "key-0\nkey-1",
+		ChannelInfo: model.ChannelInfo{
+			IsMultiKey:   true,
+			MultiKeySize: 2,
+			MultiKeyMode: constant.MultiKeyModeRandom,
+		},
+	}
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	info := &relaycommon.RelayInfo{ChannelMeta: &relaycommon.ChannelMeta{ChannelId: channel.Id, ChannelIsMultiKey: true, ChannelMultiKeyIndex: 0}}
+	rateLimited := func() *http.Response {
+		resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+		resp.Header.Set("retry-after", "60")
+		return resp
+	}
+
+	ObserveUpstreamRateLimit(c, info, rateLimited())
+	assert.WithinDuration(t, time.Now().Add(time.Minute), model.GetChannelKeyCooldown(channel.Id, 0), time.Second)
+	for i := 0; i < 10; i++ {
+		_, index, apiErr := channel.GetNextEnabledKey()
+		require.Nil(t, apiErr)
+		assert.Equal(t, 1, index)
+	}
+	assert.False(t, model.IsChannelSaturated(channel))
+
+	info.ChannelMultiKeyIndex = 1
+	ObserveUpstreamRateLimit(c, info, rateLimited())
+	assert.True(t, model.IsChannelSaturated(channel))
+	_, ok := model.TryAcquireChannelSlot(channel)
+	assert.False(t, ok)
+}
+
+func TestShouldDisableChannelIgnoresRateLimit(t *testing.T) {
+	enableRateLimitCooldown(t)
+	savedEnabled, savedRanges := common.AutomaticDisableChannelEnabled, operation_setting.AutomaticDisableStatusCodeRanges
+	t.Cleanup(func() {
+		common.AutomaticDisableChannelEnabled = savedEnabled
+		operation_setting.AutomaticDisableStatusCodeRanges = savedRanges
+	})
+	common.AutomaticDisableChannelEnabled = true
+	operation_setting.AutomaticDisableStatusCodeRanges = []operation_setting.StatusCodeRange{{Start: 429, End: 429}}
+
+	rateLimitErr := types.NewErrorWithStatusCode(errors.New("rate limit exceeded"), types.ErrorCodeBadResponseStatusCode, http.StatusTooManyRequests)
+	assert.False(t, ShouldDisableChannel(constant.ChannelTypeOpenAI, rateLimitErr))
+
+	quotaErr := types.WithOpenAIError(types.OpenAIError{Message: "quota", Type: "insufficient_quota"}, http.StatusTooManyRequests)
+	assert.True(t, ShouldDisableChannel(constant.ChannelTypeOpenAI, quotaErr))
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const usageRollupCleanupInterval = 1 * time.Hour
+
+var (
+	usageRollupOnce        sync.Once
+	usageRollupCleanupLast atomic.Int64
+	usageRollupBackfilling atomic.Bool
+)
+
+// StartUsageRollupTask 定期将内存中的用量增量刷入数据库，并由主节点清理过期的小时汇总
+func StartUsageRollupTask() {
+	usageRollupOnce.Do(func() {
+		model.RegisterLeaseJob(model.JobUsageRollupCleanup)
+		gopool.Go(func() {
+			for {
+				interval := system_setting.GetUsageRollupSetting().FlushIntervalSeconds
+				if interval <= 0 {
+					interval = 60
+				}
+				time.Sleep(time.Duration(interval) * time.Second)
+				runUsageRollupOnce()
+			}
+		})
+	})
+}
+
+func runUsageRollupOnce() {
+	ctx := context.Background()
+	if n, err := model.FlushUsageRollups(); err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("usage rollup flush failed after %d rows: %v", n, err))
+	}
+
+	retentionDays := system_setting.GetUsageRollupSetting().HourlyRetentionDays
+	if retentionDays <= 0 || !model.IsJobLeader(model.JobUsageRollupCleanup) {
+		return
+	}
+	now := time.Now()
+	if now.Unix()-usageRollupCleanupLast.Load() < int64(usageRollupCleanupInterval.Seconds()) {
+		return
+	}
+	usageRollupCleanupLast.Store(now.Unix())
+	before := now.Unix() - int64(retentionDays)*86400
+	deleted, err := model.DeleteUsageRollupsBefore(model.UsageRollupHour, before)
+	if err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("usage rollup cleanup failed: %v", err))
+		return
+	}
+	if deleted > 0 {
+		logger.LogInfo(ctx, fmt.Sprintf("usage rollup cleanup: deleted %d hourly rows", deleted))
+	}
+}
+
+// FlushUsageRollupsOnExit 进程退出前将内存中尚未写入的用量增量刷入数据库
+func FlushUsageRollupsOnExit() {
+	n, err := model.FlushUsageRollups()
+	if err != nil {
+		common.SysError(fmt.Sprintf("usage rollup flush on exit failed after %d rows: %v", n, err))
+		return
+	}
+	common.SysLog(fmt.Sprintf("usage rollup flushed %d rows on exit", n))
+}
+
+// BackfillUsageRollupsAsync 后台根据日志重建汇总，同一时间只允许一个回填任务
+func BackfillUsageRollupsAsync(startTimestamp int64, endTimestamp int64) bool {
+	if !usageRollupBackfilling.CompareAndSwap(false, true) {
+		return false
+	}
+	gopool.Go(func() {
+		defer usageRollupBackfilling.Store(false)
+		common.SysLog(fmt.Sprintf("usage rollup backfill started: %d - %d", startTimestamp, endTimestamp))
+		processed, err := model.BackfillUsageRollups(startTimestamp, endTimestamp)
+		if err != nil {
+			common.SysError(fmt.Sprintf("usage rollup backfill failed after %d logs: %v", processed, err))
+			return
+		}
+		common.SysLog(fmt.Sprintf("usage rollup backfill finished: %d logs", processed))
+	})
+	return true
+}
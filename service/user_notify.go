@@ -15,8 +15,13 @@ import (
 )
 
 func NotifyRootUser(t string, subject string, content string) {
+	NotifyRootUserEvent(t, t, subject, content)
+}
+
+// NotifyRootUserEvent 通知 root 用户，event 用于订阅过滤，t 用于限流
+func NotifyRootUserEvent(event string, t string, subject string, content string) {
 	user := model.GetRootUser().ToBaseUser()
-	err := NotifyUser(user.Id, user.Email, user.GetSetting(), dto.NewNotify(t, subject, content, nil))
+	err := NotifyUser(user.Id, user.Email, user.GetSetting(), dto.NewEventNotify(event, t, subject, content, nil))
 	if err != nil {
 		common.SysLog(fmt.Sprintf("failed to notify root user: %s", err.Error()))
 	}
@@ -54,6 +59,11 @@ func NotifyUser(userId int, userEmail string, userSetting dto.UserSetting, data
 		notifyType = dto.NotifyTypeEmail
 	}
 
+	// 未订阅的事件不发送，也不占用限流额度
+	if !userSetting.IsSubscribed(data.Event) {
+		return nil
+	}
+
 	// Check notification limit
 	canSend, err := CheckNotificationLimit(userId, data.Type)
 	if err != nil {
@@ -64,45 +74,11 @@ func NotifyUser(userId int, userEmail string, userSetting dto.UserSetting, data
 		return fmt.Errorf("notification limit exceeded for user %d with type %s", userId, notifyType)
 	}
 
-	switch notifyType {
-	case dto.NotifyTypeEmail:
-		// 优先使用设置中的通知邮箱，如果为空则使用用户的默认邮箱
-		emailToUse := userSetting.NotificationEmail
-		if emailToUse == "" {
-			emailToUse = userEmail
-		}
-		if emailToUse == "" {
-			common.SysLog(fmt.Sprintf("user %d has no email, skip sending email", userId))
-			return nil
-		}
-		return sendEmailNotify(emailToUse, data)
-	case dto.NotifyTypeWebhook:
-		webhookURLStr := userSetting.WebhookUrl
-		if webhookURLStr == "" {
-			common.SysLog(fmt.Sprintf("user %d has no webhook url, skip sending webhook", userId))
-			return nil
-		}
-
-		// 获取 webhook secret
-		webhookSecret := userSetting.WebhookSecret
-		return SendWebhookNotify(webhookURLStr, webhookSecret, data)
-	case dto.NotifyTypeBark:
-		barkURL := userSetting.BarkUrl
-		if barkURL == "" {
-			common.SysLog(fmt.Sprintf("user %d has no bark url, skip sending bark", userId))
-			return nil
-		}
-		return sendBarkNotify(barkURL, data)
-	case dto.NotifyTypeGotify:
-		gotifyUrl := userSetting.GotifyUrl
-		gotifyToken := userSetting.GotifyToken
-		if gotifyUrl == "" || gotifyToken == "" {
-			common.SysLog(fmt.Sprintf("user %d has no gotify url or token, skip sending gotify", userId))
-			return nil
-		}
-		return sendGotifyNotify(gotifyUrl, gotifyToken, userSetting.GotifyPriority, data)
+	notifier, ok := GetNotifier(notifyType)
+	if !ok {
+		return nil
 	}
-	return nil
+	return notifier.Send(NotifyTarget{UserId: userId, Email: userEmail, Setting: userSetting}, data)
 }
 
 func sendEmailNotify(userEmail string, data dto.Notify) error {
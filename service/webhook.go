@@ -54,9 +54,23 @@ func SendWebhookNotify(webhookURL string, secret string, data dto.Notify) error
 		return fmt.Errorf("failed to marshal webhook payload: %v", err)
 	}
 
+	statusCode, err := postWebhook(webhookURL, secret, payloadBytes)
+	if err != nil {
+		return err
+	}
+	// 检查响应状态
+	if statusCode < 200 || statusCode >= 300 {
+		return fmt.Errorf("webhook request failed with status code: %d", statusCode)
+	}
+	return nil
+}
+
+// postWebhook 以 JSON 发送已序列化的负载，secret 非空时附带签名，返回响应状态码
+func postWebhook(webhookURL string, secret string, payloadBytes []byte) (int, error) {
 	// 创建 HTTP 请求
 	var req *http.Request
 	var resp *http.Response
+	var err error
 
 	if system_setting.EnableWorker() {
 		// 构建worker请求数据
@@ -79,48 +93,38 @@ func SendWebhookNotify(webhookURL string, secret string, data dto.Notify) error
 
 		resp, err = DoWorkerRequest(workerReq)
 		if err != nil {
-			return fmt.Errorf("failed to send webhook request through worker: %v", err)
+			return 0, fmt.Errorf("failed to send webhook request through worker: %v", err)
 		}
 		defer resp.Body.Close()
+		return resp.StatusCode, nil
+	}
 
-		// 检查响应状态
-		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-			return fmt.Errorf("webhook request failed with status code: %d", resp.StatusCode)
-		}
-	} else {
-		// SSRF防护：验证Webhook URL（非Worker模式）
-		fetchSetting := system_setting.GetFetchSetting()
-		if err := common.ValidateURLWithFetchSetting(webhookURL, fetchSetting.EnableSSRFProtection, fetchSetting.AllowPrivateIp, fetchSetting.DomainFilterMode, fetchSetting.IpFilterMode, fetchSetting.DomainList, fetchSetting.IpList, fetchSetting.AllowedPorts, fetchSetting.ApplyIPFilterForDomain); err != nil {
-			return fmt.Errorf("request reject: %v", err)
-		}
-
-		req, err = http.NewRequest(http.MethodPost, webhookURL, bytes.NewBuffer(payloadBytes))
-		if err != nil {
-			return fmt.Errorf("failed to create webhook request: %v", err)
-		}
-
-		// 设置请求头
-		req.Header.Set("Content-Type", "application/json")
+	// SSRF防护：验证Webhook URL（非Worker模式）
+	fetchSetting := system_setting.GetFetchSetting()
+	if err := common.ValidateURLWithFetchSetting(webhookURL, fetchSetting.EnableSSRFProtection, fetchSetting.AllowPrivateIp, fetchSetting.DomainFilterMode, fetchSetting.IpFilterMode, fetchSetting.DomainList, fetchSetting.IpList, fetchSetting.AllowedPorts, fetchSetting.ApplyIPFilterForDomain); err != nil {
+		return 0, fmt.Errorf("request reject: %v", err)
+	}
 
-		// 如果有 secret，生成签名
-		if secret != "" {
-			signature := generateSignature(secret, payloadBytes)
-			req.Header.Set("X-Webhook-Signature", signature)
-		}
+	req, err = http.NewRequest(http.MethodPost, webhookURL, bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create webhook request: %v", err)
+	}
 
-		// 发送请求
-		client := GetHttpClient()
-		resp, err = client.Do(req)
-		if err != nil {
-			return fmt.Errorf("failed to send webhook request: %v", err)
-		}
-		defer resp.Body.Close()
+	// 设置请求头
+	req.Header.Set("Content-Type", "application/json")
 
-		// 检查响应状态
-		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-			return fmt.Errorf("webhook request failed with status code: %d", resp.StatusCode)
-		}
+	// 如果有 secret，生成签名
+	if secret != "" {
+		signature := generateSignature(secret, payloadBytes)
+		req.Header.Set("X-Webhook-Signature", signature)
 	}
 
-	return nil
+	// 发送请求
+	client := GetHttpClient()
+	resp, err = client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send webhook request: %v", err)
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode, nil
 }
@@ -0,0 +1,100 @@
+package operation_setting
+
+import (
+	"slices"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// AdmissionPriorityClass 准入队列的优先级类别，按分组划分，Priority 越大越先放行
+type AdmissionPriorityClass struct {
+	Name     string   `json:"name"`
+	Groups   []string `json:"groups"`
+	Priority int      `json:"priority"`
+	// MaxDepth 该类别在每个队列中的最大排队数，0 表示只受全局限制
+	MaxDepth int `json:"max_depth,omitempty"`
+	// MaxWaitMs 该类别的最长等待时间，0 表示使用全局设置
+	MaxWaitMs int `json:"max_wait_ms,omitempty"`
+}
+
+// AdmissionQueueSetting 模型的渠道并发全部已满或全部被上游限流时，请求按分组与模型排队等待，而不是直接返回错误。
+// 队列与渠道并发计数均为单实例内存状态，多实例部署时每个实例独立排队与限制
+type AdmissionQueueSetting struct {
+	Enabled bool     `json:"enabled"`
+	Models  []string `json:"models,omitempty"` // 为空时对所有模型生效
+	// MaxWaitMs 从首次入队开始计算的最长等待时间
+	MaxWaitMs int `json:"max_wait_ms"`
+	// MaxDepth 每个分组与模型队列的最大排队数
+	MaxDepth int `json:"max_depth"`
+	// MaxPerUser 每个用户在同一队列中的最大排队数，0 表示不限制
+	MaxPerUser int `json:"max_per_user,omitempty"`
+	// RequeueOnRateLimit 所有渠道都返回 429 时重新排队，等待后再试
+	RequeueOnRateLimit bool                     `json:"requeue_on_rate_limit"`
+	Classes            []AdmissionPriorityClass `json:"classes"`
+}
+
+const (
+	defaultAdmissionMaxWaitMs = 30000
+	defaultAdmissionMaxDepth  = 100
+	defaultAdmissionClassName = "default"
+)
+
+var admissionQueueSetting = AdmissionQueueSetting{
+	Enabled:            false,
+	MaxWaitMs:          defaultAdmissionMaxWaitMs,
+	MaxDepth:           defaultAdmissionMaxDepth,
+	RequeueOnRateLimit: true,
+	Classes:            []AdmissionPriorityClass{},
+}
+
+func init() {
+	config.GlobalConfig.Register("admission_queue_setting", &admissionQueueSetting)
+}
+
+func GetAdmissionQueueSetting() *AdmissionQueueSetting {
+	return &admissionQueueSetting
+}
+
+// Applies 准入队列是否对该模型生效
+func (s *AdmissionQueueSetting) Applies(modelName string) bool {
+	if !s.Enabled {
+		return false
+	}
+	return len(s.Models) == 0 || slices.Contains(s.Models, modelName)
+}
+
+// GetClass 依次按给定分组查找优先级类别，都未配置时属于优先级为 0 的默认类别
+func (s *AdmissionQueueSetting) GetClass(groups ...string) AdmissionPriorityClass {
+	for _, group := range groups {
+		for _, class := range s.Classes {
+			if group != "" && slices.Contains(class.Groups, group) {
+				if class.Name == "" {
+					class.Name = group
+				}
+				return class
+			}
+		}
+	}
+	return AdmissionPriorityClass{Name: defaultAdmissionClassName}
+}
+
+// GetMaxDepth 每个模型队列的最大排队数
+func (s *AdmissionQueueSetting) GetMaxDepth() int {
+	if s.MaxDepth <= 0 {
+		return defaultAdmissionMaxDepth
+	}
+	return s.MaxDepth
+}
+
+// GetMaxWait 返回类别的最长等待时间
+func (s *AdmissionQueueSetting) GetMaxWait(class AdmissionPriorityClass) time.Duration {
+	waitMs := class.MaxWaitMs
+	if waitMs <= 0 {
+		waitMs = s.MaxWaitMs
+	}
+	if waitMs <= 0 {
+		waitMs = defaultAdmissionMaxWaitMs
+	}
+	return time.Duration(waitMs) * time.Millisecond
+}
@@ -0,0 +1,51 @@
+package operation_setting
+
+import (
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// ChannelRateLimitSetting 按上游限流响应头与 429 冷却单个 key
+type ChannelRateLimitSetting struct {
+	// CooldownEnabled 启用后按限流响应头跳过额度耗尽的 key，429 只冷却当前 key，不计入渠道自动禁用。
+	// 默认关闭：单 key 渠道的 key 冷却期间整个渠道在本实例视为没有余量
+	CooldownEnabled bool `json:"cooldown_enabled"`
+	// DefaultCooldownSeconds 429 未携带 retry-after 或重置时间时的冷却时长
+	DefaultCooldownSeconds int `json:"default_cooldown_seconds"`
+	// MaxCooldownSeconds 冷却时长上限，避免异常的重置时间长期屏蔽 key
+	MaxCooldownSeconds int `json:"max_cooldown_seconds"`
+}
+
+const (
+	defaultKeyCooldownSeconds = 30
+	defaultMaxCooldownSeconds = 600
+)
+
+var channelRateLimitSetting = ChannelRateLimitSetting{
+	CooldownEnabled:        false,
+	DefaultCooldownSeconds: defaultKeyCooldownSeconds,
+	MaxCooldownSeconds:     defaultMaxCooldownSeconds,
+}
+
+func init() {
+	config.GlobalConfig.Register("channel_rate_limit_setting", &channelRateLimitSetting)
+}
+
+func GetChannelRateLimitSetting() *ChannelRateLimitSetting {
+	return &channelRateLimitSetting
+}
+
+func (s *ChannelRateLimitSetting) GetDefaultCooldown() time.Duration {
+	if s.DefaultCooldownSeconds <= 0 {
+		return defaultKeyCooldownSeconds * time.Second
+	}
+	return time.Duration(s.DefaultCooldownSeconds) * time.Second
+}
+
+func (s *ChannelRateLimitSetting) GetMaxCooldown() time.Duration {
+	if s.MaxCooldownSeconds <= 0 {
+		return defaultMaxCooldownSeconds * time.Second
+	}
+	return time.Duration(s.MaxCooldownSeconds) * time.Second
+}
@@ -0,0 +1,70 @@
+package operation_setting
+
+import (
+	"slices"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// HedgeRule 对冲请求规则：首个渠道在延迟内没有输出首字节时，向另一个渠道发送相同请求，先返回者胜出
+type HedgeRule struct {
+	Models []string `json:"models,omitempty"` // 为空时对所有模型生效
+	Groups []string `json:"groups,omitempty"` // 为空时对所有分组生效
+	// DelayMs 固定对冲延迟（毫秒）；UseP95 为 true 时作为样本不足时的回退值
+	DelayMs int `json:"delay_ms"`
+	// UseP95 按该模型最近首字节耗时的 p95 作为对冲延迟
+	UseP95     bool `json:"use_p95,omitempty"`
+	MinDelayMs int  `json:"min_delay_ms,omitempty"`
+	// MaxHedgeRate 对冲预算，命中规则的请求中最多有该比例发出对冲请求，如 0.1 表示 10%
+	MaxHedgeRate float64 `json:"max_hedge_rate"`
+}
+
+type HedgeSetting struct {
+	Enabled bool        `json:"enabled"`
+	Rules   []HedgeRule `json:"rules"`
+}
+
+const defaultHedgeDelayMs = 1000
+
+var hedgeSetting = HedgeSetting{
+	Enabled: false,
+	Rules:   []HedgeRule{},
+}
+
+func init() {
+	config.GlobalConfig.Register("hedge_setting", &hedgeSetting)
+}
+
+func GetHedgeSetting() *HedgeSetting {
+	return &hedgeSetting
+}
+
+// GetRule 返回第一个匹配模型与分组的规则，返回的下标用于区分对冲预算
+func (s *HedgeSetting) GetRule(modelName string, group string) (*HedgeRule, int, bool) {
+	if !s.Enabled {
+		return nil, -1, false
+	}
+	for i := range s.Rules {
+		rule := &s.Rules[i]
+		if rule.MaxHedgeRate <= 0 {
+			continue
+		}
+		if len(rule.Models) > 0 && !slices.Contains(rule.Models, modelName) {
+			continue
+		}
+		if len(rule.Groups) > 0 && !slices.Contains(rule.Groups, group) {
+			continue
+		}
+		return rule, i, true
+	}
+	return nil, -1, false
+}
+
+// FallbackDelayMs 没有可用的 p95 样本时使用的延迟
+func (r *HedgeRule) FallbackDelayMs() int {
+	delay := r.DelayMs
+	if delay <= 0 {
+		delay = defaultHedgeDelayMs
+	}
+	return max(delay, r.MinDelayMs)
+}
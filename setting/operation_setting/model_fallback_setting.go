@@ -0,0 +1,92 @@
+package operation_setting
+
+import (
+	"slices"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// 触发跨模型降级的错误类型，除 no_channel 外与用量汇总的错误分类一致
+const (
+	ModelFallbackOnNoChannel = "no_channel" // 模型在分组下没有可用渠道
+	ModelFallbackOnRateLimit = "rate_limit"
+	ModelFallbackOnTimeout   = "timeout"
+	ModelFallbackOnUpstream  = "upstream"
+	ModelFallbackOnClient    = "client"
+)
+
+var defaultModelFallbackTriggers = []string{
+	ModelFallbackOnNoChannel,
+	ModelFallbackOnRateLimit,
+	ModelFallbackOnTimeout,
+	ModelFallbackOnUpstream,
+}
+
+// ModelFallbackRule 模型 A 的所有渠道都失败时依次尝试 Fallbacks 中的模型，按实际提供服务的模型计费
+type ModelFallbackRule struct {
+	Model     string   `json:"model"`
+	Groups    []string `json:"groups,omitempty"` // 为空时对所有分组生效
+	Fallbacks []string `json:"fallbacks"`
+	// TriggerOn 触发降级的错误类型，为空时使用 no_channel、rate_limit、timeout、upstream
+	TriggerOn []string `json:"trigger_on,omitempty"`
+}
+
+// ModelFallbackSetting 跨模型降级链。已经向客户端输出内容（流式已开始）的请求不会降级
+type ModelFallbackSetting struct {
+	Enabled bool                `json:"enabled"`
+	Rules   []ModelFallbackRule `json:"rules"`
+}
+
+var modelFallbackSetting = ModelFallbackSetting{
+	Enabled: false,
+	Rules:   []ModelFallbackRule{},
+}
+
+func init() {
+	config.GlobalConfig.Register("model_fallback_setting", &modelFallbackSetting)
+}
+
+func GetModelFallbackSetting() *ModelFallbackSetting {
+	return &modelFallbackSetting
+}
+
+// GetRule 按模型与分组查找降级链，指定了分组的规则优先于对所有分组生效的规则
+func (s *ModelFallbackSetting) GetRule(modelName string, groups ...string) (*ModelFallbackRule, bool) {
+	if !s.Enabled || modelName == "" {
+		return nil, false
+	}
+	var generic *ModelFallbackRule
+	for i := range s.Rules {
+		rule := &s.Rules[i]
+		if rule.Model != modelName || len(rule.Fallbacks) == 0 {
+			continue
+		}
+		if len(rule.Groups) == 0 {
+			if generic == nil {
+				generic = rule
+			}
+			continue
+		}
+		for _, group := range groups {
+			if group != "" && slices.Contains(rule.Groups, group) {
+				return rule, true
+			}
+		}
+	}
+	return generic, generic != nil
+}
+
+func (r *ModelFallbackRule) ShouldTrigger(errorClass string) bool {
+	if len(r.TriggerOn) == 0 {
+		return slices.Contains(defaultModelFallbackTriggers, errorClass)
+	}
+	return slices.Contains(r.TriggerOn, errorClass)
+}
+
+// NextModels 返回降级链中 currentModel 之后的模型，currentModel 不在链中时从头开始
+func (r *ModelFallbackRule) NextModels(currentModel string) []string {
+	if index := slices.Index(r.Fallbacks, currentModel); index >= 0 {
+		return r.Fallbacks[index+1:]
+	}
+	return r.Fallbacks
+}
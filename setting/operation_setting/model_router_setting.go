@@ -0,0 +1,113 @@
+package operation_setting
+
+import (
+	"slices"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// TimeBudgetHeader 客户端期望的最长响应时间（毫秒），路由规则与延迟目标会参考该值
+const TimeBudgetHeader = "X-Time-Budget-Ms"
+
+// 候选模型的选择策略
+const (
+	ModelRouterStrategyOrder    = "order"    // 按候选顺序选择第一个满足条件的模型
+	ModelRouterStrategyCheapest = "cheapest" // 选择估算成本最低的模型
+	ModelRouterStrategyFastest  = "fastest"  // 选择首字节延迟 p95 最低的模型
+)
+
+// ReasoningEffortNone 在规则中匹配未指定推理强度的请求
+const ReasoningEffortNone = "none"
+
+// ModelRouterRule 路由规则，所有已配置的条件都满足时生效，未配置的条件不参与匹配
+type ModelRouterRule struct {
+	Name            string `json:"name"`
+	MinPromptTokens int    `json:"min_prompt_tokens,omitempty"`
+	MaxPromptTokens int    `json:"max_prompt_tokens,omitempty"`
+	HasImages       *bool  `json:"has_images,omitempty"`
+	HasTools        *bool  `json:"has_tools,omitempty"`
+	// ReasoningEfforts 请求的推理强度，none 匹配未指定推理强度的请求
+	ReasoningEfforts []string `json:"reasoning_efforts,omitempty"`
+	Groups           []string `json:"groups,omitempty"`
+	// MaxTimeBudgetMs 请求头 X-Time-Budget-Ms 不超过该值时匹配，未携带该请求头的请求不匹配
+	MaxTimeBudgetMs int `json:"max_time_budget_ms,omitempty"`
+
+	// Model 与 Models 为候选模型，Model 排在 Models 之前
+	Model  string   `json:"model,omitempty"`
+	Models []string `json:"models,omitempty"`
+	// Tags 只保留模型元数据中包含全部标签的候选模型
+	Tags     []string `json:"tags,omitempty"`
+	Strategy string   `json:"strategy,omitempty"`
+	// MaxCost 单次请求的估算成本上限（美元），按模型价格或倍率与估算的输入、最大输出 token 计算
+	MaxCost float64 `json:"max_cost,omitempty"`
+	// MaxLatencyMs 首字节延迟 p95 上限，没有延迟样本的模型视为满足。请求携带时间预算时取两者中较小的值
+	MaxLatencyMs int `json:"max_latency_ms,omitempty"`
+}
+
+// RouterModel 虚拟模型，按规则顺序匹配，都不匹配或没有可用候选时使用 Default
+type RouterModel struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Groups      []string          `json:"groups,omitempty"` // 为空时对所有分组可见
+	Rules       []ModelRouterRule `json:"rules"`
+	Default     string            `json:"default,omitempty"`
+}
+
+// ModelRouterSetting 虚拟路由模型，按请求特征为每个请求选择实际模型，按实际模型计费
+type ModelRouterSetting struct {
+	Enabled bool          `json:"enabled"`
+	Models  []RouterModel `json:"models"`
+}
+
+var modelRouterSetting = ModelRouterSetting{
+	Enabled: false,
+	Models:  []RouterModel{},
+}
+
+func init() {
+	config.GlobalConfig.Register("model_router_setting", &modelRouterSetting)
+}
+
+func GetModelRouterSetting() *ModelRouterSetting {
+	return &modelRouterSetting
+}
+
+// GetRouterModel 按名称查找虚拟模型
+func (s *ModelRouterSetting) GetRouterModel(modelName string) (*RouterModel, bool) {
+	if !s.Enabled || modelName == "" {
+		return nil, false
+	}
+	for i := range s.Models {
+		if s.Models[i].Name == modelName {
+			return &s.Models[i], true
+		}
+	}
+	return nil, false
+}
+
+// VisibleTo 虚拟模型对任一分组可见
+func (m *RouterModel) VisibleTo(groups ...string) bool {
+	if len(m.Groups) == 0 {
+		return true
+	}
+	for _, group := range groups {
+		if group != "" && slices.Contains(m.Groups, group) {
+			return true
+		}
+	}
+	return false
+}
+
+// Candidates 返回规则的候选模型，去除重复项
+func (r *ModelRouterRule) Candidates() []string {
+	candidates := make([]string, 0, len(r.Models)+1)
+	if r.Model != "" {
+		candidates = append(candidates, r.Model)
+	}
+	for _, name := range r.Models {
+		if name != "" && !slices.Contains(candidates, name) {
+			candidates = append(candidates, name)
+		}
+	}
+	return candidates
+}
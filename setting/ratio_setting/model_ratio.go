@@ -127,6 +127,11 @@ var defaultModelRatio = map[string]float64{
 	"text-embedding-3-small":                    0.01,
 	"text-embedding-3-large":                    0.065,
 	"text-embedding-ada-002":                    0.05,
+	"titan-embed-text-v1":                       0.05, // $0.0001 / 1K tokens
+	"titan-embed-text-v2:0":                     0.01, // $0.00002 / 1K tokens
+	"cohere-embed-english-v3":                   0.05, // $0.0001 / 1K tokens
+	"cohere-embed-multilingual-v3":              0.05, // $0.0001 / 1K tokens
+	"cohere-embed-v4:0":                         0.06, // $0.00012 / 1K tokens
 	"text-search-ada-doc-001":                   10,
 	"text-moderation-stable":                    0.1,
 	"text-moderation-latest":                    0.1,
@@ -183,6 +188,8 @@ var defaultModelRatio = map[string]float64{
 	"gemini-2.5-flash-lite-preview-thinking-*":  0.05,
 	"gemini-2.5-flash-lite-preview-06-17":       0.05,
 	"gemini-2.5-flash":                          0.15,
+	"gemini-2.5-flash-image":                    0.15,
+	"gemini-3-pro-image-preview":                1,
 	"gemini-robotics-er-1.5-preview":            0.15,
 	"gemini-embedding-001":                      0.075,
 	"text-embedding-004":                        0.001,
@@ -275,6 +282,12 @@ var defaultModelPrice = map[string]float64{
 	"suno_lyrics":                    0.01,
 	"dall-e-3":                       0.04,
 	"imagen-3.0-generate-002":        0.03,
+	"nova-canvas-v1:0":               0.04,
+	"titan-image-generator-v1":       0.01,
+	"titan-image-generator-v2:0":     0.01,
+	"stable-image-core-v1:1":         0.04,
+	"stable-image-ultra-v1:1":        0.14,
+	"sd3-5-large-v1:0":               0.08,
 	"black-forest-labs/flux-1.1-pro": 0.04,
 	"gpt-4-gizmo-*":                  0.1,
 	"mj_video":                       0.8,
@@ -322,6 +335,12 @@ var defaultAudioCompletionRatio = map[string]float64{
 	"tts-1-hd-1106":        0,
 }
 
+// defaultImageCompletionRatio 图片输出 token 相对输入价格的倍率，文本输出仍按补全倍率计费
+var defaultImageCompletionRatio = map[string]float64{
+	"gemini-2.5-flash-image":     30 / 0.3,
+	"gemini-3-pro-image-preview": 120 / 2,
+}
+
 var modelPriceMap = types.NewRWMap[string, float64]()
 var modelRatioMap = types.NewRWMap[string, float64]()
 var completionRatioMap = types.NewRWMap[string, float64]()
@@ -343,6 +362,7 @@ func InitRatioSettings() {
 	imageRatioMap.AddAll(defaultImageRatio)
 	audioRatioMap.AddAll(defaultAudioRatio)
 	audioCompletionRatioMap.AddAll(defaultAudioCompletionRatio)
+	imageCompletionRatioMap.AddAll(defaultImageCompletionRatio)
 }
 
 func GetModelPriceMap() map[string]float64 {
@@ -576,7 +596,7 @@ func getHardcodedCompletionModelRatio(name string) (float64, bool) {
 			return 2.5 / 0.3, false
 		} else if strings.HasPrefix(name, "gemini-3-pro") {
 			if strings.HasPrefix(name, "gemini-3-pro-image") {
-				return 60, false
+				return 12 / 2, false
 			}
 			return 6, false
 		}
@@ -655,6 +675,7 @@ var defaultImageRatio = map[string]float64{
 var imageRatioMap = types.NewRWMap[string, float64]()
 var audioRatioMap = types.NewRWMap[string, float64]()
 var audioCompletionRatioMap = types.NewRWMap[string, float64]()
+var imageCompletionRatioMap = types.NewRWMap[string, float64]()
 
 func ImageRatio2JSONString() string {
 	return imageRatioMap.MarshalJSONString()
@@ -688,6 +709,20 @@ func UpdateAudioCompletionRatioByJSONString(jsonStr string) error {
 	return types.LoadFromJsonStringWithCallback(audioCompletionRatioMap, jsonStr, InvalidateExposedDataCache)
 }
 
+func ImageCompletionRatio2JSONString() string {
+	return imageCompletionRatioMap.MarshalJSONString()
+}
+
+func UpdateImageCompletionRatioByJSONString(jsonStr string) error {
+	return types.LoadFromJsonStringWithCallback(imageCompletionRatioMap, jsonStr, InvalidateExposedDataCache)
+}
+
+// GetImageCompletionRatio 返回图片输出 token 的倍率，未配置时图片 token 按普通补全计费
+func GetImageCompletionRatio(name string) (float64, bool) {
+	name = FormatMatchingModelName(name)
+	return imageCompletionRatioMap.Get(name)
+}
+
 func GetModelRatioCopy() map[string]float64 {
 	return modelRatioMap.ReadAll()
 }
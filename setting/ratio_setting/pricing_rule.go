@@ -0,0 +1,54 @@
+package ratio_setting
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/types"
+)
+
+// modelPricingRuleMap 模型名 -> 定价规则（长上下文分档、请求条件、时段倍率）
+var modelPricingRuleMap = types.NewRWMap[string, *types.PricingRule]()
+
+func ModelPricingRules2JSONString() string {
+	return modelPricingRuleMap.MarshalJSONString()
+}
+
+// CheckModelPricingRules 校验定价规则 JSON
+func CheckModelPricingRules(jsonStr string) error {
+	rules := make(map[string]*types.PricingRule)
+	if err := common.UnmarshalJsonStr(jsonStr, &rules); err != nil {
+		return err
+	}
+	for name, rule := range rules {
+		if rule == nil {
+			continue
+		}
+		if err := rule.Validate(); err != nil {
+			return fmt.Errorf("模型 %s 定价规则无效: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func UpdateModelPricingRulesByJSONString(jsonStr string) error {
+	if err := CheckModelPricingRules(jsonStr); err != nil {
+		return err
+	}
+	return types.LoadFromJsonStringWithCallback(modelPricingRuleMap, jsonStr, InvalidateExposedDataCache)
+}
+
+// GetModelPricingRule 获取模型定价规则，未精确匹配时按归一化模型名查找
+func GetModelPricingRule(name string) (*types.PricingRule, bool) {
+	if rule, ok := modelPricingRuleMap.Get(name); ok && rule != nil {
+		return rule, true
+	}
+	if rule, ok := modelPricingRuleMap.Get(FormatMatchingModelName(name)); ok && rule != nil {
+		return rule, true
+	}
+	return nil, false
+}
+
+func GetModelPricingRuleCopy() map[string]*types.PricingRule {
+	return modelPricingRuleMap.ReadAll()
+}
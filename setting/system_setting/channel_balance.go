@@ -0,0 +1,41 @@
+package system_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// 余额低于下限时的处理方式
+const (
+	ChannelBalanceFloorDeprioritize = "deprioritize"
+	ChannelBalanceFloorDisable      = "disable"
+)
+
+// ChannelBalanceSetting 上游余额监控配置，渠道可在设置中覆盖阈值与处理方式
+type ChannelBalanceSetting struct {
+	AlertEnabled bool `json:"alert_enabled"`
+	// 阈值单位与渠道余额一致，0 表示不启用
+	DefaultAlertThreshold float64 `json:"default_alert_threshold"`
+	DefaultFloor          float64 `json:"default_floor"`
+	FloorAction           string  `json:"floor_action"`
+	// DeprioritizedPriority 低于下限时渠道被调整到的优先级
+	DeprioritizedPriority int64 `json:"deprioritized_priority"`
+	// AlertIntervalHours 同一渠道重复告警的最小间隔
+	AlertIntervalHours    int `json:"alert_interval_hours"`
+	ForecastWindowHours   int `json:"forecast_window_hours"`
+	SnapshotRetentionDays int `json:"snapshot_retention_days"`
+}
+
+var defaultChannelBalanceSetting = ChannelBalanceSetting{
+	AlertEnabled:          true,
+	FloorAction:           ChannelBalanceFloorDeprioritize,
+	DeprioritizedPriority: -100,
+	AlertIntervalHours:    24,
+	ForecastWindowHours:   72,
+	SnapshotRetentionDays: 30,
+}
+
+func init() {
+	config.GlobalConfig.Register("channel_balance_setting", &defaultChannelBalanceSetting)
+}
+
+func GetChannelBalanceSetting() *ChannelBalanceSetting {
+	return &defaultChannelBalanceSetting
+}
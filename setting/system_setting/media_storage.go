@@ -0,0 +1,48 @@
+package system_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+const (
+	MediaStorageBackendLocal = "local"
+	MediaStorageBackendS3    = "s3"
+)
+
+// MediaStorageSetting 生成内容（视频、图片）持久化存储配置
+type MediaStorageSetting struct {
+	Enabled              bool   `json:"enabled"`
+	Backend              string `json:"backend"` // local / s3
+	LocalPath            string `json:"local_path"`
+	S3Endpoint           string `json:"s3_endpoint"`
+	S3Region             string `json:"s3_region"`
+	S3Bucket             string `json:"s3_bucket"`
+	S3AccessKeyId        string `json:"s3_access_key_id"`
+	S3Secret             string `json:"s3_secret"`
+	S3PathStyle          bool   `json:"s3_path_style"`
+	PersistTaskResults   bool   `json:"persist_task_results"`
+	PersistImageResponse bool   `json:"persist_image_response"`
+	SignedUrlTTLSeconds  int    `json:"signed_url_ttl_seconds"`
+	DefaultRetentionDays int    `json:"default_retention_days"` // 0 表示永久保留
+	DefaultUserQuotaMB   int64  `json:"default_user_quota_mb"`  // 0 表示不限制
+	MaxObjectSizeMB      int64  `json:"max_object_size_mb"`
+}
+
+var defaultMediaStorageSetting = MediaStorageSetting{
+	Enabled:              false,
+	Backend:              MediaStorageBackendLocal,
+	LocalPath:            "./data/media",
+	S3Region:             "us-east-1",
+	PersistTaskResults:   true,
+	PersistImageResponse: true,
+	SignedUrlTTLSeconds:  3600,
+	DefaultRetentionDays: 30,
+	DefaultUserQuotaMB:   0,
+	MaxObjectSizeMB:      512,
+}
+
+func init() {
+	config.GlobalConfig.Register("media_storage_setting", &defaultMediaStorageSetting)
+}
+
+func GetMediaStorageSetting() *MediaStorageSetting {
+	return &defaultMediaStorageSetting
+}
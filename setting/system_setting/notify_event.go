@@ -0,0 +1,27 @@
+package system_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// NotifyEventSetting 定时检测类通知事件的配置
+type NotifyEventSetting struct {
+	// TokenExpiringLeadHours 令牌过期前多少小时提醒，0 表示不提醒
+	TokenExpiringLeadHours int `json:"token_expiring_lead_hours"`
+	// SubscriptionRenewingLeadHours 订阅到期前多少小时提醒，0 表示不提醒
+	SubscriptionRenewingLeadHours int `json:"subscription_renewing_lead_hours"`
+	// LoginIpHistorySize 每个用户记录的最近登录 IP 数量，0 表示关闭新 IP 登录提醒
+	LoginIpHistorySize int `json:"login_ip_history_size"`
+}
+
+var defaultNotifyEventSetting = NotifyEventSetting{
+	TokenExpiringLeadHours:        72,
+	SubscriptionRenewingLeadHours: 72,
+	LoginIpHistorySize:            10,
+}
+
+func init() {
+	config.GlobalConfig.Register("notify_event_setting", &defaultNotifyEventSetting)
+}
+
+func GetNotifyEventSetting() *NotifyEventSetting {
+	return &defaultNotifyEventSetting
+}
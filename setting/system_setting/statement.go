@@ -0,0 +1,36 @@
+package system_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// StatementSetting 月度对账单与发票配置
+type StatementSetting struct {
+	// AutoCloseEnabled 每月初自动为上月有活动的用户生成对账单
+	AutoCloseEnabled bool    `json:"auto_close_enabled"`
+	InvoicePrefix    string  `json:"invoice_prefix"`
+	Currency         string  `json:"currency"`
+	CompanyName      string  `json:"company_name"`
+	CompanyAddress   string  `json:"company_address"`
+	CompanyTaxId     string  `json:"company_tax_id"`
+	CompanyEmail     string  `json:"company_email"`
+	TaxName          string  `json:"tax_name"`
+	TaxRate          float64 `json:"tax_rate"` // 百分比，例如 6 表示 6%
+	// TaxInclusive 支付金额是否已含税
+	TaxInclusive bool   `json:"tax_inclusive"`
+	Footer       string `json:"footer"`
+}
+
+var defaultStatementSetting = StatementSetting{
+	AutoCloseEnabled: true,
+	InvoicePrefix:    "INV",
+	Currency:         "USD",
+	TaxName:          "Tax",
+	TaxInclusive:     true,
+}
+
+func init() {
+	config.GlobalConfig.Register("statement_setting", &defaultStatementSetting)
+}
+
+func GetStatementSetting() *StatementSetting {
+	return &defaultStatementSetting
+}
@@ -0,0 +1,23 @@
+package system_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// TaskCallbackSetting 上游任务回调配置，需要 ServerAddress 可被上游访问
+type TaskCallbackSetting struct {
+	Enabled bool `json:"enabled"`
+	// PollingFallbackSeconds 开启回调的任务在提交或最近一次更新后多久仍无回调才恢复轮询
+	PollingFallbackSeconds int `json:"polling_fallback_seconds"`
+}
+
+var defaultTaskCallbackSetting = TaskCallbackSetting{
+	Enabled:                false,
+	PollingFallbackSeconds: 300,
+}
+
+func init() {
+	config.GlobalConfig.Register("task_callback_setting", &defaultTaskCallbackSetting)
+}
+
+func GetTaskCallbackSetting() *TaskCallbackSetting {
+	return &defaultTaskCallbackSetting
+}
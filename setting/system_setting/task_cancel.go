@@ -0,0 +1,23 @@
+package system_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// TaskCancelSetting 用户取消异步任务的配置
+type TaskCancelSetting struct {
+	Enabled bool `json:"enabled"`
+	// AllowLocalCancel 上游没有取消接口时，是否仍允许仅在本地标记取消并退款（上游可能继续计费）
+	AllowLocalCancel bool `json:"allow_local_cancel"`
+}
+
+var defaultTaskCancelSetting = TaskCancelSetting{
+	Enabled:          true,
+	AllowLocalCancel: false,
+}
+
+func init() {
+	config.GlobalConfig.Register("task_cancel_setting", &defaultTaskCancelSetting)
+}
+
+func GetTaskCancelSetting() *TaskCancelSetting {
+	return &defaultTaskCancelSetting
+}
@@ -0,0 +1,25 @@
+package system_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// UsageRollupSetting 多维用量汇总配置
+type UsageRollupSetting struct {
+	Enabled              bool `json:"enabled"`
+	FlushIntervalSeconds int  `json:"flush_interval_seconds"`
+	// HourlyRetentionDays 小时粒度汇总的保留天数，0 表示不清理；天粒度汇总始终保留
+	HourlyRetentionDays int `json:"hourly_retention_days"`
+}
+
+var defaultUsageRollupSetting = UsageRollupSetting{
+	Enabled:              true,
+	FlushIntervalSeconds: 60,
+	HourlyRetentionDays:  90,
+}
+
+func init() {
+	config.GlobalConfig.Register("usage_rollup_setting", &defaultUsageRollupSetting)
+}
+
+func GetUsageRollupSetting() *UsageRollupSetting {
+	return &defaultUsageRollupSetting
+}
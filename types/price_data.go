@@ -1,6 +1,9 @@
 package types
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 type GroupRatioInfo struct {
 	GroupRatio        float64
@@ -20,11 +23,44 @@ type PriceData struct {
 	ImageRatio           float64
 	AudioRatio           float64
 	AudioCompletionRatio float64
+	ImageCompletionRatio float64 // 图片输出 token 倍率，0 表示未配置，按补全倍率计费
 	OtherRatios          map[string]float64
 	UsePrice             bool
 	Quota                int // 按次计费的最终额度（MJ / Task）
 	QuotaToPreConsume    int // 按量计费的预消耗额度
 	GroupRatioInfo       GroupRatioInfo
+
+	// ImagePriceRatio 图片尺寸与质量对按次价格的倍率，在定价规则之后应用，0 表示不变
+	ImagePriceRatio float64
+
+	// 模型定价规则，分档依赖实际 token 数，结算时重新计算
+	PricingRule        *PricingRule
+	PricingRuleBase    PricingRatios
+	PricingRuleAttrs   map[string]string
+	PricingRuleTime    time.Time
+	PricingRuleApplied []string
+}
+
+// ApplyPricingRule 按 token 数重新应用定价规则，覆盖当前倍率
+func (p *PriceData) ApplyPricingRule(usage PricingUsage) {
+	if p.PricingRule == nil {
+		return
+	}
+	ratios, applied := p.PricingRule.Resolve(p.PricingRuleBase, usage, p.PricingRuleAttrs, p.PricingRuleTime)
+	// 1h 缓存写入与 5m 保持固定比例
+	if p.CacheCreationRatio != 0 {
+		p.CacheCreation1hRatio = p.CacheCreation1hRatio / p.CacheCreationRatio * ratios.CacheCreationRatio
+	}
+	p.ModelRatio = ratios.ModelRatio
+	p.CompletionRatio = ratios.CompletionRatio
+	p.CacheRatio = ratios.CacheRatio
+	p.CacheCreationRatio = ratios.CacheCreationRatio
+	p.CacheCreation5mRatio = ratios.CacheCreationRatio
+	p.ModelPrice = ratios.ModelPrice
+	if p.ImagePriceRatio != 0 {
+		p.ModelPrice *= p.ImagePriceRatio
+	}
+	p.PricingRuleApplied = applied
 }
 
 func (p *PriceData) AddOtherRatio(key string, ratio float64) {
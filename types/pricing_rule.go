@@ -0,0 +1,244 @@
+package types
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// 定价规则可匹配的请求字段
+const (
+	PricingFieldServiceTier     = "service_tier"
+	PricingFieldReasoningEffort = "reasoning_effort"
+	PricingFieldImageSize       = "image_size"
+	PricingFieldImageQuality    = "image_quality"
+)
+
+// PricingRatioOverride 规则命中后覆盖的倍率，未设置的字段保持原值
+type PricingRatioOverride struct {
+	ModelRatio       *float64 `json:"model_ratio,omitempty"`
+	CompletionRatio  *float64 `json:"completion_ratio,omitempty"`
+	CacheRatio       *float64 `json:"cache_ratio,omitempty"`
+	CreateCacheRatio *float64 `json:"create_cache_ratio,omitempty"`
+	ModelPrice       *float64 `json:"model_price,omitempty"`
+	// Multiplier 在覆盖之后对整体价格再乘算，0 表示不变
+	Multiplier float64 `json:"multiplier,omitempty"`
+}
+
+// PricingTier 按输入 token 数分档，输入超过 AbovePromptTokens 时生效，多档命中取阈值最高的一档
+type PricingTier struct {
+	AbovePromptTokens int `json:"above_prompt_tokens"`
+	PricingRatioOverride
+}
+
+// PricingTokenTier 按输出或缓存 token 数分档，超过 AboveTokens 时生效，多档命中取阈值最高的一档
+type PricingTokenTier struct {
+	AboveTokens int `json:"above_tokens"`
+	PricingRatioOverride
+}
+
+// PricingUsage 分档使用的 token 数
+type PricingUsage struct {
+	PromptTokens     int
+	CompletionTokens int
+	CacheTokens      int // 缓存读取与写入 token 之和
+}
+
+// PricingCondition 请求字段取值命中 Values 之一时生效（不区分大小写）
+type PricingCondition struct {
+	Field  string   `json:"field"`
+	Values []string `json:"values"`
+	PricingRatioOverride
+}
+
+// PricingTimeWindow 时段倍率，End 小于 Start 时表示跨零点
+type PricingTimeWindow struct {
+	Start      string  `json:"start"`
+	End        string  `json:"end"`
+	Timezone   string  `json:"timezone,omitempty"`
+	Multiplier float64 `json:"multiplier"`
+}
+
+// PricingRule 单个模型的定价规则，按 输入分档 -> 输出分档 -> 缓存分档 -> 请求条件 -> 时段 的顺序应用，
+// 后应用的覆盖先应用的同名倍率
+type PricingRule struct {
+	Tiers           []PricingTier       `json:"tiers,omitempty"`
+	CompletionTiers []PricingTokenTier  `json:"completion_tiers,omitempty"`
+	CacheTiers      []PricingTokenTier  `json:"cache_tiers,omitempty"`
+	Conditions      []PricingCondition  `json:"conditions,omitempty"`
+	TimeWindows     []PricingTimeWindow `json:"time_windows,omitempty"`
+}
+
+// PricingRatios 规则计算的输入与输出
+type PricingRatios struct {
+	ModelRatio         float64 `json:"model_ratio"`
+	CompletionRatio    float64 `json:"completion_ratio"`
+	CacheRatio         float64 `json:"cache_ratio"`
+	CacheCreationRatio float64 `json:"cache_creation_ratio"`
+	ModelPrice         float64 `json:"model_price"`
+}
+
+func (o *PricingRatioOverride) apply(r *PricingRatios) float64 {
+	if o.ModelRatio != nil {
+		r.ModelRatio = *o.ModelRatio
+	}
+	if o.CompletionRatio != nil {
+		r.CompletionRatio = *o.CompletionRatio
+	}
+	if o.CacheRatio != nil {
+		r.CacheRatio = *o.CacheRatio
+	}
+	if o.CreateCacheRatio != nil {
+		r.CacheCreationRatio = *o.CreateCacheRatio
+	}
+	if o.ModelPrice != nil {
+		r.ModelPrice = *o.ModelPrice
+	}
+	if o.Multiplier > 0 {
+		return o.Multiplier
+	}
+	return 1
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (w *PricingTimeWindow) contains(at time.Time) bool {
+	start, err1 := parseClock(w.Start)
+	end, err2 := parseClock(w.End)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	if w.Timezone != "" {
+		if loc, err := time.LoadLocation(w.Timezone); err == nil {
+			at = at.In(loc)
+		}
+	}
+	minute := at.Hour()*60 + at.Minute()
+	if start <= end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+func (c *PricingCondition) matches(attrs map[string]string) bool {
+	value, ok := attrs[c.Field]
+	if !ok || value == "" {
+		return false
+	}
+	for _, v := range c.Values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate 校验规则配置
+func (r *PricingRule) Validate() error {
+	for _, tier := range r.Tiers {
+		if tier.AbovePromptTokens < 0 {
+			return fmt.Errorf("above_prompt_tokens must not be negative")
+		}
+	}
+	for _, tier := range append(slices.Clone(r.CompletionTiers), r.CacheTiers...) {
+		if tier.AboveTokens < 0 {
+			return fmt.Errorf("above_tokens must not be negative")
+		}
+	}
+	for _, cond := range r.Conditions {
+		switch cond.Field {
+		case PricingFieldServiceTier, PricingFieldReasoningEffort, PricingFieldImageSize, PricingFieldImageQuality:
+		default:
+			return fmt.Errorf("unsupported condition field %q", cond.Field)
+		}
+		if len(cond.Values) == 0 {
+			return fmt.Errorf("condition %q has no values", cond.Field)
+		}
+	}
+	for _, w := range r.TimeWindows {
+		if _, err := parseClock(w.Start); err != nil {
+			return err
+		}
+		if _, err := parseClock(w.End); err != nil {
+			return err
+		}
+		if w.Timezone != "" {
+			if _, err := time.LoadLocation(w.Timezone); err != nil {
+				return fmt.Errorf("invalid timezone %q", w.Timezone)
+			}
+		}
+		if w.Multiplier <= 0 {
+			return fmt.Errorf("time window multiplier must be positive")
+		}
+	}
+	return nil
+}
+
+// resolveTokenTiers 应用阈值最高的命中档位
+func resolveTokenTiers(tiers []PricingTokenTier, tokens int, label string, result *PricingRatios) (float64, string, bool) {
+	best := -1
+	for i := range tiers {
+		if tokens > tiers[i].AboveTokens && (best < 0 || tiers[i].AboveTokens > tiers[best].AboveTokens) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return 1, "", false
+	}
+	return tiers[best].apply(result), fmt.Sprintf("%s>%d", label, tiers[best].AboveTokens), true
+}
+
+// Resolve 计算规则命中后的倍率，返回命中项的描述用于日志
+func (r *PricingRule) Resolve(base PricingRatios, usage PricingUsage, attrs map[string]string, at time.Time) (PricingRatios, []string) {
+	result := base
+	applied := make([]string, 0)
+	multiplier := 1.0
+
+	promptTiers := make([]PricingTokenTier, len(r.Tiers))
+	for i, tier := range r.Tiers {
+		promptTiers[i] = PricingTokenTier{AboveTokens: tier.AbovePromptTokens, PricingRatioOverride: tier.PricingRatioOverride}
+	}
+	for _, group := range []struct {
+		tiers  []PricingTokenTier
+		tokens int
+		label  string
+	}{
+		{promptTiers, usage.PromptTokens, "prompt"},
+		{r.CompletionTiers, usage.CompletionTokens, "completion"},
+		{r.CacheTiers, usage.CacheTokens, "cache"},
+	} {
+		if m, desc, ok := resolveTokenTiers(group.tiers, group.tokens, group.label, &result); ok {
+			multiplier *= m
+			applied = append(applied, desc)
+		}
+	}
+
+	for i := range r.Conditions {
+		cond := &r.Conditions[i]
+		if cond.matches(attrs) {
+			multiplier *= cond.apply(&result)
+			applied = append(applied, fmt.Sprintf("%s=%s", cond.Field, attrs[cond.Field]))
+		}
+	}
+
+	for i := range r.TimeWindows {
+		w := &r.TimeWindows[i]
+		if w.contains(at) {
+			multiplier *= w.Multiplier
+			applied = append(applied, fmt.Sprintf("time %s-%s", w.Start, w.End))
+		}
+	}
+
+	if multiplier != 1 {
+		result.ModelRatio *= multiplier
+		result.ModelPrice *= multiplier
+	}
+	return result, applied
+}
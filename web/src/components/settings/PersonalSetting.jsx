@@ -86,6 +86,18 @@ const PersonalSetting = () => {
     gotifyUrl: '',
     gotifyToken: '',
     gotifyPriority: 5,
+    slackWebhookUrl: '',
+    discordWebhookUrl: '',
+    telegramBotToken: '',
+    telegramChatId: '',
+    feishuWebhookUrl: '',
+    feishuSecret: '',
+    dingtalkWebhookUrl: '',
+    dingtalkSecret: '',
+    wecomWebhookUrl: '',
+    ntfyUrl: '',
+    ntfyToken: '',
+    notifyEvents: {},
     upstreamModelUpdateNotifyEnabled: false,
     acceptUnsetModelRatioModel: false,
     recordIpLog: false,
@@ -159,6 +171,18 @@ const PersonalSetting = () => {
         gotifyToken: settings.gotify_token || '',
         gotifyPriority:
           settings.gotify_priority !== undefined ? settings.gotify_priority : 5,
+        slackWebhookUrl: settings.slack_webhook_url || '',
+        discordWebhookUrl: settings.discord_webhook_url || '',
+        telegramBotToken: settings.telegram_bot_token || '',
+        telegramChatId: settings.telegram_chat_id || '',
+        feishuWebhookUrl: settings.feishu_webhook_url || '',
+        feishuSecret: settings.feishu_secret || '',
+        dingtalkWebhookUrl: settings.dingtalk_webhook_url || '',
+        dingtalkSecret: settings.dingtalk_secret || '',
+        wecomWebhookUrl: settings.wecom_webhook_url || '',
+        ntfyUrl: settings.ntfy_url || '',
+        ntfyToken: settings.ntfy_token || '',
+        notifyEvents: settings.notify_events || {},
         upstreamModelUpdateNotifyEnabled:
           settings.upstream_model_update_notify_enabled === true,
         acceptUnsetModelRatioModel:
@@ -430,6 +454,18 @@ const PersonalSetting = () => {
           const parsed = parseInt(notificationSettings.gotifyPriority);
           return isNaN(parsed) ? 5 : parsed;
         })(),
+        slack_webhook_url: notificationSettings.slackWebhookUrl,
+        discord_webhook_url: notificationSettings.discordWebhookUrl,
+        telegram_bot_token: notificationSettings.telegramBotToken,
+        telegram_chat_id: notificationSettings.telegramChatId,
+        feishu_webhook_url: notificationSettings.feishuWebhookUrl,
+        feishu_secret: notificationSettings.feishuSecret,
+        dingtalk_webhook_url: notificationSettings.dingtalkWebhookUrl,
+        dingtalk_secret: notificationSettings.dingtalkSecret,
+        wecom_webhook_url: notificationSettings.wecomWebhookUrl,
+        ntfy_url: notificationSettings.ntfyUrl,
+        ntfy_token: notificationSettings.ntfyToken,
+        notify_events: notificationSettings.notifyEvents,
         upstream_model_update_notify_enabled:
           notificationSettings.upstreamModelUpdateNotifyEnabled === true,
         accept_unset_model_ratio_model:
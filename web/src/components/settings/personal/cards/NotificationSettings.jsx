@@ -31,6 +31,7 @@ import {
   Switch,
   Row,
   Col,
+  Checkbox,
 } from '@douyinfe/semi-ui';
 import { IconMail, IconKey, IconBell, IconLink } from '@douyinfe/semi-icons';
 import { ShieldCheck, Bell, DollarSign, Settings } from 'lucide-react';
@@ -229,6 +230,115 @@ const NotificationSettings = ({
     handleNotificationSettingChange(field, value);
   };
 
+  // 可订阅的通知事件
+  const [notifyEventCatalog, setNotifyEventCatalog] = useState([]);
+
+  useEffect(() => {
+    API.get('/api/user/notify_events')
+      .then((res) => {
+        if (res.data.success) {
+          setNotifyEventCatalog(res.data.data || []);
+        }
+      })
+      .catch(() => {});
+  }, []);
+
+  const isEventSubscribed = (item) => {
+    const events = notificationSettings.notifyEvents || {};
+    return events[item.event] !== undefined
+      ? events[item.event]
+      : item.subscribed;
+  };
+
+  const handleEventSubscriptionChange = (event, checked) => {
+    handleFormChange('notifyEvents', {
+      ...(notificationSettings.notifyEvents || {}),
+      [event]: checked,
+    });
+  };
+
+  // 机器人类通知渠道的配置项
+  const botNotifierFields = {
+    slack: [
+      {
+        field: 'slackWebhookUrl',
+        label: t('Slack Webhook 地址'),
+        placeholder: 'https://hooks.slack.com/services/...',
+        required: true,
+      },
+    ],
+    discord: [
+      {
+        field: 'discordWebhookUrl',
+        label: t('Discord Webhook 地址'),
+        placeholder: 'https://discord.com/api/webhooks/...',
+        required: true,
+      },
+    ],
+    telegram: [
+      {
+        field: 'telegramBotToken',
+        label: t('Telegram Bot Token'),
+        placeholder: '123456:ABC-DEF...',
+        required: true,
+        password: true,
+      },
+      {
+        field: 'telegramChatId',
+        label: t('Telegram Chat ID'),
+        placeholder: '123456789',
+        required: true,
+      },
+    ],
+    feishu: [
+      {
+        field: 'feishuWebhookUrl',
+        label: t('飞书机器人 Webhook 地址'),
+        placeholder: 'https://open.feishu.cn/open-apis/bot/v2/hook/...',
+        required: true,
+      },
+      {
+        field: 'feishuSecret',
+        label: t('签名密钥（可选）'),
+        password: true,
+      },
+    ],
+    dingtalk: [
+      {
+        field: 'dingtalkWebhookUrl',
+        label: t('钉钉机器人 Webhook 地址'),
+        placeholder: 'https://oapi.dingtalk.com/robot/send?access_token=...',
+        required: true,
+      },
+      {
+        field: 'dingtalkSecret',
+        label: t('加签密钥（可选）'),
+        password: true,
+      },
+    ],
+    wecom: [
+      {
+        field: 'wecomWebhookUrl',
+        label: t('企业微信机器人 Webhook 地址'),
+        placeholder: 'https://qyapi.weixin.qq.com/cgi-bin/webhook/send?key=...',
+        required: true,
+      },
+    ],
+    ntfy: [
+      {
+        field: 'ntfyUrl',
+        label: t('ntfy 主题地址'),
+        placeholder: 'https://ntfy.sh/my-topic',
+        required: true,
+      },
+      {
+        field: 'ntfyToken',
+        label: t('访问令牌（可选）'),
+        password: true,
+      },
+    ],
+  };
+
   // 检查功能是否被管理员允许
   const isAllowedByAdmin = (sectionKey, moduleKey = null) => {
     if (!adminConfig) return true;
@@ -432,6 +542,13 @@ const NotificationSettings = ({
                   <Radio value='webhook'>{t('Webhook通知')}</Radio>
                   <Radio value='bark'>{t('Bark通知')}</Radio>
                   <Radio value='gotify'>{t('Gotify通知')}</Radio>
+                  <Radio value='slack'>Slack</Radio>
+                  <Radio value='discord'>Discord</Radio>
+                  <Radio value='telegram'>Telegram</Radio>
+                  <Radio value='feishu'>{t('飞书')}</Radio>
+                  <Radio value='dingtalk'>{t('钉钉')}</Radio>
+                  <Radio value='wecom'>{t('企业微信')}</Radio>
+                  <Radio value='ntfy'>ntfy</Radio>
                 </Form.RadioGroup>
 
                 <Form.AutoComplete
@@ -744,6 +861,66 @@ const NotificationSettings = ({
                     </div>
                   </>
                 )}
+
+                {/* 机器人类通知渠道设置 */}
+                {(botNotifierFields[notificationSettings.warningType] || []).map(
+                  (item) =>
+                    item.password ? (
+                      <Form.Input
+                        key={item.field}
+                        field={item.field}
+                        label={item.label}
+                        placeholder={item.placeholder}
+                        mode='password'
+                        onChange={(val) => handleFormChange(item.field, val)}
+                        prefix={<IconKey />}
+                        rules={
+                          item.required
+                            ? [{ required: true, message: item.label }]
+                            : []
+                        }
+                      />
+                    ) : (
+                      <Form.Input
+                        key={item.field}
+                        field={item.field}
+                        label={item.label}
+                        placeholder={item.placeholder}
+                        onChange={(val) => handleFormChange(item.field, val)}
+                        prefix={<IconLink />}
+                        rules={
+                          item.required
+                            ? [{ required: true, message: item.label }]
+                            : []
+                        }
+                      />
+                    ),
+                )}
+
+                {/* 事件订阅 */}
+                {notifyEventCatalog.length > 0 && (
+                  <Form.Slot label={t('订阅的通知事件')}>
+                    <div className='flex flex-wrap gap-x-6 gap-y-2'>
+                      {notifyEventCatalog.map((item) => (
+                        <Checkbox
+                          key={item.event}
+                          checked={isEventSubscribed(item)}
+                          onChange={(e) =>
+                            handleEventSubscriptionChange(
+                              item.event,
+                              e.target.checked,
+                            )
+                          }
+                        >
+                          {t(item.name)}
+                        </Checkbox>
+                      ))}
+                    </div>
+                    <Typography.Text type='tertiary' size='small'>
+                      {t('所有通知共享同一发送频率限制')}
+                    </Typography.Text>
+                  </Form.Slot>
+                )}
               </div>
             </TabPane>
 
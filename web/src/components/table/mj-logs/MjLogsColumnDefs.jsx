@@ -268,6 +268,12 @@ function renderStatus(type, t) {
           {t('失败')}
         </Tag>
       );
+    case 'CANCELLED':
+      return (
+        <Tag color='grey' shape='circle' prefixIcon={<XCircle size={14} />}>
+          {t('已取消')}
+        </Tag>
+      );
     case 'MODAL':
       return (
         <Tag
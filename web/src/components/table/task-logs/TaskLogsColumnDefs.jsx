@@ -206,6 +206,12 @@ const renderStatus = (type, t) => {
           {t('失败')}
         </Tag>
       );
+    case 'CANCELLED':
+      return (
+        <Tag color='grey' shape='circle' prefixIcon={<XCircle size={14} />}>
+          {t('已取消')}
+        </Tag>
+      );
     case 'QUEUED':
       return (
         <Tag color='orange' shape='circle' prefixIcon={<List size={14} />}>